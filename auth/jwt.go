@@ -5,48 +5,71 @@ import (
 	"time"
 
 	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
 )
 
 var ErrInvalidToken = errors.New("invalid jwt token")
 
 const TokenDuration = time.Minute * 10
 
+// Claims are the claims of a zebra jwt. The token ID (jti) names the session
+// the token belongs to and is kept when the token is refreshed. If there is a
+// Scope, as for API tokens, it further limits what the Role allows.
 type Claims struct {
 	jwt.StandardClaims
 	Role  *Role  `json:"role"`
 	Email string `json:"email"`
+	Scope *Role  `json:"scope,omitempty"`
 }
 
 func NewClaims(issuer string, subject string, role *Role, email string) *Claims {
 	claims := new(Claims)
 
+	now := time.Now()
+
+	claims.Id = uuid.New().String()
 	claims.Issuer = issuer
 	claims.Subject = subject
-	claims.ExpiresAt = time.Now().Add(TokenDuration).Unix()
+	claims.IssuedAt = now.Unix()
+	claims.ExpiresAt = now.Add(TokenDuration).Unix()
 	claims.Role = role
 	claims.Email = email
 
 	return claims
 }
 
+// Renew returns new claims for the same session, valid for another
+// TokenDuration but not after the given time if it is not zero.
+func (claims *Claims) Renew(notAfter time.Time) *Claims {
+	renewed := NewClaims(claims.Issuer, claims.Subject, claims.Role, claims.Email)
+	renewed.Id = claims.Id
+	renewed.Scope = claims.Scope
+
+	if !notAfter.IsZero() && notAfter.Unix() < renewed.ExpiresAt {
+		renewed.ExpiresAt = notAfter.Unix()
+	}
+
+	return renewed
+}
+
 func (claims *Claims) Create(resource string) bool {
-	return claims.Role.Create(resource)
+	return claims.Role.Create(resource) && (claims.Scope == nil || claims.Scope.Create(resource))
 }
 
 func (claims *Claims) Read(resource string) bool {
-	return claims.Role.Read(resource)
+	return claims.Role.Read(resource) && (claims.Scope == nil || claims.Scope.Read(resource))
 }
 
 func (claims *Claims) Write(resource string) bool {
-	return claims.Role.Write(resource)
+	return claims.Role.Write(resource) && (claims.Scope == nil || claims.Scope.Write(resource))
 }
 
 func (claims *Claims) Delete(resource string) bool {
-	return claims.Role.Delete(resource)
+	return claims.Role.Delete(resource) && (claims.Scope == nil || claims.Scope.Delete(resource))
 }
 
 func (claims *Claims) Update(resource string) bool {
-	return claims.Role.Update(resource)
+	return claims.Role.Update(resource) && (claims.Scope == nil || claims.Scope.Update(resource))
 }
 
 func (claims *Claims) JWT(key string) string {
@@ -2,6 +2,7 @@ package auth_test
 
 import (
 	"testing"
+	"time"
 
 	"github.com/project-safari/zebra/auth"
 	"github.com/stretchr/testify/assert"
@@ -36,3 +37,25 @@ func TestClaims(t *testing.T) {
 	assert.Nil(jwtClaims)
 	assert.NotNil(err)
 }
+
+func TestRenew(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	claims := auth.NewClaims("zebra", "adam", nil, "email@domain")
+	assert.NotEmpty(claims.Id)
+	assert.NotEqual(claims.Id, auth.NewClaims("zebra", "adam", nil, "email@domain").Id)
+
+	renewed := claims.Renew(time.Time{})
+	assert.Equal(claims.Id, renewed.Id)
+	assert.Equal("adam", renewed.Subject)
+	assert.GreaterOrEqual(renewed.ExpiresAt, claims.ExpiresAt)
+
+	notAfter := time.Now().Add(time.Minute)
+	assert.Equal(notAfter.Unix(), claims.Renew(notAfter).ExpiresAt)
+
+	jwtClaims, err := auth.FromJWT(renewed.JWT("abracadabra"), "abracadabra")
+	assert.Nil(err)
+	assert.Equal(claims.Id, jwtClaims.Id)
+}
@@ -0,0 +1,222 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"sync"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/google/uuid"
+)
+
+// Signing algorithms of a KeyRing.
+const (
+	RS256 = "RS256"
+	EdDSA = "EdDSA"
+)
+
+var (
+	ErrAlgorithm  = errors.New("unsupported jwt signing algorithm")
+	ErrUnknownKey = errors.New("jwt signed with an unknown or expired key")
+)
+
+// SigningKey is a key that signs jwts, identified in them by its kid. Once a
+// newer key replaces it, a key is Retired: it signs no more tokens but still
+// verifies the ones it signed until they have all expired.
+type SigningKey struct {
+	ID        string
+	Algorithm string
+	Created   time.Time
+	Retired   time.Time
+	private   crypto.Signer
+}
+
+func generateKey(alg string, now time.Time) (*SigningKey, error) {
+	key := &SigningKey{ID: uuid.New().String(), Algorithm: alg, Created: now, Retired: time.Time{}, private: nil}
+
+	switch alg {
+	case RS256:
+		private, err := rsa.GenerateKey(rand.Reader, RSAKeySize)
+		if err != nil {
+			return nil, err
+		}
+
+		key.private = private
+	case EdDSA:
+		_, private, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+
+		key.private = private
+	default:
+		return nil, ErrAlgorithm
+	}
+
+	return key, nil
+}
+
+func (k *SigningKey) method() jwt.SigningMethod {
+	if k.Algorithm == EdDSA {
+		return jwt.SigningMethodEdDSA
+	}
+
+	return jwt.SigningMethodRS256
+}
+
+// JWK returns the public key in the JSON Web Key format.
+func (k *SigningKey) JWK() JWK {
+	jwk := JWK{Kty: "", Kid: k.ID, Use: "sig", Alg: k.Algorithm, N: "", E: "", Crv: "", X: ""}
+	encode := base64.RawURLEncoding.EncodeToString
+
+	switch public := k.private.Public().(type) {
+	case *rsa.PublicKey:
+		jwk.Kty = "RSA"
+		jwk.N = encode(public.N.Bytes())
+		jwk.E = encode(big.NewInt(int64(public.E)).Bytes())
+	case ed25519.PublicKey:
+		jwk.Kty = "OKP"
+		jwk.Crv = "Ed25519"
+		jwk.X = encode(public)
+	}
+
+	return jwk
+}
+
+// JWK is a public key as published in a JSON Web Key Set (RFC 7517).
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n,omitempty"`
+	E   string `json:"e,omitempty"`
+	Crv string `json:"crv,omitempty"`
+	X   string `json:"x,omitempty"`
+}
+
+// JWKS is a JSON Web Key Set.
+type JWKS struct {
+	Keys []JWK `json:"keys"`
+}
+
+// KeyRing signs jwts with its newest key and verifies them with any key that
+// still has unexpired tokens.
+type KeyRing struct {
+	lock      sync.RWMutex
+	algorithm string
+	keys      []*SigningKey
+}
+
+// NewKeyRing returns a key ring with a new key for the algorithm.
+func NewKeyRing(alg string) (*KeyRing, error) {
+	r := &KeyRing{lock: sync.RWMutex{}, algorithm: alg, keys: []*SigningKey{}}
+	if err := r.Rotate(time.Now()); err != nil {
+		return nil, err
+	}
+
+	return r, nil
+}
+
+// Rotate retires the signing key for a new one and drops the retired keys
+// whose tokens have all expired.
+func (r *KeyRing) Rotate(now time.Time) error {
+	key, err := generateKey(r.algorithm, now)
+	if err != nil {
+		return err
+	}
+
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	keys := []*SigningKey{key}
+
+	for _, old := range r.keys {
+		if old.Retired.IsZero() {
+			old.Retired = now
+		}
+
+		if now.Before(old.Retired.Add(TokenDuration)) {
+			keys = append(keys, old)
+		}
+	}
+
+	r.keys = keys
+
+	return nil
+}
+
+// Current returns the key that signs new tokens.
+func (r *KeyRing) Current() *SigningKey {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	return r.keys[0]
+}
+
+// Sign returns the claims as a jwt signed with the current key.
+func (r *KeyRing) Sign(claims *Claims) (string, error) {
+	key := r.Current()
+
+	tkn := jwt.NewWithClaims(key.method(), claims)
+	tkn.Header["kid"] = key.ID
+
+	return tkn.SignedString(key.private)
+}
+
+// Parse returns the claims of a jwt signed by a key of the ring.
+func (r *KeyRing) Parse(token string) (*Claims, error) {
+	claims := new(Claims)
+
+	tkn, err := jwt.ParseWithClaims(token, claims, func(tkn *jwt.Token) (interface{}, error) {
+		kid, _ := tkn.Header["kid"].(string)
+
+		key := r.find(kid)
+		if key == nil || tkn.Method != key.method() {
+			return nil, ErrUnknownKey
+		}
+
+		return key.private.Public(), nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	if !tkn.Valid {
+		return nil, ErrInvalidToken
+	}
+
+	return claims, nil
+}
+
+func (r *KeyRing) find(kid string) *SigningKey {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	for _, key := range r.keys {
+		if key.ID == kid {
+			return key
+		}
+	}
+
+	return nil
+}
+
+// JWKS returns the public keys of the ring, the current one first.
+func (r *KeyRing) JWKS() JWKS {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	set := JWKS{Keys: make([]JWK, 0, len(r.keys))}
+	for _, key := range r.keys {
+		set.Keys = append(set.Keys, key.JWK())
+	}
+
+	return set
+}
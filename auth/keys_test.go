@@ -0,0 +1,82 @@
+package auth_test
+
+import (
+	"crypto/ed25519"
+	"crypto/rsa"
+	"encoding/base64"
+	"math/big"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v4"
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+// publicKey returns the public key of a jwk, as another service would.
+func publicKey(assert *assert.Assertions, jwk auth.JWK) interface{} {
+	decode := func(s string) []byte {
+		b, err := base64.RawURLEncoding.DecodeString(s)
+		assert.Nil(err)
+
+		return b
+	}
+
+	if jwk.Kty == "OKP" {
+		return ed25519.PublicKey(decode(jwk.X))
+	}
+
+	return &rsa.PublicKey{N: new(big.Int).SetBytes(decode(jwk.N)), E: int(new(big.Int).SetBytes(decode(jwk.E)).Int64())}
+}
+
+func TestKeyRing(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	for _, alg := range []string{auth.RS256, auth.EdDSA} {
+		ring, err := auth.NewKeyRing(alg)
+		assert.Nil(err)
+
+		claims := auth.NewClaims("zebra", "adam", nil, "email@domain")
+		token, err := ring.Sign(claims)
+		assert.Nil(err)
+
+		parsed, err := ring.Parse(token)
+		assert.Nil(err)
+		assert.Equal(claims.Id, parsed.Id)
+
+		// Other services verify tokens with the published keys
+		jwks := ring.JWKS()
+		assert.Len(jwks.Keys, 1)
+		assert.Equal(alg, jwks.Keys[0].Alg)
+
+		_, err = jwt.Parse(token, func(tkn *jwt.Token) (interface{}, error) {
+			assert.Equal(jwks.Keys[0].Kid, tkn.Header["kid"])
+
+			return publicKey(assert, jwks.Keys[0]), nil
+		})
+		assert.Nil(err)
+
+		// Tokens of retired keys are good until they expire
+		now := time.Now()
+		assert.Nil(ring.Rotate(now))
+		assert.Len(ring.JWKS().Keys, 2)
+
+		_, err = ring.Parse(token)
+		assert.Nil(err)
+
+		assert.Nil(ring.Rotate(now.Add(auth.TokenDuration)))
+		assert.Len(ring.JWKS().Keys, 2)
+
+		_, err = ring.Parse(token)
+		assert.NotNil(err)
+
+		// Shared secret tokens are refused
+		_, err = ring.Parse(claims.JWT("abracadabra"))
+		assert.NotNil(err)
+	}
+
+	_, err := auth.NewKeyRing("HS256")
+	assert.ErrorIs(err, auth.ErrAlgorithm)
+}
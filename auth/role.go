@@ -203,3 +203,22 @@ func (r *Role) Delete(key string) bool {
 
 	return false
 }
+
+// Covers returns true if the role grants every operation of the privilege
+// with a privilege on the same key. Keys are compared as written, since
+// whether one regular expression matches only what another matches can not be
+// told by matching them, except that the empty key matches every resource and
+// so covers any key.
+func (r *Role) Covers(p *Priv) bool {
+	c, rd, u, d := false, false, false, false
+
+	for _, priv := range r.Privileges {
+		if priv.k.key != p.k.key && priv.k.key != "" {
+			continue
+		}
+
+		c, rd, u, d = c || priv.c, rd || priv.r, u || priv.u, d || priv.d
+	}
+
+	return (!p.c || c) && (!p.r || rd) && (!p.u || u) && (!p.d || d)
+}
@@ -98,3 +98,33 @@ func TestPriv(t *testing.T) {
 	assert.False(p.Delete("e/f/g"))
 	assert.False(p.Write("e/f/g"))
 }
+
+func TestCovers(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	read, err := auth.NewPriv("", false, true, false, false)
+	assert.Nil(err)
+
+	compute, err := auth.NewPriv(`compute\..*`, true, true, true, false)
+	assert.Nil(err)
+
+	role := &auth.Role{Name: "user", Privileges: []*auth.Priv{read, compute}}
+
+	for priv, covered := range map[string]bool{
+		"compute.*:r":         true,
+		"network.*:r":         true,
+		`compute\..*:c,r,u`:   true,
+		`compute\..*:c,r,u,d`: false,
+		"network.*:c":         false,
+		// Keys are compared as written, not by what they match
+		"compute.*:c,r,u":   false,
+		`compute\.server:c`: false,
+		`compute\..*|.*:c`:  false,
+	} {
+		p := new(auth.Priv)
+		assert.Nil(p.UnmarshalText([]byte(priv)))
+		assert.Equal(covered, role.Covers(p), priv)
+	}
+}
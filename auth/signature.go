@@ -0,0 +1,136 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers of a signed request.
+const (
+	SignatureHeader = "Signature"
+	DigestHeader    = "Digest"
+
+	SignatureAlgorithm = "rsa-sha256"
+	nonceSize          = 16
+)
+
+var (
+	ErrNoSignature  = errors.New("request is not signed")
+	ErrBadSignature = errors.New("malformed request signature")
+	ErrBadDigest    = errors.New("request body does not match its digest")
+)
+
+// RequestSignature is the Signature header of a request, in the style of the
+// HTTP Signatures draft. The signature covers the method and path of the
+// request, the digest of its body, the time it was made and a random nonce, so
+// it cannot be reused for another request nor replayed later.
+type RequestSignature struct {
+	KeyID     string
+	Created   int64
+	Nonce     string
+	Signature []byte
+}
+
+// Digest returns the value of the Digest header for a request body.
+func Digest(body []byte) string {
+	sum := sha256.Sum256(body)
+
+	return "SHA-256=" + base64.StdEncoding.EncodeToString(sum[:])
+}
+
+// SigningString returns the message that is signed for a request.
+func SigningString(method, target, digest string, created int64, nonce string) []byte {
+	return []byte(fmt.Sprintf("(request-target): %s %s\n(created): %d\nnonce: %s\ndigest: %s",
+		strings.ToLower(method), target, created, nonce, digest))
+}
+
+// SignRequest signs the request with its body as keyID, setting the Digest and
+// Signature headers.
+func SignRequest(req *http.Request, body []byte, keyID string, key *RsaIdentity, now time.Time) error {
+	b := make([]byte, nonceSize)
+	if _, err := rand.Read(b); err != nil {
+		return err
+	}
+
+	sig := &RequestSignature{KeyID: keyID, Created: now.Unix(), Nonce: hex.EncodeToString(b), Signature: nil}
+	digest := Digest(body)
+
+	signature, err := key.Sign(SigningString(req.Method, req.URL.RequestURI(), digest, sig.Created, sig.Nonce))
+	if err != nil {
+		return err
+	}
+
+	sig.Signature = signature
+
+	req.Header.Set(DigestHeader, digest)
+	req.Header.Set(SignatureHeader, sig.String())
+
+	return nil
+}
+
+// ParseSignature returns the signature of a request, ErrNoSignature if it is
+// not signed.
+func ParseSignature(req *http.Request) (*RequestSignature, error) {
+	header := req.Header.Get(SignatureHeader)
+	if header == "" {
+		return nil, ErrNoSignature
+	}
+
+	params := map[string]string{}
+
+	for _, param := range strings.Split(header, ",") {
+		kv := strings.SplitN(strings.TrimSpace(param), "=", 2) //nolint:gomnd
+		if len(kv) != 2 {                                      //nolint:gomnd
+			return nil, ErrBadSignature
+		}
+
+		params[kv[0]] = strings.Trim(kv[1], `"`)
+	}
+
+	if params["algorithm"] != SignatureAlgorithm || params["keyId"] == "" || params["nonce"] == "" {
+		return nil, ErrBadSignature
+	}
+
+	created, err := strconv.ParseInt(params["created"], 10, 64)
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+
+	signature, err := base64.StdEncoding.DecodeString(params["signature"])
+	if err != nil {
+		return nil, ErrBadSignature
+	}
+
+	return &RequestSignature{KeyID: params["keyId"], Created: created, Nonce: params["nonce"], Signature: signature}, nil
+}
+
+// Verify checks that the signature was made with key for the request and its
+// body.
+func (s *RequestSignature) Verify(req *http.Request, body []byte, key *RsaIdentity) error {
+	digest := Digest(body)
+	if subtle.ConstantTimeCompare([]byte(digest), []byte(req.Header.Get(DigestHeader))) != 1 {
+		return ErrBadDigest
+	}
+
+	return key.Verify(SigningString(req.Method, req.URL.RequestURI(), digest, s.Created, s.Nonce), s.Signature, nil)
+}
+
+// Time returns the time the request was signed.
+func (s *RequestSignature) Time() time.Time {
+	return time.Unix(s.Created, 0)
+}
+
+func (s *RequestSignature) String() string {
+	return fmt.Sprintf(`keyId="%s",algorithm="%s",headers="(request-target) (created) nonce digest",`+
+		`created=%d,nonce="%s",signature="%s"`,
+		s.KeyID, SignatureAlgorithm, s.Created, s.Nonce, base64.StdEncoding.EncodeToString(s.Signature))
+}
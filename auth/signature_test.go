@@ -0,0 +1,77 @@
+package auth_test
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRequestSignature(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	key, err := auth.Generate()
+	assert.Nil(err)
+
+	body := []byte(`{"name":"test"}`)
+	now := time.Now()
+
+	req := httptest.NewRequest("POST", "/api/v1/resources?type=compute.server", nil)
+	_, err = auth.ParseSignature(req)
+	assert.ErrorIs(err, auth.ErrNoSignature)
+
+	assert.Nil(auth.SignRequest(req, body, "email@domain", key, now))
+
+	sig, err := auth.ParseSignature(req)
+	assert.Nil(err)
+	assert.Equal("email@domain", sig.KeyID)
+	assert.Equal(now.Unix(), sig.Time().Unix())
+	assert.NotEmpty(sig.Nonce)
+	assert.Nil(sig.Verify(req, body, key.Public()))
+
+	// Each signature has its own nonce
+	other := req.Clone(req.Context())
+	assert.Nil(auth.SignRequest(other, body, "email@domain", key, now))
+
+	otherSig, err := auth.ParseSignature(other)
+	assert.Nil(err)
+	assert.NotEqual(sig.Nonce, otherSig.Nonce)
+
+	// The signature covers the body, the method and the path
+	assert.ErrorIs(sig.Verify(req, []byte(`{"name":"evil"}`), key.Public()), auth.ErrBadDigest)
+
+	req.Method = "DELETE"
+	assert.NotNil(sig.Verify(req, body, key.Public()))
+
+	req.Method = "POST"
+	req.URL.RawQuery = "type=compute.esx"
+	assert.NotNil(sig.Verify(req, body, key.Public()))
+
+	// And is only good for the key that made it
+	wrong, err := auth.Generate()
+	assert.Nil(err)
+
+	req.URL.RawQuery = "type=compute.server"
+	assert.Nil(sig.Verify(req, body, key.Public()))
+	assert.NotNil(sig.Verify(req, body, wrong.Public()))
+
+	// Signing needs a private key
+	assert.ErrorIs(auth.SignRequest(req, body, "email@domain", key.Public(), now), auth.ErrNoPrivateKey)
+
+	for _, bad := range []string{
+		"garbage",
+		strings.Replace(sig.String(), "rsa-sha256", "hmac-sha256", 1),
+		strings.Replace(sig.String(), `keyId="email@domain"`, `keyId=""`, 1),
+		strings.Replace(sig.String(), "created=", "created=x", 1),
+		strings.Replace(sig.String(), `signature="`, `signature="!`, 1),
+	} {
+		req.Header.Set(auth.SignatureHeader, bad)
+		_, err = auth.ParseSignature(req)
+		assert.ErrorIs(err, auth.ErrBadSignature, bad)
+	}
+}
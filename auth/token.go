@@ -0,0 +1,71 @@
+package auth
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+const (
+	// TokenPrefix starts every API token, so that tokens are easy to tell
+	// apart from jwts and to find when they leak.
+	TokenPrefix = "zebra_"
+
+	tokenSize = 32
+)
+
+// APIToken is a named token a user makes for scripts and automation. It
+// grants its Privileges, but never more than the role of the user, until it
+// Expires. Only the Hash of the token is kept, the token itself is shown
+// once when it is made.
+type APIToken struct {
+	ID         string    `json:"id"`
+	Name       string    `json:"name"`
+	Email      string    `json:"email"`
+	Privileges []*Priv   `json:"privileges"`
+	Created    time.Time `json:"created"`
+	Expires    time.Time `json:"expires"`
+	Hash       string    `json:"hash,omitempty"`
+}
+
+// NewAPIToken returns a new API token of the user and the secret token.
+func NewAPIToken(name, email string, privileges []*Priv, created, expires time.Time) (*APIToken, string, error) {
+	b := make([]byte, tokenSize)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+
+	secret := TokenPrefix + base64.RawURLEncoding.EncodeToString(b)
+
+	return &APIToken{
+		ID:         uuid.New().String(),
+		Name:       name,
+		Email:      email,
+		Privileges: privileges,
+		Created:    created,
+		Expires:    expires,
+		Hash:       HashToken(secret),
+	}, secret, nil
+}
+
+// HashToken returns the hash a token is kept as. Tokens are long and random,
+// so a plain SHA-256 is enough and cheap to check on every request.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+
+	return hex.EncodeToString(sum[:])
+}
+
+// Expired returns true if the token is no longer good at the given time.
+func (t *APIToken) Expired(now time.Time) bool {
+	return !now.Before(t.Expires)
+}
+
+// Scope returns the privileges of the token as a role.
+func (t *APIToken) Scope() *Role {
+	return &Role{Name: "token:" + t.Name, Privileges: t.Privileges}
+}
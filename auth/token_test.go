@@ -0,0 +1,57 @@
+package auth_test
+
+import (
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAPIToken(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	read, err := auth.NewPriv(`compute\..*`, false, true, false, false)
+	assert.Nil(err)
+
+	now := time.Now()
+
+	token, secret, err := auth.NewAPIToken("ci", "email@domain", []*auth.Priv{read}, now, now.Add(time.Hour))
+	assert.Nil(err)
+	assert.True(strings.HasPrefix(secret, auth.TokenPrefix))
+	assert.Equal(auth.HashToken(secret), token.Hash)
+	assert.NotContains(token.Hash, secret)
+
+	_, other, err := auth.NewAPIToken("ci", "email@domain", []*auth.Priv{read}, now, now.Add(time.Hour))
+	assert.Nil(err)
+	assert.NotEqual(secret, other)
+
+	assert.False(token.Expired(now))
+	assert.True(token.Expired(now.Add(time.Hour)))
+
+	// The token limits the claims of its user to its privileges
+	crud, err := auth.NewPriv("", true, true, true, true)
+	assert.Nil(err)
+
+	claims := auth.NewClaims("zebra", "adam", &auth.Role{Name: "admin", Privileges: []*auth.Priv{crud}}, "email@domain")
+	claims.Scope = token.Scope()
+
+	assert.True(claims.Read("compute.server"))
+	assert.False(claims.Create("compute.server"))
+	assert.False(claims.Update("compute.server"))
+	assert.False(claims.Delete("compute.server"))
+	assert.False(claims.Write("compute.server"))
+	assert.False(claims.Read("network.vlanPool"))
+
+	// And never grants more than the role of the user
+	none, err := auth.NewPriv(`dc\..*`, false, true, false, false)
+	assert.Nil(err)
+
+	claims.Role = &auth.Role{Name: "user", Privileges: []*auth.Priv{none}}
+	assert.False(claims.Read("compute.server"))
+
+	assert.Equal(claims.Scope, claims.Renew(time.Time{}).Scope)
+}
@@ -0,0 +1,171 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/inventory"
+	"github.com/project-safari/zebra/model"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrApplyFile = errors.New("inventory file has errors")
+	ErrApply     = errors.New("error applying change")
+	ErrAborted   = errors.New("apply aborted")
+)
+
+func NewApply() *cobra.Command {
+	applyCmd := &cobra.Command{
+		Use:          "apply",
+		Short:        "make the server inventory match an inventory file",
+		RunE:         applyInventory,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(0),
+	}
+
+	applyCmd.Flags().StringP("file", "f", "", "inventory file, csv or yaml")
+	applyCmd.Flags().String("manager", "", "value of the managed-by label, the file name if empty")
+	applyCmd.Flags().Bool("prune", false, "delete managed resources that are not in the file")
+	applyCmd.Flags().Bool("plan", false, "only print the plan")
+	applyCmd.Flags().BoolP("yes", "y", false, "apply without asking for confirmation")
+	_ = applyCmd.MarkFlagRequired("file")
+
+	return applyCmd
+}
+
+func applyInventory(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	file := cmd.Flag("file").Value.String()
+
+	desired, err := readInventory(cmd.Context(), file)
+	if err != nil {
+		return err
+	}
+
+	current := zebra.NewResourceMap(model.Factory())
+	if code, err := client.Get("api/v1/resources", nil, current); code != http.StatusOK || err != nil {
+		return ErrQuery
+	}
+
+	manager := cmd.Flag("manager").Value.String()
+	if manager == "" {
+		manager = strings.TrimSuffix(filepath.Base(file), filepath.Ext(file))
+	}
+
+	prune, _ := cmd.Flags().GetBool("prune")
+
+	plan, err := inventory.NewPlan(desired, resourceList(current), manager, prune)
+	if err != nil {
+		return err
+	}
+
+	out := cmd.OutOrStdout()
+	plan.Print(out)
+
+	if planOnly, _ := cmd.Flags().GetBool("plan"); planOnly || len(plan.Changes) == 0 {
+		return nil
+	}
+
+	if yes, _ := cmd.Flags().GetBool("yes"); !yes && !confirm(cmd.InOrStdin(), out) {
+		return ErrAborted
+	}
+
+	return applyPlan(client, plan, out)
+}
+
+// readInventory reads the resources of an inventory file, the format is taken
+// from the file extension.
+func readInventory(ctx context.Context, file string) ([]zebra.Resource, error) {
+	if ctx == nil {
+		ctx = context.Background()
+	}
+
+	f, err := os.Open(file)
+	if err != nil {
+		return nil, err
+	}
+
+	defer f.Close()
+
+	format := strings.ToLower(strings.TrimPrefix(filepath.Ext(file), "."))
+	entries, errs := inventory.Read(ctx, format, f, model.Factory(), "", nil)
+
+	if len(errs) > 0 {
+		for _, e := range errs {
+			fmt.Println(e.Error())
+		}
+
+		return nil, ErrApplyFile
+	}
+
+	resources := make([]zebra.Resource, 0, len(entries))
+	for _, e := range entries {
+		resources = append(resources, e.Resource)
+	}
+
+	return resources, nil
+}
+
+func resourceList(resMap *zebra.ResourceMap) []zebra.Resource {
+	resources := []zebra.Resource{}
+
+	for _, l := range resMap.Resources {
+		resources = append(resources, l.Resources...)
+	}
+
+	return resources
+}
+
+func confirm(in io.Reader, out io.Writer) bool {
+	fmt.Fprint(out, "Apply these changes? [y/N] ")
+
+	answer, _ := bufio.NewReader(in).ReadString('\n')
+	answer = strings.ToLower(strings.TrimSpace(answer))
+
+	return answer == "y" || answer == "yes"
+}
+
+// applyPlan applies the changes in order and stops at the first failure.
+func applyPlan(client *Client, plan *inventory.Plan, out io.Writer) error {
+	for _, c := range plan.Changes {
+		var err error
+
+		if c.Action == inventory.Delete {
+			_, err = client.Delete(path.Join("api", "v1", "resources", c.Resource.GetMeta().ID), nil, nil)
+		} else {
+			resMap := zebra.NewResourceMap(model.Factory())
+			if e := resMap.Add(c.Resource); e != nil {
+				return e
+			}
+
+			_, err = client.Post("api/v1/resources", resMap, nil)
+		}
+
+		if err != nil {
+			return fmt.Errorf("%w: %s %s: %s", ErrApply, c.Action, c.Key, err.Error())
+		}
+
+		fmt.Fprintf(out, "%s %s done\n", c.Action, c.Key)
+	}
+
+	return nil
+}
@@ -0,0 +1,70 @@
+package main //nolint:testpackage
+
+import (
+	"bytes"
+	"context"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApply(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = append([]string{"zebra"}, "apply")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "../../simulator/admin.yaml",
+		"apply", "-f", "missing.yaml")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml",
+		"apply", "-f", "lab.yaml")
+
+	assert.NotNil(execRootCmd())
+}
+
+func TestReadInventory(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	file := "test_read_inventory.yaml"
+
+	defer func() { os.Remove(file) }()
+
+	assert.Nil(os.WriteFile(file, []byte("type: dc.lab\nname: lab-1\n---\ntype: dc.lab\n"), 0o600))
+
+	_, err := readInventory(context.Background(), file)
+	assert.Equal(ErrApplyFile, err)
+
+	assert.Nil(os.WriteFile(file, []byte("type: dc.lab\nname: lab-1\n"), 0o600))
+
+	resources, err := readInventory(context.Background(), file)
+	assert.Nil(err)
+	assert.Len(resources, 1)
+}
+
+func TestConfirm(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	out := new(bytes.Buffer)
+	assert.True(confirm(strings.NewReader("y\n"), out))
+	assert.True(confirm(strings.NewReader("Yes\n"), out))
+	assert.False(confirm(strings.NewReader("\n"), out))
+	assert.False(confirm(strings.NewReader(""), out))
+}
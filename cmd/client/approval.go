@@ -0,0 +1,107 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/spf13/cobra"
+)
+
+// addApprovalCommands adds the commands approvers use to decide on leases that
+// need approval.
+func addApprovalCommands(leaseCmd *cobra.Command) {
+	approveCmd := &cobra.Command{
+		Use:          "approve <id>",
+		Short:        "approve a lease pending approval",
+		RunE:         func(cmd *cobra.Command, args []string) error { return leaseDecision(cmd, args, true) },
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	}
+	approveCmd.Flags().StringP("reason", "r", "", "reason for the approval")
+
+	denyCmd := &cobra.Command{
+		Use:          "deny <id>",
+		Short:        "deny a lease pending approval",
+		RunE:         func(cmd *cobra.Command, args []string) error { return leaseDecision(cmd, args, false) },
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	}
+	denyCmd.Flags().StringP("reason", "r", "", "reason for the denial")
+
+	leaseCmd.AddCommand(approveCmd, denyCmd, &cobra.Command{
+		Use:          "pending",
+		Short:        "show the leases you may approve",
+		RunE:         showPending,
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+	})
+}
+
+func leaseDecision(cmd *cobra.Command, args []string, approve bool) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	decision := struct {
+		Reason string `json:"reason"`
+	}{Reason: cmd.Flag("reason").Value.String()}
+
+	path := "api/v1/leases/" + args[0] + "/deny"
+	if approve {
+		path = "api/v1/leases/" + args[0] + "/approve"
+	}
+
+	l := new(lease.Lease)
+	if _, err := client.Post(path, decision, l); err != nil {
+		return err
+	}
+
+	fmt.Println("Lease", l.Meta.ID, "of", l.Owner(), "is", l.Phase.String())
+
+	return nil
+}
+
+func showPending(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	pending := []*lease.Lease{}
+	if _, err := client.Get("api/v1/approvals", nil, &pending); err != nil {
+		return err
+	}
+
+	printPending(pending)
+
+	return nil
+}
+
+func printPending(pending []*lease.Lease) {
+	tw := table.NewWriter()
+	tw.AppendHeader(table.Row{"ID", "Owner", "Duration", "Request"})
+
+	for _, l := range pending {
+		reqs := make([]string, 0, len(l.Request))
+		for _, req := range l.Request {
+			reqs = append(reqs, fmt.Sprintf("%d %s", req.Count, req.Type))
+		}
+
+		tw.AppendRow(table.Row{l.Meta.ID, l.Owner(), l.Duration, strings.Join(reqs, "\n")})
+	}
+
+	fmt.Println(tw.Render())
+}
@@ -0,0 +1,51 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApproval(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = append([]string{"zebra"}, "lease", "approve")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "lease", "approve", "0100000001", "-r", "ok")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "lease", "deny", "0100000001")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "lease", "pending")
+
+	assert.NotNil(execRootCmd())
+}
+
+func TestPrintPending(t *testing.T) {
+	t.Parallel()
+
+	l := lease.NewLease("user@zebra", time.Hour, []*lease.ResourceReq{{Type: "compute.vcenter", Count: 1}})
+	l.AwaitApproval([]string{"admin"})
+
+	printPending([]*lease.Lease{l})
+	printLeaseStatus(&LeaseStatus{Lease: l, Position: 0, ETA: time.Time{}})
+
+	assert.Nil(t, l.Decide("admin@zebra", "admin", false, "not now"))
+	printLeaseStatus(&LeaseStatus{Lease: l, Position: 0, ETA: time.Time{}})
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/project-safari/zebra"
+	"github.com/spf13/cobra"
+)
+
+type CalendarRequest struct {
+	Type    string        `json:"type"`
+	Group   string        `json:"group,omitempty"`
+	Filters []zebra.Query `json:"filters,omitempty"`
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+}
+
+type Booking struct {
+	Lease string    `json:"lease"`
+	Owner string    `json:"owner"`
+	Phase string    `json:"phase"`
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+type ResourceCalendar struct {
+	ID        string    `json:"id"`
+	Name      string    `json:"name"`
+	Lifecycle string    `json:"lifecycle"`
+	Bookings  []Booking `json:"bookings"`
+	Free      []Window  `json:"free"`
+}
+
+func NewCalendar() *cobra.Command {
+	calCmd := &cobra.Command{
+		Use:          "calendar <type>",
+		Short:        "show bookings and free time of resources",
+		RunE:         showCalendar,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	}
+
+	calCmd.Flags().StringP("group", "g", "", "resource group, any group if empty")
+	calCmd.Flags().StringSliceP("label", "l", []string{}, "only show resources with the label key=value")
+	calCmd.Flags().String("from", "", "start of the period, now if empty")
+	calCmd.Flags().String("to", "", "end of the period, a week after the start if empty")
+
+	return calCmd
+}
+
+func showCalendar(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	req, err := makeCalendarReq(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	calendars := []ResourceCalendar{}
+
+	resCode, err := client.Get("api/v1/calendar", req, &calendars)
+	if resCode != http.StatusOK {
+		return ErrQuery
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printCalendars(calendars)
+
+	return nil
+}
+
+func makeCalendarReq(cmd *cobra.Command, resType string) (*CalendarRequest, error) {
+	labels, err := cmd.Flags().GetStringSlice("label")
+	if err != nil {
+		return nil, err
+	}
+
+	filters, err := labelQueries(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	req := &CalendarRequest{
+		Type:    resType,
+		Group:   cmd.Flag("group").Value.String(),
+		Filters: filters,
+		From:    time.Time{},
+		To:      time.Time{},
+	}
+
+	if from := cmd.Flag("from").Value.String(); from != "" {
+		if req.From, err = parseTime(from); err != nil {
+			return nil, err
+		}
+	}
+
+	if to := cmd.Flag("to").Value.String(); to != "" {
+		if req.To, err = parseTime(to); err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+func printCalendars(calendars []ResourceCalendar) {
+	tw := table.NewWriter()
+	tw.AppendHeader(table.Row{"Name", "Lifecycle", "Booked", "Free"})
+
+	for _, c := range calendars {
+		booked := make([]string, 0, len(c.Bookings))
+		for _, b := range c.Bookings {
+			booked = append(booked, fmt.Sprintf("%s %s (%s)", period(b.Start, b.End), b.Owner, b.Phase))
+		}
+
+		free := make([]string, 0, len(c.Free))
+		for _, w := range c.Free {
+			free = append(free, period(w.Start, w.End))
+		}
+
+		tw.AppendRow(table.Row{c.Name, c.Lifecycle, strings.Join(booked, "\n"), strings.Join(free, "\n")})
+	}
+
+	fmt.Println(tw.Render())
+}
+
+func period(start, end time.Time) string {
+	return start.Local().Format(TimeFormat) + " - " + end.Local().Format(TimeFormat)
+}
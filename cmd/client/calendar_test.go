@@ -0,0 +1,74 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendar(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = append([]string{"zebra"}, "calendar")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "../../simulator/admin.yaml",
+		"calendar", "compute.server", "--from", "tomorrow")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "calendar", "compute.server")
+
+	assert.NotNil(execRootCmd())
+}
+
+func TestMakeCalendarReq(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	cmd := NewCalendar()
+	assert.Nil(cmd.ParseFlags([]string{"-g", "lab-1", "-l", "rack=r1", "--from", "2030-01-02 09:00"}))
+
+	req, err := makeCalendarReq(cmd, "compute.server")
+	assert.Nil(err)
+	assert.Equal("compute.server", req.Type)
+	assert.Equal("lab-1", req.Group)
+	assert.Len(req.Filters, 1)
+	assert.Equal(time.Date(2030, 1, 2, 9, 0, 0, 0, time.Local), req.From)
+	assert.True(req.To.IsZero())
+
+	cmd = NewCalendar()
+	assert.Nil(cmd.ParseFlags([]string{"--to", "soon"}))
+
+	_, err = makeCalendarReq(cmd, "compute.server")
+	assert.ErrorIs(err, ErrTimeFormat)
+}
+
+func TestParseTime(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	tm, err := parseTime("2030-01-02T09:00:00Z")
+	assert.Nil(err)
+	assert.Equal(time.Date(2030, 1, 2, 9, 0, 0, 0, time.UTC), tm.UTC())
+
+	tm, err = parseTime("2030-01-02")
+	assert.Nil(err)
+	assert.Equal(time.Date(2030, 1, 2, 0, 0, 0, 0, time.Local), tm)
+
+	_, err = parseTime("02/01/2030")
+	assert.ErrorIs(err, ErrTimeFormat)
+}
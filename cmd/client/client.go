@@ -5,13 +5,15 @@ import (
 	"context"
 	"crypto/tls"
 	"crypto/x509"
-	"encoding/base64"
 	"encoding/json"
 	"errors"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"net/http"
 	"time"
+
+	"github.com/project-safari/zebra/auth"
 )
 
 var (
@@ -40,16 +42,12 @@ func NewClient(cfg *Config) (*Client, error) {
 		return nil, ErrNoPrivateKey
 	}
 
-	t, err := cfg.Key.Sign([]byte(cfg.Email))
-	token := base64.StdEncoding.EncodeToString(t)
-
-	if err != nil {
+	// Make sure the key can sign requests
+	if _, err := cfg.Key.Sign([]byte(cfg.Email)); err != nil {
 		return nil, err
 	}
 
 	h := http.Header{}
-	h.Add("Zebra-Auth-User", cfg.Email)
-	h.Add("Zebra-Auth-Token", token)
 	h.Add("User-Agent", "zebra-client")
 	h.Add("Accept-Encoding", "application/json")
 	h.Add("Content-Type", "application/json")
@@ -80,7 +78,7 @@ func (c *Client) Post(path string, in, out interface{}) (int, error) {
 
 func (c *Client) do(ctx context.Context, method, path string, in, out interface{}) (int, error) {
 	url := fmt.Sprintf("%s/%s", c.cfg.ServerAddress, path)
-	buf := bytes.NewBuffer([]byte{})
+	body := []byte{}
 
 	if in != nil {
 		b, e := json.Marshal(in)
@@ -88,15 +86,19 @@ func (c *Client) do(ctx context.Context, method, path string, in, out interface{
 			return 0, e
 		}
 
-		buf = bytes.NewBuffer(b)
+		body = b
 	}
 
-	r, err := http.NewRequestWithContext(ctx, method, url, buf)
+	r, err := http.NewRequestWithContext(ctx, method, url, bytes.NewBuffer(body))
 	if err != nil {
 		return 0, err
 	}
 
-	r.Header = c.h
+	// Every request is signed on its own so that it cannot be replayed
+	r.Header = c.h.Clone()
+	if err := auth.SignRequest(r, body, c.cfg.Email, c.cfg.Key, time.Now()); err != nil {
+		return 0, err
+	}
 
 	resp, err := c.c.Do(r)
 	if err != nil {
@@ -112,6 +114,13 @@ func (c *Client) do(ctx context.Context, method, path string, in, out interface{
 		return resp.StatusCode, e
 	}
 
+	// Responses that are not JSON are copied to a writer as they are
+	if w, ok := out.(io.Writer); ok {
+		_, e := w.Write(b)
+
+		return resp.StatusCode, e
+	}
+
 	if out != nil {
 		if e := json.Unmarshal(b, out); e != nil {
 			return resp.StatusCode, e
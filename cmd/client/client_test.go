@@ -3,6 +3,7 @@ package main //nolint:testpackage
 import (
 	"context"
 	"fmt"
+	"io/ioutil"
 	"net/http"
 	"net/http/httptest"
 	"testing"
@@ -156,3 +157,47 @@ func makeServer(assert *assert.Assertions) *httptest.Server {
 		assert.Nil(e)
 	}))
 }
+
+func TestClientSigns(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	key, err := auth.Load(testUserKeyFile)
+	assert.Nil(err)
+
+	nonces := map[string]bool{}
+	server := httptest.NewServer(http.HandlerFunc(func(rw http.ResponseWriter, req *http.Request) {
+		body, err := ioutil.ReadAll(req.Body)
+		assert.Nil(err)
+
+		sig, err := auth.ParseSignature(req)
+		assert.Nil(err)
+		assert.Equal("loki@asgard.io", sig.KeyID)
+		assert.Nil(sig.Verify(req, body, key.Public()))
+		assert.False(nonces[sig.Nonce])
+
+		nonces[sig.Nonce] = true
+
+		rw.WriteHeader(http.StatusOK)
+	}))
+
+	defer server.Close()
+
+	client, err := NewClient(&Config{
+		ServerAddress: server.URL,
+		Key:           key,
+		User:          "loki",
+		Email:         "loki@asgard.io",
+		CACert:        testCACertFile,
+		Defaults:      ConfigDefaults{Duration: zebra.DefaultMaxDuration},
+	})
+	assert.Nil(err)
+
+	for i := 0; i < 2; i++ {
+		code, err := client.Post("api/v1/resources?type=compute.server", map[string]int{"count": i}, nil)
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, code)
+	}
+
+	assert.Len(nonces, 2)
+}
@@ -14,7 +14,7 @@ import (
 
 const ReadOnly = 0o600
 
-var ErrLeaseDuration = errors.New("lease duration cannot be more that 4 hours")
+var ErrLeaseDuration = errors.New("lease duration must be at least an hour")
 
 func NewConfigure() *cobra.Command {
 	configCmd := &cobra.Command{
@@ -250,7 +250,8 @@ func configDefaults(cmd *cobra.Command, args []string) error {
 		return e
 	}
 
-	if duration > zebra.DefaultMaxDuration {
+	// The server decides how long leases may be, see "zebra limits"
+	if duration <= 0 {
 		return ErrLeaseDuration
 	}
 
@@ -47,7 +47,7 @@ func TestConfig(t *testing.T) {
 
 	assert.Nil(execRootCmd())
 
-	os.Args = append([]string{"zebra"}, "-c", testCfgFile, "config", "defaults", "--duration", "10")
+	os.Args = append([]string{"zebra"}, "-c", testCfgFile, "config", "defaults", "--duration", "0")
 
 	assert.NotNil(execRootCmd())
 
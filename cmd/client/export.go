@@ -0,0 +1,125 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/inventory"
+	"github.com/spf13/cobra"
+)
+
+var (
+	ErrExport = errors.New("error exporting inventory")
+	ErrLabel  = errors.New("label filters must be given as key=value")
+)
+
+type ExportRequest struct {
+	QueryRequest
+	Format string `json:"format"`
+}
+
+func NewExport() *cobra.Command {
+	exportCmd := &cobra.Command{
+		Use:          "export",
+		Short:        "export the inventory as csv, yaml, ndjson or an ansible inventory",
+		RunE:         exportInventory,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(0),
+	}
+
+	exportCmd.Flags().StringP("format", "f", inventory.FormatYAML,
+		"csv, yaml, ndjson, ansible-ini or ansible-yaml")
+	exportCmd.Flags().StringSliceP("type", "t", []string{}, "resource types to export, all if empty")
+	exportCmd.Flags().StringP("group", "g", "", "resource group to export, all if empty")
+	exportCmd.Flags().StringSliceP("label", "l", []string{}, "only export resources with the label key=value")
+	exportCmd.Flags().StringP("output", "o", "", "output file, standard output if empty")
+
+	return exportCmd
+}
+
+func exportInventory(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	req, err := makeExportReq(cmd)
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	buf := new(bytes.Buffer)
+
+	resCode, err := client.Get("api/v1/export", req, buf)
+	if resCode != http.StatusOK {
+		return ErrExport
+	}
+
+	if err != nil {
+		return err
+	}
+
+	if out := cmd.Flag("output").Value.String(); out != "" {
+		return os.WriteFile(out, buf.Bytes(), 0o600) //nolint:gomnd
+	}
+
+	fmt.Print(buf.String())
+
+	return nil
+}
+
+func makeExportReq(cmd *cobra.Command) (*ExportRequest, error) {
+	types, err := cmd.Flags().GetStringSlice("type")
+	if err != nil {
+		return nil, err
+	}
+
+	labels, err := cmd.Flags().GetStringSlice("label")
+	if err != nil {
+		return nil, err
+	}
+
+	req := &ExportRequest{
+		QueryRequest: QueryRequest{Types: types},
+		Format:       strings.ToLower(cmd.Flag("format").Value.String()),
+	}
+
+	if group := cmd.Flag("group").Value.String(); group != "" {
+		labels = append(labels, "system.group="+group)
+	}
+
+	queries, err := labelQueries(labels)
+	if err != nil {
+		return nil, err
+	}
+
+	req.Labels = queries
+
+	return req, nil
+}
+
+// labelQueries turns key=value label filters into label queries.
+func labelQueries(labels []string) ([]zebra.Query, error) {
+	queries := make([]zebra.Query, 0, len(labels))
+
+	for _, l := range labels {
+		kv := strings.SplitN(l, "=", 2)  //nolint:gomnd
+		if len(kv) != 2 || kv[0] == "" { //nolint:gomnd
+			return nil, fmt.Errorf("%w: %s", ErrLabel, l)
+		}
+
+		queries = append(queries, zebra.Query{Key: kv[0], Op: zebra.MatchEqual, Values: []string{kv[1]}})
+	}
+
+	return queries, nil
+}
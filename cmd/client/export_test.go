@@ -0,0 +1,59 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = append([]string{"zebra"}, "export", "extra")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "../../simulator/admin.yaml",
+		"export", "-f", "csv")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "export")
+
+	assert.NotNil(execRootCmd())
+}
+
+func TestMakeExportReq(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	cmd := NewExport()
+	assert.Nil(cmd.ParseFlags([]string{"-f", "Ansible-INI", "-t", "compute.server,network.switch",
+		"-g", "lab-1", "-l", "rack=r1"}))
+
+	req, err := makeExportReq(cmd)
+	assert.Nil(err)
+	assert.Equal("ansible-ini", req.Format)
+	assert.Equal([]string{"compute.server", "network.switch"}, req.Types)
+	assert.Equal([]zebra.Query{
+		{Key: "rack", Op: zebra.MatchEqual, Values: []string{"r1"}},
+		{Key: "system.group", Op: zebra.MatchEqual, Values: []string{"lab-1"}},
+	}, req.Labels)
+
+	cmd = NewExport()
+	assert.Nil(cmd.ParseFlags([]string{"-l", "rack"}))
+
+	_, err = makeExportReq(cmd)
+	assert.ErrorIs(err, ErrLabel)
+}
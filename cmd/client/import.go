@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/project-safari/zebra/inventory"
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+)
+
+var (
+	ErrImport     = errors.New("error importing inventory")
+	ErrImportLine = errors.New("inventory has errors, nothing was imported")
+)
+
+func NewImport() *cobra.Command {
+	importCmd := &cobra.Command{
+		Use:          "import <file>",
+		Short:        "import resources from a csv or yaml inventory file",
+		RunE:         importInventory,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	}
+
+	importCmd.Flags().StringP("type", "t", "", "resource type of csv rows without a type column")
+	importCmd.Flags().StringP("format", "f", "", "file format, csv or yaml, taken from the file extension if empty")
+	importCmd.Flags().StringP("mapping", "m", "", "yaml file mapping csv columns to fields for each resource type")
+	importCmd.Flags().Bool("dry-run", false, "only check the inventory, do not store anything")
+	importCmd.Flags().Bool("upsert", false, "update resources that already exist with the same type, group and name")
+
+	return importCmd
+}
+
+func importInventory(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	req, err := makeImportReq(cmd, args[0])
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	result := inventory.NewImportResult(req.DryRun)
+
+	resCode, err := client.Post("api/v1/import", req, result)
+	if resCode != http.StatusOK {
+		return ErrImport
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printImportResult(result)
+
+	if len(result.Errors) > 0 {
+		return ErrImportLine
+	}
+
+	return nil
+}
+
+func makeImportReq(cmd *cobra.Command, file string) (*inventory.ImportRequest, error) {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	format := cmd.Flag("format").Value.String()
+	if format == "" {
+		format = strings.TrimPrefix(filepath.Ext(file), ".")
+	}
+
+	mappings := inventory.Mappings{}
+
+	if mapFile := cmd.Flag("mapping").Value.String(); mapFile != "" {
+		mapData, err := os.ReadFile(mapFile)
+		if err != nil {
+			return nil, err
+		}
+
+		if err := yaml.Unmarshal(mapData, &mappings); err != nil {
+			return nil, err
+		}
+	}
+
+	dryRun, _ := cmd.Flags().GetBool("dry-run")
+	upsert, _ := cmd.Flags().GetBool("upsert")
+
+	return &inventory.ImportRequest{
+		Format:   strings.ToLower(format),
+		Type:     cmd.Flag("type").Value.String(),
+		Mappings: mappings,
+		DryRun:   dryRun,
+		Upsert:   upsert,
+		Data:     string(data),
+	}, nil
+}
+
+func printImportResult(result *inventory.ImportResult) {
+	for _, e := range result.Errors {
+		fmt.Println(e.Error())
+	}
+
+	verb := "Imported"
+	if !result.Applied {
+		verb = "Would import"
+	}
+
+	if len(result.Errors) == 0 {
+		fmt.Println(verb, "- created:", len(result.Created), "updated:", len(result.Updated))
+	}
+
+	for _, key := range result.Created {
+		fmt.Println("  create", key)
+	}
+
+	for _, key := range result.Updated {
+		fmt.Println("  update", key)
+	}
+}
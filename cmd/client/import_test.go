@@ -0,0 +1,34 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = append([]string{"zebra"}, "import")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "../../simulator/admin.yaml",
+		"import", "missing.csv")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml",
+		"import", "servers.csv")
+
+	assert.NotNil(execRootCmd())
+}
@@ -4,29 +4,77 @@ import (
 	"errors"
 	"fmt"
 	"net/http"
+	"strings"
 	"time"
 
-	"github.com/project-safari/zebra"
-	"github.com/project-safari/zebra/model"
 	"github.com/project-safari/zebra/model/lease"
 	"github.com/spf13/cobra"
 )
 
-var ErrCreateLease = errors.New("error creating resource")
+var (
+	ErrCreateLease = errors.New("error creating resource")
+	ErrLeaseArgs   = errors.New("lease needs either a resource type or a template")
+)
 
 const DefaultResourceCount = 3
 
 func NewLease() *cobra.Command {
 	leaseCmd := &cobra.Command{
-		Use:          "lease",
+		Use:          "lease [type]",
 		Short:        "request a lease",
 		RunE:         leaseRequest,
 		SilenceUsage: true,
-		Args:         cobra.ExactArgs(1),
+		Args:         cobra.MaximumNArgs(1),
 	}
 
-	leaseCmd.Flags().StringP("group", "g", "global", "resource group")
+	leaseCmd.Flags().StringP("group", "g", "", "resource group, any group if empty")
 	leaseCmd.Flags().IntP("count", "k", DefaultResourceCount, "number of resources")
+	leaseCmd.Flags().StringP("start", "s", "", "start time of the lease, e.g. \"2006-01-02 15:04\", now if empty")
+	leaseCmd.Flags().DurationP("duration", "d", 0, "duration of the lease, the default of the template or config if 0")
+	leaseCmd.Flags().StringP("template", "t", "", "lease template to request instead of a resource type")
+	leaseCmd.Flags().StringToInt("set", nil, "counts of named template requests, e.g. servers=3")
+	leaseCmd.Flags().StringSlice("same", nil, "label keys all leased resources must share, e.g. rack")
+	leaseCmd.Flags().StringSlice("spread", nil, "label keys all leased resources must differ in, e.g. lab")
+	leaseCmd.Flags().StringSlice("id", nil, "IDs of specific resources to lease")
+	leaseCmd.Flags().StringSlice("name", nil, "names of specific resources to lease")
+	leaseCmd.Flags().Duration("heartbeat", 0, "heartbeat interval the lease is kept alive with, no heartbeats if 0")
+	leaseCmd.Flags().Bool("dry-run", false, "show which resources the lease would get without leasing them")
+
+	leaseCmd.AddCommand(&cobra.Command{
+		Use:          "status <id>",
+		Short:        "show the state of a lease and its place in the queue",
+		RunE:         leaseStatus,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	})
+
+	leaseCmd.AddCommand(&cobra.Command{
+		Use:          "cancel <id>",
+		Short:        "cancel a queued or scheduled lease, or release an active one",
+		RunE:         leaseCancel,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	})
+
+	leaseCmd.AddCommand(&cobra.Command{
+		Use:          "heartbeat <id>",
+		Short:        "keep an active lease alive that requires heartbeats",
+		RunE:         leaseHeartbeat,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	})
+
+	extendCmd := &cobra.Command{
+		Use:          "extend <id>",
+		Short:        "extend an active lease within its limits",
+		RunE:         leaseExtend,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	}
+	extendCmd.Flags().Duration("by", time.Hour, "time to extend the lease by")
+	leaseCmd.AddCommand(extendCmd)
+
+	addApprovalCommands(leaseCmd)
 
 	return leaseCmd
 }
@@ -42,19 +90,200 @@ func leaseRequest(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	// Create a new lease
-	resCode, err := client.Post("api/v1/resources", req, nil)
+	if dryRun, _ := cmd.Flags().GetBool("dry-run"); dryRun {
+		return leasePlan(client, req)
+	}
+
+	// Create a new lease, the server allocates the resources
+	l := new(lease.Lease)
+
+	resCode, err := client.Post("api/v1/leases", req, l)
 	if resCode != http.StatusOK {
 		return ErrCreateLease
 	}
 
-	fmt.Println("Request - Type:", resReq.Type, "Group:", resReq.Group, "Count:", resReq.Count)
-	fmt.Println("Lease request successfully created")
+	if resReq != nil {
+		fmt.Println("Request - Type:", resReq.Type, "Group:", resReq.Group, "Count:", resReq.Count)
+	} else {
+		fmt.Println("Template:", l.Template.Name, "Version:", l.Template.Version)
+	}
+
+	if l.Phase == lease.Scheduled {
+		fmt.Println("Lease", l.Meta.ID, "scheduled from", l.Start().Local().Format(TimeFormat),
+			"to", l.End().Local().Format(TimeFormat))
+
+		return err
+	}
+
+	if l.Phase == lease.Queued {
+		fmt.Println("Lease", l.Meta.ID, "is waiting for resources, see \"zebra lease status", l.Meta.ID+"\"")
+
+		return err
+	}
+
+	if l.Phase == lease.PendingApproval {
+		fmt.Println("Lease", l.Meta.ID, "is waiting for approval by", strings.Join(l.Approvers, " or "))
+
+		return err
+	}
+
+	fmt.Println("Lease", l.Meta.ID, "successfully created")
 
 	return err
 }
 
-func makeLeaseReq(cmd *cobra.Command, args []string) (*Config, *zebra.ResourceMap, *lease.ResourceReq, error) {
+// LeaseStatus is a lease along with its position in the queue and the
+// estimated time it gets its resources.
+type LeaseStatus struct {
+	Lease    *lease.Lease `json:"lease"`
+	Position int          `json:"position"`
+	ETA      time.Time    `json:"eta"`
+}
+
+func leaseStatus(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	status := new(LeaseStatus)
+	if _, err := client.Get("api/v1/leases/"+args[0], nil, status); err != nil {
+		return err
+	}
+
+	printLeaseStatus(status)
+
+	return nil
+}
+
+func printLeaseStatus(status *LeaseStatus) {
+	l := status.Lease
+
+	fmt.Println("Lease", l.Meta.ID, "of", l.Owner(), "is", l.Phase.String())
+
+	for _, req := range l.Request {
+		fmt.Println("Request - Type:", req.Type, "Group:", req.Group, "Count:", req.Count)
+	}
+
+	switch l.Phase {
+	case lease.Queued:
+		fmt.Println("Position in queue:", status.Position)
+
+		if status.ETA.IsZero() {
+			fmt.Println("Estimated start: unknown")
+		} else {
+			fmt.Println("Estimated start:", status.ETA.Local().Format(TimeFormat))
+		}
+	case lease.PendingApproval:
+		fmt.Println("Waiting for approval by:", strings.Join(l.Approvers, " or "))
+	case lease.Scheduled, lease.Activated:
+		fmt.Println("From", l.Start().Local().Format(TimeFormat), "to", l.End().Local().Format(TimeFormat))
+	case lease.Requested, lease.Released:
+	}
+
+	if a := l.Approval; a != nil {
+		decision := "Denied"
+		if a.Approved {
+			decision = "Approved"
+		}
+
+		fmt.Println(decision, "by", a.Approver, "at", a.Time.Local().Format(TimeFormat), a.Reason)
+	}
+
+	if l.Limits != nil {
+		fmt.Println("Extended", len(l.Extensions), "of", l.Limits.MaxExtensions, "times, up to", l.Limits.MaxTotal)
+	}
+
+	if l.HeartbeatInterval > 0 {
+		last := "never"
+		if !l.LastHeartbeat.IsZero() {
+			last = l.LastHeartbeat.Local().Format(TimeFormat)
+		}
+
+		fmt.Println("Heartbeat every", l.HeartbeatInterval, "last at", last)
+	}
+}
+
+func leaseCancel(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.Delete("api/v1/leases/"+args[0], nil, nil); err != nil {
+		return err
+	}
+
+	fmt.Println("Lease", args[0], "cancelled")
+
+	return nil
+}
+
+func leaseExtend(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	by, err := cmd.Flags().GetDuration("by")
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	l := new(lease.Lease)
+	extend := map[string]time.Duration{"duration": by}
+
+	if _, err := client.Post("api/v1/leases/"+args[0]+"/extend", extend, l); err != nil {
+		return err
+	}
+
+	fmt.Println("Lease", args[0], "extended to", l.End().Local().Format(TimeFormat))
+
+	return nil
+}
+
+func leaseHeartbeat(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	l := new(lease.Lease)
+	if _, err := client.Post("api/v1/leases/"+args[0]+"/heartbeat", nil, l); err != nil {
+		return err
+	}
+
+	fmt.Println("Lease", args[0], "kept alive until", l.LastHeartbeat.Add(l.HeartbeatInterval).Local().Format(TimeFormat))
+
+	return nil
+}
+
+func makeLeaseReq(cmd *cobra.Command, args []string) (*Config, *lease.Lease, *lease.ResourceReq, error) {
+	template := cmd.Flag("template").Value.String()
+	if (template == "") == (len(args) == 0) {
+		return nil, nil, nil, ErrLeaseArgs
+	}
+
 	cfgFile := cmd.Flag("config").Value.String()
 
 	cfg, err := Load(cfgFile)
@@ -62,6 +291,20 @@ func makeLeaseReq(cmd *cobra.Command, args []string) (*Config, *zebra.ResourceMa
 		return nil, nil, nil, err
 	}
 
+	dur, err := cmd.Flags().GetDuration("duration")
+	if err != nil {
+		return nil, nil, nil, err
+	}
+
+	if template != "" {
+		l, err := makeTemplateLease(cmd, cfg, template, dur)
+		if err != nil {
+			return nil, nil, nil, err
+		}
+
+		return cfg, l, nil, setPlacement(cmd, l)
+	}
+
 	resCount, err := cmd.Flags().GetInt("count")
 	if err != nil {
 		return nil, nil, nil, err
@@ -73,15 +316,121 @@ func makeLeaseReq(cmd *cobra.Command, args []string) (*Config, *zebra.ResourceMa
 		Count: resCount,
 	}
 
-	lease := lease.NewLease(
-		cfg.Email,
-		time.Duration(cfg.Defaults.Duration)*time.Hour,
-		[]*lease.ResourceReq{req})
+	if err := setPins(cmd, req); err != nil {
+		return nil, nil, nil, err
+	}
+
+	if dur == 0 {
+		dur = time.Duration(cfg.Defaults.Duration) * time.Hour
+	}
+
+	l := lease.NewLease(cfg.Email, dur, []*lease.ResourceReq{req})
+
+	if err := setStart(cmd, l); err != nil {
+		return nil, nil, nil, err
+	}
 
-	resMap := zebra.NewResourceMap(model.Factory())
-	if err := resMap.Add(lease); err != nil {
+	if err := setHeartbeat(cmd, l); err != nil {
 		return nil, nil, nil, err
 	}
 
-	return cfg, resMap, req, nil
+	return cfg, l, req, setPlacement(cmd, l)
+}
+
+// setPins pins the request to the resources given on the command line, the
+// request then asks for exactly those.
+func setPins(cmd *cobra.Command, req *lease.ResourceReq) error {
+	ids, err := cmd.Flags().GetStringSlice("id")
+	if err != nil {
+		return err
+	}
+
+	names, err := cmd.Flags().GetStringSlice("name")
+	if err != nil {
+		return err
+	}
+
+	req.IDs = ids
+	req.Names = names
+
+	if req.IsPinned() {
+		req.Count = len(ids) + len(names)
+	}
+
+	return nil
+}
+
+// setPlacement adds the placement constraints given on the command line to
+// the lease.
+func setPlacement(cmd *cobra.Command, l *lease.Lease) error {
+	for _, policy := range []string{lease.PlaceTogether, lease.PlaceSpread} {
+		keys, err := cmd.Flags().GetStringSlice(policy)
+		if err != nil {
+			return err
+		}
+
+		for _, key := range keys {
+			l.Placement = append(l.Placement, lease.Placement{Policy: policy, Key: key, Requests: nil})
+		}
+	}
+
+	return nil
+}
+
+// makeTemplateLease returns a lease of a template, the server fills in the
+// requests. The duration of the template is used if dur is 0.
+func makeTemplateLease(cmd *cobra.Command, cfg *Config, template string, dur time.Duration) (*lease.Lease, error) {
+	counts, err := cmd.Flags().GetStringToInt("set")
+	if err != nil {
+		return nil, err
+	}
+
+	l := lease.NewLease(cfg.Email, dur, nil)
+	l.Template = &lease.TemplateRef{Name: template, Version: 0, Counts: counts}
+
+	if err := setStart(cmd, l); err != nil {
+		return nil, err
+	}
+
+	return l, setHeartbeat(cmd, l)
+}
+
+func setStart(cmd *cobra.Command, l *lease.Lease) error {
+	start := cmd.Flag("start").Value.String()
+	if start == "" {
+		return nil
+	}
+
+	t, err := parseTime(start)
+	l.StartTime = t
+
+	return err
+}
+
+func setHeartbeat(cmd *cobra.Command, l *lease.Lease) error {
+	interval, err := cmd.Flags().GetDuration("heartbeat")
+	l.HeartbeatInterval = interval
+
+	return err
+}
+
+// TimeFormat is the format times are printed and most commonly given in.
+const TimeFormat = "2006-01-02 15:04"
+
+var ErrTimeFormat = errors.New("time must be given as \"2006-01-02 15:04\", \"2006-01-02\" or RFC 3339")
+
+// parseTime parses a time given on the command line, in local time unless a
+// zone is given.
+func parseTime(s string) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	for _, layout := range []string{TimeFormat, "2006-01-02T15:04", "2006-01-02"} {
+		if t, err := time.ParseInLocation(layout, s, time.Local); err == nil {
+			return t, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("%w: %s", ErrTimeFormat, s)
 }
@@ -28,4 +28,51 @@ func TestLease(t *testing.T) {
 		"lease", "Server")
 
 	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml",
+		"lease", "status", "0100000001")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml",
+		"lease", "cancel", "0100000001")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml",
+		"lease", "--template", "testbed", "--set", "servers=3")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "lease", "--template", "testbed", "Server")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml",
+		"lease", "Server", "--same", "rack", "--spread", "lab")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml",
+		"lease", "compute.server", "--id", "0100000001", "--name", "rack3-u12")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml",
+		"lease", "Server", "--heartbeat", "5m")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml",
+		"lease", "heartbeat", "0100000001")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "lease", "heartbeat")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "lease", "status")
+
+	assert.NotNil(execRootCmd())
 }
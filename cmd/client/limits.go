@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"sort"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/spf13/cobra"
+)
+
+// LeaseLimits holds the limits of the leases of a role, for any type and for
+// each type that has limits of its own.
+type LeaseLimits struct {
+	Role   string                  `json:"role"`
+	Limits lease.Limits            `json:"limits"`
+	Types  map[string]lease.Limits `json:"types"`
+}
+
+func NewLimits() *cobra.Command {
+	return &cobra.Command{
+		Use:          "limits",
+		Short:        "show how long your leases may be held and extended",
+		RunE:         showLimits,
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+	}
+}
+
+func showLimits(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	limits := new(LeaseLimits)
+
+	resCode, err := client.Get("api/v1/limits", nil, limits)
+	if resCode != http.StatusOK {
+		return ErrQuery
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printLimits(limits)
+
+	return nil
+}
+
+func printLimits(limits *LeaseLimits) {
+	tw := table.NewWriter()
+	tw.AppendHeader(table.Row{"Type", "Max Duration", "Max Extensions", "Max Total"})
+
+	row := func(resType string, l lease.Limits) table.Row {
+		return table.Row{resType, l.MaxDuration.String(), strconv.Itoa(l.MaxExtensions), l.MaxTotal.String()}
+	}
+
+	tw.AppendRow(row("any", limits.Limits))
+
+	types := make([]string, 0, len(limits.Types))
+	for resType := range limits.Types {
+		types = append(types, resType)
+	}
+
+	sort.Strings(types)
+
+	for _, resType := range types {
+		tw.AppendRow(row(resType, limits.Types[resType]))
+	}
+
+	fmt.Println("Lease limits of role", limits.Role)
+	fmt.Println(tw.Render())
+}
@@ -0,0 +1,46 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLimits(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = append([]string{"zebra"}, "limits", "blah")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "limits")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "lease", "extend", "0100000001", "--by", "30m")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "lease", "extend")
+
+	assert.NotNil(execRootCmd())
+
+	printLimits(&LeaseLimits{
+		Role:   "user",
+		Limits: lease.Limits{MaxDuration: 4 * time.Hour, MaxExtensions: 2, MaxTotal: 8 * time.Hour},
+		Types: map[string]lease.Limits{
+			"network.switch": {MaxDuration: time.Hour, MaxExtensions: 2, MaxTotal: 2 * time.Hour},
+		},
+	})
+}
@@ -0,0 +1,89 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+// Plan is the outcome of a dry run of a lease.
+type Plan struct {
+	Feasible  bool          `json:"feasible"`
+	Requests  []RequestPlan `json:"requests"`
+	Reasons   []string      `json:"reasons,omitempty"`
+	Approvers []string      `json:"approvers,omitempty"`
+}
+
+type RequestPlan struct {
+	Type       string      `json:"type"`
+	Name       string      `json:"name,omitempty"`
+	Count      int         `json:"count"`
+	Candidates []string    `json:"candidates"`
+	Picked     []string    `json:"picked,omitempty"`
+	Rejected   *Rejections `json:"rejected,omitempty"`
+}
+
+// Rejections counts the resources rejected for a request by reason.
+type Rejections struct {
+	Type        int `json:"type"`
+	Group       int `json:"group"`
+	Filter      int `json:"filter"`
+	Fault       int `json:"fault"`
+	LeaseStatus int `json:"leaseStatus"`
+	Lifecycle   int `json:"lifecycle"`
+	Booked      int `json:"booked"`
+}
+
+func leasePlan(client *Client, l *lease.Lease) error {
+	plan := new(Plan)
+
+	resCode, err := client.Post("api/v1/leases/plan", l, plan)
+	if resCode != http.StatusOK {
+		return ErrCreateLease
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printPlan(plan)
+
+	return nil
+}
+
+func printPlan(plan *Plan) {
+	if plan.Feasible {
+		fmt.Println("The lease can be satisfied now")
+	} else {
+		fmt.Println("The lease can not be satisfied now")
+	}
+
+	tw := table.NewWriter()
+	tw.AppendHeader(table.Row{
+		"Type", "Name", "Count", "Candidates", "Picked",
+		"Rejected: Type", "Group", "Filter", "Fault", "Leased", "Lifecycle", "Booked",
+	})
+
+	for _, rp := range plan.Requests {
+		row := table.Row{rp.Type, rp.Name, rp.Count, len(rp.Candidates), strings.Join(rp.Picked, ", ")}
+
+		if r := rp.Rejected; r != nil {
+			row = append(row, r.Type, r.Group, r.Filter, r.Fault, r.LeaseStatus, r.Lifecycle, r.Booked)
+		}
+
+		tw.AppendRow(row)
+	}
+
+	fmt.Println(tw.Render())
+
+	for _, reason := range plan.Reasons {
+		fmt.Println("Reason:", reason)
+	}
+
+	if len(plan.Approvers) > 0 {
+		fmt.Println("Needs approval by:", strings.Join(plan.Approvers, " or "))
+	}
+}
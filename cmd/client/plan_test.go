@@ -0,0 +1,42 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPrintPlan(t *testing.T) {
+	t.Parallel()
+
+	printPlan(&Plan{
+		Feasible: true,
+		Requests: []RequestPlan{{Type: "compute.server", Count: 1, Candidates: []string{"a", "b"}, Picked: []string{"a"}}},
+	})
+
+	printPlan(&Plan{
+		Feasible: false,
+		Requests: []RequestPlan{{
+			Type:       "compute.server",
+			Name:       "servers",
+			Count:      3,
+			Candidates: []string{"a"},
+			Rejected:   &Rejections{Type: 4, LeaseStatus: 1, Fault: 1},
+		}},
+		Reasons:   []string{"not enough allocatable resources: compute.server wanted 3, found 1"},
+		Approvers: []string{"admin"},
+	})
+}
+
+func TestLeaseDryRun(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "lease", "Server", "--dry-run")
+
+	assert.NotNil(execRootCmd())
+}
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/spf13/cobra"
+)
+
+type QuotaUsage struct {
+	Quota     *lease.Quota `json:"quota"`
+	Subject   string       `json:"subject"`
+	Resources int          `json:"resources"`
+	Hours     float64      `json:"hours"`
+}
+
+func NewQuota() *cobra.Command {
+	quotaCmd := &cobra.Command{
+		Use:          "quota",
+		Short:        "show lease usage against quotas",
+		RunE:         showQuota,
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+	}
+
+	quotaCmd.Flags().BoolP("all", "a", false, "show the usage of all quotas, not only yours")
+
+	return quotaCmd
+}
+
+func showQuota(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	all, err := cmd.Flags().GetBool("all")
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	path := "api/v1/quotas"
+	if all {
+		path += "?all=true"
+	}
+
+	usage := []QuotaUsage{}
+
+	resCode, err := client.Get(path, nil, &usage)
+	if resCode != http.StatusOK {
+		return ErrQuery
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printQuotas(usage)
+
+	return nil
+}
+
+func printQuotas(usage []QuotaUsage) {
+	tw := table.NewWriter()
+	tw.AppendHeader(table.Row{"Quota", "Subject", "Type", "Resources", "Lease Hours"})
+
+	for _, u := range usage {
+		resType := u.Quota.ResourceType
+		if resType == "" {
+			resType = "any"
+		}
+
+		tw.AppendRow(table.Row{
+			u.Quota.Meta.Name, u.Subject, resType,
+			limit(strconv.Itoa(u.Resources), u.Quota.MaxResources > 0, strconv.Itoa(u.Quota.MaxResources)),
+			limit(fmt.Sprintf("%.1f", u.Hours), u.Quota.MaxHours > 0, fmt.Sprintf("%.1f", u.Quota.MaxHours)),
+		})
+	}
+
+	fmt.Println(tw.Render())
+}
+
+// limit formats usage against a limit, if there is one.
+func limit(used string, limited bool, maxValue string) string {
+	if !limited {
+		return used + " / -"
+	}
+
+	return used + " / " + maxValue
+}
@@ -0,0 +1,43 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQuota(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = append([]string{"zebra"}, "quota", "blah")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "quota", "--all")
+
+	assert.NotNil(execRootCmd())
+}
+
+func TestPrintQuotas(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	assert.Equal("2 / -", limit("2", false, "0"))
+	assert.Equal("2 / 3", limit("2", true, "3"))
+
+	printQuotas([]QuotaUsage{
+		{Quota: lease.NewQuota("per-user", "", "", "", 3, 0), Subject: "user a@zebra", Resources: 2, Hours: 2},
+		{Quota: lease.NewQuota("devs", "", "devs", "compute.server", 0, 10), Subject: "group devs", Resources: 4, Hours: 8},
+	})
+}
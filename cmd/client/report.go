@@ -0,0 +1,175 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/spf13/cobra"
+)
+
+type ReportRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+type UsageHours struct {
+	Name   string  `json:"name"`
+	Leases int     `json:"leases"`
+	Hours  float64 `json:"hours"`
+}
+
+type TypeUtilization struct {
+	Type        string  `json:"type"`
+	Resources   int     `json:"resources"`
+	Hours       float64 `json:"hours"`
+	Utilization float64 `json:"utilization"`
+	Peak        int     `json:"peak"`
+}
+
+type Contention struct {
+	Resource string  `json:"resource"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Leases   int     `json:"leases"`
+	Hours    float64 `json:"hours"`
+}
+
+type Report struct {
+	From      time.Time         `json:"from"`
+	To        time.Time         `json:"to"`
+	Peak      int               `json:"peak"`
+	Types     []TypeUtilization `json:"types"`
+	Users     []UsageHours      `json:"users"`
+	Groups    []UsageHours      `json:"groups"`
+	Contended []Contention      `json:"contended"`
+}
+
+func NewReport() *cobra.Command {
+	reportCmd := &cobra.Command{
+		Use:          "report",
+		Short:        "show resource utilization and lease hours by user, group and type",
+		RunE:         showReport,
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+	}
+
+	reportCmd.Flags().String("from", "", "start of the period, a week before the end if empty")
+	reportCmd.Flags().String("to", "", "end of the period, now if empty")
+	reportCmd.Flags().Bool("csv", false, "print the tables as CSV")
+
+	return reportCmd
+}
+
+func showReport(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	req, err := makeReportReq(cmd)
+	if err != nil {
+		return err
+	}
+
+	csv, err := cmd.Flags().GetBool("csv")
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	report := new(Report)
+
+	resCode, err := client.Get("api/v1/reports/usage", req, report)
+	if resCode != http.StatusOK {
+		return ErrQuery
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printReport(report, csv)
+
+	return nil
+}
+
+func makeReportReq(cmd *cobra.Command) (*ReportRequest, error) {
+	req := &ReportRequest{From: time.Time{}, To: time.Time{}}
+
+	var err error
+
+	if from := cmd.Flag("from").Value.String(); from != "" {
+		if req.From, err = parseTime(from); err != nil {
+			return nil, err
+		}
+	}
+
+	if to := cmd.Flag("to").Value.String(); to != "" {
+		if req.To, err = parseTime(to); err != nil {
+			return nil, err
+		}
+	}
+
+	return req, nil
+}
+
+func printReport(report *Report, csv bool) {
+	render := func(tw table.Writer) {
+		if csv {
+			fmt.Println(tw.RenderCSV())
+		} else {
+			fmt.Println(tw.Render())
+		}
+
+		fmt.Println()
+	}
+
+	if !csv {
+		fmt.Println("Usage from", period(report.From, report.To)+", at most", report.Peak, "resources leased at once")
+	}
+
+	types := table.NewWriter()
+	types.AppendHeader(table.Row{"Type", "Resources", "Lease Hours", "Utilization", "Peak"})
+
+	for _, t := range report.Types {
+		types.AppendRow(table.Row{
+			t.Type, strconv.Itoa(t.Resources), hours(t.Hours), fmt.Sprintf("%.1f%%", t.Utilization), strconv.Itoa(t.Peak),
+		})
+	}
+
+	render(types)
+
+	for _, subject := range []struct {
+		title  string
+		usages []UsageHours
+	}{{"User", report.Users}, {"Group", report.Groups}} {
+		tw := table.NewWriter()
+		tw.AppendHeader(table.Row{subject.title, "Leases", "Lease Hours"})
+
+		for _, u := range subject.usages {
+			tw.AppendRow(table.Row{u.Name, strconv.Itoa(u.Leases), hours(u.Hours)})
+		}
+
+		render(tw)
+	}
+
+	contended := table.NewWriter()
+	contended.AppendHeader(table.Row{"Resource", "Type", "Leases", "Lease Hours"})
+
+	for _, c := range report.Contended {
+		contended.AppendRow(table.Row{c.Name, c.Type, strconv.Itoa(c.Leases), hours(c.Hours)})
+	}
+
+	render(contended)
+}
+
+func hours(h float64) string {
+	return fmt.Sprintf("%.1f", h)
+}
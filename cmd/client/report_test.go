@@ -0,0 +1,71 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReport(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = append([]string{"zebra"}, "report", "blah")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "../../simulator/admin.yaml", "report", "--from", "yesterday")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "report", "--csv")
+
+	assert.NotNil(execRootCmd())
+}
+
+func TestMakeReportReq(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	cmd := NewReport()
+	assert.Nil(cmd.ParseFlags([]string{"--from", "2030-01-02", "--to", "2030-02-02"}))
+
+	req, err := makeReportReq(cmd)
+	assert.Nil(err)
+	assert.Equal(time.Date(2030, 1, 2, 0, 0, 0, 0, time.Local), req.From)
+	assert.Equal(time.Date(2030, 2, 2, 0, 0, 0, 0, time.Local), req.To)
+
+	cmd = NewReport()
+	assert.Nil(cmd.ParseFlags([]string{"--to", "soon"}))
+
+	_, err = makeReportReq(cmd)
+	assert.ErrorIs(err, ErrTimeFormat)
+}
+
+func TestPrintReport(t *testing.T) {
+	t.Parallel()
+
+	start := time.Date(2030, 1, 2, 0, 0, 0, 0, time.Local)
+	report := &Report{
+		From:      start,
+		To:        start.Add(24 * time.Hour),
+		Peak:      2,
+		Types:     []TypeUtilization{{Type: "compute.server", Resources: 4, Hours: 24, Utilization: 25, Peak: 2}},
+		Users:     []UsageHours{{Name: "user@zebra", Leases: 3, Hours: 24}},
+		Groups:    []UsageHours{{Name: "devs", Leases: 3, Hours: 24}},
+		Contended: []Contention{{Resource: "0100000001", Name: "server-1", Type: "compute.server", Leases: 2, Hours: 12}},
+	}
+
+	printReport(report, false)
+	printReport(report, true)
+}
@@ -25,9 +25,17 @@ func New() *cobra.Command {
 	)
 	rootCmd.PersistentFlags().BoolP("verbose", "v", false, "verbose output")
 
+	rootCmd.AddCommand(NewApply())
+	rootCmd.AddCommand(NewCalendar())
 	rootCmd.AddCommand(NewConfigure())
+	rootCmd.AddCommand(NewExport())
+	rootCmd.AddCommand(NewImport())
 	rootCmd.AddCommand(NewLease())
+	rootCmd.AddCommand(NewLimits())
+	rootCmd.AddCommand(NewQuota())
+	rootCmd.AddCommand(NewReport())
 	rootCmd.AddCommand(NewShow())
+	rootCmd.AddCommand(NewToken())
 
 	return rootCmd
 }
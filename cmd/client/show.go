@@ -132,6 +132,14 @@ func NewShow() *cobra.Command { //nolint:funlen
 		SilenceUsage: true,
 	})
 
+	showCmd.AddCommand(&cobra.Command{
+		Use:          "template",
+		Short:        "show lease templates",
+		RunE:         showTemplates,
+		Args:         cobra.MaximumNArgs(1),
+		SilenceUsage: true,
+	})
+
 	showCmd.AddCommand(&cobra.Command{
 		Use:          "user",
 		Short:        "show users",
@@ -384,6 +392,23 @@ func showLeases(cmd *cobra.Command, args []string) error {
 	return nil
 }
 
+func showTemplates(cmd *cobra.Command, args []string) error {
+	code, resMap, err := justGet(cmd, "resources", "system.lease-template")
+	if err != nil {
+		return err
+	}
+
+	if code != http.StatusOK {
+		return ErrQuery
+	}
+
+	if l, ok := resMap.Resources["system.lease-template"]; ok {
+		printTemplates(l.Resources)
+	}
+
+	return nil
+}
+
 func showUsers(cmd *cobra.Command, args []string) error {
 	code, resMap, err := justGet(cmd, "resources", "system.user")
 	if err != nil {
@@ -692,6 +717,28 @@ func printLeases(leases []zebra.Resource) {
 	fmt.Println(tw.Render())
 }
 
+func printTemplates(templates []zebra.Resource) {
+	tw := table.NewWriter()
+	tw.AppendHeader(table.Row{"Name", "Version", "Duration", "Parameter", "Type", "Group", "Count"})
+
+	for _, r := range templates {
+		t, ok := r.(*lease.Template)
+		if !ok {
+			continue
+		}
+
+		for i, req := range t.Request {
+			if i == 0 {
+				tw.AppendRow(table.Row{t.Meta.Name, t.Version, t.Duration, req.Name, req.Type, req.Group, req.Count})
+			} else {
+				tw.AppendRow(table.Row{"", "", "", req.Name, req.Type, req.Group, req.Count})
+			}
+		}
+	}
+
+	fmt.Println(tw.Render())
+}
+
 func printUsers(users []zebra.Resource) {
 	data := table.NewWriter()
 	data.AppendHeader(table.Row{"Name", "Role", "Privileges", "Status"})
@@ -116,6 +116,20 @@ func TestShowLease(t *testing.T) {
 	assert.NotNil(res)
 }
 
+func TestShowTemplate(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	rootCmd := New()
+
+	rootCmd.AddCommand(test())
+
+	assert.NotNil(showTemplates(rootCmd, []string{"testbed"}))
+}
+
 // tests for server resource types (server, esx, vcenter, vm).
 func TestShowServer(t *testing.T) {
 	t.Parallel()
@@ -639,6 +653,23 @@ func TestPrintLeases(t *testing.T) {
 	printLeases(listed)
 }
 
+func TestPrintTemplates(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	resMap := zebra.NewResourceMap(model.Factory())
+	tmpl := lease.NewTemplate("testbed", time.Hour, []*lease.ResourceReq{
+		{Type: "compute.server", Name: "servers", Count: 2},
+		{Type: "network.switch", Count: 1},
+	})
+	assert.Nil(resMap.Add(tmpl))
+
+	listed := resMap.Resources["system.lease-template"].Resources
+	assert.NotNil(listed)
+
+	printTemplates(listed)
+}
+
 func TestPrintUsers(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
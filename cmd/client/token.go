@@ -0,0 +1,167 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/jedib0t/go-pretty/v6/table"
+	"github.com/project-safari/zebra/auth"
+	"github.com/spf13/cobra"
+)
+
+var ErrCreateToken = errors.New("error creating api token")
+
+const DefaultTokenDuration = 30 * 24 * time.Hour
+
+// CreatedToken is an API token as it is made, the only time the token itself
+// is shown.
+type CreatedToken struct {
+	auth.APIToken
+	Token string `json:"token"`
+}
+
+func NewToken() *cobra.Command {
+	tokenCmd := &cobra.Command{
+		Use:          "token",
+		Short:        "manage personal api tokens",
+		SilenceUsage: true,
+	}
+
+	createCmd := &cobra.Command{
+		Use:          "create <name>",
+		Short:        "create an api token with some of your privileges",
+		RunE:         tokenCreate,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	}
+	createCmd.Flags().StringSliceP("priv", "p", nil, "privileges of the token, e.g. \"compute.*:r\"")
+	createCmd.Flags().DurationP("duration", "d", DefaultTokenDuration, "time until the token expires")
+	tokenCmd.AddCommand(createCmd)
+
+	tokenCmd.AddCommand(&cobra.Command{
+		Use:          "list",
+		Short:        "list your api tokens",
+		RunE:         tokenList,
+		SilenceUsage: true,
+		Args:         cobra.NoArgs,
+	})
+
+	tokenCmd.AddCommand(&cobra.Command{
+		Use:          "revoke <id>",
+		Short:        "revoke an api token",
+		RunE:         tokenRevoke,
+		SilenceUsage: true,
+		Args:         cobra.ExactArgs(1),
+	})
+
+	return tokenCmd
+}
+
+func tokenCreate(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	privs, err := cmd.Flags().GetStringSlice("priv")
+	if err != nil {
+		return err
+	}
+
+	duration, err := cmd.Flags().GetDuration("duration")
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	req := map[string]interface{}{"name": args[0], "privileges": privs, "duration": duration.String()}
+	token := new(CreatedToken)
+
+	resCode, err := client.Post("api/v1/tokens", req, token)
+	if resCode != http.StatusOK {
+		return ErrCreateToken
+	}
+
+	if err != nil {
+		return err
+	}
+
+	fmt.Println("Token", token.Name, "("+token.ID+")", "expires", token.Expires.Local().Format(TimeFormat))
+	fmt.Println("Keep it safe, it is not shown again:")
+	fmt.Println(token.Token)
+
+	return nil
+}
+
+func tokenList(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	tokens := []auth.APIToken{}
+
+	resCode, err := client.Get("api/v1/tokens", nil, &tokens)
+	if resCode != http.StatusOK {
+		return ErrQuery
+	}
+
+	if err != nil {
+		return err
+	}
+
+	printTokens(tokens)
+
+	return nil
+}
+
+func tokenRevoke(cmd *cobra.Command, args []string) error {
+	cfg, err := Load(cmd.Flag("config").Value.String())
+	if err != nil {
+		return err
+	}
+
+	client, err := NewClient(cfg)
+	if err != nil {
+		return err
+	}
+
+	if _, err := client.Delete("api/v1/tokens/"+args[0], nil, nil); err != nil {
+		return err
+	}
+
+	fmt.Println("Token", args[0], "revoked")
+
+	return nil
+}
+
+func printTokens(tokens []auth.APIToken) {
+	tw := table.NewWriter()
+	tw.AppendHeader(table.Row{"ID", "Name", "Privileges", "Created", "Expires"})
+
+	for _, t := range tokens {
+		privs := make([]string, 0, len(t.Privileges))
+		for _, p := range t.Privileges {
+			privs = append(privs, p.String())
+		}
+
+		tw.AppendRow(table.Row{
+			t.ID, t.Name, strings.Join(privs, " "),
+			t.Created.Local().Format(TimeFormat), t.Expires.Local().Format(TimeFormat),
+		})
+	}
+
+	fmt.Println(tw.Render())
+}
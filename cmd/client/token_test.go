@@ -0,0 +1,53 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestToken(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	argLock.Lock()
+	defer argLock.Unlock()
+
+	args := os.Args
+	defer func() { os.Args = args }()
+
+	os.Args = append([]string{"zebra"}, "token", "create")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "token", "create", "ci", "-p", "compute.*:r")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "token", "list")
+
+	assert.NotNil(execRootCmd())
+
+	os.Args = append([]string{"zebra"}, "-c", "junk.yaml", "token", "revoke", "0100000001")
+
+	assert.NotNil(execRootCmd())
+}
+
+func TestPrintTokens(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	read, err := auth.NewPriv(`compute\..*`, false, true, false, false)
+	assert.Nil(err)
+
+	now := time.Now()
+	token, _, err := auth.NewAPIToken("ci", "user@zebra", []*auth.Priv{read}, now, now.Add(time.Hour))
+	assert.Nil(err)
+
+	printTokens([]auth.APIToken{*token})
+}
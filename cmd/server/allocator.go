@@ -0,0 +1,681 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/project-safari/zebra/store"
+)
+
+// ScheduleInterval is how often scheduled leases are checked for activation.
+const ScheduleInterval = 30 * time.Second
+
+var (
+	ErrAllocate      = errors.New("not enough allocatable resources")
+	ErrLeaseReleased = errors.New("lease is already released")
+)
+
+// Allocator hands out resources to leases and takes them back when the leases
+// are released. All lease status changes of resources go through the allocator
+// so that a resource is never handed out twice.
+type Allocator struct {
+	lock        sync.Mutex
+	store       zebra.Store
+	priorities  map[string]int
+	webhooks    *Dispatcher
+	hooks       *HookConfig
+	running     sync.WaitGroup
+	idleTimeout time.Duration
+	idleWarned  map[string]time.Time
+	leaseCfg    *LeaseConfig
+	metrics     *Metrics
+
+	usageRetention time.Duration
+}
+
+func NewAllocator(store zebra.Store) *Allocator {
+	return &Allocator{
+		lock:        sync.Mutex{},
+		store:       store,
+		priorities:  DefaultPriorities(),
+		webhooks:    nil,
+		hooks:       nil,
+		running:     sync.WaitGroup{},
+		idleTimeout: DefaultIdleTimeout,
+		idleWarned:  map[string]time.Time{},
+		leaseCfg:    DefaultLeaseConfig(),
+		metrics:     nil,
+
+		usageRetention: DefaultUsageRetention,
+	}
+}
+
+// Allocate assigns resources to every request of the lease. A lease that
+// starts now gets allocatable resources which are marked as leased and the
+// lease is activated. A lease that starts in the future books resources that
+// are free for the whole lease and is scheduled, it is activated by
+// ActivateDue. Either all requests are satisfied or nothing is changed. A lease
+// that would take its owner over a quota is rejected with ErrQuota.
+func (a *Allocator) Allocate(l *lease.Lease) error {
+	defer a.metrics.Since(MetricAllocatorTime, time.Now(), "operation", "allocate")
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err := a.checkQuota(l, 0); err != nil {
+		return err
+	}
+
+	return a.allocate(l)
+}
+
+func (a *Allocator) allocate(l *lease.Lease) error {
+	start, future := leaseStart(l, time.Now())
+
+	p := a.pick(l, start, future)
+
+	picked, err := p.place()
+	if err != nil {
+		if pinned := a.unavailablePins(p); len(pinned) > 0 {
+			return fmt.Errorf("%w: %s", ErrAllocate, strings.Join(pinned, ", "))
+		}
+
+		return err
+	}
+
+	if future {
+		for i, req := range l.Request {
+			for _, res := range picked[i] {
+				if err := req.Assign(res); err != nil {
+					return err
+				}
+			}
+		}
+
+		if err := l.Schedule(); err != nil {
+			return err
+		}
+
+		return a.store.Create(l)
+	}
+
+	return a.activate(l, picked)
+}
+
+// leaseStart returns the time a lease allocated now starts and whether that is
+// in the future.
+func leaseStart(l *lease.Lease, now time.Time) (time.Time, bool) {
+	if l.IsFuture(now) {
+		return l.StartTime, true
+	}
+
+	return now, false
+}
+
+// pick returns a placer for the resources matching the requests of the lease
+// that are free from start for the duration of the lease.
+func (a *Allocator) pick(l *lease.Lease, start time.Time, future bool) *placer {
+	end := start.Add(l.Duration)
+	cal := a.calendar()
+	candidates := make([][]zebra.Resource, len(l.Request))
+	needed := make([]int, len(l.Request))
+
+	for i, req := range l.Request {
+		needed[i] = req.Count - len(req.Resources)
+		candidates[i] = a.candidates(req, cal, start, end, future)
+	}
+
+	return newPlacer(l, candidates, needed)
+}
+
+// unavailablePins explains why resources that pinned requests without enough
+// candidates are pinned to are not candidates.
+func (a *Allocator) unavailablePins(p *placer) []string {
+	unavailable := []string{}
+
+	for i, req := range p.l.Request {
+		if !req.IsPinned() || len(p.candidates[i]) >= p.needed[i] {
+			continue
+		}
+
+		found := map[string]struct{}{}
+
+		for _, res := range a.matching(req) {
+			found[res.GetMeta().ID] = struct{}{}
+			found[res.GetMeta().Name] = struct{}{}
+
+			if !zebra.IsIn(res.GetMeta().ID, resourceIDs(p.candidates[i])) {
+				unavailable = append(unavailable, pinStatus(res))
+			}
+		}
+
+		for _, pin := range append(append([]string{}, req.IDs...), req.Names...) {
+			if _, ok := found[pin]; !ok {
+				unavailable = append(unavailable, fmt.Sprintf("pinned %s %s not found", req.Type, pin))
+			}
+		}
+	}
+
+	return unavailable
+}
+
+// pinStatus tells why a pinned resource can not be leased.
+func pinStatus(res zebra.Resource) string {
+	status := res.GetStatus()
+	name := res.GetMeta().Name
+
+	switch {
+	case status.UsedBy != "":
+		return fmt.Sprintf("pinned %s is leased by %s", name, status.UsedBy)
+	case status.Fault != zebra.None:
+		return fmt.Sprintf("pinned %s is faulted", name)
+	case status.Lifecycle != zebra.Available:
+		return fmt.Sprintf("pinned %s is %s", name, status.Lifecycle.String())
+	}
+
+	return fmt.Sprintf("pinned %s is booked", name)
+}
+
+// activate leases the picked resources to the owner of the lease and activates
+// it. The picked resources are assigned to the requests unless they have been
+// assigned already. If any of them have a setup hook, the lease is activated
+// once the hooks have succeeded.
+func (a *Allocator) activate(l *lease.Lease, picked [][]zebra.Resource) error {
+	leased, err := a.leaseResources(l, picked)
+	if err != nil {
+		return err
+	}
+
+	if setup := a.hooked(HookSetup, leased); len(setup) > 0 {
+		if err := l.SetUp(); err != nil {
+			return err
+		}
+
+		if err := a.store.Create(l); err != nil {
+			return err
+		}
+
+		return a.runHooks(HookSetup, l, setup, a.finishSetup)
+	}
+
+	if err := l.Activate(); err != nil {
+		return err
+	}
+
+	if err := a.store.Create(l); err != nil {
+		return err
+	}
+
+	a.webhooks.Emit(EventLeaseActivated, l)
+
+	return nil
+}
+
+// leaseResources marks the picked resources as leased by the owner of the lease
+// and assigns them to its requests. If any of them can not be leased or stored,
+// the resources and requests are put back the way they were.
+func (a *Allocator) leaseResources(l *lease.Lease, picked [][]zebra.Resource) ([]zebra.Resource, error) {
+	owner := l.Owner()
+	leased := []zebra.Resource{}
+	statuses := []zebra.Status{}
+	assigned := make([][]string, len(l.Request))
+
+	for i, req := range l.Request {
+		assigned[i] = req.Resources
+	}
+
+	undo := func(err error) ([]zebra.Resource, error) {
+		for i, req := range l.Request {
+			req.Resources = assigned[i]
+		}
+
+		for i, res := range leased {
+			*res.UpdateStatus() = statuses[i]
+			_ = a.store.Create(res)
+		}
+
+		return nil, err
+	}
+
+	for i, req := range l.Request {
+		for _, res := range picked[i] {
+			status := res.GetStatus()
+			if err := res.UpdateStatus().Lease(owner); err != nil {
+				return undo(err)
+			}
+
+			leased = append(leased, res)
+			statuses = append(statuses, status)
+
+			if err := a.store.Create(res); err != nil {
+				return undo(err)
+			}
+
+			if zebra.IsIn(res.GetMeta().ID, req.Resources) {
+				continue
+			}
+
+			if err := req.Assign(res); err != nil {
+				return undo(err)
+			}
+		}
+	}
+
+	return leased, nil
+}
+
+// ActivateDue activates the scheduled leases whose start time has come, once
+// all of their booked resources can be allocated. Scheduled leases that could
+// not be activated before their end are released.
+func (a *Allocator) ActivateDue(now time.Time) ([]*lease.Lease, error) {
+	defer a.metrics.Since(MetricAllocatorTime, time.Now(), "operation", "activate_due")
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	activated := []*lease.Lease{}
+
+	for _, l := range a.leases(lease.Scheduled) {
+		if l.IsFuture(now) {
+			continue
+		}
+
+		if !now.Before(l.End()) {
+			l.Deactivate()
+
+			if err := a.store.Create(l); err != nil {
+				return activated, err
+			}
+
+			continue
+		}
+
+		picked, ok := a.booked(l)
+		if !ok {
+			continue
+		}
+
+		if err := a.activate(l, picked); err != nil {
+			return activated, err
+		}
+
+		activated = append(activated, l)
+	}
+
+	return activated, nil
+}
+
+// ExpireDue releases the active leases that have ended.
+func (a *Allocator) ExpireDue(now time.Time) ([]*lease.Lease, error) {
+	defer a.metrics.Since(MetricAllocatorTime, time.Now(), "operation", "expire_due")
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	expired := []*lease.Lease{}
+
+	for _, l := range a.leases(lease.Activated) {
+		if now.Before(l.End()) {
+			continue
+		}
+
+		if err := a.release(l, l.Owner()); err != nil {
+			return expired, err
+		}
+
+		a.webhooks.Emit(EventLeaseExpired, l)
+
+		expired = append(expired, l)
+	}
+
+	return expired, nil
+}
+
+// Run expires, releases idle and activates due leases, hands out resources to
+// queued leases and deletes old usage records every interval until the context
+// is done.
+func (a *Allocator) Run(ctx context.Context, interval time.Duration) {
+	log := logr.FromContextOrDiscard(ctx)
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			expired, err := a.ExpireDue(now)
+			if err != nil {
+				log.Error(err, "expired leases could not be released")
+			}
+
+			for _, l := range expired {
+				log.Info("lease expired", "id", l.Meta.ID, "user", l.Owner())
+			}
+
+			idle, err := a.ReleaseIdle(now)
+			if err != nil {
+				log.Error(err, "idle leases could not be released")
+			}
+
+			for _, l := range idle {
+				log.Info("idle lease released", "id", l.Meta.ID, "user", l.Owner())
+			}
+
+			activated, err := a.ActivateDue(now)
+			if err != nil {
+				log.Error(err, "scheduled leases could not be activated")
+			}
+
+			for _, l := range activated {
+				log.Info("scheduled lease activated", "id", l.Meta.ID, "user", l.Owner())
+			}
+
+			drained, err := a.Drain()
+			if err != nil {
+				log.Error(err, "queued leases could not be allocated")
+			}
+
+			for _, l := range drained {
+				log.Info("queued lease activated", "id", l.Meta.ID, "user", l.Owner())
+			}
+
+			if pruned, err := a.PruneUsage(now); err != nil {
+				log.Error(err, "old usage records could not be deleted")
+			} else if pruned > 0 {
+				log.Info("old usage records deleted", "count", pruned)
+			}
+		}
+	}
+}
+
+// booked returns the resources booked by a lease if all of them can be
+// allocated now.
+func (a *Allocator) booked(l *lease.Lease) ([][]zebra.Resource, bool) {
+	picked := make([][]zebra.Resource, len(l.Request))
+
+	for i, req := range l.Request {
+		resMap := a.store.QueryUUID(req.Resources)
+
+		_ = applyFunc(resMap, func(res zebra.Resource) error {
+			picked[i] = append(picked[i], res)
+
+			return nil
+		})
+
+		if len(picked[i]) != len(req.Resources) {
+			return nil, false
+		}
+
+		for _, res := range picked[i] {
+			if !res.GetStatus().Allocatable() {
+				return nil, false
+			}
+		}
+	}
+
+	return picked, true
+}
+
+// Calendar returns the bookings of all resources.
+func (a *Allocator) Calendar() Calendar {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.calendar()
+}
+
+func (a *Allocator) calendar() Calendar {
+	return NewCalendar(a.store.QueryType([]string{lease.Type().Name}))
+}
+
+// leases returns the stored leases in the given phase.
+func (a *Allocator) leases(phase lease.Phase) []*lease.Lease {
+	leases := []*lease.Lease{}
+
+	_ = applyFunc(a.store.QueryType([]string{lease.Type().Name}), func(res zebra.Resource) error {
+		if l, ok := res.(*lease.Lease); ok && l.Phase == phase {
+			leases = append(leases, l)
+		}
+
+		return nil
+	})
+
+	sort.Slice(leases, func(i, j int) bool { return leases[i].StartTime.Before(leases[j].StartTime) })
+
+	return leases
+}
+
+// Release returns all resources held by the lease, deactivates it and hands
+// the resources to queued leases. A queued or scheduled lease is cancelled.
+// Resources with a teardown hook are freed once the hook has succeeded.
+func (a *Allocator) Release(l *lease.Lease, actor string) error {
+	defer a.metrics.Since(MetricAllocatorTime, time.Now(), "operation", "release")
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.release(l, actor)
+}
+
+func (a *Allocator) release(l *lease.Lease, actor string) error {
+	if l.Phase == lease.Released {
+		return ErrLeaseReleased
+	}
+
+	delete(a.idleWarned, l.Meta.ID)
+
+	if l.Phase.IsPending() {
+		l.Deactivate()
+
+		return a.store.Create(l)
+	}
+
+	if err := a.releaseResources(l, actor); err != nil {
+		return err
+	}
+
+	if err := a.recordUsage(l, time.Now()); err != nil {
+		return err
+	}
+
+	l.Deactivate()
+
+	if err := a.store.Create(l); err != nil {
+		return err
+	}
+
+	_, err := a.drain()
+
+	return err
+}
+
+// releaseResources frees the resources held by the lease, or starts their
+// teardown hooks.
+func (a *Allocator) releaseResources(l *lease.Lease, actor string) error {
+	held := []zebra.Resource{}
+
+	for _, req := range l.RequestList() {
+		resMap := a.store.QueryUUID(req.Resources)
+
+		_ = applyFunc(resMap, func(res zebra.Resource) error {
+			// skip resources that have been handed to someone else already
+			if res.GetStatus().UsedBy == l.Owner() {
+				held = append(held, res)
+			}
+
+			return nil
+		})
+	}
+
+	teardown := []zebra.Resource{}
+
+	for _, res := range held {
+		if a.hooks.Action(res.GetMeta().Type.Name, HookTeardown) != nil {
+			teardown = append(teardown, res)
+
+			continue
+		}
+
+		if err := res.UpdateStatus().Release(actor); err != nil {
+			return err
+		}
+
+		if err := a.store.Create(res); err != nil {
+			return err
+		}
+	}
+
+	if len(teardown) == 0 {
+		return nil
+	}
+
+	return a.runHooks(HookTeardown, l, teardown, a.finishTeardown(actor))
+}
+
+// Transition moves a resource to a new lifecycle state on behalf of actor.
+// Resources can not be moved into or out of the leased state this way, that is
+// done only by Allocate and Release.
+func (a *Allocator) Transition(res zebra.Resource, to zebra.Lifecycle, actor, reason string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	status := res.UpdateStatus()
+	if to == zebra.InUse || status.Lifecycle == zebra.InUse {
+		return zebra.ErrTransition
+	}
+
+	if err := status.Transition(to, actor, reason); err != nil {
+		return err
+	}
+
+	return a.store.Create(res)
+}
+
+// SetFault changes the fault level of a resource.
+func (a *Allocator) SetFault(res zebra.Resource, fault zebra.Fault) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.setFault(res, fault)
+}
+
+// ChangeFault changes the fault level of a resource from the level the caller
+// raised before to a new one. A fault that someone else has set since is only
+// ever raised, never lowered or cleared. It returns false if the fault was left
+// alone.
+func (a *Allocator) ChangeFault(res zebra.Resource, from, to zebra.Fault) (bool, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	current := res.GetStatus().Fault
+	if current == to {
+		return true, nil
+	}
+
+	if current != from && to < current {
+		return false, nil
+	}
+
+	return true, a.setFault(res, to)
+}
+
+func (a *Allocator) setFault(res zebra.Resource, fault zebra.Fault) error {
+	raised := fault != zebra.None && fault != res.GetStatus().Fault
+	res.UpdateStatus().Fault = fault
+
+	if err := a.store.Create(res); err != nil {
+		return err
+	}
+
+	if raised {
+		a.webhooks.Emit(EventResourceFaulted, res)
+	}
+
+	return nil
+}
+
+// Update runs f with the allocator lock held, so that resources written by f
+// do not race with lease status changes.
+func (a *Allocator) Update(f func(zebra.Store) error) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return f(a.store)
+}
+
+// matching returns the resources of the requested type that match the group
+// and the label filters of the request, and that it is pinned to if it is
+// pinned.
+func (a *Allocator) matching(req *lease.ResourceReq) []zebra.Resource {
+	resMap := a.store.QueryType([]string{req.Type})
+
+	for _, q := range req.Filters {
+		filtered, err := store.FilterLabel(q, resMap)
+		if err != nil {
+			return nil
+		}
+
+		resMap = filtered
+	}
+
+	resList, ok := resMap.Resources[req.Type]
+	if !ok {
+		return nil
+	}
+
+	matching := make([]zebra.Resource, 0, len(resList.Resources))
+
+	for _, res := range resList.Resources {
+		if req.Group != "" && !res.GetMeta().Labels.MatchEqual("system.group", req.Group) {
+			continue
+		}
+
+		if req.IsPinned() && !req.Pins(res) {
+			continue
+		}
+
+		matching = append(matching, res)
+	}
+
+	return matching
+}
+
+// candidates returns the resources matching the request that are not booked
+// between start and end. Resources for a lease starting now must be
+// allocatable, for a future lease it is enough that they are in service.
+func (a *Allocator) candidates(req *lease.ResourceReq, cal Calendar, start, end time.Time, future bool,
+) []zebra.Resource {
+	matching := a.matching(req)
+	candidates := make([]zebra.Resource, 0, len(matching))
+
+	for _, res := range matching {
+		id := res.GetMeta().ID
+		status := res.GetStatus()
+
+		if future && status.Lifecycle != zebra.Available && status.Lifecycle != zebra.InUse {
+			continue
+		}
+
+		if !future && !status.Allocatable() {
+			continue
+		}
+
+		if !cal.IsFree(id, start, end) {
+			continue
+		}
+
+		candidates = append(candidates, res)
+	}
+
+	return candidates
+}
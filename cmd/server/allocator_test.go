@@ -0,0 +1,274 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"errors"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeLeaseAPI(assert *assert.Assertions, root string, servers int) *ResourceAPI {
+	api := NewResourceAPI(model.Factory())
+	assert.Nil(api.Initialize(root))
+
+	for _, s := range compute.MockServer(servers) {
+		assert.Nil(api.Store.Create(s))
+	}
+
+	return api
+}
+
+func serverLease(owner string, count int) *lease.Lease {
+	return lease.NewLease(owner, time.Hour, []*lease.ResourceReq{
+		{Type: "compute.server", Count: count},
+	})
+}
+
+func TestAllocate(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_allocate"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 3)
+	a := api.Allocator
+
+	l := serverLease("user@zebra", 2)
+	assert.Nil(a.Allocate(l))
+	assert.True(l.IsValid())
+	assert.Len(l.Request[0].Resources, 2)
+
+	for _, id := range l.Request[0].Resources {
+		status := findResource(api.Store, id).GetStatus()
+		assert.Equal(zebra.InUse, status.Lifecycle)
+		assert.Equal(zebra.Leased, status.LeaseStatus)
+		assert.Equal("user@zebra", status.UsedBy)
+	}
+
+	// Only one server left
+	assert.ErrorIs(a.Allocate(serverLease("other@zebra", 2)), ErrAllocate)
+
+	// Servers in maintenance are not allocatable
+	var free zebra.Resource
+
+	for _, r := range api.Store.QueryType([]string{"compute.server"}).Resources["compute.server"].Resources {
+		if r.GetStatus().Allocatable() {
+			free = r
+		}
+	}
+
+	assert.NotNil(free)
+	assert.Nil(a.Transition(free, zebra.Maintenance, "admin@zebra", "disk swap"))
+	assert.ErrorIs(a.Allocate(serverLease("other@zebra", 1)), ErrAllocate)
+
+	// Leased resources can not be moved by a transition
+	leased := findResource(api.Store, l.Request[0].Resources[0])
+	assert.Equal(zebra.ErrTransition, a.Transition(leased, zebra.Maintenance, "admin@zebra", ""))
+	assert.Equal(zebra.ErrTransition, a.Transition(free, zebra.InUse, "admin@zebra", ""))
+
+	assert.Nil(a.Release(l, "user@zebra"))
+	assert.False(l.IsValid())
+	assert.True(findResource(api.Store, l.Request[0].Resources[0]).GetStatus().Allocatable())
+	assert.Nil(a.Allocate(serverLease("other@zebra", 2)))
+}
+
+// failingStore fails to store resources once it has stored the given number.
+type failingStore struct {
+	zebra.Store
+	left int
+}
+
+var errStore = errors.New("store failed")
+
+func (f *failingStore) Create(res zebra.Resource) error {
+	if f.left == 0 {
+		return errStore
+	}
+
+	f.left--
+
+	return f.Store.Create(res)
+}
+
+func TestAllocateRollback(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_allocate_rollback"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 3)
+	a := api.Allocator
+	a.store = &failingStore{Store: api.Store, left: 1}
+
+	l := serverLease("user@zebra", 2)
+	assert.ErrorIs(a.Allocate(l), errStore)
+	assert.Empty(l.Request[0].Resources)
+
+	// Nothing is left leased by the failed lease
+	a.store = api.Store
+	resMap := api.Store.Query().Resources["compute.server"]
+
+	for _, res := range resMap.Resources {
+		status := res.GetStatus()
+		assert.Equal(zebra.Available, status.Lifecycle)
+		assert.Equal(zebra.Free, status.LeaseStatus)
+		assert.Empty(status.UsedBy)
+	}
+
+	assert.Nil(a.Allocate(serverLease("other@zebra", 3)))
+}
+
+func TestAllocateFilters(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_allocate_filters"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+
+	l := serverLease("user@zebra", 1)
+	l.Request[0].Group = "no-such-group"
+	assert.ErrorIs(api.Allocator.Allocate(l), ErrAllocate)
+
+	l = serverLease("user@zebra", 1)
+	l.Request[0].Filters = []zebra.Query{{Key: "system.group", Op: zebra.MatchEqual, Values: []string{"server"}}}
+	assert.Nil(api.Allocator.Allocate(l))
+
+	l = serverLease("user@zebra", 1)
+	l.Request[0].Type = "compute.vm"
+	assert.ErrorIs(api.Allocator.Allocate(l), ErrAllocate)
+}
+
+func TestAllocatePinned(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_allocate_pinned"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 3)
+	a := api.Allocator
+
+	// Pinned and counted requests in the same lease
+	l := lease.NewLease("user@zebra", time.Hour, []*lease.ResourceReq{
+		{Type: "compute.server", Names: []string{"mock-server-2"}, Count: 1},
+		{Type: "compute.server", Count: 2},
+	})
+	assert.Nil(l.Validate(context.Background()))
+	assert.Nil(a.Allocate(l))
+	assert.Equal("mock-server-2", findResource(api.Store, l.Request[0].Resources[0]).GetMeta().Name)
+	assert.NotContains(l.Request[1].Resources, l.Request[0].Resources[0])
+
+	pinned := l.Request[0].Resources[0]
+
+	// The pinned resource is leased, the other lease waits for it
+	other := serverLease("other@zebra", 1)
+	other.Request[0].IDs = []string{pinned}
+
+	err := a.Allocate(other)
+	assert.ErrorIs(err, ErrAllocate)
+	assert.Contains(err.Error(), "mock-server-2 is leased by user@zebra")
+
+	assert.Nil(a.AllocateOrQueue(other))
+	assert.Equal(lease.Queued, other.Phase)
+
+	assert.Nil(a.Release(l, "user@zebra"))
+	assert.Equal(lease.Activated, other.Phase)
+	assert.Equal([]string{pinned}, other.Request[0].Resources)
+
+	// Unknown resources are never queued for
+	missing := serverLease("user@zebra", 1)
+	missing.Request[0].Names = []string{"rack3-u12"}
+	err = a.AllocateOrQueue(missing)
+	assert.ErrorIs(err, ErrAllocate)
+	assert.Contains(err.Error(), "rack3-u12 not found")
+	assert.NotEqual(lease.Queued, missing.Phase)
+
+	// A pinned request asks for exactly its resources
+	bad := serverLease("user@zebra", 2)
+	bad.Request[0].IDs = []string{pinned}
+	assert.NotNil(bad.Validate(context.Background()))
+}
+
+func TestScheduleLease(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_schedule_lease"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	a := api.Allocator
+	start := time.Now().Add(2 * time.Hour)
+
+	// Book both servers from two hours from now
+	demo := serverLease("demo@zebra", 2)
+	demo.StartTime = start
+	assert.Nil(a.Allocate(demo))
+	assert.Equal(lease.Scheduled, demo.Phase)
+	assert.Len(demo.Request[0].Resources, 2)
+
+	booked := findResource(api.Store, demo.Request[0].Resources[0])
+	assert.True(booked.GetStatus().Allocatable())
+
+	// Overlapping bookings are rejected
+	overlap := serverLease("other@zebra", 1)
+	overlap.StartTime = start.Add(30 * time.Minute)
+	assert.ErrorIs(a.Allocate(overlap), ErrAllocate)
+
+	// A lease running into the booking is rejected, one ending before is fine
+	long := serverLease("other@zebra", 1)
+	long.Duration = 3 * time.Hour
+	assert.ErrorIs(a.Allocate(long), ErrAllocate)
+
+	short := serverLease("other@zebra", 1)
+	assert.Nil(a.Allocate(short))
+
+	later := serverLease("other@zebra", 1)
+	later.StartTime = demo.End()
+	assert.Nil(a.Allocate(later))
+
+	// The demo can not start while a server is still leased
+	activated, err := a.ActivateDue(start)
+	assert.Nil(err)
+	assert.Empty(activated)
+
+	assert.Nil(a.Release(short, "other@zebra"))
+
+	activated, err = a.ActivateDue(start)
+	assert.Nil(err)
+	assert.Len(activated, 1)
+	assert.Equal(lease.Activated, demo.Phase)
+	assert.Equal("demo@zebra", findResource(api.Store, demo.Request[0].Resources[0]).GetStatus().UsedBy)
+
+	// Releasing a scheduled lease only drops the booking
+	assert.Nil(a.Release(later, "other@zebra"))
+	assert.Equal(lease.Released, later.Phase)
+	assert.Equal("demo@zebra", findResource(api.Store, demo.Request[0].Resources[0]).GetStatus().UsedBy)
+	assert.Len(a.Calendar()[demo.Request[0].Resources[0]], 1)
+
+	// Scheduled leases that could not start in time are released
+	missed := serverLease("late@zebra", 1)
+	missed.StartTime = demo.End().Add(time.Hour)
+	assert.Nil(a.Allocate(missed))
+
+	activated, err = a.ActivateDue(missed.End())
+	assert.Nil(err)
+	assert.Empty(activated)
+	assert.Equal(lease.Released, findResource(api.Store, missed.Meta.ID).(*lease.Lease).Phase)
+}
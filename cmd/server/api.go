@@ -4,17 +4,22 @@ import (
 	"context"
 	"errors"
 	"net/http"
+	"path"
 
 	"github.com/go-logr/logr"
 	"github.com/julienschmidt/httprouter"
 	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
 	"github.com/project-safari/zebra/model"
+	"github.com/project-safari/zebra/model/webhook"
 	"github.com/project-safari/zebra/store"
 )
 
 type ResourceAPI struct {
-	factory zebra.ResourceFactory
-	Store   zebra.Store
+	factory   zebra.ResourceFactory
+	Store     zebra.Store
+	Allocator *Allocator
+	Webhooks  *Dispatcher
 }
 
 type QueryRequest struct {
@@ -48,16 +53,81 @@ func (qr *QueryRequest) Validate(ctx context.Context) error {
 
 func NewResourceAPI(factory zebra.ResourceFactory) *ResourceAPI {
 	return &ResourceAPI{
-		factory: factory,
-		Store:   nil,
+		factory:   factory,
+		Store:     nil,
+		Allocator: nil,
+		Webhooks:  nil,
 	}
 }
 
 // Set up store and query store given storage root.
 func (api *ResourceAPI) Initialize(storageRoot string) error {
 	api.Store = store.NewResourceStore(storageRoot, api.factory)
+	if err := api.Store.Initialize(); err != nil {
+		return err
+	}
+
+	secrets, err := NewWebhookSecrets(path.Join(storageRoot, WebhookSecretsFile))
+	if err != nil {
+		return err
+	}
+
+	api.Webhooks = NewDispatcher(DefaultWebhookConfig(), api.Store, secrets)
+	api.Allocator = NewAllocator(api.Store)
+	api.Allocator.webhooks = api.Webhooks
 
-	return api.Store.Initialize()
+	return nil
+}
+
+// create stores a resource and emits a resource.created event if it is new.
+// It must be called with the allocator lock held. The secrets of webhooks are
+// kept by the dispatcher, new webhooks must have one and webhooks posted
+// without one keep theirs.
+func (api *ResourceAPI) create(res zebra.Resource) error {
+	if err := api.Allocator.checkTemplate(res); err != nil {
+		return err
+	}
+
+	isNew := findResource(api.Store, res.GetMeta().ID) == nil
+	versionTemplate(api.Store, res)
+
+	w, isWebhook := res.(*webhook.Webhook)
+	if isWebhook && w.Secret == "" && api.Webhooks.secrets.Get(w.Meta.ID) == "" {
+		return webhook.ErrSecret
+	}
+
+	if err := api.Store.Create(res); err != nil {
+		return err
+	}
+
+	if isWebhook && w.Secret != "" {
+		if err := api.Webhooks.secrets.Set(w.Meta.ID, w.Secret); err != nil {
+			return err
+		}
+	}
+
+	if isNew {
+		api.Webhooks.Emit(EventResourceCreated, res)
+	}
+
+	return nil
+}
+
+// delete removes a resource from the store and emits a resource.deleted event.
+func (api *ResourceAPI) delete(res zebra.Resource) error {
+	if err := api.Store.Delete(res); err != nil {
+		return err
+	}
+
+	if _, ok := res.(*webhook.Webhook); ok {
+		if err := api.Webhooks.secrets.Delete(res.GetMeta().ID); err != nil {
+			return err
+		}
+	}
+
+	api.Webhooks.Emit(EventResourceDeleted, res)
+
+	return nil
 }
 
 // Apply given function f to each resource in resMap.
@@ -99,6 +169,42 @@ func validateResources(ctx context.Context, resMap *zebra.ResourceMap) error {
 	return nil
 }
 
+// query returns the resources selected by a validated query request.
+func (api *ResourceAPI) query(qr *QueryRequest) *zebra.ResourceMap {
+	var resources *zebra.ResourceMap
+
+	labels := qr.Labels
+
+	// Get resources based on primary key (ID, Type, or Label)
+	switch {
+	case len(qr.IDs) != 0:
+		resources = api.Store.QueryUUID(qr.IDs)
+	case len(qr.Types) != 0:
+		resources = api.Store.QueryType(qr.Types)
+	case len(labels) != 0:
+		// Can safely ignore error because we have already validated the query
+		resources, _ = api.Store.QueryLabel(labels[0])
+		labels = labels[1:]
+	default:
+		resources = api.Store.Query()
+	}
+
+	// Filter further based on label queries
+	for _, q := range labels {
+		// Can safely ignore error because we have already validated the query
+		resources, _ = store.FilterLabel(q, resources)
+	}
+
+	return resources
+}
+
+// tokenAllows returns true unless the claims are those of an API token whose
+// scope does not allow the operation on the resource type. The role is left to
+// the handlers that check it.
+func tokenAllows(claims *auth.Claims, allows func(*auth.Role, string) bool, resType string) bool {
+	return claims == nil || claims.Scope == nil || allows(claims.Scope, resType)
+}
+
 func handleQuery() httprouter.Handle {
 	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
 		ctx := req.Context()
@@ -111,6 +217,9 @@ func handleQuery() httprouter.Handle {
 			return
 		}
 
+		// Only the scope of an api token limits what is allowed here
+		claims, _ := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+
 		qr := new(QueryRequest)
 
 		// Read request, return error if applicable
@@ -129,27 +238,12 @@ func handleQuery() httprouter.Handle {
 			return
 		}
 
-		var resources *zebra.ResourceMap
-
-		// Get resources based on primary key (ID, Type, or Label)
-		switch {
-		case len(qr.IDs) != 0:
-			resources = api.Store.QueryUUID(qr.IDs)
-		case len(qr.Types) != 0:
-			resources = api.Store.QueryType(qr.Types)
-		case len(qr.Labels) != 0:
-			q := qr.Labels[0]
-			qr.Labels = qr.Labels[1:]
-			// Can safely ignore error because we have already validated the query
-			resources, _ = api.Store.QueryLabel(q)
-		default:
-			resources = api.Store.Query()
-		}
-
-		// Filter further based on label queries
-		for _, q := range qr.Labels {
-			// Can safely ignore error because we have already validated the query
-			resources, _ = store.FilterLabel(q, resources)
+		// Only the types a token may read are returned
+		resources := api.query(qr)
+		for resType := range resources.Resources {
+			if !tokenAllows(claims, (*auth.Role).Read, resType) {
+				delete(resources.Resources, resType)
+			}
 		}
 
 		log.Info("successfully queried resources")
@@ -171,6 +265,8 @@ func handlePost() httprouter.Handle {
 			return
 		}
 
+		claims, _ := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+
 		resMap := zebra.NewResourceMap(model.Factory())
 
 		// Read request, return error if applicable
@@ -188,8 +284,40 @@ func handlePost() httprouter.Handle {
 			return
 		}
 
-		// Add all resources to store
-		if applyFunc(resMap, api.Store.Create) != nil {
+		// The status is owned by the server, so it is checked and the resources
+		// are stored without racing the allocator
+		err := api.Allocator.Update(func(store zebra.Store) error {
+			if err := applyFunc(resMap, func(r zebra.Resource) error {
+				return checkPost(store, claims, r)
+			}); err != nil {
+				return err
+			}
+
+			return applyFunc(resMap, api.create)
+		})
+
+		switch {
+		case errors.Is(err, ErrForbidden):
+			res.WriteHeader(http.StatusForbidden)
+			log.Info("resources could not be created, permission denied", "user", claims.Email)
+
+			return
+		case errors.Is(err, ErrStatusChange) || errors.Is(err, ErrLeaseResource):
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resources could not be created, found invalid status change(s)")
+
+			return
+		case errors.Is(err, webhook.ErrSecret):
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resources could not be created, found webhook(s) without a secret")
+
+			return
+		case errors.Is(err, ErrTemplateDuration):
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resources could not be created, found lease template(s) over the lease limits")
+
+			return
+		case err != nil:
 			res.WriteHeader(http.StatusInternalServerError)
 			log.Info("internal server error while creating resources")
 
@@ -214,6 +342,8 @@ func handleDelete() httprouter.Handle {
 			return
 		}
 
+		claims, _ := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+
 		id := params.ByName("id")
 		if id == "" {
 			res.WriteHeader(http.StatusBadRequest)
@@ -223,10 +353,40 @@ func handleDelete() httprouter.Handle {
 		}
 
 		ids := []string{id}
-		resMap := api.Store.QueryUUID(ids)
 
-		// Delete all resources from store
-		if applyFunc(resMap, api.Store.Delete) != nil {
+		// Leases and leased resources are left alone, the lease api ends them
+		err := api.Allocator.Update(func(store zebra.Store) error {
+			resMap := store.QueryUUID(ids)
+			if err := applyFunc(resMap, func(r zebra.Resource) error {
+				if !tokenAllows(claims, (*auth.Role).Delete, r.GetMeta().Type.Name) {
+					return ErrForbidden
+				}
+
+				return validateDelete(r)
+			}); err != nil {
+				return err
+			}
+
+			return applyFunc(resMap, api.delete)
+		})
+
+		switch {
+		case errors.Is(err, ErrForbidden):
+			res.WriteHeader(http.StatusForbidden)
+			log.Info("resources could not be deleted, permission denied", "user", claims.Email)
+
+			return
+		case errors.Is(err, ErrLeaseResource):
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resources could not be deleted, leases are released through the lease api")
+
+			return
+		case errors.Is(err, ErrResourceInUse):
+			res.WriteHeader(http.StatusConflict)
+			log.Info("resources could not be deleted, resource is leased")
+
+			return
+		case err != nil:
 			res.WriteHeader(http.StatusInternalServerError)
 			log.Info("internal server error while deleting resources")
 
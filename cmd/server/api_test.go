@@ -12,6 +12,7 @@ import (
 
 	"github.com/julienschmidt/httprouter"
 	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
 	"github.com/project-safari/zebra/model"
 	"github.com/project-safari/zebra/model/dc"
 	"github.com/stretchr/testify/assert"
@@ -321,6 +322,96 @@ func TestDeleteResource(t *testing.T) {
 	assert.Empty(myAPI.Store.Query().Resources)
 }
 
+func TestDeleteLeased(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_delete_leased"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	l := serverLease("user@zebra", 1)
+	assert.Nil(api.Allocator.Allocate(l))
+
+	deleteID := func(id string) int {
+		rr := httptest.NewRecorder()
+		handleDelete()(rr, createRequest(assert, "DELETE", "/resources", "", api), httprouter.Params{{Key: "id", Value: id}})
+
+		return rr.Code
+	}
+
+	// Deleting either would orphan the lease
+	assert.Equal(http.StatusBadRequest, deleteID(l.Meta.ID))
+	assert.Equal(http.StatusConflict, deleteID(l.Request[0].Resources[0]))
+
+	assert.Nil(api.Allocator.Release(l, "user@zebra"))
+	assert.Equal(http.StatusOK, deleteID(l.Request[0].Resources[0]))
+}
+
+func TestTokenScopes(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_token_scopes"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	lab := dc.NewLab("Lab1", "test_owner", "test_group")
+	assert.Nil(api.Store.Create(lab))
+
+	compute, err := auth.NewPriv(`compute\..*`, true, true, true, true)
+	assert.Nil(err)
+
+	scoped := adminClaims(assert)
+	scoped.Scope = &auth.Role{Name: "token:ci", Privileges: []*auth.Priv{compute}}
+
+	query := func(claims *auth.Claims) *zebra.ResourceMap {
+		rr := httptest.NewRecorder()
+		handleQuery()(rr, makeClaimsRequest(assert, "GET", "/api/v1/resources", "", api, claims), nil)
+		assert.Equal(http.StatusOK, rr.Code)
+
+		found := zebra.NewResourceMap(model.Factory())
+		assert.Nil(json.Unmarshal(rr.Body.Bytes(), found))
+
+		return found
+	}
+
+	// A token only sees the types in its scope, the role is not checked here
+	assert.Len(query(userClaims(assert, "user@zebra")).Resources, 2)
+	assert.Len(query(scoped).Resources, 1)
+	assert.Contains(query(scoped).Resources, "compute.server")
+
+	post := func(claims *auth.Claims, res zebra.Resource) int {
+		resMap := zebra.NewResourceMap(model.Factory())
+		assert.Nil(resMap.Add(res))
+
+		body, err := json.Marshal(resMap)
+		assert.Nil(err)
+
+		rr := httptest.NewRecorder()
+		handlePost()(rr, makeClaimsRequest(assert, "POST", "/api/v1/resources", string(body), api, claims), nil)
+
+		return rr.Code
+	}
+
+	newLab := dc.NewLab("Lab2", "test_owner", "test_group")
+	assert.Equal(http.StatusForbidden, post(scoped, newLab))
+	assert.Equal(http.StatusForbidden, post(scoped, lab))
+	assert.Equal(http.StatusOK, post(userClaims(assert, "user@zebra"), newLab))
+
+	deleteID := func(claims *auth.Claims, id string) int {
+		rr := httptest.NewRecorder()
+		handleDelete()(rr, makeClaimsRequest(assert, "DELETE", "/", "", api, claims), httprouter.Params{{Key: "id", Value: id}})
+
+		return rr.Code
+	}
+
+	assert.Equal(http.StatusForbidden, deleteID(scoped, lab.Meta.ID))
+	assert.Equal(http.StatusOK, deleteID(userClaims(assert, "user@zebra"), lab.Meta.ID))
+}
+
 func TestValidateQueries(t *testing.T) {
 	t.Parallel()
 	assert := assert.New(t)
@@ -0,0 +1,224 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+// approvers returns the roles that may approve a lease, none if the lease does
+// not need approval. A lease needs approval if any resource it may get is
+// matched by an approval policy, unless it has been approved already.
+func (a *Allocator) approvers(l *lease.Lease) []string {
+	if l.Approval != nil {
+		return nil
+	}
+
+	policies := a.policies()
+	if len(policies) == 0 {
+		return nil
+	}
+
+	roles := map[string]struct{}{}
+
+	for _, req := range l.RequestList() {
+		for _, res := range a.matching(req) {
+			for _, p := range policies {
+				if p.Matches(res) {
+					roles[p.Role()] = struct{}{}
+				}
+			}
+		}
+	}
+
+	approvers := make([]string, 0, len(roles))
+	for role := range roles {
+		approvers = append(approvers, role)
+	}
+
+	sort.Strings(approvers)
+
+	return approvers
+}
+
+// policies returns the stored approval policies.
+func (a *Allocator) policies() []*lease.ApprovalPolicy {
+	policies := []*lease.ApprovalPolicy{}
+
+	_ = applyFunc(a.store.QueryType([]string{lease.PolicyType().Name}), func(res zebra.Resource) error {
+		if p, ok := res.(*lease.ApprovalPolicy); ok {
+			policies = append(policies, p)
+		}
+
+		return nil
+	})
+
+	return policies
+}
+
+// Approve records that approver, who has the given role, approved the lease and
+// allocates or queues it. An approved lease that can never be satisfied is
+// released.
+func (a *Allocator) Approve(l *lease.Lease, approver, role, reason string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err := l.Decide(approver, role, true, reason); err != nil {
+		return err
+	}
+
+	if err := a.allocateOrQueue(l); err != nil {
+		l.Deactivate()
+
+		if e := a.store.Create(l); e != nil {
+			return e
+		}
+
+		return err
+	}
+
+	return nil
+}
+
+// Deny records that approver, who has the given role, denied the lease and
+// releases it.
+func (a *Allocator) Deny(l *lease.Lease, approver, role, reason string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err := l.Decide(approver, role, false, reason); err != nil {
+		return err
+	}
+
+	return a.store.Create(l)
+}
+
+// PendingApproval returns the leases waiting for approval by a role.
+func (a *Allocator) PendingApproval(role string) []*lease.Lease {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	pending := []*lease.Lease{}
+
+	for _, l := range a.leases(lease.PendingApproval) {
+		if zebra.IsIn(role, l.Approvers) {
+			pending = append(pending, l)
+		}
+	}
+
+	return pending
+}
+
+func roleName(role *auth.Role) string {
+	if role == nil {
+		return ""
+	}
+
+	return role.Name
+}
+
+// handleApprovals returns the leases the authenticated user may approve.
+func handleApprovals() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		writeJSON(ctx, res, api.Allocator.PendingApproval(roleName(claims.Role)))
+	}
+}
+
+// handleDecision approves or denies a lease pending approval. Only users with
+// one of the approver roles of the lease may decide on it, and not with an API
+// token, since the scope of a token does not name roles.
+func handleDecision(approve bool) httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if claims.Scope != nil {
+			res.WriteHeader(http.StatusForbidden)
+			log.Info("lease decision refused, made with an api token", "user", claims.Email)
+
+			return
+		}
+
+		decision := &struct {
+			Reason string `json:"reason"`
+		}{}
+
+		if err := readJSON(ctx, req, decision); err != nil && !errors.Is(err, ErrEmptyBody) {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("lease decision could not be read")
+
+			return
+		}
+
+		l, ok := findResource(api.Store, params.ByName("id")).(*lease.Lease)
+		if !ok {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		decide := api.Allocator.Deny
+		if approve {
+			decide = api.Allocator.Approve
+		}
+
+		if err := decide(l, claims.Email, roleName(claims.Role), decision.Reason); err != nil {
+			switch {
+			case errors.Is(err, lease.ErrNotApprover):
+				res.WriteHeader(http.StatusForbidden)
+			case errors.Is(err, lease.ErrNotPending), errors.Is(err, ErrAllocate):
+				res.WriteHeader(http.StatusConflict)
+			default:
+				res.WriteHeader(http.StatusInternalServerError)
+				log.Error(err, "lease decision could not be stored", "id", l.Meta.ID)
+
+				return
+			}
+
+			log.Info("lease decision rejected", "id", l.Meta.ID, "user", claims.Email, "error", err.Error())
+
+			return
+		}
+
+		log.Info("lease decided", "id", l.Meta.ID, "approver", claims.Email, "approved", approve,
+			"phase", l.Phase.String())
+
+		writeJSON(ctx, res, l)
+	}
+}
@@ -0,0 +1,159 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestApprovalPolicy(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	server := compute.MockServer(1)[0]
+	server.GetMeta().Labels.Add("env", "prod")
+
+	prod := []zebra.Query{{Key: "env", Op: zebra.MatchEqual, Values: []string{"prod"}}}
+	notProd := []zebra.Query{{Key: "env", Op: zebra.MatchNotEqual, Values: []string{"prod"}}}
+
+	assert.True(lease.NewPolicy("p", "compute.server", nil, "").Matches(server))
+	assert.True(lease.NewPolicy("p", "", prod, "").Matches(server))
+	assert.False(lease.NewPolicy("p", "", notProd, "").Matches(server))
+	assert.False(lease.NewPolicy("p", "compute.vcenter", prod, "").Matches(server))
+
+	assert.Equal(lease.DefaultApprover, lease.NewPolicy("p", "compute.server", nil, "").Role())
+	assert.Equal("lab-admin", lease.NewPolicy("p", "compute.server", nil, "lab-admin").Role())
+
+	assert.Nil(lease.NewPolicy("p", "compute.server", nil, "").Validate(ctx))
+	assert.NotNil(lease.NewPolicy("p", "", nil, "").Validate(ctx))
+	assert.NotNil(lease.NewPolicy("p", "", []zebra.Query{{Key: "env", Op: zebra.MatchEqual}}, "").Validate(ctx))
+	assert.NotNil(lease.EmptyPolicy().Validate(ctx))
+}
+
+func TestApprove(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_approve"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	a := api.Allocator
+
+	// No policy, no approval
+	free := serverLease("free@zebra", 1)
+	assert.Nil(a.AllocateOrQueue(free))
+	assert.Equal(lease.Activated, free.Phase)
+	assert.Nil(a.Release(free, "free@zebra"))
+
+	assert.Nil(api.Store.Create(lease.NewPolicy("servers", "compute.server", nil, "lab-admin")))
+
+	l := serverLease("user@zebra", 2)
+	assert.Nil(a.AllocateOrQueue(l))
+	assert.Equal(lease.PendingApproval, l.Phase)
+	assert.Equal([]string{"lab-admin"}, l.Approvers)
+	assert.Len(a.PendingApproval("lab-admin"), 1)
+	assert.Empty(a.PendingApproval("admin"))
+
+	// Nothing is allocated before the approval
+	for _, r := range api.Store.QueryType([]string{"compute.server"}).Resources["compute.server"].Resources {
+		assert.True(r.GetStatus().Allocatable())
+	}
+
+	assert.ErrorIs(a.Approve(l, "admin@zebra", "admin", ""), lease.ErrNotApprover)
+	assert.Nil(a.Approve(l, "boss@zebra", "lab-admin", "go ahead"))
+	assert.Equal(lease.Activated, l.Phase)
+	assert.Equal("boss@zebra", l.Approval.Approver)
+	assert.True(l.Approval.Approved)
+	assert.ErrorIs(a.Approve(l, "boss@zebra", "lab-admin", ""), lease.ErrNotPending)
+
+	// An approved lease waits in the queue like any other
+	queued := serverLease("other@zebra", 1)
+	assert.Nil(a.AllocateOrQueue(queued))
+	assert.Nil(a.Approve(queued, "boss@zebra", "lab-admin", ""))
+	assert.Equal(lease.Queued, queued.Phase)
+
+	denied := serverLease("denied@zebra", 1)
+	assert.Nil(a.AllocateOrQueue(denied))
+	assert.Nil(a.Deny(denied, "boss@zebra", "lab-admin", "not now"))
+	assert.Equal(lease.Released, denied.Phase)
+	assert.False(denied.Approval.Approved)
+	assert.Equal("not now", denied.Approval.Reason)
+
+	// A pending lease can be cancelled by its owner
+	cancelled := serverLease("user@zebra", 1)
+	assert.Nil(a.AllocateOrQueue(cancelled))
+	assert.Nil(a.Release(cancelled, "user@zebra"))
+	assert.Equal(lease.Released, cancelled.Phase)
+	assert.Empty(a.PendingApproval("lab-admin"))
+}
+
+func TestDecisionHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_decision_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	assert.Nil(api.Store.Create(lease.NewPolicy("servers", "compute.server", nil, "")))
+
+	l := serverLease("user@zebra", 1)
+	assert.Nil(api.Allocator.AllocateOrQueue(l))
+
+	decide := func(approve bool, id, body string, claims *auth.Claims) *httptest.ResponseRecorder {
+		h := handleDecision(approve)
+		rr := httptest.NewRecorder()
+		req := createRequest(assert, "POST", "/", body, api)
+
+		if claims != nil {
+			req = makeClaimsRequest(assert, "POST", "/", body, api, claims)
+		}
+
+		h(rr, req, httprouter.Params{{Key: "id", Value: id}})
+
+		return rr
+	}
+
+	assert.Equal(http.StatusUnauthorized, decide(true, l.Meta.ID, "", nil).Code)
+	assert.Equal(http.StatusBadRequest, decide(true, l.Meta.ID, "{", adminClaims(assert)).Code)
+	assert.Equal(http.StatusNotFound, decide(true, "0000000000", "", adminClaims(assert)).Code)
+	assert.Equal(http.StatusForbidden, decide(true, l.Meta.ID, "", userClaims(assert, "user@zebra")).Code)
+
+	// Not with an api token, even an admin's
+	token := adminClaims(assert)
+	token.Scope = token.Role
+	assert.Equal(http.StatusForbidden, decide(true, l.Meta.ID, "", token).Code)
+
+	// The approver sees the lease
+	rr := httptest.NewRecorder()
+	handleApprovals()(rr, makeClaimsRequest(assert, "GET", "/", "", api, adminClaims(assert)), nil)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	pending := []*lease.Lease{}
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), &pending))
+	assert.Len(pending, 1)
+
+	rr = decide(true, l.Meta.ID, `{"reason":"ok"}`, adminClaims(assert))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	got := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), got))
+	assert.Equal(lease.Activated, got.Phase)
+	assert.Equal("admin@zebra", got.Approval.Approver)
+
+	assert.Equal(http.StatusConflict, decide(false, l.Meta.ID, "", adminClaims(assert)).Code)
+}
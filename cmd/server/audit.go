@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"gojini.dev/web"
+)
+
+const (
+	// AuditKey is the privilege key of the audit log. Only users who may
+	// write it, admins by default, may read the audit log.
+	AuditKey = "system.audit"
+
+	DefaultAuditPath     = "zebra-audit.jsonl"
+	DefaultAuditMaxSize  = 10 << 20
+	DefaultAuditMaxFiles = 5
+	DefaultAuditLimit    = 1000
+
+	// maxAuditBody is how much of a request or response body is searched for
+	// resource IDs.
+	maxAuditBody = 1 << 20
+
+	RequestIDHeader = "X-Request-Id"
+
+	// AuditAnonymous is the user of audit entries of calls made by someone who
+	// has not been authenticated.
+	AuditAnonymous = "anonymous"
+)
+
+// AuditConfig is the "audit" section of the server configuration. The audit
+// log is written to Path and rotated once it is MaxSize bytes, keeping
+// MaxFiles old files named Path.1, Path.2 and so on, Path.1 being the newest.
+type AuditConfig struct {
+	Path     string `json:"path"`
+	MaxSize  int64  `json:"maxSize"`
+	MaxFiles int    `json:"maxFiles"`
+}
+
+func DefaultAuditConfig() *AuditConfig {
+	return &AuditConfig{Path: DefaultAuditPath, MaxSize: DefaultAuditMaxSize, MaxFiles: DefaultAuditMaxFiles}
+}
+
+// AuditEntry is one mutating API call or authentication: who made it from
+// where, what route it was for, the IDs of the resources it named and how it
+// turned out.
+type AuditEntry struct {
+	Time      time.Time `json:"time"`
+	RequestID string    `json:"requestId"`
+	User      string    `json:"user"`
+	Role      string    `json:"role"`
+	SourceIP  string    `json:"sourceIp"`
+	Method    string    `json:"method"`
+	Route     string    `json:"route"`
+	Path      string    `json:"path"`
+	Resources []string  `json:"resources,omitempty"`
+	Status    int       `json:"status"`
+	Outcome   string    `json:"outcome"`
+}
+
+// Outcomes of audited calls.
+const (
+	AuditSuccess = "success"
+	AuditFailure = "failure"
+)
+
+// AuditLog writes audit entries to a file as JSON lines and rotates it.
+type AuditLog struct {
+	lock sync.Mutex
+	cfg  *AuditConfig
+	file *os.File
+	size int64
+}
+
+// NewAuditLog opens the audit log for appending.
+func NewAuditLog(cfg *AuditConfig) (*AuditLog, error) {
+	a := &AuditLog{lock: sync.Mutex{}, cfg: cfg, file: nil, size: 0}
+	if err := a.open(); err != nil {
+		return nil, err
+	}
+
+	return a, nil
+}
+
+func (a *AuditLog) open() error {
+	file, err := os.OpenFile(a.cfg.Path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, ReadWriteOnly)
+	if err != nil {
+		return err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+
+		return err
+	}
+
+	a.file = file
+	a.size = info.Size()
+
+	return nil
+}
+
+// Write appends an entry to the audit log, rotating it first if the entry
+// would take it over its maximum size.
+func (a *AuditLog) Write(entry *AuditEntry) error {
+	line, err := json.Marshal(entry)
+	if err != nil {
+		return err
+	}
+
+	line = append(line, '\n')
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if a.size > 0 && a.size+int64(len(line)) > a.cfg.MaxSize {
+		if err := a.rotate(); err != nil {
+			return err
+		}
+	}
+
+	n, err := a.file.Write(line)
+	a.size += int64(n)
+
+	return err
+}
+
+// rotate moves every file one up, dropping the oldest, and starts a new file.
+func (a *AuditLog) rotate() error {
+	if err := a.file.Close(); err != nil {
+		return err
+	}
+
+	if err := os.Remove(a.rotated(a.cfg.MaxFiles)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+
+	for i := a.cfg.MaxFiles; i > 0; i-- {
+		if err := os.Rename(a.rotated(i-1), a.rotated(i)); err != nil && !errors.Is(err, os.ErrNotExist) {
+			return err
+		}
+	}
+
+	return a.open()
+}
+
+// rotated returns the name of the ith file, the current file for 0.
+func (a *AuditLog) rotated(i int) string {
+	if i == 0 {
+		return a.cfg.Path
+	}
+
+	return fmt.Sprintf("%s.%d", a.cfg.Path, i)
+}
+
+// Close closes the audit log.
+func (a *AuditLog) Close() error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.file.Close()
+}
+
+// AuditQuery selects audit entries between From and To, of User if it is not
+// empty. At most Limit entries are returned, the newest ones.
+type AuditQuery struct {
+	From  time.Time `json:"from"`
+	To    time.Time `json:"to"`
+	User  string    `json:"user"`
+	Limit int       `json:"limit"`
+}
+
+func (q *AuditQuery) matches(e *AuditEntry) bool {
+	return !e.Time.Before(q.From) && (q.To.IsZero() || e.Time.Before(q.To)) && (q.User == "" || e.User == q.User)
+}
+
+// Query returns the entries of the audit log and its rotated files that match
+// the query, oldest first.
+func (a *AuditLog) Query(q *AuditQuery) ([]AuditEntry, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	entries := []AuditEntry{}
+
+	for i := a.cfg.MaxFiles; i >= 0; i-- {
+		found, err := readAudit(a.rotated(i), q)
+		if err != nil {
+			return nil, err
+		}
+
+		entries = append(entries, found...)
+	}
+
+	sort.SliceStable(entries, func(i, j int) bool { return entries[i].Time.Before(entries[j].Time) })
+
+	if q.Limit > 0 && len(entries) > q.Limit {
+		entries = entries[len(entries)-q.Limit:]
+	}
+
+	return entries, nil
+}
+
+// readAudit returns the entries of an audit file that match the query, none
+// if the file does not exist.
+func readAudit(path string, q *AuditQuery) ([]AuditEntry, error) {
+	file, err := os.Open(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	defer file.Close()
+
+	entries := []AuditEntry{}
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 0, bufio.MaxScanTokenSize), maxAuditBody)
+
+	for scanner.Scan() {
+		e := AuditEntry{}
+		if err := json.Unmarshal(scanner.Bytes(), &e); err != nil {
+			continue
+		}
+
+		if q.matches(&e) {
+			entries = append(entries, e)
+		}
+	}
+
+	return entries, scanner.Err()
+}
+
+// isMutating returns true for the methods of calls that change something.
+func isMutating(method string) bool {
+	return method == http.MethodPost || method == http.MethodPut || method == http.MethodPatch ||
+		method == http.MethodDelete
+}
+
+// auditWriter remembers the status of a response and the start of its body.
+type auditWriter struct {
+	http.ResponseWriter
+	status int
+	body   bytes.Buffer
+}
+
+func (w *auditWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *auditWriter) Write(b []byte) (int, error) {
+	if room := maxAuditBody - w.body.Len(); room > 0 {
+		if len(b) < room {
+			room = len(b)
+		}
+
+		w.body.Write(b[:room])
+	}
+
+	return w.ResponseWriter.Write(b)
+}
+
+// auditPaths are the paths of the calls that authenticate, which are audited
+// whatever their method.
+var auditPaths = []string{"/login", "/register", "/refresh", "/logout"}
+
+// auditAdapter writes an audit entry for every mutating call and every call
+// that authenticates. It must come before login and auth so that refused calls
+// are audited too, the caller is filled in by whoever authenticates the call.
+// Every response gets a request ID, the one of the request if it has one.
+func auditAdapter() web.Adapter {
+	return func(nextHandler http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+
+			requestID := req.Header.Get(RequestIDHeader)
+			if requestID == "" {
+				requestID = uuid.New().String()
+			}
+
+			res.Header().Set(RequestIDHeader, requestID)
+
+			audit, ok := ctx.Value(AuditCtxKey).(*AuditLog)
+			if !ok || !(isMutating(req.Method) || zebra.IsIn(req.URL.Path, auditPaths)) {
+				callNext(nextHandler, res, req)
+
+				return
+			}
+
+			reqBody, err := io.ReadAll(io.LimitReader(req.Body, maxAuditBody))
+			if err != nil {
+				res.WriteHeader(http.StatusBadRequest)
+
+				return
+			}
+
+			req.Body = io.NopCloser(io.MultiReader(bytes.NewReader(reqBody), req.Body))
+
+			entry := newAuditEntry(req, requestID)
+			w := &auditWriter{ResponseWriter: res, status: http.StatusOK, body: bytes.Buffer{}}
+			callNext(nextHandler, w, req.WithContext(context.WithValue(ctx, AuditEntryCtxKey, entry)))
+
+			entry.Status = w.status
+			entry.Resources = auditIDs(req.Method, req.URL.Path, reqBody, w.body.Bytes())
+
+			if w.status >= http.StatusBadRequest {
+				entry.Outcome = AuditFailure
+			}
+
+			if err := audit.Write(entry); err != nil {
+				logr.FromContextOrDiscard(ctx).Error(err, "audit entry could not be written", "request", requestID)
+			}
+		})
+	}
+}
+
+// newAuditEntry returns the audit entry of a call made by someone who has not
+// been authenticated yet.
+func newAuditEntry(req *http.Request, requestID string) *AuditEntry {
+	return &AuditEntry{
+		Time:      time.Now(),
+		RequestID: requestID,
+		User:      AuditAnonymous,
+		Role:      "",
+		SourceIP:  sourceIP(req),
+		Method:    req.Method,
+		Route:     routeOf(req.Method, req.URL.Path),
+		Path:      req.URL.Path,
+		Resources: nil,
+		Status:    http.StatusOK,
+		Outcome:   AuditSuccess,
+	}
+}
+
+// auditCaller records who made an audited call once they are authenticated.
+func auditCaller(ctx context.Context, claims *auth.Claims) {
+	if entry, ok := ctx.Value(AuditEntryCtxKey).(*AuditEntry); ok && claims != nil {
+		entry.User = claims.Email
+		entry.Role = roleName(claims.Role)
+	}
+}
+
+// auditIDs returns the IDs named by a call: the ID in its route and the "id"
+// fields of its request and response bodies.
+func auditIDs(method, path string, bodies ...[]byte) []string {
+	ids := []string{}
+	seen := map[string]struct{}{}
+
+	add := func(id string) {
+		if _, ok := seen[id]; !ok && id != "" {
+			seen[id] = struct{}{}
+			ids = append(ids, id)
+		}
+	}
+
+	if routeOf(method, path) != "/api/v1/leases/plan" {
+		_, params := matchRoute(method, path)
+		add(params["id"])
+	}
+
+	for _, body := range bodies {
+		var data interface{}
+		if json.Unmarshal(body, &data) == nil {
+			jsonIDs(data, add)
+		}
+	}
+
+	return ids
+}
+
+// jsonIDs calls add with the value of every "id" field in the JSON data.
+func jsonIDs(data interface{}, add func(string)) {
+	switch v := data.(type) {
+	case map[string]interface{}:
+		if id, ok := v["id"].(string); ok {
+			add(id)
+		}
+
+		for _, value := range v {
+			jsonIDs(value, add)
+		}
+	case []interface{}:
+		for _, value := range v {
+			jsonIDs(value, add)
+		}
+	}
+}
+
+// handleAudit returns the audit entries selected by the query in the request
+// body, the latest ones of all users if there is none. Only users who may
+// write the audit log can read it.
+func handleAudit() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+
+		audit, ok := ctx.Value(AuditCtxKey).(*AuditLog)
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if !claims.Write(AuditKey) {
+			res.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		q := &AuditQuery{From: time.Time{}, To: time.Time{}, User: "", Limit: DefaultAuditLimit}
+		if err := readJSON(ctx, req, q); err != nil && !errors.Is(err, ErrEmptyBody) {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("audit log could not be read, could not read request")
+
+			return
+		}
+
+		if !q.To.IsZero() && q.To.Before(q.From) {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("audit log could not be read, invalid period")
+
+			return
+		}
+
+		entries, err := audit.Query(q)
+		if err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "audit log could not be read")
+
+			return
+		}
+
+		writeJSON(ctx, res, entries)
+	}
+}
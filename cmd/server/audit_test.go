@@ -0,0 +1,288 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeAuditLog(assert *assert.Assertions, root string, maxSize int64) *AuditLog {
+	assert.Nil(os.MkdirAll(root, os.ModePerm))
+
+	audit, err := NewAuditLog(&AuditConfig{Path: filepath.Join(root, "audit.jsonl"), MaxSize: maxSize, MaxFiles: 2})
+	assert.Nil(err)
+
+	return audit
+}
+
+func TestAuditLog(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_audit_log"
+
+	defer func() { os.RemoveAll(root) }()
+
+	audit := makeAuditLog(assert, root, 400)
+	start := time.Date(2022, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	for i := 0; i < 10; i++ {
+		user := "a@zebra"
+		if i%2 == 1 {
+			user = "b@zebra"
+		}
+
+		assert.Nil(audit.Write(&AuditEntry{
+			Time: start.Add(time.Duration(i) * time.Hour), RequestID: "r", User: user, Role: "user",
+			SourceIP: "127.0.0.1", Method: "POST", Route: "/api/v1/leases", Path: "/api/v1/leases",
+			Resources: []string{"id"}, Status: http.StatusOK, Outcome: AuditSuccess,
+		}))
+	}
+
+	assert.Nil(audit.Close())
+
+	// Files beyond the rotated ones are dropped
+	assert.FileExists(filepath.Join(root, "audit.jsonl.1"))
+	assert.FileExists(filepath.Join(root, "audit.jsonl.2"))
+	assert.NoFileExists(filepath.Join(root, "audit.jsonl.3"))
+
+	all, err := audit.Query(&AuditQuery{From: time.Time{}, To: time.Time{}, User: "", Limit: 0})
+	assert.Nil(err)
+	assert.NotEmpty(all)
+	assert.Less(len(all), 10)
+	assert.Equal(start.Add(9*time.Hour), all[len(all)-1].Time)
+
+	for i := 1; i < len(all); i++ {
+		assert.True(all[i-1].Time.Before(all[i].Time))
+	}
+
+	found, err := audit.Query(&AuditQuery{From: start.Add(8 * time.Hour), To: time.Time{}, User: "b@zebra", Limit: 0})
+	assert.Nil(err)
+	assert.Len(found, 1)
+	assert.Equal(start.Add(9*time.Hour), found[0].Time)
+
+	found, err = audit.Query(&AuditQuery{From: time.Time{}, To: start.Add(9 * time.Hour), User: "", Limit: 1})
+	assert.Nil(err)
+	assert.Len(found, 1)
+	assert.Equal(start.Add(8*time.Hour), found[0].Time)
+}
+
+func TestAuditIDs(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Equal([]string{"0100000001"}, auditIDs("POST", "/api/v1/leases/0100000001/extend", []byte(`{"by":"1h"}`)))
+	assert.ElementsMatch([]string{"a", "b", "c"},
+		auditIDs("POST", "/api/v1/resources", []byte(`{"compute.server":[{"id":"a"},{"id":"b"}]}`), []byte(`{"id":"c"}`)))
+	assert.Empty(auditIDs("POST", "/static/js/main.js", []byte("{")))
+	assert.Empty(auditIDs("POST", "/api/v1/leases/plan"))
+}
+
+func TestAuditAdapter(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_audit_adapter"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	audit := makeAuditLog(assert, root, DefaultAuditMaxSize)
+
+	h := auditAdapter()(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		// Stands in for auth, which tells the audit who made the call
+		claims, ok := req.Context().Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		auditCaller(req.Context(), claims)
+
+		// The body is still there for the handler
+		body := map[string]string{}
+		if readJSON(req.Context(), req, &body) != nil {
+			res.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		writeJSON(req.Context(), res, map[string]string{"id": "created"})
+	}))
+
+	request := func(method, body string, claims *auth.Claims) *httptest.ResponseRecorder {
+		req := makeClaimsRequest(assert, method, "/api/v1/leases/0100000001", body, api, claims)
+		req = req.Clone(context.WithValue(req.Context(), AuditCtxKey, audit))
+		req.RemoteAddr = "10.0.0.1:4242"
+		req.Header.Set(RequestIDHeader, "req-"+method)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := request("POST", `{"id":"sent"}`, userClaims(assert, "user@zebra"))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("req-POST", rr.Header().Get(RequestIDHeader))
+
+	assert.Equal(http.StatusBadRequest, request("DELETE", "{", adminClaims(assert)).Code)
+
+	// Reads are not audited
+	assert.Equal(http.StatusOK, request("GET", "{}", userClaims(assert, "user@zebra")).Code)
+
+	// Refused calls are
+	refused := createRequest(assert, "DELETE", "/api/v1/resources/0100000002", "{}", api)
+	refused = refused.Clone(context.WithValue(refused.Context(), AuditCtxKey, audit))
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, refused)
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	entries, err := audit.Query(&AuditQuery{From: time.Time{}, To: time.Time{}, User: "", Limit: 0})
+	assert.Nil(err)
+	assert.Len(entries, 3)
+
+	assert.Equal("req-POST", entries[0].RequestID)
+	assert.Equal("user@zebra", entries[0].User)
+	assert.Equal("user", entries[0].Role)
+	assert.Equal("10.0.0.1", entries[0].SourceIP)
+	assert.Equal("/api/v1/leases/:id", entries[0].Route)
+	assert.Equal([]string{"0100000001", "sent", "created"}, entries[0].Resources)
+	assert.Equal(AuditSuccess, entries[0].Outcome)
+
+	assert.Equal("admin@zebra", entries[1].User)
+	assert.Equal(http.StatusBadRequest, entries[1].Status)
+	assert.Equal(AuditFailure, entries[1].Outcome)
+
+	assert.Equal(AuditAnonymous, entries[2].User)
+	assert.Equal("/api/v1/resources/:id", entries[2].Route)
+	assert.Equal([]string{"0100000002"}, entries[2].Resources)
+	assert.Equal(http.StatusUnauthorized, entries[2].Status)
+	assert.Equal(AuditFailure, entries[2].Outcome)
+
+	// Without an audit log requests are only passed on, with a request ID
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/api/v1/leases", "{}", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.NotEmpty(rr.Header().Get(RequestIDHeader))
+}
+
+func TestAuditLogin(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_audit_login"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 0)
+	assert.Nil(api.Store.Create(makeUser(assert)))
+
+	audit := makeAuditLog(assert, root, DefaultAuditMaxSize)
+	h := auditAdapter()(loginAdapter()(nil))
+
+	login := func(password string) int {
+		body := fmt.Sprintf(`{"email":"email@domain","password":"%s"}`, password)
+		req := createRequest(assert, "POST", "/login", body, api)
+		ctx := context.WithValue(context.WithValue(req.Context(), AuditCtxKey, audit), AuthCtxKey, authKey)
+
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req.Clone(ctx))
+
+		return rr.Code
+	}
+
+	assert.Equal(http.StatusUnauthorized, login("wrong"))
+	assert.Equal(http.StatusOK, login(jiniWords))
+
+	entries, err := audit.Query(&AuditQuery{From: time.Time{}, To: time.Time{}, User: "", Limit: 0})
+	assert.Nil(err)
+	assert.Len(entries, 2)
+
+	assert.Equal(AuditAnonymous, entries[0].User)
+	assert.Equal("/login", entries[0].Route)
+	assert.Equal(AuditFailure, entries[0].Outcome)
+
+	assert.Equal("email@domain", entries[1].User)
+	assert.Equal("admin", entries[1].Role)
+	assert.Equal(AuditSuccess, entries[1].Outcome)
+}
+
+func TestAuditHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_audit_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	audit := makeAuditLog(assert, root, DefaultAuditMaxSize)
+	now := time.Now()
+
+	for _, user := range []string{"a@zebra", "b@zebra"} {
+		assert.Nil(audit.Write(&AuditEntry{
+			Time: now, RequestID: "r", User: user, Role: "user", SourceIP: "127.0.0.1", Method: "POST",
+			Route: "/api/v1/leases", Path: "/api/v1/leases", Resources: nil, Status: http.StatusOK,
+			Outcome: AuditSuccess,
+		}))
+	}
+
+	h := handleAudit()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, nil)
+	})
+
+	request := func(body string, claims *auth.Claims) *httptest.ResponseRecorder {
+		var req *http.Request
+		if claims == nil {
+			req = createRequest(assert, "GET", "/api/v1/audit", body, api)
+		} else {
+			req = makeClaimsRequest(assert, "GET", "/api/v1/audit", body, api, claims)
+		}
+
+		req = req.Clone(context.WithValue(req.Context(), AuditCtxKey, audit))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, createRequest(assert, "GET", "/api/v1/audit", "", api))
+	assert.Equal(http.StatusInternalServerError, rr.Code)
+
+	assert.Equal(http.StatusUnauthorized, request("", nil).Code)
+	assert.Equal(http.StatusForbidden, request("", userClaims(assert, "a@zebra")).Code)
+	assert.Equal(http.StatusBadRequest, request("{", adminClaims(assert)).Code)
+
+	b, err := json.Marshal(&AuditQuery{From: now, To: now.Add(-time.Hour), User: "", Limit: 0})
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, request(string(b), adminClaims(assert)).Code)
+
+	rr = request("{}", adminClaims(assert))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	entries := []AuditEntry{}
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), &entries))
+	assert.Len(entries, 2)
+
+	b, err = json.Marshal(&AuditQuery{From: now.Add(-time.Hour), To: now.Add(time.Hour), User: "b@zebra", Limit: 0})
+	assert.Nil(err)
+
+	rr = request(string(b), adminClaims(assert))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), &entries))
+	assert.Len(entries, 1)
+	assert.Equal("b@zebra", entries[0].User)
+}
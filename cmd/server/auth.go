@@ -4,23 +4,41 @@ import (
 	"context"
 	"encoding/base64"
 	"net/http"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/project-safari/zebra/auth"
 	"gojini.dev/web"
 )
 
+// authAdapter tries each way to authenticate a request in turn. A method that
+// does not apply to the request passes it on to the next one, a method that
+// refuses the request has written the response and ends the chain.
 func authAdapter() web.Adapter {
+	methods := []func(http.ResponseWriter, *http.Request) *http.Request{
+		signedRequest, rsaKey, apiToken, jwtClaims,
+	}
+
 	return func(nextHandler http.Handler) http.Handler {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
-			if nextReq := rsaKey(res, req); nextReq != nil {
-				callNext(nextHandler, res, req)
-			} else if nextReq := jwtClaims(res, req); nextReq != nil {
-				callNext(nextHandler, res, req)
-			} else {
-				// No auth token so return unautorized status
-				res.WriteHeader(http.StatusUnauthorized)
+			w := &statusWriter{ResponseWriter: res, status: 0}
+
+			for _, method := range methods {
+				if nextReq := method(w, req); nextReq != nil {
+					claims, _ := nextReq.Context().Value(ClaimsCtxKey).(*auth.Claims)
+					auditCaller(nextReq.Context(), claims)
+					callNext(nextHandler, res, nextReq)
+
+					return
+				}
+
+				if w.status != 0 {
+					return
+				}
 			}
+
+			// No auth token so return unautorized status
+			res.WriteHeader(http.StatusUnauthorized)
 		})
 	}
 }
@@ -33,6 +51,9 @@ func creds(r *http.Request) (string, string) {
 	return user, string(bt)
 }
 
+// rsaKey authenticates the legacy Zebra-Auth-Token, a signature of the user
+// email that never changes. It is refused unless the "signatures" section of
+// the configuration enables legacyAuth.
 func rsaKey(res http.ResponseWriter, req *http.Request) *http.Request {
 	ctx := req.Context()
 	log := logr.FromContextOrDiscard(ctx)
@@ -50,6 +71,13 @@ func rsaKey(res http.ResponseWriter, req *http.Request) *http.Request {
 		return nil
 	}
 
+	if signatures, ok := ctx.Value(SignaturesCtxKey).(*Signatures); ok && !signatures.Legacy() {
+		log.Error(nil, "legacy auth token refused", "user", userEmail)
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil
+	}
+
 	// Make sure the user still exists
 	user := findUser(api.Store, userEmail)
 	if user == nil {
@@ -104,7 +132,7 @@ func jwtClaims(res http.ResponseWriter, req *http.Request) *http.Request {
 	}
 
 	// Parse the claims
-	jwtClaims, err := auth.FromJWT(jwtCookie.Value, authKey)
+	jwtClaims, err := parseClaims(ctx, jwtCookie.Value, authKey)
 	if err != nil {
 		log.Error(err, "bad jwt token")
 		res.WriteHeader(http.StatusUnauthorized)
@@ -120,6 +148,16 @@ func jwtClaims(res http.ResponseWriter, req *http.Request) *http.Request {
 		return nil
 	}
 
+	// Make sure the session has not ended
+	if sessions, ok := ctx.Value(SessionsCtxKey).(*Sessions); ok {
+		if _, err := sessions.Check(jwtClaims, time.Now()); err != nil {
+			log.Error(err, "session ended", "user", jwtClaims.Subject)
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return nil
+		}
+	}
+
 	// Make sure the user still exists
 	user := findUser(api.Store, jwtClaims.Email)
 	if user == nil {
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+const DefaultCalendarRange = 7 * 24 * time.Hour
+
+// Booking is the time a resource is held by a lease.
+type Booking struct {
+	Lease string      `json:"lease"`
+	Owner string      `json:"owner"`
+	Phase lease.Phase `json:"phase"`
+	Start time.Time   `json:"start"`
+	End   time.Time   `json:"end"`
+}
+
+// Window is a period of time in which a resource is not booked.
+type Window struct {
+	Start time.Time `json:"start"`
+	End   time.Time `json:"end"`
+}
+
+// Calendar holds the bookings of every booked resource by resource ID. It is
+// derived from the scheduled and active leases.
+type Calendar map[string][]Booking
+
+// NewCalendar returns the calendar of all leases in the resource map.
+func NewCalendar(leases *zebra.ResourceMap) Calendar {
+	cal := Calendar{}
+
+	_ = applyFunc(leases, func(res zebra.Resource) error {
+		l, ok := res.(*lease.Lease)
+		if !ok || !l.Phase.Holds() {
+			return nil
+		}
+
+		b := Booking{Lease: l.Meta.ID, Owner: l.Owner(), Phase: l.Phase, Start: l.Start(), End: l.End()}
+
+		for _, req := range l.RequestList() {
+			for _, id := range req.Resources {
+				cal[id] = append(cal[id], b)
+			}
+		}
+
+		return nil
+	})
+
+	for id := range cal {
+		bookings := cal[id]
+		sort.Slice(bookings, func(i, j int) bool { return bookings[i].Start.Before(bookings[j].Start) })
+	}
+
+	return cal
+}
+
+// IsFree returns true if the resource has no booking overlapping the period.
+func (c Calendar) IsFree(id string, start, end time.Time) bool {
+	for _, b := range c[id] {
+		if b.Start.Before(end) && start.Before(b.End) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Bookings returns the bookings of the resource overlapping the period.
+func (c Calendar) Bookings(id string, start, end time.Time) []Booking {
+	bookings := []Booking{}
+
+	for _, b := range c[id] {
+		if b.Start.Before(end) && start.Before(b.End) {
+			bookings = append(bookings, b)
+		}
+	}
+
+	return bookings
+}
+
+// Windows returns the periods within start and end in which the resource is
+// not booked.
+func (c Calendar) Windows(id string, start, end time.Time) []Window {
+	windows := []Window{}
+	free := start
+
+	for _, b := range c.Bookings(id, start, end) {
+		if b.Start.After(free) {
+			windows = append(windows, Window{Start: free, End: b.Start})
+		}
+
+		if b.End.After(free) {
+			free = b.End
+		}
+	}
+
+	if free.Before(end) {
+		windows = append(windows, Window{Start: free, End: end})
+	}
+
+	return windows
+}
+
+// CalendarRequest selects the resources and the period to show availability
+// for. The period defaults to the coming week.
+type CalendarRequest struct {
+	Type    string        `json:"type"`
+	Group   string        `json:"group,omitempty"`
+	Filters []zebra.Query `json:"filters,omitempty"`
+	From    time.Time     `json:"from"`
+	To      time.Time     `json:"to"`
+}
+
+// ResourceCalendar is the availability of one resource.
+type ResourceCalendar struct {
+	ID        string          `json:"id"`
+	Name      string          `json:"name"`
+	Lifecycle zebra.Lifecycle `json:"lifecycle"`
+	Bookings  []Booking       `json:"bookings"`
+	Free      []Window        `json:"free"`
+}
+
+// handleCalendar returns the bookings and free windows of the resources of a
+// type that match the group and label filters. Resources of types the user may
+// not read are left out.
+func handleCalendar() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		calReq := new(CalendarRequest)
+		if err := readJSON(ctx, req, calReq); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("calendar could not be shown, could not read request")
+
+			return
+		}
+
+		if calReq.From.IsZero() {
+			calReq.From = time.Now()
+		}
+
+		if calReq.To.IsZero() {
+			calReq.To = calReq.From.Add(DefaultCalendarRange)
+		}
+
+		if err := validateQueries(calReq.Filters); err != nil || !calReq.From.Before(calReq.To) {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("calendar could not be shown, invalid request")
+
+			return
+		}
+
+		resReq := &lease.ResourceReq{Type: calReq.Type, Group: calReq.Group, Filters: calReq.Filters}
+		cal := api.Allocator.Calendar()
+		calendars := []ResourceCalendar{}
+
+		for _, r := range api.Allocator.matching(resReq) {
+			if !claims.Read(r.GetMeta().Type.Name) {
+				continue
+			}
+
+			id := r.GetMeta().ID
+			calendars = append(calendars, ResourceCalendar{
+				ID:        id,
+				Name:      r.GetMeta().Name,
+				Lifecycle: r.GetStatus().Lifecycle,
+				Bookings:  cal.Bookings(id, calReq.From, calReq.To),
+				Free:      cal.Windows(id, calReq.From, calReq.To),
+			})
+		}
+
+		sort.Slice(calendars, func(i, j int) bool { return calendars[i].Name < calendars[j].Name })
+
+		writeJSON(ctx, res, calendars)
+	}
+}
@@ -0,0 +1,113 @@
+package main //nolint:testpackage
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestCalendarWindows(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	day := time.Date(2030, 1, 1, 0, 0, 0, 0, time.UTC)
+	at := func(h int) time.Time { return day.Add(time.Duration(h) * time.Hour) }
+
+	cal := Calendar{"r1": {
+		{Lease: "a", Start: at(2), End: at(4)},
+		{Lease: "b", Start: at(3), End: at(6)},
+		{Lease: "c", Start: at(10), End: at(12)},
+	}}
+
+	assert.True(cal.IsFree("r1", at(0), at(2)))
+	assert.False(cal.IsFree("r1", at(5), at(7)))
+	assert.True(cal.IsFree("r2", at(5), at(7)))
+
+	assert.Len(cal.Bookings("r1", at(5), at(11)), 2)
+	assert.Equal([]Window{
+		{Start: at(0), End: at(2)},
+		{Start: at(6), End: at(10)},
+		{Start: at(12), End: at(24)},
+	}, cal.Windows("r1", at(0), at(24)))
+	assert.Equal([]Window{}, cal.Windows("r1", at(2), at(6)))
+	assert.Equal([]Window{{Start: at(0), End: at(24)}}, cal.Windows("r2", at(0), at(24)))
+}
+
+func TestCalendarHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_calendar_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	start := time.Now().Add(24 * time.Hour)
+
+	l := serverLease("demo@zebra", 1)
+	l.StartTime = start
+	assert.Nil(api.Allocator.Allocate(l))
+
+	h := handleCalendar()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, httprouter.Params{})
+	})
+
+	from, err := json.Marshal(start.Add(-time.Hour))
+	assert.Nil(err)
+
+	rr := httptest.NewRecorder()
+	body := fmt.Sprintf(`{"type":"compute.server","from":%s}`, from)
+	handler.ServeHTTP(rr, createRequest(assert, "GET", "/api/v1/calendar", body, api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	user := userClaims(assert, "user@zebra")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/api/v1/calendar", body, api, user))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	calendars := []ResourceCalendar{}
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), &calendars))
+	assert.Len(calendars, 2)
+
+	for _, c := range calendars {
+		if c.ID == l.Request[0].Resources[0] {
+			assert.Len(c.Bookings, 1)
+			assert.Equal("demo@zebra", c.Bookings[0].Owner)
+			assert.Len(c.Free, 2)
+		} else {
+			assert.Empty(c.Bookings)
+			assert.Len(c.Free, 1)
+		}
+	}
+
+	rr = httptest.NewRecorder()
+	body = fmt.Sprintf(`{"type":"compute.server","from":%s,"to":%s}`, from, from)
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/api/v1/calendar", body, api, user))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/api/v1/calendar", "{", api, user))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	// Nor resources a token may not read
+	network, err := auth.NewPriv(`network\..*`, false, true, false, false)
+	assert.Nil(err)
+
+	user.Scope = &auth.Role{Name: "token:ci", Privileges: []*auth.Priv{network}}
+	body = fmt.Sprintf(`{"type":"compute.server","from":%s}`, from)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/api/v1/calendar", body, api, user))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("[]", rr.Body.String())
+}
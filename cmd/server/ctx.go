@@ -3,7 +3,15 @@ package main
 type CtxKey string
 
 const (
-	ResourcesCtxKey = CtxKey("resources")
-	AuthCtxKey      = CtxKey("authKey")
-	ClaimsCtxKey    = CtxKey("claims")
+	ResourcesCtxKey  = CtxKey("resources")
+	AuthCtxKey       = CtxKey("authKey")
+	ClaimsCtxKey     = CtxKey("claims")
+	HealthCtxKey     = CtxKey("health")
+	MetricsCtxKey    = CtxKey("metrics")
+	AuditCtxKey      = CtxKey("audit")
+	AuditEntryCtxKey = CtxKey("auditEntry")
+	SessionsCtxKey   = CtxKey("sessions")
+	KeysCtxKey       = CtxKey("keys")
+	SignaturesCtxKey = CtxKey("signatures")
+	TokensCtxKey     = CtxKey("tokens")
 )
@@ -0,0 +1,26 @@
+package main
+
+import (
+	"time"
+)
+
+// Duration is a time.Duration that is read from the server configuration as a
+// string such as "30s" or "4h".
+type Duration struct {
+	time.Duration
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	v, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+
+	d.Duration = v
+
+	return nil
+}
@@ -0,0 +1,27 @@
+package main //nolint:testpackage
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDuration(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	d := struct {
+		D Duration `json:"d"`
+	}{}
+
+	assert.Nil(json.Unmarshal([]byte(`{"d": "90s"}`), &d))
+	assert.Equal(90*time.Second, d.D.Duration)
+
+	b, err := json.Marshal(d)
+	assert.Nil(err)
+	assert.Equal(`{"d":"1m30s"}`, string(b))
+
+	assert.NotNil(json.Unmarshal([]byte(`{"d": "forever"}`), &d))
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/inventory"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/project-safari/zebra/model/user"
+)
+
+// ExportRequest selects the resources to export like a query request and
+// names the format to write them in.
+type ExportRequest struct {
+	QueryRequest
+	Format string `json:"format"`
+}
+
+// handleExport writes the selected resources as CSV, YAML, NDJSON or an Ansible
+// inventory. Users are never exported, leases only when asked for by type and
+// other resources only when the caller may read their type.
+func handleExport() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		exportReq := &ExportRequest{QueryRequest: QueryRequest{}, Format: inventory.FormatYAML}
+
+		if err := readJSON(ctx, req, exportReq); err != nil && !errors.Is(err, ErrEmptyBody) {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resources could not be exported, could not read request")
+
+			return
+		}
+
+		if err := exportReq.Validate(ctx); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resources could not be exported, found invalid quer(y/ies)")
+
+			return
+		}
+
+		resources := []zebra.Resource{}
+		_ = applyFunc(api.query(&exportReq.QueryRequest), func(r zebra.Resource) error {
+			resType := r.GetMeta().Type.Name
+			if resType == user.Type().Name || !claims.Read(resType) ||
+				(resType == lease.Type().Name && !zebra.IsIn(resType, exportReq.Types)) {
+				return nil
+			}
+
+			resources = append(resources, r)
+
+			return nil
+		})
+
+		buf := new(bytes.Buffer)
+		if err := inventory.Write(buf, exportReq.Format, resources); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("resources could not be exported", "error", err.Error())
+
+			return
+		}
+
+		res.Header().Set("Content-Type", inventory.ContentType(exportReq.Format))
+		res.WriteHeader(http.StatusOK)
+
+		if _, err := res.Write(buf.Bytes()); err != nil {
+			log.Error(err, "error writing response")
+
+			return
+		}
+
+		log.Info("successfully exported resources", "format", exportReq.Format, "count", len(resources))
+	}
+}
@@ -0,0 +1,82 @@
+package main //nolint:testpackage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/network"
+	"github.com/project-safari/zebra/model/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestExport(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_export"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	for _, v := range network.MockVLANPool(1) {
+		assert.Nil(api.Store.Create(v))
+	}
+
+	key, err := auth.Generate()
+	assert.Nil(err)
+	assert.Nil(api.Store.Create(user.NewUser("jdoe", "jdoe@zebra", "Riddikulus!1", key.Public(), DefaultRole())))
+
+	h := handleExport()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, httprouter.Params{})
+	})
+
+	claims := userClaims(assert, "jdoe@zebra")
+	export := func(body string) *httptest.ResponseRecorder {
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/api/v1/export", body, api, claims))
+
+		return rr
+	}
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, createRequest(assert, "GET", "/api/v1/export", "{}", api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	// Defaults to yaml, users are never exported
+	rr = export("{}")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("application/yaml", rr.Header().Get("Content-Type"))
+	assert.Equal(2, strings.Count(rr.Body.String(), "type: compute.server"))
+	assert.Equal(1, strings.Count(rr.Body.String(), "type: network.vlanPool"))
+	assert.NotContains(rr.Body.String(), "jdoe")
+
+	rr = export(`{"format":"csv","types":["compute.server"]}`)
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("text/csv", rr.Header().Get("Content-Type"))
+	assert.Len(strings.Split(strings.TrimSpace(rr.Body.String()), "\n"), 3)
+
+	rr = export(`{"format":"ansible-ini","labels":[{"key":"system.group","op":"==","values":["nowhere"]}]}`)
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("", rr.Body.String())
+
+	assert.Equal(http.StatusBadRequest, export(`{"format":"xml"}`).Code)
+	assert.Equal(http.StatusBadRequest, export(`{"format":"csv","ids":["x"],"types":["y"]}`).Code)
+	assert.Equal(http.StatusBadRequest, export("{").Code)
+
+	// A token only exports the types in its scope
+	compute, err := auth.NewPriv(`compute\..*`, false, true, false, false)
+	assert.Nil(err)
+
+	claims.Scope = &auth.Role{Name: "token:ci", Privileges: []*auth.Priv{compute}}
+
+	rr = export("{}")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal(2, strings.Count(rr.Body.String(), "type: compute.server"))
+	assert.NotContains(rr.Body.String(), "network.vlanPool")
+}
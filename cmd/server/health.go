@@ -0,0 +1,299 @@
+package main
+
+import (
+	"context"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model"
+)
+
+const (
+	DefaultHealthInterval = time.Minute
+	DefaultProbeTimeout   = 2 * time.Second
+	MaxParallelProbes     = 16
+)
+
+// ProbeConfig describes how resources of one type are probed. A resource is
+// reachable when a TCP connection can be made to every port.
+type ProbeConfig struct {
+	Ports   []int    `json:"ports"`
+	Timeout Duration `json:"timeout"`
+}
+
+// HealthConfig is the "health" section of the server configuration. Faults are
+// raised after the given number of consecutive failed probes.
+type HealthConfig struct {
+	Interval      Duration               `json:"interval"`
+	MinorAfter    int                    `json:"minorAfter"`
+	MajorAfter    int                    `json:"majorAfter"`
+	CriticalAfter int                    `json:"criticalAfter"`
+	Probes        map[string]ProbeConfig `json:"probes"`
+}
+
+func DefaultHealthConfig() *HealthConfig {
+	return &HealthConfig{
+		Interval:      Duration{DefaultHealthInterval},
+		MinorAfter:    1,
+		MajorAfter:    3,
+		CriticalAfter: 5,
+		Probes:        map[string]ProbeConfig{},
+	}
+}
+
+// Fault returns the fault level for the given number of consecutive failures.
+func (c *HealthConfig) Fault(failures int) zebra.Fault {
+	switch {
+	case failures == 0:
+		return zebra.None
+	case failures >= c.CriticalAfter:
+		return zebra.Critical
+	case failures >= c.MajorAfter:
+		return zebra.Major
+	case failures >= c.MinorAfter:
+		return zebra.Minor
+	}
+
+	return zebra.None
+}
+
+// HealthRecord is the latest reachability information of a resource. Fault is
+// the level the health checker has raised on the resource.
+type HealthRecord struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"`
+	Address   string        `json:"address"`
+	Reachable bool          `json:"reachable"`
+	Latency   time.Duration `json:"latency"`
+	LastSeen  time.Time     `json:"lastSeen"`
+	LastProbe time.Time     `json:"lastProbe"`
+	Failures  int           `json:"failures"`
+	Fault     zebra.Fault   `json:"fault"`
+	Error     string        `json:"error,omitempty"`
+}
+
+type dialFunc func(ctx context.Context, network, address string) (net.Conn, error)
+
+// HealthChecker periodically probes the management addresses of resources and
+// raises or clears their fault based on the number of consecutive failures.
+type HealthChecker struct {
+	lock    sync.RWMutex
+	cfg     *HealthConfig
+	api     *ResourceAPI
+	records map[string]*HealthRecord
+	dial    dialFunc
+}
+
+func NewHealthChecker(cfg *HealthConfig, api *ResourceAPI) *HealthChecker {
+	dialer := new(net.Dialer)
+
+	if cfg.Interval.Duration <= 0 {
+		cfg.Interval.Duration = DefaultHealthInterval
+	}
+
+	return &HealthChecker{
+		lock:    sync.RWMutex{},
+		cfg:     cfg,
+		api:     api,
+		records: make(map[string]*HealthRecord),
+		dial:    dialer.DialContext,
+	}
+}
+
+// Run probes all resources every interval until the context is done.
+func (h *HealthChecker) Run(ctx context.Context) {
+	ticker := time.NewTicker(h.cfg.Interval.Duration)
+	defer ticker.Stop()
+
+	for {
+		h.CheckAll(ctx)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// CheckAll probes every resource of the configured types once.
+func (h *HealthChecker) CheckAll(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	slots := make(chan struct{}, MaxParallelProbes)
+
+	for resType, probe := range h.cfg.Probes {
+		resMap := h.api.Store.QueryType([]string{resType})
+
+		_ = applyFunc(resMap, func(res zebra.Resource) error {
+			addr := model.ManagementIP(res)
+			if addr == nil {
+				return nil
+			}
+
+			wg.Add(1)
+			slots <- struct{}{}
+
+			go func(res zebra.Resource, probe ProbeConfig) {
+				defer func() {
+					<-slots
+					wg.Done()
+				}()
+
+				latency, err := h.probe(ctx, addr, probe)
+				h.record(ctx, res, addr, latency, err)
+			}(res, probe)
+
+			return nil
+		})
+	}
+
+	wg.Wait()
+}
+
+// Records returns the health records of all probed resources.
+func (h *HealthChecker) Records() []HealthRecord {
+	h.lock.RLock()
+	defer h.lock.RUnlock()
+
+	records := make([]HealthRecord, 0, len(h.records))
+	for _, r := range h.records {
+		records = append(records, *r)
+	}
+
+	sort.Slice(records, func(i, j int) bool { return records[i].ID < records[j].ID })
+
+	return records
+}
+
+// probe connects to every port of the probe config and returns the slowest
+// connect time.
+func (h *HealthChecker) probe(ctx context.Context, addr net.IP, probe ProbeConfig) (time.Duration, error) {
+	timeout := probe.Timeout.Duration
+	if timeout == 0 {
+		timeout = DefaultProbeTimeout
+	}
+
+	var latency time.Duration
+
+	for _, port := range probe.Ports {
+		dialCtx, cancel := context.WithTimeout(ctx, timeout)
+		start := time.Now()
+		conn, err := h.dial(dialCtx, "tcp", net.JoinHostPort(addr.String(), strconv.Itoa(port)))
+
+		cancel()
+
+		if err != nil {
+			return 0, err
+		}
+
+		_ = conn.Close()
+
+		if d := time.Since(start); d > latency {
+			latency = d
+		}
+	}
+
+	return latency, nil
+}
+
+func (h *HealthChecker) record(ctx context.Context, res zebra.Resource, addr net.IP,
+	latency time.Duration, err error,
+) {
+	log := logr.FromContextOrDiscard(ctx)
+	meta := res.GetMeta()
+
+	h.lock.Lock()
+
+	rec, ok := h.records[meta.ID]
+	if !ok {
+		rec = &HealthRecord{ID: meta.ID, Type: meta.Type.Name}
+		h.records[meta.ID] = rec
+	}
+
+	rec.Address = addr.String()
+	rec.LastProbe = time.Now()
+	rec.Reachable = err == nil
+
+	if err == nil {
+		rec.Latency = latency
+		rec.LastSeen = rec.LastProbe
+		rec.Failures = 0
+		rec.Error = ""
+	} else {
+		rec.Failures++
+		rec.Error = err.Error()
+	}
+
+	failures := rec.Failures
+	raised := rec.Fault
+
+	h.lock.Unlock()
+
+	fault := h.cfg.Fault(failures)
+	current := res.GetStatus().Fault
+
+	if fault == raised && fault == current {
+		return
+	}
+
+	// Only touch faults that the health checker raised itself, so that a fault
+	// set by someone else is not lowered or cleared by a good probe.
+	changed, e := h.api.Allocator.ChangeFault(res, raised, fault)
+	if e != nil {
+		log.Error(e, "fault could not be stored", "id", meta.ID)
+
+		return
+	}
+
+	if !changed {
+		fault = zebra.None
+	}
+
+	h.lock.Lock()
+	rec.Fault = fault
+	h.lock.Unlock()
+
+	if changed && fault != current {
+		log.Info("resource fault changed", "id", meta.ID, "fault", fault.String(), "failures", failures)
+	}
+}
+
+// handleHealth returns the health records of the resources of the types the
+// user may read.
+func handleHealth() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		records := []HealthRecord{}
+
+		checker, ok := ctx.Value(HealthCtxKey).(*HealthChecker)
+		if !ok || checker == nil {
+			writeJSON(ctx, res, records)
+
+			return
+		}
+
+		for _, r := range checker.Records() {
+			if claims.Read(r.Type) {
+				records = append(records, r)
+			}
+		}
+
+		writeJSON(ctx, res, records)
+	}
+}
@@ -0,0 +1,184 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestHealthConfigFault(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfg := DefaultHealthConfig()
+	assert.Equal(zebra.None, cfg.Fault(0))
+	assert.Equal(zebra.Minor, cfg.Fault(1))
+	assert.Equal(zebra.Minor, cfg.Fault(2))
+	assert.Equal(zebra.Major, cfg.Fault(3))
+	assert.Equal(zebra.Critical, cfg.Fault(5))
+	assert.Equal(zebra.Critical, cfg.Fault(50))
+}
+
+func TestHealthChecker(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_health_checker"
+
+	defer func() { os.RemoveAll(root) }()
+
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	assert.Nil(err)
+
+	port := listener.Addr().(*net.TCPAddr).Port
+
+	api := makeLeaseAPI(assert, root, 0)
+	server, ok := compute.MockServer(1)[0].(*compute.Server)
+	assert.True(ok)
+
+	server.BoardIP = net.IPv4(127, 0, 0, 1)
+	assert.Nil(api.Store.Create(server))
+
+	cfg := DefaultHealthConfig()
+	cfg.MajorAfter = 2
+	cfg.CriticalAfter = 3
+	cfg.Probes["compute.server"] = ProbeConfig{Ports: []int{port}, Timeout: Duration{time.Second}}
+
+	checker := NewHealthChecker(cfg, api)
+	ctx := context.Background()
+
+	checker.CheckAll(ctx)
+
+	records := checker.Records()
+	assert.Len(records, 1)
+	assert.True(records[0].Reachable)
+	assert.Equal(0, records[0].Failures)
+	assert.False(records[0].LastSeen.IsZero())
+	assert.Equal(zebra.None, findResource(api.Store, server.Meta.ID).GetStatus().Fault)
+
+	// Nobody is listening anymore
+	assert.Nil(listener.Close())
+
+	expected := []zebra.Fault{zebra.Minor, zebra.Major, zebra.Critical, zebra.Critical}
+	for i, fault := range expected {
+		checker.CheckAll(ctx)
+
+		records = checker.Records()
+		assert.False(records[0].Reachable)
+		assert.Equal(i+1, records[0].Failures)
+		assert.NotEmpty(records[0].Error)
+		assert.Equal(fault, findResource(api.Store, server.Meta.ID).GetStatus().Fault)
+	}
+
+	// Faulted resources are not leased
+	assert.ErrorIs(api.Allocator.Allocate(serverLease("user@zebra", 1)), ErrAllocate)
+
+	// Recovery clears the fault, the port may have been taken in the meantime
+	listener, err = net.Listen("tcp", net.JoinHostPort("127.0.0.1", strconv.Itoa(port)))
+	if err == nil {
+		defer listener.Close()
+
+		checker.CheckAll(ctx)
+		assert.Equal(zebra.None, findResource(api.Store, server.Meta.ID).GetStatus().Fault)
+		assert.Nil(api.Allocator.Allocate(serverLease("user@zebra", 1)))
+	}
+}
+
+func TestHealthKeepsFaults(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_health_keeps_faults"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	a := api.Allocator
+	l := serverLease("user@zebra", 1)
+	assert.Nil(a.Allocate(l))
+
+	// A failed setup hook faults the server
+	server := findResource(api.Store, l.Request[0].Resources[0])
+	assert.Nil(a.fault(server, "zebra"))
+	assert.Equal(zebra.Major, server.GetStatus().Fault)
+
+	checker := NewHealthChecker(DefaultHealthConfig(), api)
+	ctx := context.Background()
+	addr := net.IPv4(127, 0, 0, 1)
+	unreachable := errors.New("unreachable")
+
+	// Neither a failed nor a good probe lowers it
+	checker.record(ctx, server, addr, 0, unreachable)
+	assert.Equal(zebra.Major, server.GetStatus().Fault)
+	assert.Equal(zebra.None, checker.Records()[0].Fault)
+
+	checker.record(ctx, server, addr, time.Millisecond, nil)
+	assert.Equal(zebra.Major, server.GetStatus().Fault)
+	assert.ErrorIs(a.Allocate(serverLease("user@zebra", 1)), ErrAllocate)
+}
+
+func TestHealthHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_health_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	h := handleHealth()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, nil)
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, createRequest(assert, "GET", "/api/v1/health", "", api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	user := userClaims(assert, "user@zebra")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/api/v1/health", "", api, user))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("[]", rr.Body.String())
+
+	checker := NewHealthChecker(DefaultHealthConfig(), api)
+	checker.records["x"] = &HealthRecord{ID: "x", Type: "compute.server", Reachable: true}
+	checker.records["y"] = &HealthRecord{ID: "y", Type: "network.switch", Reachable: true}
+
+	health := func(claims *auth.Claims) []HealthRecord {
+		req := makeClaimsRequest(assert, "GET", "/api/v1/health", "", api, claims)
+		req = req.Clone(context.WithValue(req.Context(), HealthCtxKey, checker))
+		rr := httptest.NewRecorder()
+		handler.ServeHTTP(rr, req)
+		assert.Equal(http.StatusOK, rr.Code)
+
+		records := []HealthRecord{}
+		assert.Nil(json.Unmarshal(rr.Body.Bytes(), &records))
+
+		return records
+	}
+
+	assert.Len(health(user), 2)
+
+	// Tokens only see the types in their scope
+	compute, err := auth.NewPriv(`compute\..*`, false, true, false, false)
+	assert.Nil(err)
+
+	user.Scope = &auth.Role{Name: "token:ci", Privileges: []*auth.Priv{compute}}
+	records := health(user)
+	assert.Len(records, 1)
+	assert.Equal("x", records[0].ID)
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+const DefaultIdleTimeout = 30 * time.Minute
+
+// HeartbeatConfig is the "heartbeats" section of the server configuration. An
+// active lease that needs heartbeats is warned about once it misses one and
+// released once it has missed them for IdleTimeout more.
+type HeartbeatConfig struct {
+	IdleTimeout Duration `json:"idleTimeout"`
+}
+
+func DefaultHeartbeatConfig() *HeartbeatConfig {
+	return &HeartbeatConfig{IdleTimeout: Duration{DefaultIdleTimeout}}
+}
+
+// SetIdleTimeout sets how long leases may miss heartbeats before they are
+// released.
+func (a *Allocator) SetIdleTimeout(timeout time.Duration) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.idleTimeout = timeout
+}
+
+// Heartbeat records a heartbeat of an active lease.
+func (a *Allocator) Heartbeat(l *lease.Lease, now time.Time) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err := l.Beat(now); err != nil {
+		return err
+	}
+
+	return a.store.Create(l)
+}
+
+// ReleaseIdle emits a lease.idle event, once per missed heartbeat, for active
+// leases that missed a heartbeat and releases the leases that have been idle
+// for the idle timeout since.
+func (a *Allocator) ReleaseIdle(now time.Time) ([]*lease.Lease, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	released := []*lease.Lease{}
+
+	for _, l := range a.leases(lease.Activated) {
+		idle := l.Idle(now)
+		if idle <= l.HeartbeatInterval {
+			continue
+		}
+
+		if idle > l.HeartbeatInterval+a.idleTimeout {
+			if err := a.release(l, "zebra"); err != nil {
+				return released, err
+			}
+
+			a.webhooks.Emit(EventLeaseIdleReleased, l)
+
+			released = append(released, l)
+
+			continue
+		}
+
+		if warned, ok := a.idleWarned[l.Meta.ID]; !ok || !warned.Equal(l.LastHeartbeat) {
+			a.idleWarned[l.Meta.ID] = l.LastHeartbeat
+			a.webhooks.Emit(EventLeaseIdle, l)
+		}
+	}
+
+	return released, nil
+}
+
+// handleHeartbeat records a heartbeat of a lease. Only the owner of the lease
+// or a user who can write leases may send heartbeats for it.
+func handleHeartbeat() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		l, ok := findResource(api.Store, params.ByName("id")).(*lease.Lease)
+		if !ok {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if l.Owner() != claims.Email && !claims.Write(lease.Type().Name) {
+			res.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		if err := api.Allocator.Heartbeat(l, time.Now()); err != nil {
+			if errors.Is(err, lease.ErrNotActive) {
+				res.WriteHeader(http.StatusConflict)
+
+				return
+			}
+
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "lease heartbeat could not be stored", "id", l.Meta.ID)
+
+			return
+		}
+
+		writeJSON(ctx, res, l)
+	}
+}
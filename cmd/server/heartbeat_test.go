@@ -0,0 +1,129 @@
+package main //nolint:testpackage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestReleaseIdle(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_release_idle"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 3)
+	a := api.Allocator
+	a.SetIdleTimeout(10 * time.Minute)
+
+	l := serverLease("user@zebra", 1)
+	l.HeartbeatInterval = time.Minute
+	assert.Nil(a.Allocate(l))
+	assert.Equal(l.ActivationTime, l.LastHeartbeat)
+
+	// Leases without heartbeats are never idle
+	other := serverLease("other@zebra", 1)
+	assert.Nil(a.Allocate(other))
+
+	start := l.LastHeartbeat
+
+	released, err := a.ReleaseIdle(start.Add(30 * time.Second))
+	assert.Nil(err)
+	assert.Empty(released)
+	assert.Empty(a.idleWarned)
+
+	// A missed heartbeat is warned about once
+	released, err = a.ReleaseIdle(start.Add(2 * time.Minute))
+	assert.Nil(err)
+	assert.Empty(released)
+	assert.Equal(start, a.idleWarned[l.Meta.ID])
+
+	assert.Nil(a.Heartbeat(l, start.Add(3*time.Minute)))
+	assert.Equal(start.Add(3*time.Minute), l.LastHeartbeat)
+
+	released, err = a.ReleaseIdle(start.Add(4 * time.Minute))
+	assert.Nil(err)
+	assert.Empty(released)
+
+	// Warnings are forgotten when the owner releases the lease
+	mine := serverLease("user@zebra", 1)
+	mine.HeartbeatInterval = time.Minute
+	assert.Nil(a.Allocate(mine))
+
+	_, err = a.ReleaseIdle(mine.LastHeartbeat.Add(2 * time.Minute))
+	assert.Nil(err)
+	assert.Contains(a.idleWarned, mine.Meta.ID)
+	assert.Nil(a.Release(mine, "user@zebra"))
+	assert.NotContains(a.idleWarned, mine.Meta.ID)
+
+	// Idle for longer than the timeout
+	released, err = a.ReleaseIdle(start.Add(15 * time.Minute))
+	assert.Nil(err)
+	assert.Len(released, 1)
+	assert.Equal(lease.Released, l.Phase)
+	assert.Equal(lease.Activated, other.Phase)
+	assert.Empty(a.idleWarned)
+
+	assert.ErrorIs(a.Heartbeat(l, start.Add(16*time.Minute)), lease.ErrNotActive)
+}
+
+func TestHeartbeatHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_heartbeat_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+
+	l := serverLease("user@zebra", 1)
+	l.HeartbeatInterval = time.Minute
+	assert.Nil(api.Allocator.Allocate(l))
+
+	h := handleHeartbeat()
+	handler := func(id string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			h(w, r, httprouter.Params{{Key: "id", Value: id}})
+		}
+	}
+
+	rr := httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, createRequest(assert, "POST", "/", "", api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler("unknown").ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", "", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", "", api,
+		userClaims(assert, "other@zebra")))
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	last := l.LastHeartbeat
+
+	rr = httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", "", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.True(l.LastHeartbeat.After(last))
+
+	// Admins may keep any lease alive
+	rr = httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", "", api, adminClaims(assert)))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	assert.Nil(api.Allocator.Release(l, "user@zebra"))
+
+	rr = httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", "", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusConflict, rr.Code)
+}
@@ -0,0 +1,370 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os/exec"
+	"sync"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+// Hooks run on resources of a lease.
+const (
+	HookSetup    = "setup"
+	HookTeardown = "teardown"
+)
+
+const (
+	DefaultHookTimeout = 5 * time.Minute
+	MaxHookOutput      = 4096
+)
+
+var ErrHook = errors.New("hook failed")
+
+// HookAction is a command to run or a URL to post to. The hook payload, the
+// lease and the resource as JSON, is written to the standard input of the
+// command or posted as the request body. The hook succeeds if the command exits
+// with status 0, or the URL answers with a 2xx status, within the timeout.
+type HookAction struct {
+	Command []string `json:"command,omitempty"`
+	URL     string   `json:"url,omitempty"`
+	Timeout Duration `json:"timeout"`
+}
+
+// TypeHooks are the hooks run on resources of one type. Setup runs when a
+// resource is handed to a lease and Teardown when the lease gives it back.
+type TypeHooks struct {
+	Setup    *HookAction `json:"setup,omitempty"`
+	Teardown *HookAction `json:"teardown,omitempty"`
+}
+
+// HookConfig is the "hooks" section of the server configuration, it maps
+// resource types to their hooks.
+type HookConfig struct {
+	Types map[string]TypeHooks `json:"types"`
+}
+
+func DefaultHookConfig() *HookConfig {
+	return &HookConfig{Types: map[string]TypeHooks{}}
+}
+
+// Action returns the action of a hook for resources of a type, nil if there is
+// none.
+func (c *HookConfig) Action(resType, hook string) *HookAction {
+	if c == nil {
+		return nil
+	}
+
+	hooks, ok := c.Types[resType]
+	if !ok {
+		return nil
+	}
+
+	if hook == HookSetup {
+		return hooks.Setup
+	}
+
+	return hooks.Teardown
+}
+
+// HookPayload is the input of a hook.
+type HookPayload struct {
+	Hook     string          `json:"hook"`
+	Lease    json.RawMessage `json:"lease"`
+	Resource zebra.Resource  `json:"resource"`
+}
+
+// Run runs the action and returns its output, cut to MaxHookOutput bytes.
+func (h *HookAction) Run(ctx context.Context, payload []byte) (string, error) {
+	timeout := h.Timeout.Duration
+	if timeout <= 0 {
+		timeout = DefaultHookTimeout
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	var (
+		out []byte
+		err error
+	)
+
+	switch {
+	case len(h.Command) > 0:
+		cmd := exec.CommandContext(ctx, h.Command[0], h.Command[1:]...) //nolint:gosec
+		cmd.Stdin = bytes.NewReader(payload)
+		out, err = cmd.CombinedOutput()
+	case h.URL != "":
+		out, err = h.post(ctx, payload)
+	}
+
+	if len(out) > MaxHookOutput {
+		out = out[:MaxHookOutput]
+	}
+
+	if ctx.Err() != nil {
+		err = ctx.Err()
+	}
+
+	if err != nil {
+		return string(out), fmt.Errorf("%w: %s", ErrHook, err.Error())
+	}
+
+	return string(out), nil
+}
+
+func (h *HookAction) post(ctx context.Context, payload []byte) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, h.URL, bytes.NewReader(payload))
+	if err != nil {
+		return nil, err
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "zebra-hook")
+
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return nil, err
+	}
+
+	defer resp.Body.Close()
+
+	out, err := io.ReadAll(io.LimitReader(resp.Body, MaxHookOutput))
+	if err != nil {
+		return out, err
+	}
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return out, fmt.Errorf("%w: %s", ErrHook, resp.Status)
+	}
+
+	return out, nil
+}
+
+// SetHooks sets the setup and teardown hooks run on leased resources.
+func (a *Allocator) SetHooks(cfg *HookConfig) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.hooks = cfg
+}
+
+// WaitHooks waits until all running hooks have finished.
+func (a *Allocator) WaitHooks() {
+	a.running.Wait()
+}
+
+// hooked returns the resources of a type with the given hook.
+func (a *Allocator) hooked(hook string, resources []zebra.Resource) []zebra.Resource {
+	hooked := []zebra.Resource{}
+
+	for _, res := range resources {
+		if a.hooks.Action(res.GetMeta().Type.Name, hook) != nil {
+			hooked = append(hooked, res)
+		}
+	}
+
+	return hooked
+}
+
+// runHooks runs a hook on the resources of a lease in the background, the
+// resources are held in the setup state meanwhile. Once all of them have
+// finished, done is called with the allocator lock held.
+func (a *Allocator) runHooks(hook string, l *lease.Lease, resources []zebra.Resource,
+	done func(*lease.Lease, []zebra.Resource, []lease.HookResult) error,
+) error {
+	leaseData, err := json.Marshal(l)
+	if err != nil {
+		return err
+	}
+
+	actions := make([]*HookAction, len(resources))
+	payloads := make([][]byte, len(resources))
+
+	for i, res := range resources {
+		actions[i] = a.hooks.Action(res.GetMeta().Type.Name, hook)
+		res.UpdateStatus().LeaseStatus = zebra.Setup
+
+		if err := a.store.Create(res); err != nil {
+			return err
+		}
+
+		payloads[i], err = json.Marshal(HookPayload{Hook: hook, Lease: leaseData, Resource: res})
+		if err != nil {
+			return err
+		}
+	}
+
+	a.running.Add(1)
+
+	go func() {
+		defer a.running.Done()
+
+		results := runActions(hook, resources, actions, payloads)
+
+		a.lock.Lock()
+		defer a.lock.Unlock()
+
+		_ = done(l, resources, results)
+	}()
+
+	return nil
+}
+
+// runActions runs the hook actions of all resources in parallel.
+func runActions(hook string, resources []zebra.Resource, actions []*HookAction, payloads [][]byte,
+) []lease.HookResult {
+	wg := sync.WaitGroup{}
+	results := make([]lease.HookResult, len(resources))
+
+	for i, res := range resources {
+		wg.Add(1)
+
+		go func(i int, id string) {
+			defer wg.Done()
+
+			out, err := actions[i].Run(context.Background(), payloads[i])
+			results[i] = lease.HookResult{Resource: id, Hook: hook, Output: out, Time: time.Now()}
+
+			if err != nil {
+				results[i].Error = err.Error()
+			}
+		}(i, res.GetMeta().ID)
+	}
+
+	wg.Wait()
+
+	return results
+}
+
+// finishSetup records the setup results on the lease. If all resources have
+// been set up the lease is activated. Resources that failed are faulted and
+// given back, the others are torn down and the lease is queued again so that it
+// gets healthy resources.
+func (a *Allocator) finishSetup(l *lease.Lease, resources []zebra.Resource, results []lease.HookResult) error {
+	l.RecordHooks(results)
+
+	if l.Phase != lease.SettingUp {
+		// the lease has been released while it was being set up
+		return a.store.Create(l)
+	}
+
+	failed := false
+
+	for i, res := range resources {
+		status := res.UpdateStatus()
+
+		if results[i].Error == "" {
+			status.LeaseStatus = zebra.Leased
+		} else {
+			failed = true
+
+			if err := a.fault(res, "zebra"); err != nil {
+				return err
+			}
+		}
+
+		if err := a.store.Create(res); err != nil {
+			return err
+		}
+	}
+
+	if failed {
+		return a.requeue(l)
+	}
+
+	if err := l.Activate(); err != nil {
+		return err
+	}
+
+	if err := a.store.Create(l); err != nil {
+		return err
+	}
+
+	a.webhooks.Emit(EventLeaseActivated, l)
+
+	return nil
+}
+
+// finishTeardown records the teardown results on the lease and frees the
+// resources. Resources that failed are faulted so that they are not handed out
+// again.
+func (a *Allocator) finishTeardown(actor string) func(*lease.Lease, []zebra.Resource, []lease.HookResult) error {
+	return func(l *lease.Lease, resources []zebra.Resource, results []lease.HookResult) error {
+		l.RecordHooks(results)
+
+		if err := a.store.Create(l); err != nil {
+			return err
+		}
+
+		for i, res := range resources {
+			status := res.GetStatus()
+			if status.UsedBy != l.Owner() || status.LeaseStatus != zebra.Setup {
+				continue
+			}
+
+			if results[i].Error != "" {
+				if err := a.fault(res, actor); err != nil {
+					return err
+				}
+
+				continue
+			}
+
+			if err := res.UpdateStatus().Release(actor); err != nil {
+				return err
+			}
+
+			if err := a.store.Create(res); err != nil {
+				return err
+			}
+		}
+
+		_, err := a.drain()
+
+		return err
+	}
+}
+
+// fault frees a resource whose hook failed and marks it faulted.
+func (a *Allocator) fault(res zebra.Resource, actor string) error {
+	status := res.UpdateStatus()
+
+	if err := status.Release(actor); err != nil {
+		return err
+	}
+
+	status.Fault = zebra.Major
+
+	if err := a.store.Create(res); err != nil {
+		return err
+	}
+
+	a.webhooks.Emit(EventResourceFaulted, res)
+
+	return nil
+}
+
+// requeue gives back the resources of a lease whose setup failed and puts it
+// back in the queue.
+func (a *Allocator) requeue(l *lease.Lease) error {
+	if err := a.releaseResources(l, "zebra"); err != nil {
+		return err
+	}
+
+	for _, req := range l.Request {
+		req.Resources = nil
+	}
+
+	l.Enqueue()
+
+	return a.store.Create(l)
+}
@@ -0,0 +1,147 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func serverHooks(setup, teardown *HookAction) *HookConfig {
+	cfg := DefaultHookConfig()
+	cfg.Types["compute.server"] = TypeHooks{Setup: setup, Teardown: teardown}
+
+	return cfg
+}
+
+func TestHookAction(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	out, err := (&HookAction{Command: []string{"cat"}}).Run(ctx, []byte("payload"))
+	assert.Nil(err)
+	assert.Equal("payload", out)
+
+	_, err = (&HookAction{Command: []string{"false"}}).Run(ctx, nil)
+	assert.ErrorIs(err, ErrHook)
+
+	slow := &HookAction{Command: []string{"sleep", "5"}, Timeout: Duration{10 * time.Millisecond}}
+	_, err = slow.Run(ctx, nil)
+	assert.ErrorIs(err, ErrHook)
+
+	srv := httptest.NewServer(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		if req.URL.Path == "/fail" {
+			res.WriteHeader(http.StatusInternalServerError)
+		}
+
+		_, _ = res.Write([]byte("done"))
+	}))
+
+	defer srv.Close()
+
+	out, err = (&HookAction{URL: srv.URL + "/ok"}).Run(ctx, nil)
+	assert.Nil(err)
+	assert.Equal("done", out)
+
+	_, err = (&HookAction{URL: srv.URL + "/fail"}).Run(ctx, nil)
+	assert.ErrorIs(err, ErrHook)
+}
+
+func TestSetupHooks(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_setup_hooks"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	a := api.Allocator
+	a.SetHooks(serverHooks(&HookAction{Command: []string{"cat"}}, &HookAction{Command: []string{"true"}}))
+
+	l := serverLease("user@zebra", 1)
+	server := api.Store.QueryType([]string{"compute.server"}).Resources["compute.server"].Resources[0]
+
+	// Hooks finish with the allocator lock held
+	assert.Nil(a.Update(func(zebra.Store) error {
+		assert.Nil(a.allocate(l))
+		assert.Equal(lease.SettingUp, l.Phase)
+		assert.Equal(zebra.Setup, server.GetStatus().LeaseStatus)
+
+		return nil
+	}))
+
+	a.WaitHooks()
+	assert.Equal(lease.Activated, l.Phase)
+	assert.Equal(zebra.Leased, server.GetStatus().LeaseStatus)
+	assert.Len(l.Hooks, 1)
+	assert.Equal(HookSetup, l.Hooks[0].Hook)
+	assert.Contains(l.Hooks[0].Output, l.Meta.ID)
+	assert.Empty(l.Hooks[0].Error)
+
+	// The resource is freed once torn down
+	assert.Nil(a.Update(func(zebra.Store) error {
+		assert.Nil(a.release(l, "user@zebra"))
+		assert.Equal(lease.Released, l.Phase)
+		assert.Equal(zebra.Setup, server.GetStatus().LeaseStatus)
+
+		return nil
+	}))
+
+	a.WaitHooks()
+	assert.True(server.GetStatus().Allocatable())
+	assert.Len(l.Hooks, 2)
+	assert.Equal(HookTeardown, l.Hooks[1].Hook)
+}
+
+func TestFailedHooks(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_failed_hooks"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	a := api.Allocator
+	a.SetHooks(serverHooks(&HookAction{Command: []string{"false"}}, nil))
+
+	// The faulted resource is not handed out and the lease waits for another
+	l := serverLease("user@zebra", 1)
+	assert.Nil(a.Allocate(l))
+
+	failed := findResource(api.Store, l.Request[0].Resources[0])
+
+	a.WaitHooks()
+	assert.Equal(lease.Queued, l.Phase)
+	assert.Empty(l.Request[0].Resources)
+	assert.NotEmpty(l.Hooks[0].Error)
+	assert.Equal(zebra.Major, failed.GetStatus().Fault)
+	assert.Equal(zebra.Free, failed.GetStatus().LeaseStatus)
+
+	a.SetHooks(nil)
+
+	drained, err := a.Drain()
+	assert.Nil(err)
+	assert.Len(drained, 1)
+	assert.Equal(lease.Activated, l.Phase)
+	assert.NotEqual(failed.GetMeta().ID, l.Request[0].Resources[0])
+
+	// A failed teardown faults the resource too
+	a.SetHooks(serverHooks(nil, &HookAction{Command: []string{"false"}}))
+
+	server := findResource(api.Store, l.Request[0].Resources[0])
+	assert.Nil(a.Release(l, "user@zebra"))
+
+	a.WaitHooks()
+	assert.Equal(zebra.Major, server.GetStatus().Fault)
+	assert.False(server.GetStatus().Allocatable())
+}
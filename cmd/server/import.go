@@ -0,0 +1,154 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/inventory"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+var (
+	ErrExists    = errors.New("resource already exists, use upsert to update it")
+	ErrForbidden = errors.New("permission denied")
+)
+
+// handleImport creates resources from a CSV or YAML inventory. Resources are
+// matched against the store by type, group and name. With upsert a matching
+// resource is replaced, keeping its ID and status. All lines are checked before
+// anything is stored and nothing is stored if any line has an error.
+func handleImport() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		importReq := new(inventory.ImportRequest)
+		if err := readJSON(ctx, req, importReq); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("inventory could not be imported, could not read request")
+
+			return
+		}
+
+		result := inventory.NewImportResult(importReq.DryRun)
+		entries, errs := inventory.Read(ctx, importReq.Format, strings.NewReader(importReq.Data),
+			api.factory, importReq.Type, importReq.Mappings)
+		result.Errors = append(result.Errors, errs...)
+
+		err := api.Allocator.Update(func(store zebra.Store) error {
+			resources := prepareImport(store, claims, importReq.Upsert, entries, result)
+			if len(result.Errors) > 0 || importReq.DryRun {
+				return nil
+			}
+
+			for _, r := range resources {
+				if err := api.create(r); err != nil {
+					return err
+				}
+			}
+
+			result.Applied = true
+
+			return nil
+		})
+		if err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "internal server error while importing resources")
+
+			return
+		}
+
+		log.Info("inventory imported", "applied", result.Applied, "created", len(result.Created),
+			"updated", len(result.Updated), "errors", len(result.Errors))
+
+		writeJSON(ctx, res, result)
+	}
+}
+
+// prepareImport matches the imported resources against the store and checks
+// that the user may create or update them. Problems are added to the result.
+func prepareImport(store zebra.Store, claims *auth.Claims, upsert bool,
+	entries []inventory.Entry, result *inventory.ImportResult,
+) []zebra.Resource {
+	existing := make(map[string]zebra.Resource)
+	_ = applyFunc(store.Query(), func(r zebra.Resource) error {
+		existing[inventory.Key(r)] = r
+
+		return nil
+	})
+
+	seen := make(map[string]struct{}, len(entries))
+	resources := make([]zebra.Resource, 0, len(entries))
+
+	for _, e := range entries {
+		key := inventory.Key(e.Resource)
+
+		if err := checkImport(claims, e.Resource, existing[key], upsert); err != nil {
+			result.Errors = append(result.Errors, inventory.LineError{Line: e.Line, Message: err.Error()})
+
+			continue
+		}
+
+		if _, ok := seen[key]; ok {
+			result.Errors = append(result.Errors, inventory.LineError{Line: e.Line, Message: inventory.ErrDuplicate.Error()})
+
+			continue
+		}
+
+		seen[key] = struct{}{}
+
+		if old, ok := existing[key]; ok {
+			meta := e.Resource.UpdateMeta()
+			meta.ID = old.GetMeta().ID
+			meta.CreationTime = old.GetMeta().CreationTime
+			meta.ModificationTime = time.Now()
+			*e.Resource.UpdateStatus() = old.GetStatus()
+			result.Updated = append(result.Updated, key)
+		} else {
+			result.Created = append(result.Created, key)
+		}
+
+		resources = append(resources, e.Resource)
+	}
+
+	return resources
+}
+
+func checkImport(claims *auth.Claims, res, old zebra.Resource, upsert bool) error {
+	resType := res.GetMeta().Type.Name
+
+	switch {
+	case resType == lease.Type().Name:
+		return ErrLeaseResource
+	case old == nil && !claims.Create(resType):
+		return ErrForbidden
+	case old == nil:
+		return validateNewStatus(res.GetStatus())
+	case !upsert:
+		return ErrExists
+	case !claims.Update(resType):
+		return ErrForbidden
+	}
+
+	return nil
+}
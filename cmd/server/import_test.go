@@ -0,0 +1,137 @@
+package main //nolint:testpackage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/inventory"
+	"github.com/stretchr/testify/assert"
+)
+
+const importCSV = "name,group,rangeStart,rangeEnd\npool-1,lab,1,10\npool-2,lab,20,30\n"
+
+func importRequest(assert *assert.Assertions, data string, dryRun, upsert bool) string {
+	body, err := json.Marshal(&inventory.ImportRequest{
+		Format:   inventory.FormatCSV,
+		Type:     "network.vlanPool",
+		Mappings: nil,
+		DryRun:   dryRun,
+		Upsert:   upsert,
+		Data:     data,
+	})
+	assert.Nil(err)
+
+	return string(body)
+}
+
+func doImport(assert *assert.Assertions, api *ResourceAPI, claims *auth.Claims, body string,
+) (int, *inventory.ImportResult) {
+	h := handleImport()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, httprouter.Params{})
+	})
+
+	rr := httptest.NewRecorder()
+	if claims == nil {
+		handler.ServeHTTP(rr, createRequest(assert, "POST", "/api/v1/import", body, api))
+	} else {
+		handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/api/v1/import", body, api, claims))
+	}
+
+	result := new(inventory.ImportResult)
+	if rr.Code == http.StatusOK {
+		assert.Nil(json.Unmarshal(rr.Body.Bytes(), result))
+	}
+
+	return rr.Code, result
+}
+
+func TestImport(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_import"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 0)
+	admin := adminClaims(assert)
+	pools := func() int {
+		n := 0
+		_ = applyFunc(api.Store.QueryType([]string{"network.vlanPool"}), func(zebra.Resource) error {
+			n++
+
+			return nil
+		})
+
+		return n
+	}
+
+	code, _ := doImport(assert, api, nil, importRequest(assert, importCSV, false, false))
+	assert.Equal(http.StatusUnauthorized, code)
+
+	code, _ = doImport(assert, api, admin, "{")
+	assert.Equal(http.StatusBadRequest, code)
+
+	// Read only users can not create resources
+	code, result := doImport(assert, api, userClaims(assert, "user@zebra"), importRequest(assert, importCSV, false, false))
+	assert.Equal(http.StatusOK, code)
+	assert.False(result.Applied)
+	assert.Len(result.Errors, 2)
+	assert.Equal(ErrForbidden.Error(), result.Errors[0].Message)
+
+	// Dry run
+	code, result = doImport(assert, api, admin, importRequest(assert, importCSV, true, false))
+	assert.Equal(http.StatusOK, code)
+	assert.False(result.Applied)
+	assert.Equal([]string{"network.vlanPool/lab/pool-1", "network.vlanPool/lab/pool-2"}, result.Created)
+	assert.Equal(0, pools())
+
+	// One bad row stops the whole import
+	code, result = doImport(assert, api, admin, importRequest(assert, importCSV+"pool-3,lab,9,1\n", false, false))
+	assert.Equal(http.StatusOK, code)
+	assert.False(result.Applied)
+	assert.Equal(4, result.Errors[0].Line)
+	assert.Equal(0, pools())
+
+	code, result = doImport(assert, api, admin, importRequest(assert, importCSV, false, false))
+	assert.Equal(http.StatusOK, code)
+	assert.True(result.Applied)
+	assert.Len(result.Created, 2)
+
+	vlans := api.Store.QueryType([]string{"network.vlanPool"}).Resources["network.vlanPool"].Resources
+	assert.Len(vlans, 2)
+
+	// Already exists
+	code, result = doImport(assert, api, admin, importRequest(assert, importCSV, false, false))
+	assert.Equal(http.StatusOK, code)
+	assert.False(result.Applied)
+	assert.Equal(ErrExists.Error(), result.Errors[0].Message)
+
+	// Duplicate rows
+	code, result = doImport(assert, api, admin, importRequest(assert, importCSV+"pool-1,lab,1,10\n", false, true))
+	assert.Equal(http.StatusOK, code)
+	assert.Equal(inventory.ErrDuplicate.Error(), result.Errors[0].Message)
+
+	// Upsert keeps the ID and the status
+	old := vlans[0]
+	assert.Nil(api.Allocator.Transition(old, zebra.Maintenance, "admin", ""))
+
+	code, result = doImport(assert, api, admin,
+		importRequest(assert, "name,group,rangeStart,rangeEnd\n"+old.GetMeta().Name+",lab,1,99\n", false, true))
+	assert.Equal(http.StatusOK, code)
+	assert.True(result.Applied)
+	assert.Len(result.Updated, 1)
+
+	updated := findResource(api.Store, old.GetMeta().ID)
+	assert.NotNil(updated)
+	assert.Equal(zebra.Maintenance, updated.GetStatus().Lifecycle)
+	assert.Equal(old.GetMeta().CreationTime.Unix(), updated.GetMeta().CreationTime.Unix())
+	assert.Equal(2, pools())
+}
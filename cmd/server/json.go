@@ -8,6 +8,7 @@ import (
 	"net/http"
 
 	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
 )
 
 var ErrEmptyBody = errors.New("request body is empty")
@@ -15,12 +16,16 @@ var ErrEmptyBody = errors.New("request body is empty")
 func readJSON(ctx context.Context, req *http.Request, data interface{}) error {
 	log := logr.FromContextOrDiscard(ctx)
 
+	if req.Body == nil {
+		return ErrEmptyBody
+	}
+
 	body, err := ioutil.ReadAll(req.Body)
 	if err != nil {
 		return err
 	}
 
-	log.Info("request", "body", string(body))
+	log.Info("request", "body", string(zebra.RedactJSON(body)))
 
 	if len(body) > 0 {
 		err = json.Unmarshal(body, data)
@@ -0,0 +1,137 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra/auth"
+	"gojini.dev/config"
+	"gojini.dev/web"
+)
+
+const (
+	// HS256 signs jwts with the shared authKey, as zebra always did.
+	HS256 = "HS256"
+
+	DefaultKeyRotation = 24 * time.Hour
+
+	JWKSPath = "/.well-known/jwks.json"
+)
+
+// JWTConfig is the "jwt" section of the server configuration. Tokens are
+// signed with Algorithm, RS256 or EdDSA with a new key every Rotation (never
+// if it is not positive), or HS256 with the authKey.
+type JWTConfig struct {
+	Algorithm string   `json:"algorithm"`
+	Rotation  Duration `json:"rotation"`
+}
+
+func DefaultJWTConfig() *JWTConfig {
+	return &JWTConfig{Algorithm: auth.RS256, Rotation: Duration{DefaultKeyRotation}}
+}
+
+// setupKeys returns the key ring that signs jwts and starts rotating its keys,
+// or nil if jwts are signed with the authKey.
+func setupKeys(ctx context.Context, cfgStore *config.Store) *auth.KeyRing {
+	log := logr.FromContextOrDiscard(ctx)
+	cfg := DefaultJWTConfig()
+
+	if e := cfgStore.Get("jwt", cfg); e != nil {
+		cfg = DefaultJWTConfig()
+	}
+
+	if cfg.Algorithm == HS256 {
+		log.Info("jwts are signed with the authKey")
+
+		return nil
+	}
+
+	keys, err := auth.NewKeyRing(cfg.Algorithm)
+	if err != nil {
+		panic(err)
+	}
+
+	go rotateKeys(ctx, keys, cfg.Rotation.Duration)
+
+	log.Info("jwt keys generated", "algorithm", cfg.Algorithm, "rotation", cfg.Rotation.String())
+
+	return keys
+}
+
+// rotateKeys rotates the keys of the ring every interval, the keys are kept if
+// the interval is not positive.
+func rotateKeys(ctx context.Context, keys *auth.KeyRing, interval time.Duration) {
+	log := logr.FromContextOrDiscard(ctx)
+
+	if interval <= 0 {
+		log.Info("jwt keys are not rotated", "rotation", interval.String())
+
+		return
+	}
+
+	ticker := time.NewTicker(interval)
+
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			if err := keys.Rotate(now); err != nil {
+				log.Error(err, "jwt keys could not be rotated")
+
+				continue
+			}
+
+			log.Info("jwt keys rotated", "kid", keys.Current().ID)
+		}
+	}
+}
+
+// signClaims returns the claims as a jwt, signed with the key ring if there is
+// one in the context and with the authKey otherwise.
+func signClaims(ctx context.Context, claims *auth.Claims, authKey string) (string, error) {
+	if keys, ok := ctx.Value(KeysCtxKey).(*auth.KeyRing); ok {
+		return keys.Sign(claims)
+	}
+
+	return claims.JWT(authKey), nil
+}
+
+// parseClaims returns the claims of a jwt signed by signClaims.
+func parseClaims(ctx context.Context, token string, authKey string) (*auth.Claims, error) {
+	if keys, ok := ctx.Value(KeysCtxKey).(*auth.KeyRing); ok {
+		return keys.Parse(token)
+	}
+
+	return auth.FromJWT(token, authKey)
+}
+
+// jwksAdapter serves the public keys that verify zebra jwts at JWKSPath,
+// without authentication so that other services can fetch them.
+func jwksAdapter() web.Adapter {
+	return func(nextHandler http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != JWKSPath {
+				// This is not a jwks request just forward it
+				callNext(nextHandler, res, req)
+
+				return
+			}
+
+			ctx := req.Context()
+
+			keys, ok := ctx.Value(KeysCtxKey).(*auth.KeyRing)
+			if !ok {
+				res.WriteHeader(http.StatusNotFound)
+
+				return
+			}
+
+			writeJSON(ctx, res, keys.JWKS())
+		})
+	}
+}
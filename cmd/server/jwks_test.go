@@ -0,0 +1,134 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+	"gojini.dev/config"
+)
+
+func TestSetupKeys(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	cfgStore := config.New()
+	assert.Nil(cfgStore.LoadFromStr(ctx, `{}`))
+	assert.NotNil(setupKeys(ctx, cfgStore))
+
+	cfgStore = config.New()
+	assert.Nil(cfgStore.LoadFromStr(ctx, `{"jwt": {"algorithm": "EdDSA", "rotation": "1h"}}`))
+	assert.Equal(auth.EdDSA, setupKeys(ctx, cfgStore).Current().Algorithm)
+
+	// Keys are kept without a rotation
+	for _, rotation := range []string{"0s", "-1h"} {
+		cfgStore = config.New()
+		assert.Nil(cfgStore.LoadFromStr(ctx, `{"jwt": {"algorithm": "RS256", "rotation": "`+rotation+`"}}`))
+		assert.NotPanics(func() { setupKeys(ctx, cfgStore) })
+	}
+
+	keys, err := auth.NewKeyRing(auth.RS256)
+	assert.Nil(err)
+
+	kid := keys.Current().ID
+	rotateKeys(ctx, keys, 0)
+	assert.Equal(kid, keys.Current().ID)
+
+	cfgStore = config.New()
+	assert.Nil(cfgStore.LoadFromStr(ctx, `{"jwt": {"algorithm": "HS256"}}`))
+	assert.Nil(setupKeys(ctx, cfgStore))
+
+	cfgStore = config.New()
+	assert.Nil(cfgStore.LoadFromStr(ctx, `{"jwt": {"algorithm": "none", "rotation": "1h"}}`))
+	assert.Panics(func() { setupKeys(ctx, cfgStore) })
+}
+
+func TestJWKSAdapter(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	testForward(assert, jwksAdapter())
+
+	handler := jwksAdapter()(nil)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, httptest.NewRequest("GET", JWKSPath, nil))
+	assert.Equal(http.StatusNotFound, rr.Code)
+
+	keys, err := auth.NewKeyRing(auth.RS256)
+	assert.Nil(err)
+
+	req := httptest.NewRequest("GET", JWKSPath, nil)
+	req = req.Clone(context.WithValue(req.Context(), KeysCtxKey, keys))
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, req)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	jwks := new(auth.JWKS)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), jwks))
+	assert.Len(jwks.Keys, 1)
+	assert.Equal(keys.Current().ID, jwks.Keys[0].Kid)
+	assert.Equal("RSA", jwks.Keys[0].Kty)
+}
+
+func TestSignedJWT(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_signed_jwt"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	jini := makeUser(assert)
+	assert.Nil(api.Store.Create(jini))
+
+	keys, err := auth.NewKeyRing(auth.EdDSA)
+	assert.Nil(err)
+
+	withKeys := func(req *http.Request) *http.Request {
+		ctx := context.WithValue(req.Context(), KeysCtxKey, keys)
+		ctx = context.WithValue(ctx, AuthCtxKey, authKey)
+
+		return req.Clone(ctx)
+	}
+
+	// Logging in returns a token signed with the current key
+	rr := httptest.NewRecorder()
+	body := `{"email":"email@domain","password":"` + jiniWords + `"}`
+	loginAdapter()(nil).ServeHTTP(rr, withKeys(createRequest(assert, "POST", "/login", body, api)))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	cookie := rr.Result().Cookies()[0]
+	assert.Nil(rr.Result().Body.Close())
+
+	claims, err := keys.Parse(cookie.Value)
+	assert.Nil(err)
+	assert.Equal("email@domain", claims.Email)
+
+	authed := func(cookie *http.Cookie) int {
+		req := withKeys(createRequest(assert, "GET", "/api/v1/types", "", api))
+		req.AddCookie(cookie)
+
+		rr := httptest.NewRecorder()
+		authAdapter()(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			res.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	assert.Equal(http.StatusOK, authed(cookie))
+
+	// Tokens signed with the shared authKey are refused
+	assert.Equal(http.StatusUnauthorized, authed(makeCookie(claims.JWT(authKey))))
+}
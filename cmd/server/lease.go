@@ -0,0 +1,183 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+// handleLease creates a new lease for the authenticated user and allocates the
+// requested resources to it, or books them if the lease starts in the future.
+// A lease that can not be satisfied right now is put on the waitlist.
+func handleLease() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		l, err := readLease(req, api, claims)
+		if err != nil {
+			res.WriteHeader(readStatus(err))
+			log.Info("lease could not be created", "error", err.Error())
+
+			return
+		}
+
+		if err := api.Allocator.AllocateOrQueue(l); err != nil {
+			if errors.Is(err, ErrQuota) {
+				res.WriteHeader(http.StatusForbidden)
+				log.Info("lease over quota", "user", claims.Email, "error", err.Error())
+
+				return
+			}
+
+			if errors.Is(err, ErrAllocate) {
+				res.WriteHeader(http.StatusConflict)
+				log.Info("lease could not be satisfied", "user", claims.Email, "error", err.Error())
+
+				return
+			}
+
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "lease could not be allocated", "user", claims.Email)
+
+			return
+		}
+
+		log.Info("lease "+l.Phase.String(), "id", l.Meta.ID, "user", claims.Email, "start", l.Start())
+
+		writeJSON(ctx, res, l)
+	}
+}
+
+var ErrLeaseRead = errors.New("lease request could not be read")
+
+// readLease returns a new lease for the authenticated user from the request
+// body, with the requests of its template filled in.
+func readLease(req *http.Request, api *ResourceAPI, claims *auth.Claims) (*lease.Lease, error) {
+	ctx := req.Context()
+	leaseReq := new(lease.Lease)
+
+	if err := readJSON(ctx, req, leaseReq); err != nil {
+		return nil, fmt.Errorf("%w: %s", ErrLeaseRead, err.Error())
+	}
+
+	if leaseReq.Template != nil {
+		if err := useTemplate(api.Store, leaseReq); err != nil {
+			return nil, err
+		}
+	}
+
+	// Resources are assigned by the allocator only, a pinned request gets
+	// all of the resources it is pinned to. API tokens may lease the types
+	// they can read.
+	for _, r := range leaseReq.Request {
+		if !tokenAllows(claims, (*auth.Role).Read, r.Type) {
+			return nil, fmt.Errorf("%w: %s", ErrForbidden, r.Type)
+		}
+
+		r.Resources = nil
+
+		if r.IsPinned() && r.Count == 0 {
+			r.Count = len(r.IDs) + len(r.Names)
+		}
+	}
+
+	// The lease always belongs to the user asking for it.
+	l := lease.NewLease(claims.Email, leaseReq.Duration, leaseReq.Request)
+	l.StartTime = leaseReq.StartTime
+	l.Placement = leaseReq.Placement
+	l.Template = leaseReq.Template
+	l.HeartbeatInterval = leaseReq.HeartbeatInterval
+	l.Priority = api.Allocator.Priority(claims.Role)
+	limits := api.Allocator.Limits(claims.Role, l.Request)
+	l.Limits = &limits
+
+	if err := l.Validate(ctx); err != nil {
+		return nil, err
+	}
+
+	return l, nil
+}
+
+// readStatus returns the response status for an error reading a lease.
+func readStatus(err error) int {
+	if errors.Is(err, ErrNoTemplate) {
+		return http.StatusNotFound
+	}
+
+	if errors.Is(err, ErrForbidden) {
+		return http.StatusForbidden
+	}
+
+	return http.StatusBadRequest
+}
+
+// handleRelease releases all resources held by a lease. Only the owner of the
+// lease or a user who can delete leases may release it.
+func handleRelease() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		l, ok := findResource(api.Store, params.ByName("id")).(*lease.Lease)
+		if !ok {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if l.Owner() != claims.Email && !claims.Delete(lease.Type().Name) {
+			res.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		if err := api.Allocator.Release(l, claims.Email); errors.Is(err, ErrLeaseReleased) {
+			res.WriteHeader(http.StatusConflict)
+
+			return
+		} else if err != nil {
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "lease could not be released", "id", l.Meta.ID)
+
+			return
+		}
+
+		log.Info("lease released", "id", l.Meta.ID, "user", claims.Email)
+
+		res.WriteHeader(http.StatusOK)
+	}
+}
@@ -0,0 +1,111 @@
+package main //nolint:testpackage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_lease_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	h := handleLease()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, nil)
+	})
+
+	b, err := json.Marshal(serverLease("someone@zebra", 2))
+	assert.Nil(err)
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, createRequest(assert, "POST", "/api/v1/leases", string(b), api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", "{", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	// Nor with a token that can't read servers
+	token := userClaims(assert, "user@zebra")
+	token.Scope = &auth.Role{Name: "token:none"}
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", string(b), api, token))
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", string(b), api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	l := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), l))
+	assert.Equal("user@zebra", l.Owner())
+	assert.Len(l.Request[0].Resources, 2)
+
+	// More than there are in service
+	tooMany, err := json.Marshal(serverLease("someone@zebra", 3))
+	assert.Nil(err)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", string(tooMany), api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusConflict, rr.Code)
+
+	// Nothing left, the lease waits in the queue
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", string(b), api, userClaims(assert, "other@zebra")))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	queued := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), queued))
+	assert.Equal(lease.Queued, queued.Phase)
+
+	// Release
+	release := handleRelease()
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release(w, r, httprouter.Params{{Key: "id", Value: l.Meta.ID}})
+	})
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "DELETE", "/", "", api, userClaims(assert, "other@zebra")))
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "DELETE", "/", "", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	// The released servers went to the queued lease
+	for _, id := range l.Request[0].Resources {
+		assert.Equal("other@zebra", findResource(api.Store, id).GetStatus().UsedBy)
+	}
+
+	assert.Equal(lease.Activated, findResource(api.Store, queued.Meta.ID).(*lease.Lease).Phase)
+
+	// Releasing again must not take the servers from the queued lease
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "DELETE", "/", "", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusConflict, rr.Code)
+
+	for _, id := range l.Request[0].Resources {
+		assert.Equal("other@zebra", findResource(api.Store, id).GetStatus().UsedBy)
+	}
+
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		release(w, r, httprouter.Params{{Key: "id", Value: "0000000000"}})
+	})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "DELETE", "/", "", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusNotFound, rr.Code)
+}
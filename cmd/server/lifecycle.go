@@ -0,0 +1,186 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+var (
+	ErrStatusChange  = errors.New("status can not be changed by a resource update")
+	ErrLeaseResource = errors.New("leases must be requested through the lease api")
+	ErrResourceInUse = errors.New("resource is leased")
+)
+
+// validateStatus makes sure that a posted resource does not change the status
+// of a resource. New resources must start in an initial lifecycle state, free
+// and without faults, after that the lifecycle and its transitions are changed
+// only through the lifecycle api, and the lease status and the fault only by
+// the allocator.
+func validateStatus(store zebra.Store, res zebra.Resource) error {
+	if res.GetMeta().Type.Name == lease.Type().Name {
+		return ErrLeaseResource
+	}
+
+	status := res.GetStatus()
+	old := findResource(store, res.GetMeta().ID)
+
+	if old == nil {
+		return validateNewStatus(status)
+	}
+
+	oldStatus := old.GetStatus()
+	if oldStatus.Lifecycle != status.Lifecycle ||
+		oldStatus.LeaseStatus != status.LeaseStatus ||
+		oldStatus.UsedBy != status.UsedBy ||
+		oldStatus.Fault != status.Fault ||
+		!sameTransitions(oldStatus.Transitions, status.Transitions) {
+		return ErrStatusChange
+	}
+
+	return nil
+}
+
+// sameTransitions returns true if both lists hold the same transitions.
+func sameTransitions(a, b []zebra.Transition) bool {
+	if len(a) != len(b) {
+		return false
+	}
+
+	for i := range a {
+		if a[i].From != b[i].From || a[i].To != b[i].To || a[i].Actor != b[i].Actor ||
+			a[i].Reason != b[i].Reason || !a[i].Time.Equal(b[i].Time) {
+			return false
+		}
+	}
+
+	return true
+}
+
+// checkPost makes sure that an API token may create a posted resource, or
+// update it if it exists, and that the post does not change its status.
+func checkPost(store zebra.Store, claims *auth.Claims, res zebra.Resource) error {
+	allows := (*auth.Role).Update
+	if findResource(store, res.GetMeta().ID) == nil {
+		allows = (*auth.Role).Create
+	}
+
+	if !tokenAllows(claims, allows, res.GetMeta().Type.Name) {
+		return ErrForbidden
+	}
+
+	return validateStatus(store, res)
+}
+
+// validateNewStatus makes sure that a new resource starts in an initial
+// lifecycle state, free, without faults and without a history.
+func validateNewStatus(status zebra.Status) error {
+	if !status.Lifecycle.IsInitial() || status.LeaseStatus != zebra.Free || status.UsedBy != "" ||
+		status.Fault != zebra.None || len(status.Transitions) != 0 {
+		return ErrStatusChange
+	}
+
+	return nil
+}
+
+// validateDelete makes sure that a resource can be deleted. Leases are ended
+// through the lease api, and resources can not be deleted while they are leased
+// since that would orphan the lease.
+func validateDelete(res zebra.Resource) error {
+	if res.GetMeta().Type.Name == lease.Type().Name {
+		return ErrLeaseResource
+	}
+
+	if status := res.GetStatus(); status.LeaseStatus != zebra.Free || status.UsedBy != "" {
+		return ErrResourceInUse
+	}
+
+	return nil
+}
+
+// findResource returns the resource with the given ID, nil if there is none.
+func findResource(store zebra.Store, id string) zebra.Resource {
+	var found zebra.Resource
+
+	_ = applyFunc(store.QueryUUID([]string{id}), func(res zebra.Resource) error {
+		found = res
+
+		return nil
+	})
+
+	return found
+}
+
+// handleLifecycle moves a resource to a new lifecycle state. Resources can not
+// be moved into or out of the leased state here, that is done only by the lease
+// allocator.
+func handleLifecycle() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		stateReq := &struct {
+			Lifecycle zebra.Lifecycle `json:"lifecycle"`
+			Reason    string          `json:"reason"`
+		}{}
+
+		if err := readJSON(ctx, req, stateReq); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("lifecycle could not be changed, could not read request")
+
+			return
+		}
+
+		resource := findResource(api.Store, params.ByName("id"))
+		if resource == nil {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if !claims.Update(resource.GetMeta().Type.Name) {
+			res.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		if err := api.Allocator.Transition(resource, stateReq.Lifecycle, claims.Email, stateReq.Reason); err != nil {
+			if errors.Is(err, zebra.ErrTransition) {
+				res.WriteHeader(http.StatusConflict)
+				log.Info("lifecycle transition not allowed", "id", resource.GetMeta().ID,
+					"to", stateReq.Lifecycle.String())
+
+				return
+			}
+
+			res.WriteHeader(http.StatusInternalServerError)
+			log.Error(err, "lifecycle could not be stored", "id", resource.GetMeta().ID)
+
+			return
+		}
+
+		log.Info("lifecycle changed", "id", resource.GetMeta().ID,
+			"to", stateReq.Lifecycle.String(), "actor", claims.Email)
+
+		writeJSON(ctx, res, resource.GetStatus())
+	}
+}
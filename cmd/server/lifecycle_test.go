@@ -0,0 +1,179 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeClaimsRequest(assert *assert.Assertions, method string, url string,
+	body string, api *ResourceAPI, claims *auth.Claims,
+) *http.Request {
+	req := createRequest(assert, method, url, body, api)
+	ctx := context.WithValue(req.Context(), ClaimsCtxKey, claims)
+
+	return req.Clone(ctx)
+}
+
+func adminClaims(assert *assert.Assertions) *auth.Claims {
+	all, err := auth.NewPriv("", true, true, true, true)
+	assert.Nil(err)
+
+	return auth.NewClaims("zebra", "admin", &auth.Role{Name: "admin", Privileges: []*auth.Priv{all}},
+		"admin@zebra")
+}
+
+func userClaims(assert *assert.Assertions, email string) *auth.Claims {
+	return auth.NewClaims("zebra", email, DefaultRole(), email)
+}
+
+func TestValidateStatus(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_validate_status"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	s := compute.MockServer(1)[0]
+
+	assert.Nil(validateStatus(api.Store, s))
+
+	s.UpdateStatus().Lifecycle = zebra.Maintenance
+	assert.Equal(ErrStatusChange, validateStatus(api.Store, s))
+
+	s.UpdateStatus().Lifecycle = zebra.InUse
+	s.UpdateStatus().LeaseStatus = zebra.Leased
+	assert.Equal(ErrStatusChange, validateStatus(api.Store, s))
+
+	assert.Equal(ErrLeaseResource, validateStatus(api.Store, serverLease("user@zebra", 1)))
+
+	// Existing resources must keep their status
+	s = compute.MockServer(1)[0]
+	assert.Nil(api.Store.Create(s))
+	assert.Nil(validateStatus(api.Store, s))
+
+	updated, ok := compute.MockServer(1)[0].(*compute.Server)
+	assert.True(ok)
+
+	updated.Meta.ID = s.GetMeta().ID
+	updated.Status.Lifecycle = zebra.Decommissioned
+	assert.Equal(ErrStatusChange, validateStatus(api.Store, updated))
+
+	// Faults and the transition history are owned by the server too
+	updated.Status = s.GetStatus()
+	updated.Status.Fault = zebra.Critical
+	assert.Equal(ErrStatusChange, validateStatus(api.Store, updated))
+
+	assert.Nil(api.Allocator.Transition(s, zebra.Maintenance, "admin@zebra", "disk swap"))
+
+	updated.Status = s.GetStatus()
+	assert.Nil(validateStatus(api.Store, updated))
+
+	updated.Status.Transitions = []zebra.Transition{{From: zebra.Available, To: zebra.Maintenance, Actor: "user@zebra"}}
+	assert.Equal(ErrStatusChange, validateStatus(api.Store, updated))
+
+	updated.Status.Transitions = nil
+	assert.Equal(ErrStatusChange, validateStatus(api.Store, updated))
+
+	fresh := compute.MockServer(1)[0]
+	fresh.UpdateStatus().Fault = zebra.Minor
+	assert.Equal(ErrStatusChange, validateStatus(api.Store, fresh))
+
+	fresh.UpdateStatus().Fault = zebra.None
+	fresh.UpdateStatus().Transitions = s.GetStatus().Transitions
+	assert.Equal(ErrStatusChange, validateStatus(api.Store, fresh))
+
+	fresh.UpdateStatus().Transitions = nil
+	assert.Nil(validateStatus(api.Store, fresh))
+}
+
+func TestValidateDelete(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_validate_delete"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	l := serverLease("user@zebra", 1)
+	assert.Nil(api.Allocator.Allocate(l))
+
+	assert.Equal(ErrLeaseResource, validateDelete(l))
+
+	for _, r := range api.Store.QueryType([]string{"compute.server"}).Resources["compute.server"].Resources {
+		if r.GetStatus().UsedBy == "" {
+			assert.Nil(validateDelete(r))
+		} else {
+			assert.Equal(ErrResourceInUse, validateDelete(r))
+		}
+	}
+}
+
+func TestLifecycleHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_lifecycle_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 0)
+	s := compute.MockServer(1)[0]
+	assert.Nil(api.Store.Create(s))
+
+	h := handleLifecycle()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, httprouter.Params{{Key: "id", Value: s.GetMeta().ID}})
+	})
+
+	body := `{"lifecycle":"maintenance","reason":"bios update"}`
+
+	// No claims
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, createRequest(assert, "POST", "/api/v1/resources", body, api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	// Read only user
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", body, api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	// Bad lifecycle
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", `{"lifecycle":"broken"}`, api, adminClaims(assert)))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", body, api, adminClaims(assert)))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	status := findResource(api.Store, s.GetMeta().ID).GetStatus()
+	assert.Equal(zebra.Maintenance, status.Lifecycle)
+	assert.Equal("admin@zebra", status.Transitions[0].Actor)
+	assert.Equal("bios update", status.Transitions[0].Reason)
+
+	// Not allowed from maintenance
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", `{"lifecycle":"leased"}`, api, adminClaims(assert)))
+	assert.Equal(http.StatusConflict, rr.Code)
+
+	// Unknown resource
+	h = handleLifecycle()
+	handler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, httprouter.Params{{Key: "id", Value: "0000000000"}})
+	})
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", body, api, adminClaims(assert)))
+	assert.Equal(http.StatusNotFound, rr.Code)
+}
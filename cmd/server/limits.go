@@ -0,0 +1,335 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+var (
+	ErrExtendQueued = errors.New("lease can not be extended while other leases wait for its resources")
+	ErrExtendBooked = errors.New("lease can not be extended into a booking of its resources")
+)
+
+const (
+	DefaultMaxExtensions = 2
+	DefaultMaxTotal      = 8 * time.Hour
+)
+
+// LeaseLimits are the limits of a lease as read from the configuration.
+type LeaseLimits struct {
+	MaxDuration   Duration `json:"maxDuration"`
+	MaxExtensions int      `json:"maxExtensions"`
+	MaxTotal      Duration `json:"maxTotal"`
+}
+
+// LeaseConfig is the "leases" section of the server configuration. The Limits
+// apply to all leases, Roles replace them for the users of a role and Types
+// tighten them for leases of a resource type. Limits left at 0 in Roles or
+// Types are not changed.
+type LeaseConfig struct {
+	Limits LeaseLimits            `json:"limits"`
+	Roles  map[string]LeaseLimits `json:"roles,omitempty"`
+	Types  map[string]LeaseLimits `json:"types,omitempty"`
+}
+
+func DefaultLeaseConfig() *LeaseConfig {
+	return &LeaseConfig{
+		Limits: LeaseLimits{
+			MaxDuration:   Duration{zebra.DefaultMaxDuration * time.Hour},
+			MaxExtensions: DefaultMaxExtensions,
+			MaxTotal:      Duration{DefaultMaxTotal},
+		},
+		Roles: map[string]LeaseLimits{},
+		Types: map[string]LeaseLimits{},
+	}
+}
+
+// LimitsFor returns the limits of a lease for the role asking for the types.
+func (c *LeaseConfig) LimitsFor(role string, types []string) lease.Limits {
+	limits := lease.Limits{
+		MaxDuration:   c.Limits.MaxDuration.Duration,
+		MaxExtensions: c.Limits.MaxExtensions,
+		MaxTotal:      c.Limits.MaxTotal.Duration,
+	}
+
+	if r, ok := c.Roles[role]; ok {
+		if r.MaxDuration.Duration > 0 {
+			limits.MaxDuration = r.MaxDuration.Duration
+		}
+
+		if r.MaxExtensions > 0 {
+			limits.MaxExtensions = r.MaxExtensions
+		}
+
+		if r.MaxTotal.Duration > 0 {
+			limits.MaxTotal = r.MaxTotal.Duration
+		}
+	}
+
+	for _, resType := range types {
+		t, ok := c.Types[resType]
+		if !ok {
+			continue
+		}
+
+		if t.MaxDuration.Duration > 0 && t.MaxDuration.Duration < limits.MaxDuration {
+			limits.MaxDuration = t.MaxDuration.Duration
+		}
+
+		if t.MaxExtensions > 0 && t.MaxExtensions < limits.MaxExtensions {
+			limits.MaxExtensions = t.MaxExtensions
+		}
+
+		if t.MaxTotal.Duration > 0 && t.MaxTotal.Duration < limits.MaxTotal {
+			limits.MaxTotal = t.MaxTotal.Duration
+		}
+	}
+
+	if limits.MaxTotal < limits.MaxDuration {
+		limits.MaxTotal = limits.MaxDuration
+	}
+
+	return limits
+}
+
+// MaxDurationFor returns the longest duration any role may lease the types
+// for.
+func (c *LeaseConfig) MaxDurationFor(types []string) time.Duration {
+	longest := c.LimitsFor("", types).MaxDuration
+
+	for role := range c.Roles {
+		if d := c.LimitsFor(role, types).MaxDuration; d > longest {
+			longest = d
+		}
+	}
+
+	return longest
+}
+
+// SetLeaseConfig sets the limits of new leases.
+func (a *Allocator) SetLeaseConfig(cfg *LeaseConfig) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.leaseCfg = cfg
+}
+
+// Limits returns the limits of a lease with the requests for the role.
+func (a *Allocator) Limits(role *auth.Role, reqs []*lease.ResourceReq) lease.Limits {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	types := make([]string, 0, len(reqs))
+	for _, req := range reqs {
+		types = append(types, req.Type)
+	}
+
+	return a.leaseCfg.LimitsFor(roleName(role), types)
+}
+
+// Extend extends an active lease by the duration if its limits and the quotas
+// of its owner allow it, no queued lease may get its resources and none of them
+// is booked by another lease before the new end.
+func (a *Allocator) Extend(l *lease.Lease, by time.Duration, actor string) error {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err := l.CanExtend(by); err != nil {
+		return err
+	}
+
+	if err := a.checkQuota(l, by); err != nil {
+		return err
+	}
+
+	if waiting := a.waiting(l); len(waiting) > 0 {
+		return fmt.Errorf("%w: %s", ErrExtendQueued, strings.Join(waiting, ", "))
+	}
+
+	cal := a.calendar()
+
+	for _, req := range l.RequestList() {
+		for _, id := range req.Resources {
+			for _, b := range cal.Bookings(id, l.End(), l.End().Add(by)) {
+				if b.Lease != l.Meta.ID {
+					return fmt.Errorf("%w: %s is booked by %s from %s", ErrExtendBooked, id, b.Owner,
+						b.Start.Format(time.RFC3339))
+				}
+			}
+		}
+	}
+
+	if err := l.Extend(by, actor, time.Now()); err != nil {
+		return err
+	}
+
+	return a.store.Create(l)
+}
+
+// waiting returns the IDs of the queued leases that may get any of the
+// resources of the lease.
+func (a *Allocator) waiting(l *lease.Lease) []string {
+	held := map[string]struct{}{}
+
+	for _, req := range l.RequestList() {
+		for _, id := range req.Resources {
+			held[id] = struct{}{}
+		}
+	}
+
+	waiting := []string{}
+
+	for _, q := range a.leases(lease.Queued) {
+		if a.wants(q, held) {
+			waiting = append(waiting, q.Meta.ID)
+		}
+	}
+
+	sort.Strings(waiting)
+
+	return waiting
+}
+
+// wants returns true if any of the resources matches a request of the lease.
+func (a *Allocator) wants(l *lease.Lease, resources map[string]struct{}) bool {
+	for _, req := range l.RequestList() {
+		for _, res := range a.matching(req) {
+			if _, ok := resources[res.GetMeta().ID]; ok {
+				return true
+			}
+		}
+	}
+
+	return false
+}
+
+// ExtendRequest is the body of a request to extend a lease.
+type ExtendRequest struct {
+	Duration time.Duration `json:"duration"`
+}
+
+// handleExtend extends a lease. Only the owner of the lease or a user who can
+// write leases may extend it.
+func handleExtend() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		l, ok := findResource(api.Store, params.ByName("id")).(*lease.Lease)
+		if !ok {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if l.Owner() != claims.Email && !claims.Write(lease.Type().Name) {
+			res.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		extendReq := new(ExtendRequest)
+		if err := readJSON(ctx, req, extendReq); err != nil || extendReq.Duration <= 0 {
+			res.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		if err := api.Allocator.Extend(l, extendReq.Duration, claims.Email); err != nil {
+			res.WriteHeader(extendStatus(err))
+			log.Info("lease could not be extended", "id", l.Meta.ID, "error", err.Error())
+
+			return
+		}
+
+		log.Info("lease extended", "id", l.Meta.ID, "user", claims.Email, "end", l.End())
+
+		writeJSON(ctx, res, l)
+	}
+}
+
+// extendStatus returns the response status for an error extending a lease.
+func extendStatus(err error) int {
+	switch {
+	case errors.Is(err, lease.ErrExtendLimit), errors.Is(err, ErrQuota):
+		return http.StatusForbidden
+	case errors.Is(err, lease.ErrNotActive), errors.Is(err, ErrExtendQueued), errors.Is(err, ErrExtendBooked):
+		return http.StatusConflict
+	default:
+		return http.StatusInternalServerError
+	}
+}
+
+// LimitsResponse holds the limits of the leases of a role, for any type and
+// for each type that has limits of its own.
+type LimitsResponse struct {
+	Role   string                  `json:"role"`
+	Limits lease.Limits            `json:"limits"`
+	Types  map[string]lease.Limits `json:"types"`
+}
+
+// handleLimits returns the limits of the leases of the authenticated user.
+func handleLimits() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		writeJSON(ctx, res, api.Allocator.RoleLimits(claims.Role))
+	}
+}
+
+// RoleLimits returns the limits of the leases of a role.
+func (a *Allocator) RoleLimits(role *auth.Role) *LimitsResponse {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	name := roleName(role)
+	limits := &LimitsResponse{
+		Role:   name,
+		Limits: a.leaseCfg.LimitsFor(name, nil),
+		Types:  map[string]lease.Limits{},
+	}
+
+	for resType := range a.leaseCfg.Types {
+		limits.Types[resType] = a.leaseCfg.LimitsFor(name, []string{resType})
+	}
+
+	return limits
+}
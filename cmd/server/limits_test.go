@@ -0,0 +1,185 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLeaseConfigLimits(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	cfg := DefaultLeaseConfig()
+	cfg.Roles["admin"] = LeaseLimits{MaxDuration: Duration{12 * time.Hour}, MaxExtensions: 5}
+	cfg.Types["network.switch"] = LeaseLimits{MaxDuration: Duration{time.Hour}, MaxTotal: Duration{2 * time.Hour}}
+
+	limits := cfg.LimitsFor("user", []string{"compute.server"})
+	assert.Equal(4*time.Hour, limits.MaxDuration)
+	assert.Equal(DefaultMaxExtensions, limits.MaxExtensions)
+	assert.Equal(DefaultMaxTotal, limits.MaxTotal)
+
+	// The total is never less than the duration
+	limits = cfg.LimitsFor("admin", []string{"compute.server"})
+	assert.Equal(12*time.Hour, limits.MaxDuration)
+	assert.Equal(5, limits.MaxExtensions)
+	assert.Equal(12*time.Hour, limits.MaxTotal)
+
+	// Type limits are tighter
+	limits = cfg.LimitsFor("admin", []string{"compute.server", "network.switch"})
+	assert.Equal(time.Hour, limits.MaxDuration)
+	assert.Equal(5, limits.MaxExtensions)
+	assert.Equal(2*time.Hour, limits.MaxTotal)
+}
+
+func TestExtend(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_extend"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	a := api.Allocator
+
+	l := serverLease("user@zebra", 1)
+	l.Limits = &lease.Limits{MaxDuration: time.Hour, MaxExtensions: 2, MaxTotal: 3 * time.Hour}
+
+	assert.ErrorIs(a.Extend(l, time.Hour, "user@zebra"), lease.ErrNotActive)
+	assert.Nil(a.Allocate(l))
+
+	end := l.End()
+
+	assert.Nil(a.Extend(l, time.Hour, "user@zebra"))
+	assert.Equal(end.Add(time.Hour), l.End())
+	assert.Len(l.Extensions, 1)
+	assert.Nil(l.Validate(context.Background()))
+
+	assert.ErrorIs(a.Extend(l, 2*time.Hour, "user@zebra"), lease.ErrExtendLimit)
+
+	// Nor over a quota
+	quota := lease.NewQuota("hours", "user@zebra", "", "", 0, 2.5)
+	assert.Nil(api.Store.Create(quota))
+	assert.ErrorIs(a.Extend(l, 45*time.Minute, "user@zebra"), ErrQuota)
+	assert.Len(l.Extensions, 1)
+	assert.Nil(api.Store.Delete(quota))
+
+	// Not while someone waits for the server
+	queued := serverLease("other@zebra", 1)
+	assert.Nil(a.AllocateOrQueue(queued))
+	assert.Equal(lease.Queued, queued.Phase)
+	assert.ErrorIs(a.Extend(l, 30*time.Minute, "user@zebra"), ErrExtendQueued)
+	assert.Nil(a.Release(queued, "other@zebra"))
+
+	// Nor into a booking
+	booked := serverLease("other@zebra", 1)
+	booked.StartTime = l.End().Add(30 * time.Minute)
+	assert.Nil(a.Allocate(booked))
+	assert.Equal(lease.Scheduled, booked.Phase)
+	assert.ErrorIs(a.Extend(l, time.Hour, "user@zebra"), ErrExtendBooked)
+
+	assert.Nil(a.Extend(l, 15*time.Minute, "user@zebra"))
+	assert.Len(l.Extensions, 2)
+
+	assert.ErrorIs(a.Extend(l, time.Minute, "user@zebra"), lease.ErrExtendLimit)
+}
+
+func TestExtendHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_extend_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+
+	l := serverLease("user@zebra", 1)
+	l.Limits = &lease.Limits{MaxDuration: time.Hour, MaxExtensions: 1, MaxTotal: 2 * time.Hour}
+	assert.Nil(api.Allocator.Allocate(l))
+
+	h := handleExtend()
+	handler := func(id string) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			h(w, r, httprouter.Params{{Key: "id", Value: id}})
+		}
+	}
+
+	b, err := json.Marshal(&ExtendRequest{Duration: time.Hour})
+	assert.Nil(err)
+
+	rr := httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, createRequest(assert, "POST", "/", string(b), api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler("unknown").ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", string(b), api,
+		userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusNotFound, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", string(b), api,
+		userClaims(assert, "other@zebra")))
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", "{", api,
+		userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", string(b), api,
+		userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	extended := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), extended))
+	assert.Equal(2*time.Hour, extended.Duration)
+
+	rr = httptest.NewRecorder()
+	handler(l.Meta.ID).ServeHTTP(rr, makeClaimsRequest(assert, "POST", "/", string(b), api,
+		userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusForbidden, rr.Code)
+}
+
+func TestLimitsHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_limits_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 0)
+
+	cfg := DefaultLeaseConfig()
+	cfg.Types["compute.server"] = LeaseLimits{MaxDuration: Duration{2 * time.Hour}}
+	api.Allocator.SetLeaseConfig(cfg)
+
+	h := handleLimits()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, nil)
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, createRequest(assert, "GET", "/api/v1/limits", "", api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/", "", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	limits := new(LimitsResponse)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), limits))
+	assert.Equal(4*time.Hour, limits.Limits.MaxDuration)
+	assert.Equal(2*time.Hour, limits.Types["compute.server"].MaxDuration)
+}
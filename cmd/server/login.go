@@ -65,6 +65,12 @@ func loginAdapter() web.Adapter {
 			}
 
 			claims := auth.NewClaims("zebra", user.Meta.Name, user.Role, user.Email)
+			auditCaller(ctx, claims)
+
+			if sessions, ok := ctx.Value(SessionsCtxKey).(*Sessions); ok {
+				sessions.Start(claims, sourceIP(req), time.Now())
+			}
+
 			respondWithClaims(ctx, res, claims, authKey)
 
 			log.Info("login succeeded", "user", user.Email)
@@ -102,12 +108,19 @@ func findUser(store zebra.Store, email string) *user.User {
 func respondWithClaims(ctx context.Context, res http.ResponseWriter,
 	claims *auth.Claims, authKey string,
 ) {
+	jwt, err := signClaims(ctx, claims, authKey)
+	if err != nil {
+		res.WriteHeader(http.StatusInternalServerError)
+
+		return
+	}
+
 	resData := &struct {
 		JWT   string     `json:"jwt"`
 		Role  *auth.Role `json:"role"`
 		Email string     `json:"email"`
 		Name  string     `json:"name"`
-	}{JWT: claims.JWT(authKey), Role: claims.Role, Email: claims.Email, Name: claims.Id}
+	}{JWT: jwt, Role: claims.Role, Email: claims.Email, Name: claims.Subject}
 
 	http.SetCookie(res, makeCookie(resData.JWT))
 	writeJSON(ctx, res, resData)
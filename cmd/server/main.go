@@ -76,19 +76,28 @@ func startServer(cfgStore *config.Store) error {
 
 	log.Info("setup completed")
 
+	metrics := metricsAdapter()
 	login := loginAdapter()
 	register := registerAdapter()
+	jwks := jwksAdapter()
 	auth := authAdapter()
 	refresh := refreshAdapter()
+	logout := logoutAdapter()
+	audit := auditAdapter()
 	routes := routeHandler()
 	static := staticAdaptor()
 
 	// The order of wrap matters, routes is the final handler that is being
-	// wrapped. setup, login and register are unauthenticated APIs that serve
-	// as a way to bootstrap authentication. auth, refresh and all endpoints
-	// registered by routes must be authenticated either via a jwt in the cookie
-	// or via a rsa key token in the header.
-	handler := web.Wrap(routes, setup, login, register, static, auth, refresh)
+	// wrapped. metrics records every request and serves /metrics without
+	// authentication so that it can be scraped. audit comes before login and
+	// auth so that logins, registrations and refused calls are audited, and
+	// learns who made a call from them. setup, login and register are
+	// unauthenticated APIs that serve as a way to bootstrap authentication, and
+	// jwks publishes the keys that verify jwts to other services.
+	// auth, refresh and all endpoints registered by routes must be
+	// authenticated either via a jwt in the cookie or via a rsa key token in
+	// the header.
+	handler := web.Wrap(routes, setup, metrics, audit, login, register, jwks, static, auth, refresh, logout)
 
 	webServer := web.NewServer(serverCfg, handler)
 
@@ -0,0 +1,397 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model/lease"
+	"gojini.dev/web"
+)
+
+// Metric names.
+const (
+	MetricRequests      = "zebra_http_requests_total"
+	MetricRequestTime   = "zebra_http_request_duration_seconds"
+	MetricAuthFailures  = "zebra_auth_failures_total"
+	MetricAllocatorTime = "zebra_allocator_duration_seconds"
+	MetricStoreTime     = "zebra_store_duration_seconds"
+	MetricStoreErrors   = "zebra_store_errors_total"
+	MetricResources     = "zebra_resources"
+	MetricLeases        = "zebra_leases"
+)
+
+var metricHelp = map[string]string{
+	MetricRequests:      "HTTP requests by route, method and status.",
+	MetricRequestTime:   "Time taken to serve HTTP requests by route and method.",
+	MetricAuthFailures:  "HTTP requests refused as unauthenticated by route.",
+	MetricAllocatorTime: "Time taken by allocator operations.",
+	MetricStoreTime:     "Time taken by store operations.",
+	MetricStoreErrors:   "Store operations that failed.",
+	MetricResources:     "Resources by type, lifecycle state and lease status.",
+	MetricLeases:        "Leases by phase.",
+}
+
+// DefaultBuckets are the upper bounds in seconds of the histogram buckets.
+var DefaultBuckets = []float64{0.005, 0.01, 0.025, 0.05, 0.1, 0.25, 0.5, 1, 2.5, 5, 10} //nolint:gomnd
+
+type histogram struct {
+	counts []uint64
+	sum    float64
+	count  uint64
+}
+
+// Metrics collects the counters and histograms served at /metrics in the
+// Prometheus text format. Series are kept by metric name and by their labels
+// as written out. The gauges of resources and leases are read from the store
+// when the metrics are served.
+type Metrics struct {
+	lock       sync.Mutex
+	counters   map[string]map[string]float64
+	histograms map[string]map[string]*histogram
+}
+
+func NewMetrics() *Metrics {
+	return &Metrics{
+		lock:       sync.Mutex{},
+		counters:   map[string]map[string]float64{},
+		histograms: map[string]map[string]*histogram{},
+	}
+}
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// metricLabels returns the label pairs as written in a series, in the given order.
+func metricLabels(pairs ...string) string {
+	written := make([]string, 0, len(pairs)/2) //nolint:gomnd
+
+	for i := 0; i+1 < len(pairs); i += 2 {
+		written = append(written, pairs[i]+`="`+labelEscaper.Replace(pairs[i+1])+`"`)
+	}
+
+	return strings.Join(written, ",")
+}
+
+// Inc adds one to a counter. It does nothing on nil metrics so that code can
+// report to metrics that are not set up.
+func (m *Metrics) Inc(name string, pairs ...string) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.counters[name] == nil {
+		m.counters[name] = map[string]float64{}
+	}
+
+	m.counters[name][metricLabels(pairs...)]++
+}
+
+// Observe adds a duration to a histogram.
+func (m *Metrics) Observe(name string, d time.Duration, pairs ...string) {
+	if m == nil {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	if m.histograms[name] == nil {
+		m.histograms[name] = map[string]*histogram{}
+	}
+
+	key := metricLabels(pairs...)
+
+	h, ok := m.histograms[name][key]
+	if !ok {
+		h = &histogram{counts: make([]uint64, len(DefaultBuckets)), sum: 0, count: 0}
+		m.histograms[name][key] = h
+	}
+
+	seconds := d.Seconds()
+
+	for i, bound := range DefaultBuckets {
+		if seconds <= bound {
+			h.counts[i]++
+		}
+	}
+
+	h.sum += seconds
+	h.count++
+}
+
+// Since adds the time since start to a histogram, to be deferred.
+func (m *Metrics) Since(name string, start time.Time, pairs ...string) {
+	m.Observe(name, time.Since(start), pairs...)
+}
+
+// ObserveRequest records a served HTTP request.
+func (m *Metrics) ObserveRequest(route, method string, status int, d time.Duration) {
+	m.Inc(MetricRequests, "route", route, "method", method, "status", strconv.Itoa(status))
+	m.Observe(MetricRequestTime, d, "route", route, "method", method)
+
+	if status == http.StatusUnauthorized {
+		m.Inc(MetricAuthFailures, "route", route)
+	}
+}
+
+// Write writes all metrics in the Prometheus text format, with the resources
+// and leases in the store of the api if there is one.
+func (m *Metrics) Write(w io.Writer, api *ResourceAPI) error {
+	gauges := map[string]map[string]float64{}
+	if api != nil {
+		gauges = storeGauges(api.Store)
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+
+	out := &strings.Builder{}
+
+	for _, name := range sortedKeys(gauges) {
+		writeSeries(out, name, "gauge", gauges[name])
+	}
+
+	for _, name := range sortedKeys(m.counters) {
+		writeSeries(out, name, "counter", m.counters[name])
+	}
+
+	for _, name := range sortedKeys(m.histograms) {
+		writeHeader(out, name, "histogram")
+
+		for _, key := range sortedKeys(m.histograms[name]) {
+			writeHistogram(out, name, key, m.histograms[name][key])
+		}
+	}
+
+	_, err := io.WriteString(w, out.String())
+
+	return err
+}
+
+// storeGauges counts the resources by type and status and the leases by phase.
+func storeGauges(store zebra.Store) map[string]map[string]float64 {
+	resources := map[string]float64{}
+	leases := map[string]float64{}
+
+	_ = applyFunc(store.Query(), func(res zebra.Resource) error {
+		status := res.GetStatus()
+		resources[metricLabels("type", res.GetMeta().Type.Name, "lifecycle", status.Lifecycle.String(),
+			"lease_status", status.LeaseStatus.String())]++
+
+		if l, ok := res.(*lease.Lease); ok {
+			leases[metricLabels("phase", l.Phase.String())]++
+		}
+
+		return nil
+	})
+
+	return map[string]map[string]float64{MetricResources: resources, MetricLeases: leases}
+}
+
+func writeHeader(out *strings.Builder, name, kind string) {
+	fmt.Fprintf(out, "# HELP %s %s\n# TYPE %s %s\n", name, metricHelp[name], name, kind)
+}
+
+func writeSeries(out *strings.Builder, name, kind string, series map[string]float64) {
+	writeHeader(out, name, kind)
+
+	for _, key := range sortedKeys(series) {
+		fmt.Fprintf(out, "%s %s\n", seriesName(name, key), formatValue(series[key]))
+	}
+}
+
+func writeHistogram(out *strings.Builder, name, key string, h *histogram) {
+	withLe := func(le string) string {
+		if key == "" {
+			return metricLabels("le", le)
+		}
+
+		return key + "," + metricLabels("le", le)
+	}
+
+	for i, bound := range DefaultBuckets {
+		fmt.Fprintf(out, "%s %d\n", seriesName(name+"_bucket", withLe(formatValue(bound))), h.counts[i])
+	}
+
+	fmt.Fprintf(out, "%s %d\n", seriesName(name+"_bucket", withLe("+Inf")), h.count)
+	fmt.Fprintf(out, "%s %s\n", seriesName(name+"_sum", key), formatValue(h.sum))
+	fmt.Fprintf(out, "%s %d\n", seriesName(name+"_count", key), h.count)
+}
+
+func seriesName(name, key string) string {
+	if key == "" {
+		return name
+	}
+
+	return name + "{" + key + "}"
+}
+
+func formatValue(v float64) string {
+	return strconv.FormatFloat(v, 'g', -1, 64)
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for k := range m {
+		keys = append(keys, k)
+	}
+
+	sort.Strings(keys)
+
+	return keys
+}
+
+// routeOf returns the route of a request: the path of the api route serving it
+// with its parameters named instead of their values, the path of the other
+// pages the server serves, or "other". The routes are a fixed set whatever is
+// requested, so that every route is one series.
+func routeOf(method, path string) string {
+	switch {
+	case strings.HasPrefix(path, "/static/"):
+		return "/static"
+	case zebra.IsIn(path, []string{
+		"/", "/login", "/logout", "/register", "/refresh", "/ZebraIcon.svg", JWKSPath,
+		"/api/v1/leases/plan",
+	}):
+		return path
+	}
+
+	if route, _ := matchRoute(method, path); route != "" {
+		return route
+	}
+
+	return "other"
+}
+
+// statusWriter remembers the status of a response.
+type statusWriter struct {
+	http.ResponseWriter
+	status int
+}
+
+func (w *statusWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+// metricsAdapter serves the metrics at /metrics and records every other
+// request. It must come after setup, which puts the metrics in the context,
+// and before auth so that the metrics can be scraped without logging in.
+func metricsAdapter() web.Adapter {
+	return func(nextHandler http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			ctx := req.Context()
+
+			metrics, ok := ctx.Value(MetricsCtxKey).(*Metrics)
+			if !ok {
+				callNext(nextHandler, res, req)
+
+				return
+			}
+
+			if req.URL.Path == "/metrics" {
+				api, _ := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+				res.Header().Set("Content-Type", "text/plain; version=0.0.4")
+				_ = metrics.Write(res, api)
+
+				return
+			}
+
+			start := time.Now()
+			sw := &statusWriter{ResponseWriter: res, status: http.StatusOK}
+
+			callNext(nextHandler, sw, req)
+			metrics.ObserveRequest(routeOf(req.Method, req.URL.Path), req.Method, sw.status, time.Since(start))
+		})
+	}
+}
+
+// metricStore reports the time taken by store operations and their errors.
+type metricStore struct {
+	zebra.Store
+	metrics *Metrics
+}
+
+// Instrument has the store and the allocator report to the metrics. It must be
+// called before the store is handed to anything else.
+func (api *ResourceAPI) Instrument(m *Metrics) {
+	api.Store = &metricStore{Store: api.Store, metrics: m}
+	api.Allocator.store = api.Store
+	api.Allocator.metrics = m
+}
+
+func (s *metricStore) done(op string, start time.Time, err error) {
+	s.metrics.Since(MetricStoreTime, start, "operation", op)
+
+	if err != nil {
+		s.metrics.Inc(MetricStoreErrors, "operation", op)
+	}
+}
+
+func (s *metricStore) Load() (*zebra.ResourceMap, error) {
+	start := time.Now()
+	resMap, err := s.Store.Load()
+	s.done("load", start, err)
+
+	return resMap, err
+}
+
+func (s *metricStore) Create(res zebra.Resource) error {
+	start := time.Now()
+	err := s.Store.Create(res)
+	s.done("create", start, err)
+
+	return err
+}
+
+func (s *metricStore) Delete(res zebra.Resource) error {
+	start := time.Now()
+	err := s.Store.Delete(res)
+	s.done("delete", start, err)
+
+	return err
+}
+
+func (s *metricStore) Query() *zebra.ResourceMap {
+	defer s.done("query", time.Now(), nil)
+
+	return s.Store.Query()
+}
+
+func (s *metricStore) QueryUUID(uuids []string) *zebra.ResourceMap {
+	defer s.done("query_uuid", time.Now(), nil)
+
+	return s.Store.QueryUUID(uuids)
+}
+
+func (s *metricStore) QueryType(types []string) *zebra.ResourceMap {
+	defer s.done("query_type", time.Now(), nil)
+
+	return s.Store.QueryType(types)
+}
+
+func (s *metricStore) QueryLabel(query zebra.Query) (*zebra.ResourceMap, error) {
+	start := time.Now()
+	resMap, err := s.Store.QueryLabel(query)
+	s.done("query_label", start, err)
+
+	return resMap, err
+}
+
+func (s *metricStore) QueryProperty(query zebra.Query) (*zebra.ResourceMap, error) {
+	start := time.Now()
+	resMap, err := s.Store.QueryProperty(query)
+	s.done("query_property", start, err)
+
+	return resMap, err
+}
@@ -0,0 +1,105 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRouteOf(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Equal("/login", routeOf("POST", "/login"))
+	assert.Equal("/static", routeOf("GET", "/static/js/main.js"))
+	assert.Equal("other", routeOf("GET", "/wp-admin"))
+	assert.Equal("/api/v1/resources", routeOf("GET", "/api/v1/resources"))
+	assert.Equal("/api/v1/leases/:id", routeOf("GET", "/api/v1/leases/0100000001"))
+	assert.Equal("/api/v1/leases/:id/extend", routeOf("POST", "/api/v1/leases/0100000001/extend"))
+	assert.Equal("/api/v1/leases/plan", routeOf("POST", "/api/v1/leases/plan"))
+	assert.Equal("/api/v1/sessions/:id", routeOf("DELETE", "/api/v1/sessions/abc"))
+	assert.Equal("/api/v1/tokens/:id", routeOf("DELETE", "/api/v1/tokens/abc"))
+	assert.Equal("/api/v1/sessions", routeOf("DELETE", "/api/v1/sessions"))
+
+	// Paths no route serves all end up in one series
+	assert.Equal("other", routeOf("GET", "/api/v1/made/up"))
+	assert.Equal("other", routeOf("GET", "/api/v1/tokens/abc"))
+	assert.Equal("other", routeOf("GET", "/api/v1/resources/"))
+}
+
+func TestMetricsWrite(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	m := NewMetrics()
+	m.Inc(MetricStoreErrors, "operation", "create")
+	m.Observe(MetricStoreTime, 20*time.Millisecond, "operation", "create")
+	m.Observe(MetricStoreTime, 2*time.Second, "operation", "create")
+
+	// Nil metrics are ignored
+	var none *Metrics
+	none.Inc(MetricStoreErrors, "operation", "create")
+
+	out := &strings.Builder{}
+	assert.Nil(m.Write(out, nil))
+	assert.Contains(out.String(), "# TYPE zebra_store_errors_total counter\n")
+	assert.Contains(out.String(), `zebra_store_errors_total{operation="create"} 1`)
+	assert.Contains(out.String(), "# TYPE zebra_store_duration_seconds histogram\n")
+	assert.Contains(out.String(), `zebra_store_duration_seconds_bucket{operation="create",le="0.01"} 0`)
+	assert.Contains(out.String(), `zebra_store_duration_seconds_bucket{operation="create",le="0.025"} 1`)
+	assert.Contains(out.String(), `zebra_store_duration_seconds_bucket{operation="create",le="+Inf"} 2`)
+	assert.Contains(out.String(), `zebra_store_duration_seconds_count{operation="create"} 2`)
+	assert.Equal(`a="x\"y"`, metricLabels("a", `x"y`))
+}
+
+func TestMetricsAdapter(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_metrics_adapter"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	m := NewMetrics()
+	api.Instrument(m)
+
+	assert.Nil(api.Allocator.AllocateOrQueue(serverLease("user@zebra", 1)))
+
+	h := metricsAdapter()(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusUnauthorized)
+	}))
+
+	request := func(path string) *httptest.ResponseRecorder {
+		req := createRequest(assert, "GET", path, "", api)
+		req = req.Clone(context.WithValue(req.Context(), MetricsCtxKey, m))
+		rr := httptest.NewRecorder()
+		h.ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	assert.Equal(http.StatusUnauthorized, request("/api/v1/leases/0100000001").Code)
+
+	rr := request("/metrics")
+	assert.Equal(http.StatusOK, rr.Code)
+
+	body := rr.Body.String()
+	assert.Contains(body, `zebra_http_requests_total{route="/api/v1/leases/:id",method="GET",status="401"} 1`)
+	assert.Contains(body, `zebra_auth_failures_total{route="/api/v1/leases/:id"} 1`)
+	assert.Contains(body, `zebra_allocator_duration_seconds_count{operation="allocate_or_queue"} 1`)
+	assert.Contains(body, `zebra_store_duration_seconds_count{operation="create"}`)
+	assert.Contains(body, `zebra_leases{phase="active"} 1`)
+	assert.Contains(body, `zebra_resources{type="compute.server",lifecycle=`)
+
+	// Without metrics in the context requests are only passed on
+	rr = httptest.NewRecorder()
+	h.ServeHTTP(rr, createRequest(assert, "GET", "/metrics", "", api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+}
@@ -0,0 +1,208 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+// placer picks resources for the requests of a lease out of their candidates
+// so that no resource is picked twice and the placement constraints hold.
+// Constraints keeping resources together are tried with every combination of
+// label values, spread constraints are met by picking resources with values
+// not used yet.
+type placer struct {
+	l          *lease.Lease
+	candidates [][]zebra.Resource
+	needed     []int
+	together   []lease.Placement
+	spread     []lease.Placement
+	reasons    []string
+}
+
+func newPlacer(l *lease.Lease, candidates [][]zebra.Resource, needed []int) *placer {
+	p := &placer{l: l, candidates: candidates, needed: needed, together: nil, spread: nil, reasons: nil}
+
+	for _, c := range l.Placement {
+		if c.Policy == lease.PlaceTogether {
+			p.together = append(p.together, c)
+		} else {
+			p.spread = append(p.spread, c)
+		}
+	}
+
+	return p
+}
+
+// place returns the picked resources of every request, or an ErrAllocate
+// explaining why the last combination of label values could not be placed.
+// The reasons of all failed attempts are kept in p.reasons.
+func (p *placer) place() ([][]zebra.Resource, error) {
+	for _, c := range p.together {
+		if len(p.values(c)) == 0 {
+			err := fmt.Errorf("%w: no candidates have label %s for %s", ErrAllocate, c.Key, c.String())
+			p.reasons = append(p.reasons, err.Error())
+
+			return nil, err
+		}
+	}
+
+	var err error
+
+	for _, values := range p.combinations() {
+		picked, e := p.pick(values)
+		if e == nil {
+			return picked, nil
+		}
+
+		err = e
+		p.reasons = append(p.reasons, e.Error())
+	}
+
+	return nil, err
+}
+
+// combinations returns every combination of label values for the constraints
+// keeping resources together.
+func (p *placer) combinations() [][]string {
+	combinations := [][]string{{}}
+
+	for _, c := range p.together {
+		next := [][]string{}
+
+		for _, combination := range combinations {
+			for _, v := range p.values(c) {
+				next = append(next, append(append([]string{}, combination...), v))
+			}
+		}
+
+		combinations = next
+	}
+
+	return combinations
+}
+
+// values returns the sorted label values of the candidates of the requests a
+// constraint applies to.
+func (p *placer) values(c lease.Placement) []string {
+	set := map[string]struct{}{}
+
+	for i, req := range p.l.Request {
+		if !c.Applies(req) {
+			continue
+		}
+
+		for _, res := range p.candidates[i] {
+			if v, ok := res.GetMeta().Labels[c.Key]; ok {
+				set[v] = struct{}{}
+			}
+		}
+	}
+
+	values := make([]string, 0, len(set))
+	for v := range set {
+		values = append(values, v)
+	}
+
+	sort.Strings(values)
+
+	return values
+}
+
+// pick picks resources in order, keeping the resources of every constraint
+// together at the given value.
+func (p *placer) pick(values []string) ([][]zebra.Resource, error) {
+	taken := map[string]struct{}{}
+	used := make([]map[string]struct{}, len(p.spread))
+	picked := make([][]zebra.Resource, len(p.l.Request))
+
+	for i := range used {
+		used[i] = map[string]struct{}{}
+	}
+
+	for i, req := range p.l.Request {
+		for _, res := range p.candidates[i] {
+			if len(picked[i]) == p.needed[i] {
+				break
+			}
+
+			if _, ok := taken[res.GetMeta().ID]; ok || !p.fits(req, res, values, used) {
+				continue
+			}
+
+			picked[i] = append(picked[i], res)
+			taken[res.GetMeta().ID] = struct{}{}
+
+			for j, c := range p.spread {
+				if c.Applies(req) {
+					used[j][res.GetMeta().Labels[c.Key]] = struct{}{}
+				}
+			}
+		}
+
+		if len(picked[i]) < p.needed[i] {
+			return nil, fmt.Errorf("%w: %s wanted %d, found %d%s", ErrAllocate, req.Type, p.needed[i],
+				len(picked[i]), p.describe(req, values))
+		}
+	}
+
+	return picked, nil
+}
+
+// fits returns true if the resource can be picked for the request without
+// breaking a constraint.
+func (p *placer) fits(req *lease.ResourceReq, res zebra.Resource, values []string,
+	used []map[string]struct{},
+) bool {
+	labels := res.GetMeta().Labels
+
+	for i, c := range p.together {
+		if c.Applies(req) && !labels.MatchEqual(c.Key, values[i]) {
+			return false
+		}
+	}
+
+	for i, c := range p.spread {
+		if !c.Applies(req) {
+			continue
+		}
+
+		v, ok := labels[c.Key]
+		if !ok {
+			return false
+		}
+
+		if _, ok := used[i][v]; ok {
+			return false
+		}
+	}
+
+	return true
+}
+
+// describe returns the constraints that applied to a request, to explain why
+// it could not be placed.
+func (p *placer) describe(req *lease.ResourceReq, values []string) string {
+	applied := []string{}
+
+	for i, c := range p.together {
+		if c.Applies(req) {
+			applied = append(applied, fmt.Sprintf("%s=%s", c.Key, values[i]))
+		}
+	}
+
+	for _, c := range p.spread {
+		if c.Applies(req) {
+			applied = append(applied, "spread over "+c.Key)
+		}
+	}
+
+	if len(applied) == 0 {
+		return ""
+	}
+
+	return " with " + strings.Join(applied, ", ")
+}
@@ -0,0 +1,172 @@
+package main //nolint:testpackage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+// makeRackAPI stores four servers, in racks r1, r2, r2 and r3 and in labs a,
+// a, b and c.
+func makeRackAPI(assert *assert.Assertions, root string) *ResourceAPI {
+	api := NewResourceAPI(model.Factory())
+	assert.Nil(api.Initialize(root))
+
+	racks := []string{"r1", "r2", "r2", "r3"}
+	labs := []string{"a", "a", "b", "c"}
+
+	for i, s := range compute.MockServer(len(racks)) {
+		s.GetMeta().Labels.Add("rack", racks[i]).Add("lab", labs[i])
+		assert.Nil(api.Store.Create(s))
+	}
+
+	return api
+}
+
+func placedLease(count int, placement ...lease.Placement) *lease.Lease {
+	l := serverLease("user@zebra", count)
+	l.Placement = placement
+
+	return l
+}
+
+func labelsOf(api *ResourceAPI, l *lease.Lease, key string) []string {
+	values := []string{}
+
+	for _, req := range l.Request {
+		for _, id := range req.Resources {
+			values = append(values, findResource(api.Store, id).GetMeta().Labels[key])
+		}
+	}
+
+	return values
+}
+
+func TestPlacementValidate(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	reqs := []*lease.ResourceReq{{Type: "compute.server", Name: "servers", Count: 1}}
+
+	assert.Nil(lease.Placement{Policy: lease.PlaceTogether, Key: "rack"}.Validate(reqs))
+	assert.Nil(lease.Placement{Policy: lease.PlaceSpread, Key: "lab", Requests: []string{"servers"}}.Validate(reqs))
+	assert.NotNil(lease.Placement{Policy: "near", Key: "rack"}.Validate(reqs))
+	assert.NotNil(lease.Placement{Policy: lease.PlaceTogether}.Validate(reqs))
+	assert.NotNil(lease.Placement{Policy: lease.PlaceTogether, Key: "rack", Requests: []string{"x"}}.Validate(reqs))
+	assert.Equal("spread lab for servers", lease.Placement{
+		Policy: lease.PlaceSpread, Key: "lab", Requests: []string{"servers"},
+	}.String())
+}
+
+func TestPlacement(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_placement"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeRackAPI(assert, root)
+	a := api.Allocator
+	sameRack := lease.Placement{Policy: lease.PlaceTogether, Key: "rack"}
+	spreadLab := lease.Placement{Policy: lease.PlaceSpread, Key: "lab"}
+
+	// Only r2 has two servers
+	l := placedLease(2, sameRack)
+	assert.Nil(a.Allocate(l))
+	assert.Equal([]string{"r2", "r2"}, labelsOf(api, l, "rack"))
+	assert.Nil(a.Release(l, "user@zebra"))
+
+	err := a.Allocate(placedLease(3, sameRack))
+	assert.ErrorIs(err, ErrAllocate)
+	assert.Contains(err.Error(), "with rack=")
+
+	l = placedLease(3, spreadLab)
+	assert.Nil(a.Allocate(l))
+	assert.ElementsMatch([]string{"a", "b", "c"}, labelsOf(api, l, "lab"))
+	assert.Nil(a.Release(l, "user@zebra"))
+
+	assert.ErrorIs(a.Allocate(placedLease(4, spreadLab)), ErrAllocate)
+
+	// Across requests of a lease
+	l = lease.NewLease("user@zebra", time.Hour, []*lease.ResourceReq{
+		{Type: "compute.server", Name: "first", Count: 1},
+		{Type: "compute.server", Name: "second", Count: 1},
+	})
+	l.Placement = []lease.Placement{sameRack, {Policy: lease.PlaceSpread, Key: "lab", Requests: []string{"first", "second"}}}
+	assert.Nil(a.Allocate(l))
+	assert.Equal([]string{"r2", "r2"}, labelsOf(api, l, "rack"))
+	assert.ElementsMatch([]string{"a", "b"}, labelsOf(api, l, "lab"))
+	assert.Nil(a.Release(l, "user@zebra"))
+
+	err = a.Allocate(placedLease(1, lease.Placement{Policy: lease.PlaceTogether, Key: "switch"}))
+	assert.ErrorIs(err, ErrAllocate)
+	assert.Contains(err.Error(), "label switch")
+}
+
+func TestPlanHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_plan_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeRackAPI(assert, root)
+	h := handleLeasePost()
+
+	plan := func(id string, l *lease.Lease, claims bool) *httptest.ResponseRecorder {
+		b, err := json.Marshal(l)
+		assert.Nil(err)
+
+		rr := httptest.NewRecorder()
+		req := createRequest(assert, "POST", "/", string(b), api)
+
+		if claims {
+			req = makeClaimsRequest(assert, "POST", "/", string(b), api, userClaims(assert, "user@zebra"))
+		}
+
+		h(rr, req, httprouter.Params{{Key: "id", Value: id}})
+
+		return rr
+	}
+
+	sameRack := lease.Placement{Policy: lease.PlaceTogether, Key: "rack"}
+
+	assert.Equal(http.StatusNotFound, plan("0100000001", placedLease(2), true).Code)
+	assert.Equal(http.StatusUnauthorized, plan("plan", placedLease(2), false).Code)
+	assert.Equal(http.StatusBadRequest, plan("plan", placedLease(2, lease.Placement{}), true).Code)
+
+	rr := plan("plan", placedLease(2, sameRack), true)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	p := new(Plan)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), p))
+	assert.True(p.Feasible)
+	assert.Len(p.Requests[0].Candidates, 4)
+	assert.Len(p.Requests[0].Picked, 2)
+
+	rr = plan("plan", placedLease(3, sameRack), true)
+	assert.Equal(http.StatusOK, rr.Code)
+
+	p = new(Plan)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), p))
+	assert.False(p.Feasible)
+	assert.Empty(p.Requests[0].Picked)
+	assert.Len(p.Reasons, 3)
+
+	// Nothing was reserved
+	for _, r := range api.Store.QueryType([]string{"compute.server"}).Resources["compute.server"].Resources {
+		assert.Equal(zebra.Free, r.GetStatus().LeaseStatus)
+	}
+}
@@ -0,0 +1,200 @@
+package main
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+// Plan is the outcome of a dry run of the allocation of a lease. Reasons
+// explain why the lease could not be placed or would be over quota, Approvers
+// are the roles that would have to approve it.
+type Plan struct {
+	Feasible  bool          `json:"feasible"`
+	Requests  []RequestPlan `json:"requests"`
+	Reasons   []string      `json:"reasons,omitempty"`
+	Approvers []string      `json:"approvers,omitempty"`
+}
+
+// RequestPlan lists the resources a request could get and the ones it would
+// get if the lease was allocated now. If there are not enough candidates,
+// Rejected tells why the other resources were not.
+type RequestPlan struct {
+	Type       string      `json:"type"`
+	Name       string      `json:"name,omitempty"`
+	Count      int         `json:"count"`
+	Candidates []string    `json:"candidates"`
+	Picked     []string    `json:"picked,omitempty"`
+	Rejected   *Rejections `json:"rejected,omitempty"`
+}
+
+// Rejections counts the resources that are no candidates for a request by the
+// first reason they were rejected for.
+type Rejections struct {
+	Type        int `json:"type"`
+	Group       int `json:"group"`
+	Filter      int `json:"filter"`
+	Fault       int `json:"fault"`
+	LeaseStatus int `json:"leaseStatus"`
+	Lifecycle   int `json:"lifecycle"`
+	Booked      int `json:"booked"`
+}
+
+// Plan runs the allocation of a lease without reserving anything.
+func (a *Allocator) Plan(l *lease.Lease) *Plan {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	start, future := leaseStart(l, time.Now())
+	p := a.pick(l, start, future)
+	picked, err := p.place()
+
+	plan := &Plan{
+		Feasible:  err == nil,
+		Requests:  make([]RequestPlan, 0, len(l.Request)),
+		Reasons:   p.reasons,
+		Approvers: a.approvers(l),
+	}
+
+	if err != nil {
+		plan.Reasons = append(plan.Reasons, a.unavailablePins(p)...)
+	}
+
+	if err := a.checkQuota(l, 0); err != nil {
+		plan.Feasible = false
+		plan.Reasons = append(plan.Reasons, err.Error())
+	}
+
+	for i, req := range l.Request {
+		rp := RequestPlan{
+			Type:       req.Type,
+			Name:       req.Name,
+			Count:      req.Count,
+			Candidates: resourceIDs(p.candidates[i]),
+			Picked:     nil,
+			Rejected:   nil,
+		}
+
+		if picked != nil {
+			rp.Picked = resourceIDs(picked[i])
+		}
+
+		if len(p.candidates[i]) < p.needed[i] {
+			rp.Rejected = a.rejections(req, start, start.Add(l.Duration), future)
+		}
+
+		plan.Requests = append(plan.Requests, rp)
+	}
+
+	return plan
+}
+
+// rejections checks every resource against a request the way candidates does
+// and counts why the resources are rejected.
+func (a *Allocator) rejections(req *lease.ResourceReq, start, end time.Time, future bool) *Rejections {
+	r := new(Rejections)
+	cal := a.calendar()
+
+	_ = applyFunc(a.store.Query(), func(res zebra.Resource) error {
+		meta := res.GetMeta()
+		status := res.GetStatus()
+		inService := status.Lifecycle == zebra.Available || (future && status.Lifecycle == zebra.InUse)
+
+		switch {
+		case meta.Type.Name != req.Type:
+			r.Type++
+		case req.Group != "" && !meta.Labels.MatchEqual("system.group", req.Group):
+			r.Group++
+		case !matchFilters(meta.Labels, req.Filters):
+			r.Filter++
+		case !future && status.Fault != zebra.None:
+			r.Fault++
+		case !future && status.LeaseStatus != zebra.Free:
+			r.LeaseStatus++
+		case !inService:
+			r.Lifecycle++
+		case !cal.IsFree(meta.ID, start, end):
+			r.Booked++
+		}
+
+		return nil
+	})
+
+	return r
+}
+
+// matchFilters returns true if the labels match all of the label filters.
+func matchFilters(labels zebra.Labels, filters []zebra.Query) bool {
+	for _, q := range filters {
+		inVals := q.Op == zebra.MatchEqual || q.Op == zebra.MatchIn
+		if labels.MatchIn(q.Key, q.Values...) != inVals {
+			return false
+		}
+	}
+
+	return true
+}
+
+func resourceIDs(resources []zebra.Resource) []string {
+	ids := make([]string, 0, len(resources))
+
+	for _, res := range resources {
+		ids = append(ids, res.GetMeta().ID)
+	}
+
+	return ids
+}
+
+// handleLeasePost serves POST /api/v1/leases/:id. The router does not allow
+// static paths next to the :id wildcard, so /api/v1/leases/plan is served
+// here.
+func handleLeasePost() httprouter.Handle {
+	plan := handlePlan()
+
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		if params.ByName("id") != "plan" {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		plan(res, req, params)
+	}
+}
+
+// handlePlan returns the plan for a lease without creating it.
+func handlePlan() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		l, err := readLease(req, api, claims)
+		if err != nil {
+			res.WriteHeader(readStatus(err))
+			log.Info("lease could not be planned", "error", err.Error())
+
+			return
+		}
+
+		writeJSON(ctx, res, api.Allocator.Plan(l))
+	}
+}
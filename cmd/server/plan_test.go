@@ -0,0 +1,66 @@
+package main //nolint:testpackage
+
+import (
+	"os"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestPlanRejections(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_plan_rejections"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 3)
+	a := api.Allocator
+
+	leased := serverLease("other@zebra", 1)
+	assert.Nil(a.Allocate(leased))
+
+	free := a.Plan(serverLease("user@zebra", 1))
+	assert.True(free.Feasible)
+	assert.Nil(free.Requests[0].Rejected)
+
+	for _, r := range api.Store.QueryType([]string{"compute.server"}).Resources["compute.server"].Resources {
+		if r.GetStatus().LeaseStatus == zebra.Free {
+			assert.Nil(a.SetFault(r, zebra.Major))
+
+			break
+		}
+	}
+
+	plan := a.Plan(serverLease("user@zebra", 3))
+	assert.False(plan.Feasible)
+	assert.NotEmpty(plan.Reasons)
+	assert.Len(plan.Requests[0].Candidates, 1)
+	assert.Empty(plan.Requests[0].Picked)
+
+	rejected := plan.Requests[0].Rejected
+	assert.NotNil(rejected)
+	assert.Equal(1, rejected.Type)
+	assert.Equal(1, rejected.LeaseStatus)
+	assert.Equal(1, rejected.Fault)
+	assert.Zero(rejected.Group + rejected.Filter + rejected.Lifecycle + rejected.Booked)
+
+	grouped := serverLease("user@zebra", 1)
+	grouped.Request[0].Group = "nowhere"
+	assert.Equal(3, a.Plan(grouped).Requests[0].Rejected.Group)
+
+	filtered := serverLease("user@zebra", 1)
+	filtered.Request[0].Filters = []zebra.Query{{Key: "env", Op: zebra.MatchEqual, Values: []string{"prod"}}}
+	assert.Equal(3, a.Plan(filtered).Requests[0].Rejected.Filter)
+
+	// Nothing changed and approvals are shown
+	assert.Nil(api.Store.Create(lease.NewPolicy("servers", "compute.server", nil, "")))
+
+	plan = a.Plan(serverLease("user@zebra", 1))
+	assert.True(plan.Feasible)
+	assert.Equal([]string{lease.DefaultApprover}, plan.Approvers)
+	assert.Equal(lease.Activated, leased.Phase)
+}
@@ -0,0 +1,295 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+var ErrCapacity = errors.New("not enough resources in service to ever satisfy the request")
+
+// QueueConfig is the "queue" section of the server configuration. Queued leases
+// of users whose role has a higher priority are served first.
+type QueueConfig struct {
+	Priorities map[string]int `json:"priorities"`
+}
+
+func DefaultPriorities() map[string]int {
+	return map[string]int{"admin": 10} //nolint:gomnd
+}
+
+// SetPriorities sets the queue priority of each role.
+func (a *Allocator) SetPriorities(priorities map[string]int) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	a.priorities = priorities
+}
+
+// Priority returns the queue priority of a role, 0 for roles without one.
+func (a *Allocator) Priority(role *auth.Role) int {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if role == nil {
+		return 0
+	}
+
+	return a.priorities[role.Name]
+}
+
+// AllocateOrQueue allocates resources to a lease that starts now, or queues
+// the lease if there are not enough free resources right now. A lease that
+// could never be satisfied with the resources in service is not queued, nor is
+// a lease that would take its owner over a quota. A lease that may get
+// resources under an approval policy waits for approval first.
+func (a *Allocator) AllocateOrQueue(l *lease.Lease) error {
+	defer a.metrics.Since(MetricAllocatorTime, time.Now(), "operation", "allocate_or_queue")
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if err := a.checkQuota(l, 0); err != nil {
+		return err
+	}
+
+	if roles := a.approvers(l); len(roles) > 0 {
+		l.AwaitApproval(roles)
+
+		return a.store.Create(l)
+	}
+
+	return a.allocateOrQueue(l)
+}
+
+func (a *Allocator) allocateOrQueue(l *lease.Lease) error {
+	err := a.allocate(l)
+	if err == nil || !errors.Is(err, ErrAllocate) || l.IsFuture(time.Now()) {
+		return err
+	}
+
+	for _, req := range l.Request {
+		inService := 0
+
+		for _, res := range a.matching(req) {
+			if l := res.GetStatus().Lifecycle; l == zebra.Available || l == zebra.InUse {
+				inService++
+			}
+		}
+
+		if inService < req.Count && req.IsPinned() {
+			// err tells which pinned resources are missing or out of service
+			return fmt.Errorf("%w, %s", err, ErrCapacity.Error())
+		}
+
+		if inService < req.Count {
+			return fmt.Errorf("%w: %s: %s wanted %d, %d in service", ErrAllocate, ErrCapacity.Error(),
+				req.Type, req.Count, inService)
+		}
+	}
+
+	l.Enqueue()
+
+	return a.store.Create(l)
+}
+
+// Drain hands out free resources to queued leases.
+func (a *Allocator) Drain() ([]*lease.Lease, error) {
+	defer a.metrics.Since(MetricAllocatorTime, time.Now(), "operation", "drain")
+
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	return a.drain()
+}
+
+// drain goes through the queue in order. Once a lease can not be satisfied the
+// types it asks for are held back for it, so that later and smaller leases for
+// the same types do not starve it. Leases for other types are still served.
+func (a *Allocator) drain() ([]*lease.Lease, error) {
+	activated := []*lease.Lease{}
+	blocked := map[string]struct{}{}
+
+	for _, l := range a.queue() {
+		if isBlocked(l, blocked) {
+			continue
+		}
+
+		err := a.allocate(l)
+		if errors.Is(err, ErrAllocate) {
+			for _, req := range l.Request {
+				blocked[req.Type] = struct{}{}
+			}
+
+			continue
+		}
+
+		if err != nil {
+			return activated, err
+		}
+
+		activated = append(activated, l)
+	}
+
+	return activated, nil
+}
+
+func isBlocked(l *lease.Lease, blocked map[string]struct{}) bool {
+	for _, req := range l.Request {
+		if _, ok := blocked[req.Type]; ok {
+			return true
+		}
+	}
+
+	return false
+}
+
+// queue returns the queued leases by priority and then by arrival.
+func (a *Allocator) queue() []*lease.Lease {
+	queue := a.leases(lease.Queued)
+
+	sort.SliceStable(queue, func(i, j int) bool {
+		if queue[i].Priority != queue[j].Priority {
+			return queue[i].Priority > queue[j].Priority
+		}
+
+		return queue[i].Meta.CreationTime.Before(queue[j].Meta.CreationTime)
+	})
+
+	return queue
+}
+
+// LeaseStatus is a lease along with its place in the queue. Position starts at
+// 1 and is 0 for leases that are not queued. ETA is an estimate of when the
+// lease gets its resources, based on the end of the leases holding them, and is
+// zero when no estimate can be made.
+type LeaseStatus struct {
+	Lease    *lease.Lease `json:"lease"`
+	Position int          `json:"position"`
+	ETA      time.Time    `json:"eta"`
+}
+
+// Status returns the queue position and the estimated start of a lease.
+func (a *Allocator) Status(l *lease.Lease) LeaseStatus {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	status := LeaseStatus{Lease: l, Position: 0, ETA: time.Time{}}
+
+	if l.Phase != lease.Queued {
+		return status
+	}
+
+	queue := a.queue()
+	ahead := map[string]int{}
+
+	for i, q := range queue {
+		if q.Meta.ID == l.Meta.ID {
+			status.Position = i + 1
+
+			break
+		}
+
+		for _, req := range q.Request {
+			ahead[req.Type] += req.Count
+		}
+	}
+
+	status.ETA = a.eta(l, ahead)
+
+	return status
+}
+
+// eta estimates when enough resources for every request of the lease are free
+// if the leases ahead in the queue are served first.
+func (a *Allocator) eta(l *lease.Lease, ahead map[string]int) time.Time {
+	cal := a.calendar()
+	now := time.Now()
+	eta := now
+
+	for _, req := range l.Request {
+		free := 0
+		ends := []time.Time{}
+
+		for _, res := range a.matching(req) {
+			if res.GetStatus().Allocatable() && cal.IsFree(res.GetMeta().ID, now, now.Add(l.Duration)) {
+				free++
+
+				continue
+			}
+
+			if res.GetStatus().Lifecycle != zebra.InUse {
+				continue
+			}
+
+			if b := cal[res.GetMeta().ID]; len(b) > 0 {
+				ends = append(ends, b[len(b)-1].End)
+			}
+		}
+
+		needed := ahead[req.Type] + req.Count - free
+		if needed <= 0 {
+			continue
+		}
+
+		if needed > len(ends) {
+			return time.Time{}
+		}
+
+		sort.Slice(ends, func(i, j int) bool { return ends[i].Before(ends[j]) })
+
+		if end := ends[needed-1]; end.After(eta) {
+			eta = end
+		}
+	}
+
+	return eta
+}
+
+// handleLeaseStatus returns a lease with its queue position and estimated
+// start. Only the owner of the lease or a user who can read leases may see it.
+func handleLeaseStatus() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		l, ok := findResource(api.Store, params.ByName("id")).(*lease.Lease)
+		if !ok {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		if l.Owner() != claims.Email && !claims.Read(lease.Type().Name) {
+			res.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		log.Info("lease status requested", "id", l.Meta.ID, "user", claims.Email)
+
+		writeJSON(ctx, res, api.Allocator.Status(l))
+	}
+}
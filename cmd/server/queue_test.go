@@ -0,0 +1,135 @@
+package main //nolint:testpackage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestQueue(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_queue"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	a := api.Allocator
+
+	first := serverLease("first@zebra", 2)
+	assert.Nil(a.AllocateOrQueue(first))
+	assert.Equal(lease.Activated, first.Phase)
+
+	// Never satisfiable with two servers
+	assert.ErrorIs(a.AllocateOrQueue(serverLease("greedy@zebra", 3)), ErrAllocate)
+
+	user := serverLease("user@zebra", 2)
+	assert.Nil(a.AllocateOrQueue(user))
+	assert.Equal(lease.Queued, user.Phase)
+
+	small := serverLease("small@zebra", 1)
+	assert.Nil(a.AllocateOrQueue(small))
+
+	admin := serverLease("admin@zebra", 1)
+	admin.Priority = a.Priority(adminClaims(assert).Role)
+	assert.Equal(10, admin.Priority)
+	assert.Nil(a.AllocateOrQueue(admin))
+
+	status := a.Status(admin)
+	assert.Equal(1, status.Position)
+	assert.False(status.ETA.IsZero())
+	assert.Equal(2, a.Status(user).Position)
+	assert.Equal(3, a.Status(small).Position)
+	assert.Equal(0, a.Status(first).Position)
+
+	// Nothing is free yet
+	drained, err := a.Drain()
+	assert.Nil(err)
+	assert.Empty(drained)
+
+	// The admin lease is served first, then user waits for the second server
+	// and small may not jump ahead of it.
+	assert.Nil(a.Release(first, "first@zebra"))
+	assert.Equal(lease.Activated, findResource(api.Store, admin.Meta.ID).(*lease.Lease).Phase)
+	assert.Equal(lease.Queued, findResource(api.Store, user.Meta.ID).(*lease.Lease).Phase)
+	assert.Equal(lease.Queued, findResource(api.Store, small.Meta.ID).(*lease.Lease).Phase)
+	assert.Equal(1, a.Status(user).Position)
+
+	// Cancelling a queued lease does not touch any resource
+	assert.Nil(a.Release(user, "user@zebra"))
+	assert.Equal(lease.Released, user.Phase)
+
+	drained, err = a.Drain()
+	assert.Nil(err)
+	assert.Len(drained, 1)
+	assert.Equal(small.Meta.ID, drained[0].Meta.ID)
+
+	// Servers out of service do not count towards the capacity
+	assert.Nil(a.Release(admin, "admin@zebra"))
+
+	for _, r := range api.Store.QueryType([]string{"compute.server"}).Resources["compute.server"].Resources {
+		if r.GetStatus().Allocatable() {
+			assert.Nil(a.Transition(r, zebra.Maintenance, "admin@zebra", "broken"))
+		}
+	}
+
+	assert.ErrorIs(a.AllocateOrQueue(serverLease("late@zebra", 2)), ErrAllocate)
+}
+
+func TestLeaseStatusHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_lease_status"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	assert.Nil(api.Allocator.AllocateOrQueue(serverLease("first@zebra", 1)))
+
+	l := serverLease("user@zebra", 1)
+	assert.Nil(api.Allocator.AllocateOrQueue(l))
+
+	status := func(id string, claims *auth.Claims) *httptest.ResponseRecorder {
+		h := handleLeaseStatus()
+		rr := httptest.NewRecorder()
+		req := createRequest(assert, "GET", "/", "{}", api)
+
+		if claims != nil {
+			req = makeClaimsRequest(assert, "GET", "/", "{}", api, claims)
+		}
+
+		h(rr, req, httprouter.Params{{Key: "id", Value: id}})
+
+		return rr
+	}
+
+	nobody := auth.NewClaims("zebra", "other", &auth.Role{Name: "none", Privileges: nil}, "other@zebra")
+
+	assert.Equal(http.StatusUnauthorized, status(l.Meta.ID, nil).Code)
+	assert.Equal(http.StatusNotFound, status("0000000000", userClaims(assert, "user@zebra")).Code)
+	assert.Equal(http.StatusForbidden, status(l.Meta.ID, nobody).Code)
+
+	rr := status(l.Meta.ID, userClaims(assert, "user@zebra"))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	got := struct {
+		Lease    *lease.Lease `json:"lease"`
+		Position int          `json:"position"`
+		ETA      time.Time    `json:"eta"`
+	}{}
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), &got))
+	assert.Equal(lease.Queued, got.Lease.Phase)
+	assert.Equal(1, got.Position)
+	assert.True(got.ETA.After(time.Now().Add(30 * time.Minute)))
+}
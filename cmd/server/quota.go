@@ -0,0 +1,264 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/project-safari/zebra/model/user"
+)
+
+var ErrQuota = errors.New("lease quota exceeded")
+
+// QuotaUsage is what the leases of the subject of a quota hold against its
+// limits. Hours include the hours used by released leases within the period of
+// the quota.
+type QuotaUsage struct {
+	Quota     *lease.Quota `json:"quota"`
+	Subject   string       `json:"subject"`
+	Resources int          `json:"resources"`
+	Hours     float64      `json:"hours"`
+}
+
+// Exceeds returns true if the usage is over one of the limits of the quota.
+func (u QuotaUsage) Exceeds() bool {
+	return (u.Quota.MaxResources > 0 && u.Resources > u.Quota.MaxResources) ||
+		(u.Quota.MaxHours > 0 && u.Hours > u.Quota.MaxHours)
+}
+
+func (u QuotaUsage) add(q *lease.Quota, l *lease.Lease, by time.Duration) QuotaUsage {
+	for _, req := range l.RequestList() {
+		if q.Counts(req) {
+			u.Resources += req.Count
+			u.Hours += float64(req.Count) * (l.Duration + by).Hours()
+		}
+	}
+
+	return u
+}
+
+// addUsed adds the part of a recorded usage within the period of the quota up
+// to now.
+func (u QuotaUsage) addUsed(q *lease.Quota, used *lease.Usage, now time.Time) QuotaUsage {
+	if !q.Counts(&lease.ResourceReq{Type: used.ResourceType}) {
+		return u
+	}
+
+	if start, end, ok := used.Within(now.Add(-q.Window()), now); ok {
+		u.Hours += end.Sub(start).Hours()
+	}
+
+	return u
+}
+
+// checkQuota returns an error if the lease, extended by the given duration,
+// would take its owner over any of the quotas that apply to them. Leases that
+// have not been released count against the quotas, whether they wait for
+// approval, are queued, scheduled or active, and so do the hours used by
+// released leases within the period of the quota.
+func (a *Allocator) checkQuota(l *lease.Lease, by time.Duration) error {
+	quotas := a.quotas()
+	if len(quotas) == 0 {
+		return nil
+	}
+
+	groups := a.userGroups()
+	used := a.usages()
+	now := time.Now()
+	owner := l.Owner()
+	held := []*lease.Lease{}
+
+	for _, o := range a.outstanding() {
+		if o.Meta.ID != l.Meta.ID {
+			held = append(held, o)
+		}
+	}
+
+	for _, q := range quotas {
+		if !q.Applies(owner, groups[owner]) {
+			continue
+		}
+
+		if usage := quotaUsage(q, owner, groups, held, used, now).add(q, l, by); usage.Exceeds() {
+			return fmt.Errorf("%w: %s: quota %s allows %d resources and %.1f hours, asked for %d and %.1f",
+				ErrQuota, usage.Subject, q.Meta.Name, q.MaxResources, q.MaxHours, usage.Resources, usage.Hours)
+		}
+	}
+
+	return nil
+}
+
+// Usage returns the usage of every quota that applies to the user, or of all
+// quotas if user is empty. A quota for every user has one usage for each user
+// holding leases or having used any within the period of the quota.
+func (a *Allocator) Usage(email string) []QuotaUsage {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	groups := a.userGroups()
+	outstanding := a.outstanding()
+	used := a.usages()
+	now := time.Now()
+	usages := []QuotaUsage{}
+
+	for _, q := range a.quotas() {
+		switch {
+		case email != "" && !q.Applies(email, groups[email]):
+		case q.User == "" && q.Group == "":
+			owners := []string{email}
+			if email == "" {
+				owners = quotaOwners(q, outstanding, used, now)
+			}
+
+			for _, owner := range owners {
+				usages = append(usages, quotaUsage(q, owner, groups, outstanding, used, now))
+			}
+		default:
+			usages = append(usages, quotaUsage(q, q.User, groups, outstanding, used, now))
+		}
+	}
+
+	return usages
+}
+
+// quotaUsage returns the usage of a quota by the leases of the group of the
+// quota, or by the leases of owner.
+func quotaUsage(q *lease.Quota, owner string, groups map[string]string, leases []*lease.Lease,
+	used []*lease.Usage, now time.Time,
+) QuotaUsage {
+	usage := QuotaUsage{Quota: q, Subject: q.Subject(owner), Resources: 0, Hours: 0}
+
+	for _, l := range leases {
+		if (q.Group != "" && groups[l.Owner()] == q.Group) || (q.Group == "" && l.Owner() == owner) {
+			usage = usage.add(q, l, 0)
+		}
+	}
+
+	for _, u := range used {
+		if (q.Group != "" && u.Group == q.Group) || (q.Group == "" && u.User == owner) {
+			usage = usage.addUsed(q, u, now)
+		}
+	}
+
+	return usage
+}
+
+// quotaOwners returns the sorted owners of the leases and of the usage within
+// the period of the quota.
+func quotaOwners(q *lease.Quota, leases []*lease.Lease, used []*lease.Usage, now time.Time) []string {
+	owners := []string{}
+	seen := map[string]struct{}{}
+	from := now.Add(-q.Window())
+
+	add := func(owner string) {
+		if _, ok := seen[owner]; !ok {
+			seen[owner] = struct{}{}
+			owners = append(owners, owner)
+		}
+	}
+
+	for _, l := range leases {
+		add(l.Owner())
+	}
+
+	for _, u := range used {
+		if _, _, ok := u.Within(from, now); ok {
+			add(u.User)
+		}
+	}
+
+	sort.Strings(owners)
+
+	return owners
+}
+
+// quotas returns the stored quotas.
+func (a *Allocator) quotas() []*lease.Quota {
+	quotas := []*lease.Quota{}
+
+	_ = applyFunc(a.store.QueryType([]string{lease.QuotaType().Name}), func(res zebra.Resource) error {
+		if q, ok := res.(*lease.Quota); ok {
+			quotas = append(quotas, q)
+		}
+
+		return nil
+	})
+
+	sort.Slice(quotas, func(i, j int) bool { return quotas[i].Meta.Name < quotas[j].Meta.Name })
+
+	return quotas
+}
+
+// outstanding returns the leases that have not been released.
+func (a *Allocator) outstanding() []*lease.Lease {
+	leases := []*lease.Lease{}
+
+	phases := []lease.Phase{lease.PendingApproval, lease.Queued, lease.Scheduled, lease.SettingUp, lease.Activated}
+
+	for _, phase := range phases {
+		leases = append(leases, a.leases(phase)...)
+	}
+
+	return leases
+}
+
+// userGroups returns the group of every user by email.
+func (a *Allocator) userGroups() map[string]string {
+	groups := map[string]string{}
+
+	_ = applyFunc(a.store.QueryType([]string{user.Type().Name}), func(res zebra.Resource) error {
+		if u, ok := res.(*user.User); ok {
+			groups[u.Email] = u.Meta.Labels["system.group"]
+		}
+
+		return nil
+	})
+
+	return groups
+}
+
+// handleQuotas returns the usage of the quotas that apply to the authenticated
+// user, or of all quotas for users who can read quotas and ask for "all".
+func handleQuotas() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		email := claims.Email
+
+		if req.URL.Query().Get("all") == "true" {
+			if !claims.Read(lease.QuotaType().Name) {
+				res.WriteHeader(http.StatusForbidden)
+
+				return
+			}
+
+			email = ""
+		}
+
+		log.Info("quota usage requested", "user", claims.Email, "all", email == "")
+
+		writeJSON(ctx, res, api.Allocator.Usage(email))
+	}
+}
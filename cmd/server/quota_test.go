@@ -0,0 +1,206 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/project-safari/zebra/model/user"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeGroupUser(assert *assert.Assertions, api *ResourceAPI, email, group string) {
+	key, err := auth.Generate()
+	assert.Nil(err)
+
+	u := user.NewUser(email, email, "Secret1234!!", key.Public(), DefaultRole())
+	u.Meta.Labels.Add("system.group", group)
+	assert.Nil(api.Store.Create(u))
+}
+
+func TestQuota(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_quota"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 10)
+	a := api.Allocator
+
+	makeGroupUser(assert, api, "a@zebra", "devs")
+	makeGroupUser(assert, api, "b@zebra", "devs")
+	makeGroupUser(assert, api, "c@zebra", "ops")
+
+	// Every user may hold 3 servers, devs 4 together, c 5 lease hours
+	assert.Nil(api.Store.Create(lease.NewQuota("per-user", "", "", "compute.server", 3, 0)))
+	assert.Nil(api.Store.Create(lease.NewQuota("devs", "", "devs", "", 4, 0)))
+	assert.Nil(api.Store.Create(lease.NewQuota("c", "c@zebra", "", "", 0, 5)))
+
+	assert.Nil(a.AllocateOrQueue(serverLease("a@zebra", 3)))
+	assert.ErrorIs(a.AllocateOrQueue(serverLease("a@zebra", 1)), ErrQuota)
+	assert.ErrorIs(a.AllocateOrQueue(serverLease("b@zebra", 2)), ErrQuota)
+	assert.Nil(a.AllocateOrQueue(serverLease("b@zebra", 1)))
+
+	c := serverLease("c@zebra", 3)
+	assert.Nil(a.Allocate(c))
+	assert.ErrorIs(a.Allocate(serverLease("c@zebra", 1)), ErrQuota)
+
+	// Releasing a lease gives the quota back, but not more lease hours than
+	// allowed.
+	assert.Nil(a.Release(c, "c@zebra"))
+
+	long := lease.NewLease("c@zebra", 6*time.Hour, []*lease.ResourceReq{{Type: "compute.server", Count: 1}})
+	assert.ErrorIs(a.AllocateOrQueue(long), ErrQuota)
+	assert.Nil(a.AllocateOrQueue(serverLease("c@zebra", 3)))
+	assert.Nil(a.AllocateOrQueue(serverLease("other@zebra", 3)))
+
+	// Queued leases count against the quota
+	queued := serverLease("queued@zebra", 3)
+	assert.Nil(a.AllocateOrQueue(queued))
+	assert.Equal(lease.Queued, queued.Phase)
+	assert.ErrorIs(a.AllocateOrQueue(serverLease("queued@zebra", 1)), ErrQuota)
+
+	usage := a.Usage("a@zebra")
+	assert.Len(usage, 2)
+
+	for _, u := range usage {
+		switch u.Quota.Meta.Name {
+		case "devs":
+			assert.Equal("group devs", u.Subject)
+			assert.Equal(4, u.Resources)
+		case "per-user":
+			assert.Equal("user a@zebra", u.Subject)
+			assert.Equal(3, u.Resources)
+			assert.Equal(3.0, u.Hours)
+		}
+
+		assert.False(u.Exceeds())
+	}
+
+	// Every user with leases has a usage of the per-user quota
+	assert.Len(a.Usage(""), 7)
+}
+
+func TestQuotaPeriod(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_quota_period"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	a := api.Allocator
+
+	quota := lease.NewQuota("hours", "user@zebra", "", "", 0, 3)
+	quota.Period = 24 * time.Hour
+	assert.Nil(api.Store.Create(quota))
+
+	used := func(start, end time.Time) {
+		server := findResource(api.Store, a.matching(&lease.ResourceReq{Type: "compute.server"})[0].GetMeta().ID)
+		assert.Nil(api.Store.Create(lease.NewUsage(serverLease("user@zebra", 1), server, "", start, end)))
+	}
+
+	// Released leases count for the hours used within the period
+	now := time.Now()
+	used(now.Add(-48*time.Hour), now.Add(-30*time.Hour))
+	used(now.Add(-25*time.Hour), now.Add(-23*time.Hour))
+	used(now.Add(-3*time.Hour), now.Add(-2*time.Hour))
+
+	usage := a.Usage("user@zebra")
+	assert.Len(usage, 1)
+	assert.InDelta(2.0, usage[0].Hours, 0.01)
+
+	assert.ErrorIs(a.Allocate(serverLease("user@zebra", 2)), ErrQuota)
+	assert.Nil(a.Allocate(serverLease("user@zebra", 1)))
+
+	// Nor once the active lease is added
+	l := serverLease("user@zebra", 1)
+	assert.ErrorIs(a.Allocate(l), ErrQuota)
+
+	// Every user with usage in the period has a usage of a quota for everyone
+	assert.Nil(api.Store.Delete(quota))
+	assert.Nil(api.Store.Create(lease.NewQuota("per-user", "", "", "", 0, 10)))
+	assert.Len(a.Usage(""), 1)
+}
+
+func TestQuotaValidate(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	assert.Nil(lease.NewQuota("q", "", "", "", 1, 1).Validate(ctx))
+	assert.NotNil(lease.NewQuota("q", "a@zebra", "devs", "", 1, 1).Validate(ctx))
+	assert.NotNil(lease.NewQuota("q", "", "", "", -1, 0).Validate(ctx))
+	assert.NotNil(lease.NewQuota("q", "", "", "", 0, -1).Validate(ctx))
+
+	negative := lease.NewQuota("q", "", "", "", 0, 1)
+	negative.Period = -time.Hour
+	assert.NotNil(negative.Validate(ctx))
+	assert.NotNil(lease.EmptyQuota().Validate(ctx))
+}
+
+func TestQuotasHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_quotas_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+	assert.Nil(api.Store.Create(lease.NewQuota("per-user", "", "", "", 1, 0)))
+	assert.Nil(api.Store.Create(lease.NewQuota("admin", "admin@zebra", "", "", 5, 0)))
+	assert.Nil(api.Allocator.AllocateOrQueue(serverLease("user@zebra", 1)))
+
+	quotas := func(url string, claims *auth.Claims) *httptest.ResponseRecorder {
+		h := handleQuotas()
+		rr := httptest.NewRecorder()
+		req := createRequest(assert, "GET", url, "{}", api)
+
+		if claims != nil {
+			req = makeClaimsRequest(assert, "GET", url, "{}", api, claims)
+		}
+
+		h(rr, req, httprouter.Params{})
+
+		return rr
+	}
+
+	assert.Equal(http.StatusUnauthorized, quotas("/api/v1/quotas", nil).Code)
+	nobody := auth.NewClaims("zebra", "nobody", &auth.Role{Name: "nobody", Privileges: nil}, "nobody@zebra")
+	assert.Equal(http.StatusForbidden, quotas("/api/v1/quotas?all=true", nobody).Code)
+
+	// A lease over quota is forbidden
+	h := handleLease()
+	b, err := json.Marshal(serverLease("user@zebra", 1))
+	assert.Nil(err)
+
+	rr := httptest.NewRecorder()
+	h(rr, makeClaimsRequest(assert, "POST", "/", string(b), api, userClaims(assert, "user@zebra")), nil)
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = quotas("/api/v1/quotas", userClaims(assert, "user@zebra"))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	usage := []QuotaUsage{}
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), &usage))
+	assert.Len(usage, 1)
+	assert.Equal("user user@zebra", usage[0].Subject)
+	assert.Equal(1, usage[0].Resources)
+
+	rr = quotas("/api/v1/quotas?all=true", adminClaims(assert))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), &usage))
+	assert.Len(usage, 2)
+}
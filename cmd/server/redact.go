@@ -0,0 +1,78 @@
+package main
+
+import (
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra"
+)
+
+// redactSink scrubs secrets from everything logged through it: the values of
+// secret keys such as "password" are replaced and all other values are passed
+// through zebra.Redact, so that secrets, credentials and JSON bodies holding
+// them never reach the log.
+type redactSink struct {
+	sink logr.LogSink
+}
+
+// redactLogger returns a logger that redacts secrets before logging to log.
+func redactLogger(log logr.Logger) logr.Logger {
+	if sink := log.GetSink(); sink != nil {
+		return logr.New(&redactSink{sink: sink})
+	}
+
+	return log
+}
+
+// redactValues returns the key/value pairs with their values redacted.
+func redactValues(keysAndValues []interface{}) []interface{} {
+	redacted := make([]interface{}, len(keysAndValues))
+
+	for i := 0; i < len(keysAndValues); i += 2 {
+		redacted[i] = keysAndValues[i]
+
+		if i+1 == len(keysAndValues) {
+			break
+		}
+
+		if key, ok := keysAndValues[i].(string); ok && zebra.IsSecretKey(key) {
+			redacted[i+1] = zebra.Redacted
+		} else {
+			redacted[i+1] = zebra.Redact(keysAndValues[i+1])
+		}
+	}
+
+	return redacted
+}
+
+func (r *redactSink) Init(info logr.RuntimeInfo) {
+	// One more frame for the redacting sink
+	info.CallDepth++
+	r.sink.Init(info)
+}
+
+func (r *redactSink) Enabled(level int) bool {
+	return r.sink.Enabled(level)
+}
+
+func (r *redactSink) Info(level int, msg string, keysAndValues ...interface{}) {
+	r.sink.Info(level, msg, redactValues(keysAndValues)...)
+}
+
+func (r *redactSink) Error(err error, msg string, keysAndValues ...interface{}) {
+	r.sink.Error(err, msg, redactValues(keysAndValues)...)
+}
+
+func (r *redactSink) WithValues(keysAndValues ...interface{}) logr.LogSink {
+	return &redactSink{sink: r.sink.WithValues(redactValues(keysAndValues)...)}
+}
+
+func (r *redactSink) WithName(name string) logr.LogSink {
+	return &redactSink{sink: r.sink.WithName(name)}
+}
+
+func (r *redactSink) WithCallDepth(depth int) logr.LogSink {
+	if sink, ok := r.sink.(logr.CallDepthLogSink); ok {
+		return &redactSink{sink: sink.WithCallDepth(depth)}
+	}
+
+	return r
+}
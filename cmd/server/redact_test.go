@@ -0,0 +1,233 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/go-logr/logr/funcr"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/project-safari/zebra/model/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+// captureLogger returns a redacting logger that writes everything it logs to
+// the builder, at all levels.
+func captureLogger(out *strings.Builder, lock *sync.Mutex) logr.Logger {
+	return redactLogger(funcr.New(func(prefix, args string) {
+		lock.Lock()
+		defer lock.Unlock()
+
+		out.WriteString(prefix + " " + args + "\n")
+	}, funcr.Options{Verbosity: 10})) //nolint:gomnd
+}
+
+func TestRedactLogger(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	out := &strings.Builder{}
+	log := captureLogger(out, &sync.Mutex{})
+
+	secret := zebra.Secret{}
+	assert.Nil(secret.UnmarshalText([]byte("s3cret-value")))
+
+	creds := zebra.NewCredentials("admin")
+	assert.Nil(creds.Add("ssh-key", "s3cret-key"))
+
+	log.WithName("test").WithValues("token", "s3cret-token").Info("values",
+		"password", "s3cret-password", "body", `{"passwordHash":"s3cret-hash"}`, "secret", secret,
+		"credentials", creds, "user", "user@zebra")
+	log.Error(errors.New("failed"), "error", "authKey", "s3cret-auth", "odd")
+
+	assert.NotContains(out.String(), "s3cret")
+	assert.Contains(out.String(), "user@zebra")
+	assert.Contains(out.String(), zebra.Redacted)
+
+	// Loggers without a sink are left alone
+	assert.Nil(redactLogger(logr.Logger{}).GetSink())
+}
+
+// fuzzRoute is a route called with every fuzzed body.
+type fuzzRoute struct {
+	method string
+	path   string
+}
+
+// fuzzRoutes are all routes of the server, the ones handled by adapters
+// followed by the ones of routeHandler.
+var fuzzRoutes = []fuzzRoute{
+	{"POST", "/login"},
+	{"POST", "/register"},
+	{"POST", "/refresh"},
+	{"POST", "/logout"},
+	{"GET", "/.well-known/jwks.json"},
+	{"GET", "/api/v1/types"},
+	{"GET", "/api/v1/calendar"},
+	{"GET", "/api/v1/health"},
+	{"GET", "/api/v1/labels"},
+	{"GET", "/api/v1/resources"},
+	{"POST", "/api/v1/resources"},
+	{"DELETE", "/api/v1/resources/:id"},
+	{"GET", "/api/v1/export"},
+	{"POST", "/api/v1/import"},
+	{"POST", "/api/v1/resources/:id/lifecycle"},
+	{"POST", "/api/v1/leases"},
+	{"GET", "/api/v1/leases/:id"},
+	{"POST", "/api/v1/leases/:id"},
+	{"DELETE", "/api/v1/leases/:id"},
+	{"POST", "/api/v1/leases/:id/approve"},
+	{"POST", "/api/v1/leases/:id/deny"},
+	{"POST", "/api/v1/leases/:id/heartbeat"},
+	{"POST", "/api/v1/leases/:id/extend"},
+	{"GET", "/api/v1/limits"},
+	{"GET", "/api/v1/approvals"},
+	{"GET", "/api/v1/quotas"},
+	{"GET", "/api/v1/reports/usage"},
+	{"GET", "/api/v1/webhooks/deliveries"},
+	{"GET", "/api/v1/audit"},
+	{"GET", "/api/v1/sessions"},
+	{"DELETE", "/api/v1/sessions"},
+	{"DELETE", "/api/v1/sessions/:id"},
+	{"GET", "/api/v1/tokens"},
+	{"POST", "/api/v1/tokens"},
+	{"DELETE", "/api/v1/tokens/:id"},
+}
+
+const fuzzLetters = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+
+// fuzzSecret returns a random secret that is also a valid password.
+func fuzzSecret(r *rand.Rand) string {
+	b := make([]byte, 16) //nolint:gomnd
+	for i := range b {
+		b[i] = fuzzLetters[r.Intn(len(fuzzLetters))]
+	}
+
+	return "Zq9!" + string(b)
+}
+
+// fuzzBodies returns request bodies holding the secret in every way the API
+// takes secrets: passwords, credentials, webhook secrets and tokens, nested
+// at random depths, in resources and in bodies that cannot be parsed.
+func fuzzBodies(assert *assert.Assertions, r *rand.Rand, secret string) []string {
+	server, ok := compute.MockServer(1)[0].(*compute.Server)
+	assert.True(ok)
+
+	server.Credentials = zebra.NewCredentials("admin")
+	assert.Nil(server.Credentials.Add([]string{"password", "ssh-key"}[r.Intn(2)], secret))
+
+	resources := zebra.NewResourceMap(model.Factory())
+	assert.Nil(resources.Add(server))
+	assert.Nil(resources.Add(webhook.NewWebhook("hook", "http://localhost", secret, nil)))
+
+	b, err := json.Marshal(resources)
+	assert.Nil(err)
+
+	var nested interface{} = map[string]interface{}{
+		[]string{"password", "secret", "token", "privateKey", "authKey"}[r.Intn(5)]: secret, //nolint:gomnd
+	}
+
+	for depth := r.Intn(5); depth > 0; depth-- { //nolint:gomnd
+		if r.Intn(2) == 0 {
+			nested = []interface{}{nested, "x"}
+		} else {
+			nested = map[string]interface{}{"inner": nested, "id": "0100000001"}
+		}
+	}
+
+	n, err := json.Marshal(nested)
+	assert.Nil(err)
+
+	return []string{
+		`{"email":"admin@zebra","password":"` + secret + `"}`,
+		`{"name":"fuzz","email":"fuzz@zebra","password":"` + secret + `"}`,
+		string(b),
+		string(n),
+		`{"reason":"ok","password":"` + secret + `"`,
+	}
+}
+
+// TestRedactEndpoints calls every endpoint with bodies holding random secrets
+// and checks that none of them reaches the log.
+func TestRedactEndpoints(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_redact_endpoints"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+
+	l := serverLease("admin@zebra", 1)
+	assert.Nil(api.Allocator.AllocateOrQueue(l))
+
+	audit := makeAuditLog(assert, root, DefaultAuditMaxSize)
+	sessions := NewSessions(DefaultSessionConfig())
+	tokens := makeTokens(assert, root)
+
+	out := &strings.Builder{}
+	lock := &sync.Mutex{}
+	log := captureLogger(out, lock)
+
+	handler := loginAdapter()(registerAdapter()(jwksAdapter()(auditAdapter()(refreshAdapter()(logoutAdapter()(routeHandler()))))))
+
+	seed := time.Now().UnixNano()
+	r := rand.New(rand.NewSource(seed)) //nolint:gosec
+	secrets := []string{}
+
+	for i := 0; i < 5; i++ {
+		secret := fuzzSecret(r)
+		secrets = append(secrets, secret)
+
+		for _, body := range fuzzBodies(assert, r, secret) {
+			for _, route := range fuzzRoutes {
+				path := strings.ReplaceAll(route.path, ":id", l.Meta.ID)
+
+				ctx := logr.NewContext(context.Background(), log)
+				ctx = context.WithValue(ctx, ResourcesCtxKey, api)
+				ctx = context.WithValue(ctx, AuthCtxKey, "AvadaKedavra")
+				ctx = context.WithValue(ctx, ClaimsCtxKey, adminClaims(assert))
+				ctx = context.WithValue(ctx, AuditCtxKey, audit)
+				ctx = context.WithValue(ctx, SessionsCtxKey, sessions)
+				ctx = context.WithValue(ctx, TokensCtxKey, tokens)
+
+				req, err := http.NewRequestWithContext(ctx, route.method, path, strings.NewReader(body))
+				assert.Nil(err)
+
+				assert.NotPanics(func() { handler.ServeHTTP(httptest.NewRecorder(), req) }, route.path)
+			}
+		}
+	}
+
+	lock.Lock()
+	logged := out.String()
+	lock.Unlock()
+
+	assert.Contains(logged, `"request"`)
+
+	for _, secret := range secrets {
+		assert.NotContains(logged, secret, "seed %d", seed)
+	}
+
+	entries, err := audit.Query(&AuditQuery{From: time.Time{}, To: time.Time{}, User: "", Limit: 0})
+	assert.Nil(err)
+	assert.NotEmpty(entries)
+
+	for _, e := range entries {
+		for _, secret := range secrets {
+			assert.NotContains(e.Resources, secret, "seed %d", seed)
+		}
+	}
+}
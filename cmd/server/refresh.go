@@ -1,7 +1,9 @@
 package main
 
 import (
+	"errors"
 	"net/http"
+	"time"
 
 	"github.com/go-logr/logr"
 	"github.com/project-safari/zebra/auth"
@@ -29,6 +31,14 @@ func refreshAdapter() web.Adapter {
 				return
 			}
 
+			// API tokens are not exchanged for jwts, which would outlive them
+			if jwtClaims.Scope != nil {
+				log.Error(nil, "api token cannot be refreshed", "user", jwtClaims.Subject)
+				res.WriteHeader(http.StatusForbidden)
+
+				return
+			}
+
 			authKey, ok := ctx.Value(AuthCtxKey).(string)
 			if !ok {
 				log.Error(nil, "authKey not in context")
@@ -37,8 +47,30 @@ func refreshAdapter() web.Adapter {
 				return
 			}
 
-			// Create a new token and cookie
-			claims := auth.NewClaims("zebra", jwtClaims.Subject, jwtClaims.Role, jwtClaims.Email)
+			// Create a new token and cookie for the same session, which
+			// ends the token at the latest when the session ends. Callers
+			// that logged in with a rsa key have no session yet.
+			var notAfter time.Time
+
+			if sessions, ok := ctx.Value(SessionsCtxKey).(*Sessions); ok {
+				now := time.Now()
+
+				session, err := sessions.Check(jwtClaims, now)
+				if errors.Is(err, ErrSessionUnknown) {
+					session, err = sessions.Start(jwtClaims, sourceIP(req), now), nil
+				}
+
+				if err != nil {
+					log.Error(err, "session cannot be refreshed", "user", jwtClaims.Subject)
+					res.WriteHeader(http.StatusUnauthorized)
+
+					return
+				}
+
+				notAfter = session.Expires
+			}
+
+			claims := jwtClaims.Renew(notAfter)
 			respondWithClaims(ctx, res, claims, authKey)
 
 			log.Info("refresh succeeded", "user", jwtClaims.Subject)
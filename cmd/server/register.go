@@ -52,7 +52,7 @@ func registerHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
-	log.Info("request", "body", string(body))
+	log.Info("request", "body", string(zebra.RedactJSON(body)))
 
 	if err := json.Unmarshal(body, regReq); err != nil {
 		log.Error(err, "bad body")
@@ -80,6 +80,7 @@ func registerHandler(res http.ResponseWriter, req *http.Request) {
 		return
 	}
 
+	auditCaller(ctx, auth.NewClaims("zebra", newuser.Meta.Name, newuser.Role, newuser.Email))
 	responseRegister(log, res, newuser)
 	log.Info("Registry succeeded", "user", regReq.Name)
 }
@@ -0,0 +1,407 @@
+package main
+
+import (
+	"net/http"
+	"sort"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+const (
+	DefaultReportRange    = 7 * 24 * time.Hour
+	DefaultContended      = 10
+	DefaultUsageRetention = 90 * 24 * time.Hour
+)
+
+// ReportConfig is the "reports" section of the server configuration. Usage
+// records are deleted once they ended longer than Retention ago.
+type ReportConfig struct {
+	Retention Duration `json:"retention"`
+}
+
+func DefaultReportConfig() *ReportConfig {
+	return &ReportConfig{Retention: Duration{DefaultUsageRetention}}
+}
+
+// ReportRequest selects the period to report usage for. The period defaults to
+// the past week.
+type ReportRequest struct {
+	From time.Time `json:"from"`
+	To   time.Time `json:"to"`
+}
+
+// UsageHours is the lease hours of a user or a group.
+type UsageHours struct {
+	Name   string  `json:"name"`
+	Leases int     `json:"leases"`
+	Hours  float64 `json:"hours"`
+}
+
+// TypeUtilization is the usage of the resources of a type. Utilization is the
+// percentage of the time the resources there are now were leased, Peak the
+// most resources leased at the same time.
+type TypeUtilization struct {
+	Type        string  `json:"type"`
+	Resources   int     `json:"resources"`
+	Hours       float64 `json:"hours"`
+	Utilization float64 `json:"utilization"`
+	Peak        int     `json:"peak"`
+}
+
+// Contention is how often a resource was leased.
+type Contention struct {
+	Resource string  `json:"resource"`
+	Name     string  `json:"name"`
+	Type     string  `json:"type"`
+	Leases   int     `json:"leases"`
+	Hours    float64 `json:"hours"`
+}
+
+// Report is the usage of resources in a period: by type, by user and by group,
+// the most resources leased at the same time and the resources leased by the
+// most leases.
+type Report struct {
+	From      time.Time         `json:"from"`
+	To        time.Time         `json:"to"`
+	Peak      int               `json:"peak"`
+	Types     []TypeUtilization `json:"types"`
+	Users     []UsageHours      `json:"users"`
+	Groups    []UsageHours      `json:"groups"`
+	Contended []Contention      `json:"contended"`
+}
+
+// recordUsage records the usage of the resources of an active lease that is
+// being released.
+func (a *Allocator) recordUsage(l *lease.Lease, now time.Time) error {
+	if l.Phase != lease.Activated {
+		return nil
+	}
+
+	group := a.userGroups()[l.Owner()]
+
+	for _, u := range a.leaseUsage(l, group, now) {
+		if err := a.store.Create(u); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// leaseUsage returns the usage of the resources of an active lease up to now.
+func (a *Allocator) leaseUsage(l *lease.Lease, group string, now time.Time) []*lease.Usage {
+	end := l.End()
+	if now.Before(end) {
+		end = now
+	}
+
+	usages := []*lease.Usage{}
+
+	for _, req := range l.RequestList() {
+		_ = applyFunc(a.store.QueryUUID(req.Resources), func(res zebra.Resource) error {
+			usages = append(usages, lease.NewUsage(l, res, group, l.Start(), end))
+
+			return nil
+		})
+	}
+
+	return usages
+}
+
+// SetUsageRetention sets how long usage records are kept, the default if it is
+// not positive.
+func (a *Allocator) SetUsageRetention(retention time.Duration) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	if retention <= 0 {
+		retention = DefaultUsageRetention
+	}
+
+	a.usageRetention = retention
+}
+
+// PruneUsage deletes the usage records that ended longer than the retention
+// ago and returns how many were deleted.
+func (a *Allocator) PruneUsage(now time.Time) (int, error) {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	pruned := 0
+	before := now.Add(-a.usageRetention)
+
+	for _, u := range a.usages() {
+		if !u.End.Before(before) {
+			continue
+		}
+
+		if err := a.store.Delete(u); err != nil {
+			return pruned, err
+		}
+
+		pruned++
+	}
+
+	return pruned, nil
+}
+
+// usages returns the recorded usage of the released leases.
+func (a *Allocator) usages() []*lease.Usage {
+	usages := []*lease.Usage{}
+
+	_ = applyFunc(a.store.QueryType([]string{lease.UsageType().Name}), func(res zebra.Resource) error {
+		if u, ok := res.(*lease.Usage); ok {
+			usages = append(usages, u)
+		}
+
+		return nil
+	})
+
+	return usages
+}
+
+// Report returns the usage of resources between from and to, of the released
+// leases as recorded and of the active leases up to now.
+func (a *Allocator) Report(from, to, now time.Time) *Report {
+	a.lock.Lock()
+	defer a.lock.Unlock()
+
+	usages := a.usages()
+	groups := a.userGroups()
+
+	for _, l := range a.leases(lease.Activated) {
+		usages = append(usages, a.leaseUsage(l, groups[l.Owner()], now)...)
+	}
+
+	counts := map[string]int{}
+
+	for _, u := range usages {
+		if _, ok := counts[u.ResourceType]; !ok {
+			counts[u.ResourceType] = len(a.matching(&lease.ResourceReq{Type: u.ResourceType}))
+		}
+	}
+
+	return NewReport(usages, counts, from, to)
+}
+
+// NewReport returns the report of the usages between from and to. Counts holds
+// the number of resources of each type.
+func NewReport(usages []*lease.Usage, counts map[string]int, from, to time.Time) *Report {
+	types := map[string]*TypeUtilization{}
+	users := map[string]*UsageHours{}
+	groups := map[string]*UsageHours{}
+	userLeases := map[string]struct{}{}
+	groupLeases := map[string]struct{}{}
+	contended := map[string]*Contention{}
+	periods := map[string][]Window{}
+	all := []Window{}
+
+	for _, u := range usages {
+		start, end, ok := u.Within(from, to)
+		if !ok {
+			continue
+		}
+
+		hours := end.Sub(start).Hours()
+
+		t, ok := types[u.ResourceType]
+		if !ok {
+			t = &TypeUtilization{Type: u.ResourceType, Resources: counts[u.ResourceType]}
+			types[u.ResourceType] = t
+		}
+
+		t.Hours += hours
+
+		addHours(users, userLeases, u.User, u.Lease, hours)
+
+		if u.Group != "" {
+			addHours(groups, groupLeases, u.Group, u.Lease, hours)
+		}
+
+		c, ok := contended[u.Resource]
+		if !ok {
+			c = &Contention{Resource: u.Resource, Name: u.ResourceName, Type: u.ResourceType}
+			contended[u.Resource] = c
+		}
+
+		c.Leases++
+		c.Hours += hours
+
+		periods[u.ResourceType] = append(periods[u.ResourceType], Window{Start: start, End: end})
+		all = append(all, Window{Start: start, End: end})
+	}
+
+	report := &Report{
+		From:      from,
+		To:        to,
+		Peak:      peak(all),
+		Types:     make([]TypeUtilization, 0, len(types)),
+		Users:     sortHours(users),
+		Groups:    sortHours(groups),
+		Contended: make([]Contention, 0, len(contended)),
+	}
+
+	for _, t := range types {
+		if t.Resources > 0 {
+			t.Utilization = 100 * t.Hours / (float64(t.Resources) * to.Sub(from).Hours()) //nolint:gomnd
+		}
+
+		t.Peak = peak(periods[t.Type])
+		report.Types = append(report.Types, *t)
+	}
+
+	sort.Slice(report.Types, func(i, j int) bool { return report.Types[i].Type < report.Types[j].Type })
+
+	for _, c := range contended {
+		report.Contended = append(report.Contended, *c)
+	}
+
+	sort.Slice(report.Contended, func(i, j int) bool {
+		ci, cj := report.Contended[i], report.Contended[j]
+		if ci.Leases != cj.Leases {
+			return ci.Leases > cj.Leases
+		}
+
+		if ci.Hours != cj.Hours {
+			return ci.Hours > cj.Hours
+		}
+
+		return ci.Name < cj.Name
+	})
+
+	if len(report.Contended) > DefaultContended {
+		report.Contended = report.Contended[:DefaultContended]
+	}
+
+	return report
+}
+
+// addHours adds the hours of a lease to the usage of a user or group. Leases
+// are counted once however many resources they hold, seen holds the leases
+// counted already.
+func addHours(usages map[string]*UsageHours, seen map[string]struct{}, name, leaseID string, hours float64) {
+	u, ok := usages[name]
+	if !ok {
+		u = &UsageHours{Name: name, Leases: 0, Hours: 0}
+		usages[name] = u
+	}
+
+	u.Hours += hours
+
+	if _, ok := seen[name+" "+leaseID]; !ok {
+		seen[name+" "+leaseID] = struct{}{}
+		u.Leases++
+	}
+}
+
+// sortHours returns the usages by most hours first.
+func sortHours(usages map[string]*UsageHours) []UsageHours {
+	sorted := make([]UsageHours, 0, len(usages))
+	for _, u := range usages {
+		sorted = append(sorted, *u)
+	}
+
+	sort.Slice(sorted, func(i, j int) bool {
+		if sorted[i].Hours != sorted[j].Hours {
+			return sorted[i].Hours > sorted[j].Hours
+		}
+
+		return sorted[i].Name < sorted[j].Name
+	})
+
+	return sorted
+}
+
+// peak returns the most periods that overlap at any time.
+func peak(periods []Window) int {
+	type edge struct {
+		at    time.Time
+		delta int
+	}
+
+	edges := make([]edge, 0, 2*len(periods))
+	for _, p := range periods {
+		edges = append(edges, edge{p.Start, 1}, edge{p.End, -1})
+	}
+
+	// Periods ending when others start do not overlap them
+	sort.Slice(edges, func(i, j int) bool {
+		if edges[i].at.Equal(edges[j].at) {
+			return edges[i].delta < edges[j].delta
+		}
+
+		return edges[i].at.Before(edges[j].at)
+	})
+
+	current, most := 0, 0
+
+	for _, e := range edges {
+		current += e.delta
+		if current > most {
+			most = current
+		}
+	}
+
+	return most
+}
+
+// handleReport returns the usage of resources in a period to users who can
+// read usage records.
+func handleReport() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if !claims.Read(lease.UsageType().Name) {
+			res.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		reportReq := new(ReportRequest)
+		if err := readJSON(ctx, req, reportReq); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("report could not be made, could not read request")
+
+			return
+		}
+
+		now := time.Now()
+
+		if reportReq.To.IsZero() {
+			reportReq.To = now
+		}
+
+		if reportReq.From.IsZero() {
+			reportReq.From = reportReq.To.Add(-DefaultReportRange)
+		}
+
+		if !reportReq.From.Before(reportReq.To) {
+			res.WriteHeader(http.StatusBadRequest)
+			log.Info("report could not be made, invalid period")
+
+			return
+		}
+
+		writeJSON(ctx, res, api.Allocator.Report(reportReq.From, reportReq.To, now))
+	}
+}
@@ -0,0 +1,146 @@
+package main //nolint:testpackage
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNewReport(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	servers := compute.MockServer(3)
+	first := serverLease("a@zebra", 2)
+	second := serverLease("b@zebra", 1)
+	third := serverLease("b@zebra", 1)
+	start := time.Date(2022, 6, 1, 9, 0, 0, 0, time.UTC)
+
+	usages := []*lease.Usage{
+		lease.NewUsage(first, servers[0], "devs", start, start.Add(2*time.Hour)),
+		lease.NewUsage(first, servers[1], "devs", start, start.Add(2*time.Hour)),
+		lease.NewUsage(second, servers[0], "", start.Add(2*time.Hour), start.Add(3*time.Hour)),
+		// Only the hour within the period counts
+		lease.NewUsage(third, servers[2], "", start.Add(-time.Hour), start.Add(time.Hour)),
+		// Outside the period
+		lease.NewUsage(third, servers[2], "", start.Add(-3*time.Hour), start.Add(-2*time.Hour)),
+	}
+
+	report := NewReport(usages, map[string]int{"compute.server": 3}, start, start.Add(4*time.Hour))
+	assert.Equal(3, report.Peak)
+
+	assert.Len(report.Types, 1)
+	assert.Equal(6.0, report.Types[0].Hours)
+	assert.Equal(50.0, report.Types[0].Utilization)
+	assert.Equal(3, report.Types[0].Peak)
+
+	assert.Equal([]UsageHours{{Name: "a@zebra", Leases: 1, Hours: 4}, {Name: "b@zebra", Leases: 2, Hours: 2}},
+		report.Users)
+	assert.Equal([]UsageHours{{Name: "devs", Leases: 1, Hours: 4}}, report.Groups)
+
+	assert.Len(report.Contended, 3)
+	assert.Equal(servers[0].GetMeta().ID, report.Contended[0].Resource)
+	assert.Equal(2, report.Contended[0].Leases)
+	assert.Equal(3.0, report.Contended[0].Hours)
+}
+
+func TestPruneUsage(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_prune_usage"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	a := api.Allocator
+	a.SetUsageRetention(0)
+	assert.Equal(DefaultUsageRetention, a.usageRetention)
+
+	a.SetUsageRetention(24 * time.Hour)
+
+	server := compute.MockServer(1)[0]
+	now := time.Now()
+	old := lease.NewUsage(serverLease("a@zebra", 1), server, "", now.Add(-30*time.Hour), now.Add(-25*time.Hour))
+	recent := lease.NewUsage(serverLease("a@zebra", 1), server, "", now.Add(-30*time.Hour), now.Add(-time.Hour))
+
+	assert.Nil(api.Store.Create(old))
+	assert.Nil(api.Store.Create(recent))
+
+	pruned, err := a.PruneUsage(now)
+	assert.Nil(err)
+	assert.Equal(1, pruned)
+
+	usages := a.usages()
+	assert.Len(usages, 1)
+	assert.Equal(recent.Meta.ID, usages[0].Meta.ID)
+}
+
+func TestReportHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_report_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 2)
+
+	released := serverLease("user@zebra", 1)
+	assert.Nil(api.Allocator.Allocate(released))
+	assert.Nil(api.Allocator.Release(released, "user@zebra"))
+	assert.Len(api.Store.QueryType([]string{lease.UsageType().Name}).Resources[lease.UsageType().Name].Resources, 1)
+
+	active := serverLease("other@zebra", 2)
+	assert.Nil(api.Allocator.Allocate(active))
+
+	h := handleReport()
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h(w, r, nil)
+	})
+
+	rr := httptest.NewRecorder()
+	handler.ServeHTTP(rr, createRequest(assert, "GET", "/api/v1/reports/usage", "", api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	nobody := auth.NewClaims("zebra", "nobody", &auth.Role{Name: "nobody", Privileges: nil}, "nobody@zebra")
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/", "", api, nobody))
+	assert.Equal(http.StatusForbidden, rr.Code)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/", "{", api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	now := time.Now()
+	b, err := json.Marshal(&ReportRequest{From: now, To: now.Add(-time.Hour)})
+	assert.Nil(err)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/", string(b), api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusBadRequest, rr.Code)
+
+	// Released and active leases are both reported
+	b, err = json.Marshal(&ReportRequest{From: now.Add(-time.Hour), To: now.Add(time.Hour)})
+	assert.Nil(err)
+
+	rr = httptest.NewRecorder()
+	handler.ServeHTTP(rr, makeClaimsRequest(assert, "GET", "/", string(b), api, userClaims(assert, "user@zebra")))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	report := new(Report)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), report))
+	assert.Len(report.Types, 1)
+	assert.Equal(2, report.Types[0].Resources)
+	assert.Len(report.Users, 2)
+	assert.Len(report.Contended, 2)
+}
@@ -2,20 +2,103 @@ package main
 
 import (
 	"net/http"
+	"strings"
 
 	"github.com/julienschmidt/httprouter"
 )
 
+// apiRoute is a route under the /api/v1 endpoint.
+type apiRoute struct {
+	method string
+	path   string
+	handle httprouter.Handle
+}
+
+func apiRoutes() []apiRoute {
+	return []apiRoute{
+		{http.MethodGet, "/api/v1/types", handleTypes()},
+		{http.MethodGet, "/api/v1/calendar", handleCalendar()},
+		{http.MethodGet, "/api/v1/health", handleHealth()},
+		{http.MethodGet, "/api/v1/labels", handleLabels()},
+		{http.MethodGet, "/api/v1/resources", handleQuery()},
+		{http.MethodPost, "/api/v1/resources", handlePost()},
+		{http.MethodDelete, "/api/v1/resources/:id", handleDelete()},
+		{http.MethodGet, "/api/v1/export", handleExport()},
+		{http.MethodPost, "/api/v1/import", handleImport()},
+		{http.MethodPost, "/api/v1/resources/:id/lifecycle", handleLifecycle()},
+		{http.MethodPost, "/api/v1/leases", handleLease()},
+		{http.MethodGet, "/api/v1/leases/:id", handleLeaseStatus()},
+		{http.MethodPost, "/api/v1/leases/:id", handleLeasePost()},
+		{http.MethodDelete, "/api/v1/leases/:id", handleRelease()},
+		{http.MethodPost, "/api/v1/leases/:id/approve", handleDecision(true)},
+		{http.MethodPost, "/api/v1/leases/:id/deny", handleDecision(false)},
+		{http.MethodPost, "/api/v1/leases/:id/heartbeat", handleHeartbeat()},
+		{http.MethodPost, "/api/v1/leases/:id/extend", handleExtend()},
+		{http.MethodGet, "/api/v1/limits", handleLimits()},
+		{http.MethodGet, "/api/v1/approvals", handleApprovals()},
+		{http.MethodGet, "/api/v1/quotas", handleQuotas()},
+		{http.MethodGet, "/api/v1/reports/usage", handleReport()},
+		{http.MethodGet, "/api/v1/webhooks/deliveries", handleDeliveries()},
+		{http.MethodGet, "/api/v1/audit", handleAudit()},
+		{http.MethodGet, "/api/v1/sessions", handleSessions()},
+		{http.MethodDelete, "/api/v1/sessions", handleRevokeSessions()},
+		{http.MethodDelete, "/api/v1/sessions/:id", handleRevokeSession()},
+		{http.MethodGet, "/api/v1/tokens", handleTokens()},
+		{http.MethodPost, "/api/v1/tokens", handleCreateToken()},
+		{http.MethodDelete, "/api/v1/tokens/:id", handleRevokeToken()},
+	}
+}
+
 // routeHandler returns a http handler that handles all routes under the
 // /api/v1 endpoint. It is expected that this handler is the final handler
 // and requires the request context to be set with log, store, auth etc.
 func routeHandler() http.Handler {
 	router := httprouter.New()
-	router.GET("/api/v1/types", handleTypes())
-	router.GET("/api/v1/labels", handleLabels())
-	router.GET("/api/v1/resources", handleQuery())
-	router.POST("/api/v1/resources", handlePost())
-	router.DELETE("/api/v1/resources/:id", handleDelete())
+
+	for _, r := range apiRoutes() {
+		router.Handle(r.method, r.path, r.handle)
+	}
 
 	return router
 }
+
+// apiPatterns are the routes requests are matched against by matchRoute.
+var apiPatterns = apiRoutes()
+
+// matchRoute returns the path of the api route that serves a request and the
+// values of its parameters, or an empty path if there is none. As in the
+// router, static segments take precedence over parameters.
+func matchRoute(method, path string) (string, map[string]string) {
+	segments := strings.Split(path, "/")
+	match, matchParams, matchStatic := "", map[string]string{}, -1
+
+	for _, r := range apiPatterns {
+		pattern := strings.Split(r.path, "/")
+		if r.method != method || len(pattern) != len(segments) {
+			continue
+		}
+
+		params, static := map[string]string{}, 0
+
+		for i, p := range pattern {
+			switch {
+			case strings.HasPrefix(p, ":") && segments[i] != "":
+				params[p[1:]] = segments[i]
+			case p == segments[i]:
+				static++
+			default:
+				params = nil
+			}
+
+			if params == nil {
+				break
+			}
+		}
+
+		if params != nil && static > matchStatic {
+			match, matchParams, matchStatic = r.path, params, static
+		}
+	}
+
+	return match, matchParams
+}
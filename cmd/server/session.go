@@ -0,0 +1,362 @@
+package main
+
+import (
+	"errors"
+	"net"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+	"gojini.dev/web"
+)
+
+const (
+	// SessionKey is the privilege key of sessions. Only users who may write
+	// it, admins by default, may list and revoke the sessions of others.
+	SessionKey = "system.session"
+
+	DefaultMaxLifetime = 24 * time.Hour
+)
+
+var (
+	ErrSessionUnknown = errors.New("session is unknown")
+	ErrSessionRevoked = errors.New("session is revoked")
+	ErrSessionExpired = errors.New("session is past its maximum lifetime")
+)
+
+// SessionConfig is the "sessions" section of the server configuration. A
+// session starts at login and ends at logout, when it is revoked or once it
+// is MaxLifetime old, however often its token is refreshed.
+type SessionConfig struct {
+	MaxLifetime Duration `json:"maxLifetime"`
+}
+
+func DefaultSessionConfig() *SessionConfig {
+	return &SessionConfig{MaxLifetime: Duration{DefaultMaxLifetime}}
+}
+
+// Session is a login of a user. Its ID is the jti of the tokens of the
+// session.
+type Session struct {
+	ID       string    `json:"id"`
+	User     string    `json:"user"`
+	Email    string    `json:"email"`
+	SourceIP string    `json:"sourceIp"`
+	Created  time.Time `json:"created"`
+	LastSeen time.Time `json:"lastSeen"`
+	Expires  time.Time `json:"expires"`
+	Revoked  bool      `json:"revoked"`
+}
+
+// Sessions is the table of sessions of the server. Sessions are kept in
+// memory only, so all users have to log in again after a restart. Sessions are
+// also kept in the order they expire, so that the ones that are over can be
+// forgotten without looking at all of them.
+type Sessions struct {
+	lock        sync.Mutex
+	maxLifetime time.Duration
+	sessions    map[string]*Session
+	expiring    []*Session
+}
+
+func NewSessions(cfg *SessionConfig) *Sessions {
+	return &Sessions{
+		lock:        sync.Mutex{},
+		maxLifetime: cfg.MaxLifetime.Duration,
+		sessions:    map[string]*Session{},
+		expiring:    []*Session{},
+	}
+}
+
+// prune forgets the sessions that are over, revoked or not. Sessions expire in
+// the order they start, so only the oldest have to be looked at.
+func (s *Sessions) prune(now time.Time) {
+	for len(s.expiring) > 0 && !now.Before(s.expiring[0].Expires) {
+		session := s.expiring[0]
+		s.expiring[0] = nil
+		s.expiring = s.expiring[1:]
+
+		if s.sessions[session.ID] == session {
+			delete(s.sessions, session.ID)
+		}
+	}
+}
+
+// Start starts the session of the claims and limits them to the lifetime of
+// the session.
+func (s *Sessions) Start(claims *auth.Claims, sourceIP string, now time.Time) *Session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune(now)
+
+	session := &Session{
+		ID:       claims.Id,
+		User:     claims.Subject,
+		Email:    claims.Email,
+		SourceIP: sourceIP,
+		Created:  now,
+		LastSeen: now,
+		Expires:  now.Add(s.maxLifetime),
+		Revoked:  false,
+	}
+
+	s.sessions[session.ID] = session
+	s.expiring = append(s.expiring, session)
+
+	if session.Expires.Unix() < claims.ExpiresAt {
+		claims.ExpiresAt = session.Expires.Unix()
+	}
+
+	return session
+}
+
+// Check returns an error if the session of the claims is unknown, revoked or
+// over, and records that it was seen otherwise.
+func (s *Sessions) Check(claims *auth.Claims, now time.Time) (*Session, error) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+	defer s.prune(now)
+
+	session, ok := s.sessions[claims.Id]
+
+	switch {
+	case !ok || session.Email != claims.Email:
+		return nil, ErrSessionUnknown
+	case session.Revoked:
+		return nil, ErrSessionRevoked
+	case !now.Before(session.Expires):
+		return nil, ErrSessionExpired
+	}
+
+	session.LastSeen = now
+
+	return session, nil
+}
+
+// Get returns a session.
+func (s *Sessions) Get(id string) (Session, bool) {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if session, ok := s.sessions[id]; ok {
+		return *session, true
+	}
+
+	return Session{}, false
+}
+
+// Revoke revokes a session, it returns false if there is no such session.
+func (s *Sessions) Revoke(id string) bool {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	session, ok := s.sessions[id]
+	if ok {
+		session.Revoked = true
+	}
+
+	return ok
+}
+
+// RevokeUser revokes all sessions of a user and returns how many there were.
+func (s *Sessions) RevokeUser(email string) int {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	count := 0
+
+	for _, session := range s.sessions {
+		if session.Email == email && !session.Revoked {
+			session.Revoked = true
+			count++
+		}
+	}
+
+	return count
+}
+
+// List returns the sessions of a user, or of all users if email is empty,
+// oldest first. Sessions that are over are forgotten.
+func (s *Sessions) List(email string, now time.Time) []Session {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.prune(now)
+
+	list := []Session{}
+
+	for _, session := range s.sessions {
+		if now.Before(session.Expires) && (email == "" || session.Email == email) {
+			list = append(list, *session)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+
+	return list
+}
+
+// sourceIP returns the address a request came from.
+func sourceIP(req *http.Request) string {
+	if host, _, err := net.SplitHostPort(req.RemoteAddr); err == nil {
+		return host
+	}
+
+	return req.RemoteAddr
+}
+
+// logoutAdapter ends the session of the caller at /logout and clears the jwt
+// cookie. It must come after auth.
+func logoutAdapter() web.Adapter {
+	return func(nextHandler http.Handler) http.Handler {
+		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			if req.URL.Path != "/logout" {
+				// This is not a logout request just forward it
+				callNext(nextHandler, res, req)
+
+				return
+			}
+
+			ctx := req.Context()
+			log := logr.FromContextOrDiscard(ctx)
+
+			claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+			if !ok {
+				log.Error(nil, "claims not in context")
+				res.WriteHeader(http.StatusUnauthorized)
+
+				return
+			}
+
+			if sessions, ok := ctx.Value(SessionsCtxKey).(*Sessions); ok {
+				sessions.Revoke(claims.Id)
+			}
+
+			cookie := makeCookie("")
+			cookie.MaxAge = -1
+
+			http.SetCookie(res, cookie)
+			res.WriteHeader(http.StatusOK)
+
+			log.Info("logout succeeded", "user", claims.Subject)
+		})
+	}
+}
+
+// handleSessions lists the sessions of the user given by the user query
+// parameter, of all users if there is none. Users may list their own sessions
+// and only users who may write sessions those of others.
+func handleSessions() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+
+		sessions, claims, ok := sessionAccess(res, req, req.URL.Query().Get("user"))
+		if !ok {
+			return
+		}
+
+		email := req.URL.Query().Get("user")
+		if email == "" && !claims.Write(SessionKey) {
+			email = claims.Email
+		}
+
+		writeJSON(ctx, res, sessions.List(email, time.Now()))
+	}
+}
+
+// handleRevokeSessions revokes all sessions of the user given by the user
+// query parameter.
+func handleRevokeSessions() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		email := req.URL.Query().Get("user")
+
+		if email == "" {
+			res.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		sessions, claims, ok := sessionAccess(res, req, email)
+		if !ok {
+			return
+		}
+
+		count := sessions.RevokeUser(email)
+
+		log.Info("sessions revoked", "user", claims.Email, "of", email, "count", count)
+
+		writeJSON(ctx, res, map[string]int{"revoked": count})
+	}
+}
+
+// handleRevokeSession revokes one session.
+func handleRevokeSession() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		id := params.ByName("id")
+
+		sessions, ok := ctx.Value(SessionsCtxKey).(*Sessions)
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		session, ok := sessions.Get(id)
+		if !ok {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		owner := session.Email
+
+		_, claims, ok := sessionAccess(res, req, owner)
+		if !ok {
+			return
+		}
+
+		sessions.Revoke(id)
+
+		log.Info("session revoked", "user", claims.Email, "of", owner, "session", id)
+
+		res.WriteHeader(http.StatusOK)
+	}
+}
+
+// sessionAccess returns the sessions and the claims of the caller if the
+// caller may manage the sessions of the user, writing the error status
+// otherwise. Everyone may manage their own sessions.
+func sessionAccess(res http.ResponseWriter, req *http.Request, email string) (*Sessions, *auth.Claims, bool) {
+	ctx := req.Context()
+
+	sessions, ok := ctx.Value(SessionsCtxKey).(*Sessions)
+	if !ok {
+		res.WriteHeader(http.StatusInternalServerError)
+
+		return nil, nil, false
+	}
+
+	claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+	if !ok {
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil, nil, false
+	}
+
+	if email != "" && email != claims.Email && !claims.Write(SessionKey) {
+		res.WriteHeader(http.StatusForbidden)
+
+		return nil, nil, false
+	}
+
+	return sessions, claims, true
+}
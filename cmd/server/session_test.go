@@ -0,0 +1,237 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSessions(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	sessions := NewSessions(&SessionConfig{MaxLifetime: Duration{time.Hour}})
+	now := time.Now()
+
+	claims := auth.NewClaims("zebra", "user", DefaultRole(), "user@zebra")
+	session := sessions.Start(claims, "10.0.0.1", now)
+	assert.Equal(claims.Id, session.ID)
+	assert.Equal(now.Add(time.Hour), session.Expires)
+
+	_, err := sessions.Check(claims, now.Add(time.Minute))
+	assert.Nil(err)
+
+	// The session ends after its lifetime however often it is refreshed
+	ended := NewSessions(&SessionConfig{MaxLifetime: Duration{time.Hour}})
+	ended.Start(claims, "", now)
+
+	_, err = ended.Check(claims.Renew(session.Expires), now.Add(time.Hour))
+	assert.ErrorIs(err, ErrSessionExpired)
+
+	// The claims are limited to the lifetime of the session
+	short := NewSessions(&SessionConfig{MaxLifetime: Duration{time.Minute}})
+	other := auth.NewClaims("zebra", "user", DefaultRole(), "user@zebra")
+	short.Start(other, "", now)
+	assert.Equal(now.Add(time.Minute).Unix(), other.ExpiresAt)
+
+	_, err = sessions.Check(other, now)
+	assert.ErrorIs(err, ErrSessionUnknown)
+
+	sessions.Start(other, "", now)
+	assert.Len(sessions.List("user@zebra", now), 2)
+	assert.Empty(sessions.List("admin@zebra", now))
+
+	assert.True(sessions.Revoke(claims.Id))
+	assert.False(sessions.Revoke("unknown"))
+
+	_, err = sessions.Check(claims, now)
+	assert.ErrorIs(err, ErrSessionRevoked)
+
+	assert.Equal(1, sessions.RevokeUser("user@zebra"))
+
+	got, ok := sessions.Get(other.Id)
+	assert.True(ok)
+	assert.True(got.Revoked)
+
+	// Sessions that are over are forgotten
+	assert.Empty(sessions.List("", now.Add(2*time.Hour)))
+
+	_, ok = sessions.Get(other.Id)
+	assert.False(ok)
+
+	// Also when sessions start or are checked
+	for i := 0; i < 3; i++ {
+		sessions.Start(auth.NewClaims("zebra", "user", DefaultRole(), "user@zebra"), "", now)
+	}
+
+	assert.Len(sessions.sessions, 3)
+
+	later := auth.NewClaims("zebra", "user", DefaultRole(), "user@zebra")
+	sessions.Start(later, "", now.Add(2*time.Hour))
+	assert.Len(sessions.sessions, 1)
+	assert.Len(sessions.expiring, 1)
+
+	_, err = sessions.Check(claims, now.Add(4*time.Hour))
+	assert.ErrorIs(err, ErrSessionUnknown)
+	assert.Empty(sessions.sessions)
+}
+
+func TestSessionLogin(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_session_login"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	jini := makeUser(assert)
+	assert.Nil(api.Store.Create(jini))
+
+	sessions := NewSessions(DefaultSessionConfig())
+	withSessions := func(req *http.Request) *http.Request {
+		ctx := context.WithValue(req.Context(), SessionsCtxKey, sessions)
+		ctx = context.WithValue(ctx, AuthCtxKey, authKey)
+
+		return req.Clone(ctx)
+	}
+
+	// Log in
+	rr := httptest.NewRecorder()
+	body := `{"email":"email@domain","password":"` + jiniWords + `"}`
+	loginAdapter()(nil).ServeHTTP(rr, withSessions(createRequest(assert, "POST", "/login", body, api)))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Len(sessions.List("email@domain", time.Now()), 1)
+
+	cookie := rr.Result().Cookies()[0]
+	assert.Nil(rr.Result().Body.Close())
+
+	ok := http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		res.WriteHeader(http.StatusOK)
+	})
+	authed := func(path string) *httptest.ResponseRecorder {
+		req := withSessions(createRequest(assert, "POST", path, "", api))
+		req.AddCookie(cookie)
+
+		rr := httptest.NewRecorder()
+		authAdapter()(refreshAdapter()(logoutAdapter()(ok))).ServeHTTP(rr, req)
+
+		return rr
+	}
+
+	assert.Equal(http.StatusOK, authed("/api/v1/types").Code)
+
+	// Refreshed tokens belong to the same session
+	rr = authed("/refresh")
+	assert.Equal(http.StatusOK, rr.Code)
+
+	refreshed, err := auth.FromJWT(rr.Result().Cookies()[0].Value, authKey)
+	assert.Nil(err)
+	assert.Nil(rr.Result().Body.Close())
+	assert.Equal(sessions.List("", time.Now())[0].ID, refreshed.Id)
+
+	// After logout the token is no good
+	rr = authed("/logout")
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal(-1, rr.Result().Cookies()[0].MaxAge)
+	assert.Nil(rr.Result().Body.Close())
+
+	assert.Equal(http.StatusUnauthorized, authed("/api/v1/types").Code)
+	assert.Equal(http.StatusUnauthorized, authed("/refresh").Code)
+
+	// Callers that logged in with a rsa key get a session when they refresh
+	claims := auth.NewClaims("zebra", "jini", jini.Role, "email@domain")
+	rr = httptest.NewRecorder()
+	refreshAdapter()(nil).ServeHTTP(rr, withSessions(makeRefreshRequest(assert, claims, authKey)))
+	assert.Equal(http.StatusOK, rr.Code)
+
+	_, found := sessions.Get(claims.Id)
+	assert.True(found)
+
+	// Logout needs a caller
+	rr = httptest.NewRecorder()
+	logoutAdapter()(nil).ServeHTTP(rr, createRequest(assert, "POST", "/logout", "", api))
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+
+	testForward(assert, logoutAdapter())
+}
+
+func TestSessionHandlers(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_session_handlers"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	sessions := NewSessions(DefaultSessionConfig())
+	now := time.Now()
+
+	user := userClaims(assert, "user@zebra")
+	sessions.Start(user, "", now)
+	sessions.Start(userClaims(assert, "user@zebra"), "", now)
+	sessions.Start(userClaims(assert, "other@zebra"), "", now)
+
+	call := func(h httprouter.Handle, method, url, id string, claims *auth.Claims) *httptest.ResponseRecorder {
+		req := createRequest(assert, method, url, "", api)
+		if claims != nil {
+			req = makeClaimsRequest(assert, method, url, "", api, claims)
+		}
+
+		req = req.Clone(context.WithValue(req.Context(), SessionsCtxKey, sessions))
+		rr := httptest.NewRecorder()
+		h(rr, req, httprouter.Params{{Key: "id", Value: id}})
+
+		return rr
+	}
+
+	list := func(claims *auth.Claims, url string) []Session {
+		rr := call(handleSessions(), "GET", url, "", claims)
+		assert.Equal(http.StatusOK, rr.Code)
+
+		found := []Session{}
+		assert.Nil(json.Unmarshal(rr.Body.Bytes(), &found))
+
+		return found
+	}
+
+	rr := httptest.NewRecorder()
+	handleSessions()(rr, makeClaimsRequest(assert, "GET", "/", "", api, user), nil)
+	assert.Equal(http.StatusInternalServerError, rr.Code)
+
+	assert.Equal(http.StatusUnauthorized, call(handleSessions(), "GET", "/", "", nil).Code)
+
+	// Users see their own sessions, admins everyone's
+	assert.Len(list(user, "/api/v1/sessions"), 2)
+	assert.Len(list(adminClaims(assert), "/api/v1/sessions"), 3)
+	assert.Len(list(adminClaims(assert), "/api/v1/sessions?user=other@zebra"), 1)
+	assert.Equal(http.StatusForbidden, call(handleSessions(), "GET", "/?user=other@zebra", "", user).Code)
+
+	// Users can end their own sessions
+	assert.Equal(http.StatusNotFound, call(handleRevokeSession(), "DELETE", "/", "unknown", user).Code)
+	assert.Equal(http.StatusOK, call(handleRevokeSession(), "DELETE", "/", user.Id, user).Code)
+
+	other := list(adminClaims(assert), "/api/v1/sessions?user=other@zebra")[0]
+	assert.Equal(http.StatusForbidden, call(handleRevokeSession(), "DELETE", "/", other.ID, user).Code)
+
+	// Admins can end all sessions of a user
+	assert.Equal(http.StatusBadRequest, call(handleRevokeSessions(), "DELETE", "/", "", adminClaims(assert)).Code)
+	assert.Equal(http.StatusForbidden, call(handleRevokeSessions(), "DELETE", "/?user=other@zebra", "", user).Code)
+
+	rr = call(handleRevokeSessions(), "DELETE", "/?user=user@zebra", "", adminClaims(assert))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.JSONEq(`{"revoked":1}`, rr.Body.String())
+
+	for _, s := range list(user, "/api/v1/sessions") {
+		assert.True(s.Revoked)
+	}
+}
@@ -20,7 +20,7 @@ func setupLogger(cfgStore *config.Store) context.Context {
 	zl := zerolog.New(os.Stderr).Level(zerolog.DebugLevel)
 	logger := zerologr.New(&zl)
 
-	return logr.NewContext(ctx, logger.WithName("zebra"))
+	return logr.NewContext(ctx, redactLogger(logger.WithName("zebra")))
 }
 
 func setupAdapter(ctx context.Context, cfgStore *config.Store) web.Adapter {
@@ -49,10 +49,62 @@ func setupAdapter(ctx context.Context, cfgStore *config.Store) web.Adapter {
 
 	log.Info("zebra store initialized")
 
+	metrics := NewMetrics()
+	resAPI.Instrument(metrics)
+
 	if e := initAdminUser(log, resAPI.Store, cfgStore); e != nil {
 		panic(e)
 	}
 
+	health := setupHealth(ctx, cfgStore, resAPI)
+
+	queueCfg := QueueConfig{Priorities: DefaultPriorities()}
+	if e := cfgStore.Get("queue", &queueCfg); e == nil {
+		resAPI.Allocator.SetPriorities(queueCfg.Priorities)
+	}
+
+	leaseCfg := DefaultLeaseConfig()
+	if e := cfgStore.Get("leases", leaseCfg); e == nil {
+		resAPI.Allocator.SetLeaseConfig(leaseCfg)
+	}
+
+	setupWebhooks(ctx, cfgStore, resAPI)
+
+	heartbeatCfg := DefaultHeartbeatConfig()
+	if e := cfgStore.Get("heartbeats", heartbeatCfg); e == nil {
+		resAPI.Allocator.SetIdleTimeout(heartbeatCfg.IdleTimeout.Duration)
+	}
+
+	reportCfg := DefaultReportConfig()
+	if e := cfgStore.Get("reports", reportCfg); e == nil {
+		resAPI.Allocator.SetUsageRetention(reportCfg.Retention.Duration)
+	}
+
+	hookCfg := DefaultHookConfig()
+	if e := cfgStore.Get("hooks", hookCfg); e == nil {
+		resAPI.Allocator.SetHooks(hookCfg)
+	}
+
+	audit := setupAudit(ctx, cfgStore)
+
+	sessionCfg := DefaultSessionConfig()
+	if e := cfgStore.Get("sessions", sessionCfg); e != nil {
+		sessionCfg = DefaultSessionConfig()
+	}
+
+	sessions := NewSessions(sessionCfg)
+	keys := setupKeys(ctx, cfgStore)
+
+	signatureCfg := DefaultSignatureConfig()
+	if e := cfgStore.Get("signatures", signatureCfg); e != nil {
+		signatureCfg = DefaultSignatureConfig()
+	}
+
+	signatures := NewSignatures(signatureCfg)
+	tokens := setupTokens(ctx, cfgStore)
+
+	go resAPI.Allocator.Run(ctx, ScheduleInterval)
+
 	return func(nextHandler http.Handler) http.Handler {
 		return http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
 			if nextHandler == nil {
@@ -65,6 +117,16 @@ func setupAdapter(ctx context.Context, cfgStore *config.Store) web.Adapter {
 			ctx = logr.NewContext(ctx, log)
 			ctx = context.WithValue(ctx, AuthCtxKey, authKey)
 			ctx = context.WithValue(ctx, ResourcesCtxKey, resAPI)
+			ctx = context.WithValue(ctx, HealthCtxKey, health)
+			ctx = context.WithValue(ctx, MetricsCtxKey, metrics)
+			ctx = context.WithValue(ctx, AuditCtxKey, audit)
+			ctx = context.WithValue(ctx, SessionsCtxKey, sessions)
+			ctx = context.WithValue(ctx, SignaturesCtxKey, signatures)
+			ctx = context.WithValue(ctx, TokensCtxKey, tokens)
+
+			if keys != nil {
+				ctx = context.WithValue(ctx, KeysCtxKey, keys)
+			}
 
 			newReq := req.Clone(ctx)
 
@@ -89,3 +151,82 @@ func initAdminUser(log logr.Logger, store zebra.Store, cfgStore *config.Store) e
 
 	return nil
 }
+
+// setupHealth starts the health checker if any probes are configured in the
+// "health" section of the configuration.
+func setupHealth(ctx context.Context, cfgStore *config.Store, api *ResourceAPI) *HealthChecker {
+	log := logr.FromContextOrDiscard(ctx)
+	cfg := DefaultHealthConfig()
+
+	if e := cfgStore.Get("health", cfg); e != nil || len(cfg.Probes) == 0 {
+		log.Info("health checks are not configured")
+
+		return nil
+	}
+
+	checker := NewHealthChecker(cfg, api)
+
+	go checker.Run(ctx)
+
+	log.Info("health checker started", "interval", cfg.Interval.String())
+
+	return checker
+}
+
+// setupWebhooks starts delivering events to webhooks with the settings of the
+// "webhooks" section of the configuration, or the defaults if there is none.
+func setupWebhooks(ctx context.Context, cfgStore *config.Store, api *ResourceAPI) {
+	log := logr.FromContextOrDiscard(ctx)
+	cfg := DefaultWebhookConfig()
+
+	if e := cfgStore.Get("webhooks", cfg); e != nil {
+		cfg = DefaultWebhookConfig()
+	}
+
+	api.Webhooks = NewDispatcher(cfg, api.Store, api.Webhooks.secrets)
+	api.Allocator.webhooks = api.Webhooks
+
+	go api.Webhooks.Run(ctx)
+
+	log.Info("webhook dispatcher started", "attempts", cfg.Attempts, "backoff", cfg.Backoff.String())
+}
+
+// setupAudit opens the audit log with the settings of the "audit" section of
+// the configuration, or the defaults if there is none.
+func setupAudit(ctx context.Context, cfgStore *config.Store) *AuditLog {
+	log := logr.FromContextOrDiscard(ctx)
+	cfg := DefaultAuditConfig()
+
+	if e := cfgStore.Get("audit", cfg); e != nil {
+		cfg = DefaultAuditConfig()
+	}
+
+	audit, err := NewAuditLog(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Info("audit log opened", "path", cfg.Path)
+
+	return audit
+}
+
+// setupTokens loads the API tokens with the settings of the "tokens" section
+// of the configuration, or the defaults if there is none.
+func setupTokens(ctx context.Context, cfgStore *config.Store) *Tokens {
+	log := logr.FromContextOrDiscard(ctx)
+	cfg := DefaultTokenConfig()
+
+	if e := cfgStore.Get("tokens", cfg); e != nil {
+		cfg = DefaultTokenConfig()
+	}
+
+	tokens, err := NewTokens(cfg)
+	if err != nil {
+		panic(err)
+	}
+
+	log.Info("api tokens loaded", "path", cfg.Path)
+
+	return tokens
+}
@@ -13,6 +13,8 @@ import (
 const storeCfg = `
 {
 	"store": { "rootDir": "test_setup" },
+	"audit": { "path": "test_setup/audit.jsonl", "maxSize": 1048576, "maxFiles": 1 },
+	"tokens": { "path": "test_setup/tokens.json" },
 	"authKey": "AvadaKedavra",
 	"admin": {
 	  "meta": {
@@ -49,6 +51,8 @@ const storeCfg = `
 const storeCfgAdapter = `
 {
 	"store": { "rootDir": "test_setup_adapter" },
+	"audit": { "path": "test_setup_adapter/audit.jsonl", "maxSize": 1048576, "maxFiles": 1 },
+	"tokens": { "path": "test_setup_adapter/tokens.json" },
 	"authKey": "AvadaKedavra",
 	"admin": {
 	  "meta": {
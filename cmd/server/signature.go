@@ -0,0 +1,198 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/project-safari/zebra/auth"
+)
+
+const (
+	DefaultMaxSkew = 5 * time.Minute
+	DefaultMaxBody = 32 << 20
+)
+
+var (
+	ErrSignatureStale = errors.New("request signature is too old or in the future")
+	ErrNonceReplayed  = errors.New("request nonce was already used")
+)
+
+// SignatureConfig is the "signatures" section of the server configuration.
+// Signed requests are refused if their time is more than MaxSkew away from
+// the server clock, or if their body is larger than MaxBody bytes. LegacyAuth
+// also accepts the static Zebra-Auth-Token of older clients until they have all
+// been upgraded.
+type SignatureConfig struct {
+	MaxSkew    Duration `json:"maxSkew"`
+	MaxBody    int64    `json:"maxBody"`
+	LegacyAuth bool     `json:"legacyAuth"`
+}
+
+func DefaultSignatureConfig() *SignatureConfig {
+	return &SignatureConfig{MaxSkew: Duration{DefaultMaxSkew}, MaxBody: DefaultMaxBody, LegacyAuth: false}
+}
+
+// Signatures remembers the nonces of the signed requests that are recent
+// enough to be accepted, so that none of them can be replayed. The nonces are
+// also kept in the order they can be forgotten.
+type Signatures struct {
+	lock    sync.Mutex
+	maxSkew time.Duration
+	maxBody int64
+	legacy  bool
+	nonces  map[string]time.Time
+	expiry  []nonceExpiry
+}
+
+// nonceExpiry is when a nonce can be forgotten.
+type nonceExpiry struct {
+	key   string
+	until time.Time
+}
+
+func NewSignatures(cfg *SignatureConfig) *Signatures {
+	if cfg.MaxSkew.Duration <= 0 {
+		cfg.MaxSkew.Duration = DefaultMaxSkew
+	}
+
+	if cfg.MaxBody <= 0 {
+		cfg.MaxBody = DefaultMaxBody
+	}
+
+	return &Signatures{
+		lock:    sync.Mutex{},
+		maxSkew: cfg.MaxSkew.Duration,
+		maxBody: cfg.MaxBody,
+		legacy:  cfg.LegacyAuth,
+		nonces:  map[string]time.Time{},
+		expiry:  []nonceExpiry{},
+	}
+}
+
+// Legacy returns true if requests may still authenticate with the static
+// Zebra-Auth-Token.
+func (s *Signatures) Legacy() bool {
+	return s.legacy
+}
+
+// Accept returns an error if the signature is stale or its nonce has been
+// seen before, and remembers the nonce otherwise.
+func (s *Signatures) Accept(sig *auth.RequestSignature, now time.Time) error {
+	created := sig.Time()
+	if created.Before(now.Add(-s.maxSkew)) || created.After(now.Add(s.maxSkew)) {
+		return ErrSignatureStale
+	}
+
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	// Nonces of signatures that are stale by now need not be kept, they
+	// are forgotten in the order they were seen.
+	for len(s.expiry) > 0 && s.expiry[0].until.Before(now) {
+		if e := s.expiry[0]; s.nonces[e.key].Equal(e.until) {
+			delete(s.nonces, e.key)
+		}
+
+		s.expiry = s.expiry[1:]
+	}
+
+	key := sig.KeyID + " " + sig.Nonce
+	if _, ok := s.nonces[key]; ok {
+		return ErrNonceReplayed
+	}
+
+	// A signature made up to maxSkew ahead stays fresh for maxSkew after that
+	until := now.Add(2 * s.maxSkew)
+	s.nonces[key] = until
+	s.expiry = append(s.expiry, nonceExpiry{key: key, until: until})
+
+	return nil
+}
+
+// signedRequest verifies the signature of the request with the key of the
+// user who signed it and sets the claims of the user into the request context.
+// It returns nil if the request is not signed or the signature is not good.
+func signedRequest(res http.ResponseWriter, req *http.Request) *http.Request {
+	ctx := req.Context()
+	log := logr.FromContextOrDiscard(ctx)
+	api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+	if !ok {
+		log.Error(nil, "resources not in context")
+
+		return nil
+	}
+
+	signatures, ok := ctx.Value(SignaturesCtxKey).(*Signatures)
+	if !ok {
+		return nil
+	}
+
+	sig, err := auth.ParseSignature(req)
+	if errors.Is(err, auth.ErrNoSignature) {
+		return nil
+	} else if err != nil {
+		log.Error(err, "bad request signature")
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	// Make sure the user still exists
+	user := findUser(api.Store, sig.KeyID)
+	if user == nil || user.Key == nil {
+		log.Error(nil, "user not found", "user", sig.KeyID)
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	body := []byte{}
+
+	if req.Body != nil {
+		// Read one byte more than allowed to tell a body that is too large
+		body, err = ioutil.ReadAll(io.LimitReader(req.Body, signatures.maxBody+1))
+		if err != nil {
+			log.Error(err, "request body could not be read")
+			res.WriteHeader(http.StatusBadRequest)
+
+			return nil
+		}
+
+		if int64(len(body)) > signatures.maxBody {
+			log.Error(nil, "request body too large", "user", sig.KeyID, "limit", signatures.maxBody)
+			res.WriteHeader(http.StatusRequestEntityTooLarge)
+
+			return nil
+		}
+
+		req.Body = ioutil.NopCloser(bytes.NewReader(body))
+	}
+
+	if err := sig.Verify(req, body, user.Key); err != nil {
+		log.Error(err, "request signature invalid", "user", sig.KeyID)
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	if err := signatures.Accept(sig, time.Now()); err != nil {
+		log.Error(err, "request signature refused", "user", sig.KeyID)
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	// Set the claims into request
+	claims := auth.NewClaims("zebra", user.Meta.Name, user.Role, user.Email)
+	ctx = context.WithValue(ctx, ClaimsCtxKey, claims)
+
+	return req.Clone(ctx)
+}
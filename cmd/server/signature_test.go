@@ -0,0 +1,155 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/base64"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSignatures(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	signatures := NewSignatures(DefaultSignatureConfig())
+	assert.False(signatures.Legacy())
+
+	now := time.Now()
+	sig := &auth.RequestSignature{KeyID: "user@zebra", Created: now.Unix(), Nonce: "abc", Signature: nil}
+
+	assert.Nil(signatures.Accept(sig, now))
+	assert.ErrorIs(signatures.Accept(sig, now.Add(time.Minute)), ErrNonceReplayed)
+
+	// Nonces are per user
+	other := &auth.RequestSignature{KeyID: "other@zebra", Created: now.Unix(), Nonce: "abc", Signature: nil}
+	assert.Nil(signatures.Accept(other, now))
+
+	// Signatures must be recent
+	assert.ErrorIs(signatures.Accept(sig, now.Add(DefaultMaxSkew+time.Second)), ErrSignatureStale)
+
+	future := &auth.RequestSignature{KeyID: "user@zebra", Created: now.Add(time.Hour).Unix(), Nonce: "f", Signature: nil}
+	assert.ErrorIs(signatures.Accept(future, now), ErrSignatureStale)
+
+	// A signature made ahead of the server clock can not be replayed while
+	// it is fresh
+	ahead := &auth.RequestSignature{KeyID: "user@zebra", Created: now.Add(DefaultMaxSkew).Unix(), Nonce: "a"}
+	assert.Nil(signatures.Accept(ahead, now))
+	assert.ErrorIs(signatures.Accept(ahead, now.Add(2*DefaultMaxSkew-time.Second)), ErrNonceReplayed)
+
+	// Nonces of stale signatures are forgotten
+	later := now.Add(2*DefaultMaxSkew + time.Minute)
+	fresh := &auth.RequestSignature{KeyID: "user@zebra", Created: later.Unix(), Nonce: "def", Signature: nil}
+	assert.Nil(signatures.Accept(fresh, later))
+	assert.Len(signatures.nonces, 1)
+	assert.Len(signatures.expiry, 1)
+
+	// Without a skew in the configuration the default is used
+	unset := NewSignatures(&SignatureConfig{MaxSkew: Duration{0}, MaxBody: 0, LegacyAuth: false})
+	assert.Nil(unset.Accept(sig, now.Add(time.Minute)))
+}
+
+func TestSignedRequest(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_signed_request"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	jini := makeUser(assert)
+	key := jini.Key
+	jini.Key = key.Public()
+	assert.Nil(api.Store.Create(jini))
+
+	signatures := NewSignatures(DefaultSignatureConfig())
+	withSignatures := func(req *http.Request, signatures *Signatures) *http.Request {
+		ctx := context.WithValue(req.Context(), SignaturesCtxKey, signatures)
+		ctx = context.WithValue(ctx, AuthCtxKey, authKey)
+
+		return req.Clone(ctx)
+	}
+
+	body := `{"name":"test"}`
+	call := func(req *http.Request) int {
+		rr := httptest.NewRecorder()
+		authAdapter()(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			// The body is still there for the handlers
+			data := struct {
+				Name string `json:"name"`
+			}{Name: ""}
+			assert.Nil(readJSON(req.Context(), req, &data))
+			assert.Equal("test", data.Name)
+			res.WriteHeader(http.StatusOK)
+		})).ServeHTTP(rr, req)
+
+		return rr.Code
+	}
+
+	signed := func(email string, key *auth.RsaIdentity, now time.Time) *http.Request {
+		req := withSignatures(createRequest(assert, "POST", "/api/v1/resources", body, api), signatures)
+		assert.Nil(auth.SignRequest(req, []byte(body), email, key, now))
+
+		return req
+	}
+
+	req := signed("email@domain", key, time.Now())
+	assert.Equal(http.StatusOK, call(req))
+
+	// The same request cannot be replayed
+	req = req.Clone(req.Context())
+	req.Body = createRequest(assert, "POST", "/", body, api).Body
+	assert.Equal(http.StatusUnauthorized, call(req))
+
+	// Nor can an old one
+	assert.Equal(http.StatusUnauthorized, call(signed("email@domain", key, time.Now().Add(-time.Hour))))
+
+	// The signature must be made by the key of the user
+	other, err := auth.Generate()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnauthorized, call(signed("email@domain", other, time.Now())))
+	assert.Equal(http.StatusUnauthorized, call(signed("unknown@domain", key, time.Now())))
+
+	// The static token is only accepted if legacy auth is enabled
+	token, err := key.Sign([]byte("email@domain"))
+	assert.Nil(err)
+
+	legacy := func(signatures *Signatures) int {
+		req := withSignatures(createRequest(assert, "POST", "/api/v1/resources", body, api), signatures)
+		req.Header.Set("Zebra-Auth-User", "email@domain")
+		req.Header.Set("Zebra-Auth-Token", base64.StdEncoding.EncodeToString(token))
+
+		return call(req)
+	}
+
+	assert.Equal(http.StatusUnauthorized, legacy(signatures))
+
+	lenient := NewSignatures(&SignatureConfig{MaxSkew: Duration{DefaultMaxSkew}, MaxBody: 0, LegacyAuth: true})
+	assert.Equal(http.StatusOK, legacy(lenient))
+
+	// A refused signature ends the chain, other credentials are not tried
+	reached := false
+	req = withSignatures(createRequest(assert, "POST", "/api/v1/resources", body, api), lenient)
+	assert.Nil(auth.SignRequest(req, []byte(body), "email@domain", other, time.Now()))
+	req.Header.Set("Zebra-Auth-User", "email@domain")
+	req.Header.Set("Zebra-Auth-Token", base64.StdEncoding.EncodeToString(token))
+
+	rr := httptest.NewRecorder()
+	authAdapter()(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+		reached = true
+	})).ServeHTTP(rr, req)
+	assert.Equal(http.StatusUnauthorized, rr.Code)
+	assert.False(reached)
+
+	// Bodies larger than the limit are not read
+	small := NewSignatures(&SignatureConfig{MaxSkew: Duration{DefaultMaxSkew}, MaxBody: 4, LegacyAuth: false})
+	req = withSignatures(createRequest(assert, "POST", "/api/v1/resources", body, api), small)
+	assert.Nil(auth.SignRequest(req, []byte(body), "email@domain", key, time.Now()))
+	assert.Equal(http.StatusRequestEntityTooLarge, call(req))
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model/lease"
+)
+
+var (
+	ErrNoTemplate       = errors.New("lease template not found")
+	ErrTemplateDuration = errors.New("lease template is longer than its resources may be leased")
+)
+
+// checkTemplate makes sure that a lease template about to be stored is not
+// longer than any role may lease its resource types for. It reads the lease
+// limits, so the allocator lock must be held.
+func (a *Allocator) checkTemplate(res zebra.Resource) error {
+	t, ok := res.(*lease.Template)
+	if !ok {
+		return nil
+	}
+
+	types := make([]string, 0, len(t.Request))
+	for _, req := range t.Request {
+		types = append(types, req.Type)
+	}
+
+	if longest := a.leaseCfg.MaxDurationFor(types); t.Duration > longest {
+		return fmt.Errorf("%w: %s is over %s", ErrTemplateDuration, t.Duration, longest)
+	}
+
+	return nil
+}
+
+// versionTemplate numbers a lease template about to be stored one version
+// after the template it replaces, if any.
+func versionTemplate(store zebra.Store, res zebra.Resource) {
+	t, ok := res.(*lease.Template)
+	if !ok {
+		return
+	}
+
+	t.Version = 1
+
+	if old, ok := findResource(store, t.Meta.ID).(*lease.Template); ok {
+		t.Version = old.Version + 1
+	}
+}
+
+// findTemplate returns the lease template with the given name.
+func findTemplate(store zebra.Store, name string) *lease.Template {
+	var found *lease.Template
+
+	_ = applyFunc(store.QueryType([]string{lease.TemplateType().Name}), func(res zebra.Resource) error {
+		if t, ok := res.(*lease.Template); ok && t.Meta.Name == name {
+			found = t
+		}
+
+		return nil
+	})
+
+	return found
+}
+
+// useTemplate fills in the requests of a lease from the template it names,
+// adds the placement constraints of the template to those of the lease and
+// records the version of the template. The duration of the template is used
+// unless the lease has one.
+func useTemplate(store zebra.Store, l *lease.Lease) error {
+	t := findTemplate(store, l.Template.Name)
+	if t == nil {
+		return fmt.Errorf("%w: %s", ErrNoTemplate, l.Template.Name)
+	}
+
+	reqs, err := t.Instantiate(l.Template.Counts)
+	if err != nil {
+		return err
+	}
+
+	l.Request = reqs
+	l.Placement = append(append([]lease.Placement{}, t.Placement...), l.Placement...)
+	l.Template.Version = t.Version
+
+	if l.Duration == 0 {
+		l.Duration = t.Duration
+	}
+
+	return nil
+}
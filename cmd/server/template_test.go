@@ -0,0 +1,130 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/stretchr/testify/assert"
+)
+
+func testbed() *lease.Template {
+	return lease.NewTemplate("testbed", 2*time.Hour, []*lease.ResourceReq{
+		{Type: "compute.server", Name: "servers", Count: 1},
+		{Type: "compute.server", Count: 1},
+	})
+}
+
+func TestTemplate(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+	tmpl := testbed()
+	assert.Nil(tmpl.Validate(ctx))
+
+	reqs, err := tmpl.Instantiate(map[string]int{"servers": 3})
+	assert.Nil(err)
+	assert.Equal(3, reqs[0].Count)
+	assert.Equal(1, reqs[1].Count)
+	assert.Equal(1, tmpl.Request[0].Count)
+
+	_, err = tmpl.Instantiate(map[string]int{"switches": 1})
+	assert.ErrorIs(err, lease.ErrTemplateParam)
+
+	_, err = tmpl.Instantiate(map[string]int{"servers": 0})
+	assert.ErrorIs(err, lease.ErrTemplateValid)
+
+	assert.NotNil(lease.NewTemplate("empty", time.Hour, nil).Validate(ctx))
+	assert.NotNil(lease.NewTemplate("forever", 0, tmpl.Request).Validate(ctx))
+	assert.Nil(lease.NewTemplate("long", 8*time.Hour, tmpl.Request).Validate(ctx))
+	assert.NotNil(lease.NewTemplate("twice", time.Hour, []*lease.ResourceReq{
+		{Type: "compute.server", Name: "servers", Count: 1},
+		{Type: "compute.server", Name: "servers", Count: 1},
+	}).Validate(ctx))
+	assert.NotNil(lease.EmptyTemplate().Validate(ctx))
+}
+
+func TestCheckTemplate(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_check_template"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 0)
+	long := testbed()
+	long.Duration = 6 * time.Hour
+
+	// Templates are held to the longest lease any role may have
+	assert.ErrorIs(api.create(long), ErrTemplateDuration)
+
+	cfg := DefaultLeaseConfig()
+	cfg.Roles["admin"] = LeaseLimits{MaxDuration: Duration{8 * time.Hour}}
+	api.Allocator.SetLeaseConfig(cfg)
+	assert.Nil(api.create(long))
+
+	cfg.Types["compute.server"] = LeaseLimits{MaxDuration: Duration{time.Hour}}
+	assert.ErrorIs(api.Allocator.checkTemplate(long), ErrTemplateDuration)
+	assert.Nil(api.Allocator.checkTemplate(serverLease("user@zebra", 1)))
+}
+
+func TestTemplateLease(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_template_lease"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 4)
+	tmpl := testbed()
+	assert.Nil(api.create(tmpl))
+	assert.Equal(1, findTemplate(api.Store, "testbed").Version)
+
+	post := func(ref *lease.TemplateRef) *httptest.ResponseRecorder {
+		l := lease.NewLease("someone@zebra", 0, nil)
+		l.Template = ref
+
+		b, err := json.Marshal(l)
+		assert.Nil(err)
+
+		rr := httptest.NewRecorder()
+		handleLease()(rr, makeClaimsRequest(assert, "POST", "/", string(b), api, userClaims(assert, "user@zebra")), nil)
+
+		return rr
+	}
+
+	assert.Equal(http.StatusNotFound, post(&lease.TemplateRef{Name: "nothing"}).Code)
+	assert.Equal(http.StatusBadRequest, post(&lease.TemplateRef{Name: "testbed", Counts: map[string]int{"x": 1}}).Code)
+
+	rr := post(&lease.TemplateRef{Name: "testbed", Counts: map[string]int{"servers": 2}})
+	assert.Equal(http.StatusOK, rr.Code)
+
+	l := new(lease.Lease)
+	assert.Nil(json.Unmarshal(rr.Body.Bytes(), l))
+	assert.Equal(lease.Activated, l.Phase)
+	assert.Equal(2*time.Hour, l.Duration)
+	assert.Equal(1, l.Template.Version)
+	assert.Len(l.Request, 2)
+	assert.Len(l.Request[0].Resources, 2)
+
+	// A new version does not change the lease
+	updated := testbed()
+	updated.Meta.ID = tmpl.Meta.ID
+	updated.Request[0].Count = 5
+	assert.Nil(api.create(updated))
+	assert.Equal(2, updated.Version)
+
+	stored, ok := findResource(api.Store, l.Meta.ID).(*lease.Lease)
+	assert.True(ok)
+	assert.Equal(1, stored.Template.Version)
+	assert.Equal(2, stored.Request[0].Count)
+	assert.Len(stored.Request[0].Resources, 2)
+}
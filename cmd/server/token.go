@@ -0,0 +1,461 @@
+package main
+
+import (
+	"context"
+	"crypto/subtle"
+	"encoding/json"
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+)
+
+const (
+	// TokenKey is the privilege key of API tokens. Only users who may write
+	// it, admins by default, may list and revoke the tokens of others.
+	TokenKey = "system.token"
+
+	DefaultTokensPath       = "zebra-tokens.json"
+	DefaultTokenDuration    = 30 * 24 * time.Hour
+	DefaultTokenMaxDuration = 365 * 24 * time.Hour
+)
+
+var (
+	ErrTokenName       = errors.New("api token name is empty")
+	ErrTokenExists     = errors.New("api token with this name already exists")
+	ErrTokenPrivileges = errors.New("api token needs at least one privilege")
+	ErrTokenDuration   = errors.New("api token duration is out of range")
+	ErrTokenUnknown    = errors.New("api token is unknown")
+	ErrTokenExpired    = errors.New("api token has expired")
+)
+
+// TokenConfig is the "tokens" section of the server configuration. API tokens
+// are kept in the file at Path and may be valid for at most MaxDuration.
+type TokenConfig struct {
+	Path        string   `json:"path"`
+	MaxDuration Duration `json:"maxDuration"`
+}
+
+func DefaultTokenConfig() *TokenConfig {
+	return &TokenConfig{Path: DefaultTokensPath, MaxDuration: Duration{DefaultTokenMaxDuration}}
+}
+
+// TokenRequest asks for a new API token. The token is valid for Duration,
+// DefaultTokenDuration if it is 0.
+type TokenRequest struct {
+	Name       string       `json:"name"`
+	Privileges []*auth.Priv `json:"privileges"`
+	Duration   Duration     `json:"duration"`
+}
+
+// NewToken is a new API token along with the token itself, which is never
+// shown again.
+type NewToken struct {
+	auth.APIToken
+	Token string `json:"token"`
+}
+
+// Tokens is the table of API tokens of the server, saved to a file whenever
+// it changes.
+type Tokens struct {
+	lock        sync.Mutex
+	path        string
+	maxDuration time.Duration
+	tokens      map[string]*auth.APIToken
+}
+
+// NewTokens loads the API tokens from the file of the configuration, if it
+// exists.
+func NewTokens(cfg *TokenConfig) (*Tokens, error) {
+	t := &Tokens{
+		lock:        sync.Mutex{},
+		path:        cfg.Path,
+		maxDuration: cfg.MaxDuration.Duration,
+		tokens:      map[string]*auth.APIToken{},
+	}
+
+	b, err := ioutil.ReadFile(cfg.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return t, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	list := []*auth.APIToken{}
+	if err := json.Unmarshal(b, &list); err != nil {
+		return nil, err
+	}
+
+	for _, token := range list {
+		t.tokens[token.ID] = token
+	}
+
+	return t, nil
+}
+
+// Create makes a new API token for the user with the given role and returns
+// it with the token itself.
+func (t *Tokens) Create(email string, role *auth.Role, req *TokenRequest, now time.Time) (*NewToken, error) {
+	if strings.TrimSpace(req.Name) == "" {
+		return nil, ErrTokenName
+	}
+
+	if len(req.Privileges) == 0 {
+		return nil, ErrTokenPrivileges
+	}
+
+	for _, priv := range req.Privileges {
+		if priv == nil || !role.Covers(priv) {
+			return nil, ErrForbidden
+		}
+	}
+
+	duration := req.Duration.Duration
+	if duration == 0 {
+		duration = DefaultTokenDuration
+	}
+
+	if duration < 0 || duration > t.maxDuration {
+		return nil, ErrTokenDuration
+	}
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	t.prune(now)
+
+	for _, token := range t.tokens {
+		if token.Email == email && token.Name == req.Name {
+			return nil, ErrTokenExists
+		}
+	}
+
+	token, secret, err := auth.NewAPIToken(req.Name, email, req.Privileges, now, now.Add(duration))
+	if err != nil {
+		return nil, err
+	}
+
+	t.tokens[token.ID] = token
+
+	if err := t.save(); err != nil {
+		delete(t.tokens, token.ID)
+
+		return nil, err
+	}
+
+	created := *token
+	created.Hash = ""
+
+	return &NewToken{APIToken: created, Token: secret}, nil
+}
+
+// Authenticate returns the API token of a secret token if it has not expired.
+func (t *Tokens) Authenticate(secret string, now time.Time) (*auth.APIToken, error) {
+	hash := auth.HashToken(secret)
+
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	for _, token := range t.tokens {
+		if subtle.ConstantTimeCompare([]byte(hash), []byte(token.Hash)) != 1 {
+			continue
+		}
+
+		if token.Expired(now) {
+			return nil, ErrTokenExpired
+		}
+
+		found := *token
+
+		return &found, nil
+	}
+
+	return nil, ErrTokenUnknown
+}
+
+// Get returns an API token without its hash.
+func (t *Tokens) Get(id string) (auth.APIToken, bool) {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	token, ok := t.tokens[id]
+	if !ok {
+		return auth.APIToken{}, false
+	}
+
+	found := *token
+	found.Hash = ""
+
+	return found, true
+}
+
+// List returns the API tokens of a user, or of all users if email is empty,
+// oldest first and without their hashes.
+func (t *Tokens) List(email string) []auth.APIToken {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	list := []auth.APIToken{}
+
+	for _, token := range t.tokens {
+		if email == "" || token.Email == email {
+			found := *token
+			found.Hash = ""
+			list = append(list, found)
+		}
+	}
+
+	sort.Slice(list, func(i, j int) bool { return list[i].Created.Before(list[j].Created) })
+
+	return list
+}
+
+// Revoke deletes an API token.
+func (t *Tokens) Revoke(id string) error {
+	t.lock.Lock()
+	defer t.lock.Unlock()
+
+	token, ok := t.tokens[id]
+	if !ok {
+		return ErrTokenUnknown
+	}
+
+	delete(t.tokens, id)
+
+	if err := t.save(); err != nil {
+		t.tokens[id] = token
+
+		return err
+	}
+
+	return nil
+}
+
+// prune forgets the tokens that have expired. The caller must hold the lock.
+func (t *Tokens) prune(now time.Time) {
+	for id, token := range t.tokens {
+		if token.Expired(now) {
+			delete(t.tokens, id)
+		}
+	}
+}
+
+// save writes the tokens to their file. The caller must hold the lock.
+func (t *Tokens) save() error {
+	list := make([]*auth.APIToken, 0, len(t.tokens))
+	for _, token := range t.tokens {
+		list = append(list, token)
+	}
+
+	b, err := json.Marshal(list)
+	if err != nil {
+		return err
+	}
+
+	// Write a new file and move it over the old one, so that a crash does
+	// not leave half the tokens behind
+	tmp := t.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, auth.ReadOnly); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, t.path)
+}
+
+// apiToken authenticates a bearer API token in the Authorization header and
+// sets the claims of its user, limited to the privileges of the token, into
+// the request context.
+func apiToken(res http.ResponseWriter, req *http.Request) *http.Request {
+	ctx := req.Context()
+	log := logr.FromContextOrDiscard(ctx)
+	api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+	if !ok {
+		log.Error(nil, "resources not in context")
+
+		return nil
+	}
+
+	secret := strings.TrimPrefix(req.Header.Get("Authorization"), "Bearer ")
+	if !strings.HasPrefix(secret, auth.TokenPrefix) {
+		// No api token
+		return nil
+	}
+
+	tokens, ok := ctx.Value(TokensCtxKey).(*Tokens)
+	if !ok {
+		log.Error(nil, "tokens not in context")
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	token, err := tokens.Authenticate(secret, time.Now())
+	if err != nil {
+		log.Error(err, "api token refused")
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	// Make sure the user still exists
+	user := findUser(api.Store, token.Email)
+	if user == nil {
+		log.Error(nil, "user not found", "user", token.Email)
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil
+	}
+
+	// Set the claims into request
+	claims := auth.NewClaims("zebra", user.Meta.Name, user.Role, user.Email)
+	claims.Id = token.ID
+	claims.ExpiresAt = token.Expires.Unix()
+	claims.Scope = token.Scope()
+	ctx = context.WithValue(ctx, ClaimsCtxKey, claims)
+
+	return req.Clone(ctx)
+}
+
+// handleTokens lists the API tokens of the user given by the user query
+// parameter, of all users if there is none. Users may list their own tokens
+// and only users who may write tokens those of others.
+func handleTokens() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+
+		tokens, claims, ok := tokenAccess(res, req, req.URL.Query().Get("user"))
+		if !ok {
+			return
+		}
+
+		email := req.URL.Query().Get("user")
+		if email == "" && !claims.Write(TokenKey) {
+			email = claims.Email
+		}
+
+		writeJSON(ctx, res, tokens.List(email))
+	}
+}
+
+// handleCreateToken makes a new API token for the caller.
+func handleCreateToken() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+
+		tokens, claims, ok := tokenAccess(res, req, "")
+		if !ok {
+			return
+		}
+
+		tokenReq := &TokenRequest{Name: "", Privileges: nil, Duration: Duration{0}}
+		if err := readJSON(ctx, req, tokenReq); err != nil {
+			res.WriteHeader(http.StatusBadRequest)
+
+			return
+		}
+
+		token, err := tokens.Create(claims.Email, claims.Role, tokenReq, time.Now())
+
+		switch {
+		case errors.Is(err, ErrForbidden):
+			res.WriteHeader(http.StatusForbidden)
+
+			return
+		case errors.Is(err, ErrTokenExists):
+			res.WriteHeader(http.StatusConflict)
+
+			return
+		case errors.Is(err, ErrTokenName), errors.Is(err, ErrTokenPrivileges), errors.Is(err, ErrTokenDuration):
+			res.WriteHeader(http.StatusBadRequest)
+
+			return
+		case err != nil:
+			log.Error(err, "api token could not be saved")
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		log.Info("api token created", "user", claims.Email, "token", token.ID, "name", token.Name)
+
+		writeJSON(ctx, res, token)
+	}
+}
+
+// handleRevokeToken revokes one API token.
+func handleRevokeToken() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		log := logr.FromContextOrDiscard(ctx)
+		id := params.ByName("id")
+
+		tokens, ok := ctx.Value(TokensCtxKey).(*Tokens)
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		token, ok := tokens.Get(id)
+		if !ok {
+			res.WriteHeader(http.StatusNotFound)
+
+			return
+		}
+
+		_, claims, ok := tokenAccess(res, req, token.Email)
+		if !ok {
+			return
+		}
+
+		if err := tokens.Revoke(id); err != nil {
+			log.Error(err, "api token could not be revoked", "token", id)
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		log.Info("api token revoked", "user", claims.Email, "of", token.Email, "token", id)
+
+		res.WriteHeader(http.StatusOK)
+	}
+}
+
+// tokenAccess returns the tokens and the claims of the caller if the caller
+// may manage the API tokens of the user, writing the error status otherwise.
+// Everyone may manage their own tokens, but not with an API token.
+func tokenAccess(res http.ResponseWriter, req *http.Request, email string) (*Tokens, *auth.Claims, bool) {
+	ctx := req.Context()
+
+	tokens, ok := ctx.Value(TokensCtxKey).(*Tokens)
+	if !ok {
+		res.WriteHeader(http.StatusInternalServerError)
+
+		return nil, nil, false
+	}
+
+	claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+	if !ok {
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return nil, nil, false
+	}
+
+	if claims.Scope != nil || (email != "" && email != claims.Email && !claims.Write(TokenKey)) {
+		res.WriteHeader(http.StatusForbidden)
+
+		return nil, nil, false
+	}
+
+	return tokens, claims, true
+}
@@ -0,0 +1,267 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra/auth"
+	"github.com/stretchr/testify/assert"
+)
+
+func makeTokens(assert *assert.Assertions, root string) *Tokens {
+	assert.Nil(os.MkdirAll(root, os.ModePerm))
+
+	tokens, err := NewTokens(&TokenConfig{
+		Path:        path.Join(root, "tokens.json"),
+		MaxDuration: Duration{DefaultTokenMaxDuration},
+	})
+	assert.Nil(err)
+
+	return tokens
+}
+
+func makeTokenRequest(assert *assert.Assertions, name string, duration time.Duration, privs ...string) *TokenRequest {
+	req := &TokenRequest{Name: name, Privileges: []*auth.Priv{}, Duration: Duration{duration}}
+
+	for _, p := range privs {
+		priv := new(auth.Priv)
+		assert.Nil(priv.UnmarshalText([]byte(p)))
+		req.Privileges = append(req.Privileges, priv)
+	}
+
+	return req
+}
+
+func TestTokens(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_tokens"
+
+	defer func() { os.RemoveAll(root) }()
+
+	tokens := makeTokens(assert, root)
+	now := time.Now()
+	role := DefaultRole()
+
+	token, err := tokens.Create("user@zebra", role, makeTokenRequest(assert, "ci", 0, "compute.*:r"), now)
+	assert.Nil(err)
+	assert.Equal(now.Add(DefaultTokenDuration), token.Expires)
+	assert.Empty(token.Hash)
+
+	found, err := tokens.Authenticate(token.Token, now)
+	assert.Nil(err)
+	assert.Equal(token.ID, found.ID)
+
+	_, err = tokens.Authenticate(token.Token, token.Expires)
+	assert.ErrorIs(err, ErrTokenExpired)
+
+	_, err = tokens.Authenticate(auth.TokenPrefix+"guess", now)
+	assert.ErrorIs(err, ErrTokenUnknown)
+
+	// Tokens are checked when they are made
+	for req, want := range map[*TokenRequest]error{
+		makeTokenRequest(assert, "ci", 0, "compute.*:r"):                  ErrTokenExists,
+		makeTokenRequest(assert, " ", 0, "compute.*:r"):                   ErrTokenName,
+		makeTokenRequest(assert, "none", 0):                               ErrTokenPrivileges,
+		makeTokenRequest(assert, "long", 2*DefaultTokenMaxDuration, ":r"): ErrTokenDuration,
+		makeTokenRequest(assert, "write", 0, "compute.*:c,r,u,d"):         ErrForbidden,
+	} {
+		_, err := tokens.Create("user@zebra", role, req, now)
+		assert.ErrorIs(err, want, req.Name)
+	}
+
+	// Names only need to be unique per user
+	_, err = tokens.Create("other@zebra", role, makeTokenRequest(assert, "ci", time.Hour, ":r"), now)
+	assert.Nil(err)
+
+	assert.Len(tokens.List("user@zebra"), 1)
+	assert.Len(tokens.List(""), 2)
+
+	// Only the hash of a token is saved, and the tokens are there after a
+	// restart
+	b, err := ioutil.ReadFile(path.Join(root, "tokens.json"))
+	assert.Nil(err)
+	assert.NotContains(string(b), token.Token)
+	assert.Contains(string(b), auth.HashToken(token.Token))
+
+	reloaded := makeTokens(assert, root)
+	assert.Len(reloaded.List(""), 2)
+
+	found, err = reloaded.Authenticate(token.Token, now)
+	assert.Nil(err)
+	assert.True(found.Scope().Read("compute.server"))
+
+	assert.Nil(reloaded.Revoke(token.ID))
+	assert.ErrorIs(reloaded.Revoke(token.ID), ErrTokenUnknown)
+
+	_, err = reloaded.Authenticate(token.Token, now)
+	assert.ErrorIs(err, ErrTokenUnknown)
+
+	// Expired tokens are forgotten
+	_, err = reloaded.Create("user@zebra", role, makeTokenRequest(assert, "next", 0, ":r"), now.Add(2*time.Hour))
+	assert.Nil(err)
+	assert.Empty(reloaded.List("other@zebra"))
+
+	assert.Nil(ioutil.WriteFile(path.Join(root, "tokens.json"), []byte("junk"), auth.ReadOnly))
+
+	_, err = NewTokens(&TokenConfig{Path: path.Join(root, "tokens.json"), MaxDuration: Duration{time.Hour}})
+	assert.NotNil(err)
+}
+
+func TestAPIToken(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_api_token"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	jini := makeUser(assert)
+	assert.Nil(api.Store.Create(jini))
+
+	tokens := makeTokens(assert, root)
+
+	token, err := tokens.Create("email@domain", jini.Role, makeTokenRequest(assert, "ci", 0, `compute\..*:r`), time.Now())
+	assert.Nil(err)
+
+	call := func(secret string, path string) (int, *auth.Claims) {
+		req := createRequest(assert, "GET", path, "", api)
+		ctx := context.WithValue(req.Context(), TokensCtxKey, tokens)
+		req = req.Clone(context.WithValue(ctx, AuthCtxKey, authKey))
+		req.Header.Set("Authorization", "Bearer "+secret)
+
+		var claims *auth.Claims
+
+		rr := httptest.NewRecorder()
+		authAdapter()(refreshAdapter()(http.HandlerFunc(func(res http.ResponseWriter, req *http.Request) {
+			claims, _ = req.Context().Value(ClaimsCtxKey).(*auth.Claims)
+			res.WriteHeader(http.StatusOK)
+		}))).ServeHTTP(rr, req)
+
+		return rr.Code, claims
+	}
+
+	code, claims := call(token.Token, "/api/v1/resources")
+	assert.Equal(http.StatusOK, code)
+	assert.Equal("email@domain", claims.Email)
+	assert.Equal(token.ID, claims.Id)
+
+	// The token only has its own privileges, though the user may do anything
+	assert.True(claims.Read("compute.server"))
+	assert.False(claims.Write("compute.server"))
+	assert.False(claims.Read("network.vlanPool"))
+
+	// Tokens cannot be turned into jwts
+	code, _ = call(token.Token, "/refresh")
+	assert.Equal(http.StatusForbidden, code)
+
+	// Other bearer tokens are not api tokens
+	code, _ = call("somethingelse", "/api/v1/resources")
+	assert.Equal(http.StatusUnauthorized, code)
+
+	assert.Nil(tokens.Revoke(token.ID))
+
+	code, _ = call(token.Token, "/api/v1/resources")
+	assert.Equal(http.StatusUnauthorized, code)
+}
+
+func TestTokenHandlers(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_token_handlers"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeLeaseAPI(assert, root, 1)
+	tokens := makeTokens(assert, root)
+	user := userClaims(assert, "user@zebra")
+
+	call := func(h httprouter.Handle, method, url, id, body string, claims *auth.Claims) *httptest.ResponseRecorder {
+		req := createRequest(assert, method, url, body, api)
+		if claims != nil {
+			req = makeClaimsRequest(assert, method, url, body, api, claims)
+		}
+
+		req = req.Clone(context.WithValue(req.Context(), TokensCtxKey, tokens))
+		rr := httptest.NewRecorder()
+		h(rr, req, httprouter.Params{{Key: "id", Value: id}})
+
+		return rr
+	}
+
+	create := func(body string, claims *auth.Claims) *NewToken {
+		rr := call(handleCreateToken(), "POST", "/api/v1/tokens", "", body, claims)
+		assert.Equal(http.StatusOK, rr.Code)
+
+		token := new(NewToken)
+		assert.Nil(json.Unmarshal(rr.Body.Bytes(), token))
+
+		return token
+	}
+
+	list := func(claims *auth.Claims, url string) []auth.APIToken {
+		rr := call(handleTokens(), "GET", url, "", "", claims)
+		assert.Equal(http.StatusOK, rr.Code)
+
+		found := []auth.APIToken{}
+		assert.Nil(json.Unmarshal(rr.Body.Bytes(), &found))
+
+		return found
+	}
+
+	rr := httptest.NewRecorder()
+	handleTokens()(rr, makeClaimsRequest(assert, "GET", "/", "", api, user), nil)
+	assert.Equal(http.StatusInternalServerError, rr.Code)
+
+	assert.Equal(http.StatusUnauthorized, call(handleTokens(), "GET", "/", "", "", nil).Code)
+
+	// Users make tokens with privileges they have
+	token := create(`{"name":"ci","privileges":["compute.*:r"],"duration":"24h"}`, user)
+	assert.NotEmpty(token.Token)
+	assert.Equal("user@zebra", token.Email)
+
+	create(`{"name":"all","privileges":[":c,r,u,d"]}`, adminClaims(assert))
+
+	for body, want := range map[string]int{
+		`{"name":"ci","privileges":["compute.*:r"]}`:   http.StatusConflict,
+		`{"name":"rw","privileges":["compute.*:r,u"]}`: http.StatusForbidden,
+		`{"name":"none"}`: http.StatusBadRequest,
+		`{"name":"bad","privileges":["compute.*"]}`:                http.StatusBadRequest,
+		`{"name":"long","privileges":[":r"],"duration":"100000h"}`: http.StatusBadRequest,
+	} {
+		assert.Equal(want, call(handleCreateToken(), "POST", "/", "", body, user).Code, body)
+	}
+
+	// Users see their own tokens, admins everyone's
+	found := list(user, "/api/v1/tokens")
+	assert.Len(found, 1)
+	assert.Empty(found[0].Hash)
+	assert.Len(list(adminClaims(assert), "/api/v1/tokens"), 2)
+	assert.Len(list(adminClaims(assert), "/api/v1/tokens?user=user@zebra"), 1)
+	assert.Equal(http.StatusForbidden, call(handleTokens(), "GET", "/?user=admin@zebra", "", "", user).Code)
+
+	// Tokens cannot manage tokens
+	scoped := userClaims(assert, "user@zebra")
+	scoped.Scope = &auth.Role{Name: "token:ci", Privileges: DefaultRole().Privileges}
+	assert.Equal(http.StatusForbidden, call(handleTokens(), "GET", "/", "", "", scoped).Code)
+	assert.Equal(http.StatusForbidden, call(handleRevokeToken(), "DELETE", "/", token.ID, "", scoped).Code)
+
+	// Users can revoke their own tokens, admins anyone's
+	admins := list(adminClaims(assert), "/api/v1/tokens?user=admin@zebra")[0]
+	assert.Equal(http.StatusForbidden, call(handleRevokeToken(), "DELETE", "/", admins.ID, "", user).Code)
+	assert.Equal(http.StatusNotFound, call(handleRevokeToken(), "DELETE", "/", "unknown", "", user).Code)
+	assert.Equal(http.StatusOK, call(handleRevokeToken(), "DELETE", "/", token.ID, "", user).Code)
+	assert.Equal(http.StatusOK, call(handleRevokeToken(), "DELETE", "/", admins.ID, "", adminClaims(assert)).Code)
+	assert.Empty(list(adminClaims(assert), "/api/v1/tokens"))
+}
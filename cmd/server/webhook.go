@@ -0,0 +1,458 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/google/uuid"
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/project-safari/zebra/model/webhook"
+)
+
+var ErrDelivery = errors.New("webhook did not accept the event")
+
+// Event types sent to webhooks.
+const (
+	EventLeaseActivated    = "lease.activated"
+	EventLeaseExpiring     = "lease.expiring"
+	EventLeaseExpired      = "lease.expired"
+	EventLeaseIdle         = "lease.idle"
+	EventLeaseIdleReleased = "lease.idle-released"
+	EventResourceCreated   = "resource.created"
+	EventResourceDeleted   = "resource.deleted"
+	EventResourceFaulted   = "resource.faulted"
+)
+
+const (
+	DefaultWebhookAttempts = 5
+	DefaultWebhookBackoff  = time.Second
+	DefaultWebhookTimeout  = 5 * time.Second
+	DefaultExpiryWarning   = 15 * time.Minute
+	MaxDeliveryLog         = 1000
+	EventQueueSize         = 1024
+	WebhookSecretsFile     = "webhook-secrets.json"
+)
+
+// WebhookConfig is the "webhooks" section of the server configuration. A failed
+// delivery is tried again up to Attempts times in all, waiting Backoff before
+// the first retry and twice as long before each next one. Leases ending within
+// ExpiryWarning cause a lease.expiring event.
+type WebhookConfig struct {
+	Attempts      int      `json:"attempts"`
+	Backoff       Duration `json:"backoff"`
+	Timeout       Duration `json:"timeout"`
+	ExpiryWarning Duration `json:"expiryWarning"`
+}
+
+func DefaultWebhookConfig() *WebhookConfig {
+	return &WebhookConfig{
+		Attempts:      DefaultWebhookAttempts,
+		Backoff:       Duration{DefaultWebhookBackoff},
+		Timeout:       Duration{DefaultWebhookTimeout},
+		ExpiryWarning: Duration{DefaultExpiryWarning},
+	}
+}
+
+// Event is the payload posted to webhooks. Resource is the resource the event
+// is about as it was when the event happened.
+type Event struct {
+	ID       string          `json:"id"`
+	Type     string          `json:"type"`
+	Time     time.Time       `json:"time"`
+	Resource json.RawMessage `json:"resource"`
+}
+
+// Delivery records the attempts to post an event to a webhook.
+type Delivery struct {
+	ID         string    `json:"id"`
+	Webhook    string    `json:"webhook"`
+	URL        string    `json:"url"`
+	Event      string    `json:"event"`
+	EventType  string    `json:"eventType"`
+	Attempts   int       `json:"attempts"`
+	StatusCode int       `json:"statusCode"`
+	Delivered  bool      `json:"delivered"`
+	Error      string    `json:"error,omitempty"`
+	Time       time.Time `json:"time"`
+}
+
+// WebhookSecrets keeps the secrets of webhooks by webhook ID in a file of their
+// own, apart from the resources, so that they are never returned by the api or
+// sent in events.
+type WebhookSecrets struct {
+	lock    sync.RWMutex
+	path    string
+	secrets map[string]string
+}
+
+// NewWebhookSecrets returns the secrets kept in the file at path, which does
+// not have to exist yet.
+func NewWebhookSecrets(path string) (*WebhookSecrets, error) {
+	s := &WebhookSecrets{lock: sync.RWMutex{}, path: path, secrets: map[string]string{}}
+
+	b, err := ioutil.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	} else if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(b, &s.secrets); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Get returns the secret of a webhook, empty if it has none.
+func (s *WebhookSecrets) Get(id string) string {
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+
+	return s.secrets[id]
+}
+
+// Set changes the secret of a webhook.
+func (s *WebhookSecrets) Set(id, secret string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	s.secrets[id] = secret
+
+	return s.save()
+}
+
+// Delete forgets the secret of a webhook.
+func (s *WebhookSecrets) Delete(id string) error {
+	s.lock.Lock()
+	defer s.lock.Unlock()
+
+	if _, ok := s.secrets[id]; !ok {
+		return nil
+	}
+
+	delete(s.secrets, id)
+
+	return s.save()
+}
+
+func (s *WebhookSecrets) save() error {
+	b, err := json.Marshal(s.secrets)
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := ioutil.WriteFile(tmp, b, auth.ReadOnly); err != nil {
+		return err
+	}
+
+	return os.Rename(tmp, s.path)
+}
+
+// Dispatcher posts events to the webhooks subscribed to them. Events are
+// queued by Emit and delivered by Run, each delivery is retried with backoff
+// until it succeeds or runs out of attempts. The latest deliveries are kept in
+// a log.
+type Dispatcher struct {
+	lock       sync.RWMutex
+	cfg        *WebhookConfig
+	store      zebra.Store
+	secrets    *WebhookSecrets
+	client     *http.Client
+	events     chan Event
+	deliveries []*Delivery
+	warned     map[string]struct{}
+}
+
+func NewDispatcher(cfg *WebhookConfig, store zebra.Store, secrets *WebhookSecrets) *Dispatcher {
+	if cfg.Attempts <= 0 {
+		cfg.Attempts = DefaultWebhookAttempts
+	}
+
+	if cfg.Timeout.Duration <= 0 {
+		cfg.Timeout.Duration = DefaultWebhookTimeout
+	}
+
+	return &Dispatcher{
+		lock:       sync.RWMutex{},
+		cfg:        cfg,
+		store:      store,
+		secrets:    secrets,
+		client:     &http.Client{Timeout: cfg.Timeout.Duration},
+		events:     make(chan Event, EventQueueSize),
+		deliveries: []*Delivery{},
+		warned:     map[string]struct{}{},
+	}
+}
+
+// Emit queues an event about a resource. Events are dropped if the queue is
+// full so that emitting never blocks the server.
+func (d *Dispatcher) Emit(eventType string, res zebra.Resource) {
+	if d == nil {
+		return
+	}
+
+	data, err := json.Marshal(res)
+	if err != nil {
+		return
+	}
+
+	select {
+	case d.events <- Event{ID: uuid.New().String(), Type: eventType, Time: time.Now(), Resource: data}:
+	default:
+	}
+}
+
+// Run delivers queued events and looks for leases about to expire until the
+// context is done.
+func (d *Dispatcher) Run(ctx context.Context) {
+	wg := sync.WaitGroup{}
+	ticker := time.NewTicker(ScheduleInterval)
+
+	defer func() {
+		ticker.Stop()
+		wg.Wait()
+	}()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case now := <-ticker.C:
+			d.WarnExpiring(now)
+		case e := <-d.events:
+			for _, w := range d.subscribers(e.Type) {
+				wg.Add(1)
+
+				go func(w *webhook.Webhook) {
+					defer wg.Done()
+
+					d.Deliver(ctx, w, e)
+				}(w)
+			}
+		}
+	}
+}
+
+// WarnExpiring emits a lease.expiring event, once, for every active lease that
+// ends within the expiry warning.
+func (d *Dispatcher) WarnExpiring(now time.Time) {
+	_ = applyFunc(d.store.QueryType([]string{lease.Type().Name}), func(res zebra.Resource) error {
+		l, ok := res.(*lease.Lease)
+		if !ok {
+			return nil
+		}
+
+		emit := false
+
+		d.lock.Lock()
+		_, warned := d.warned[l.Meta.ID]
+
+		switch {
+		case l.Phase != lease.Activated:
+			delete(d.warned, l.Meta.ID)
+		case !warned && now.Add(d.cfg.ExpiryWarning.Duration).After(l.End()):
+			d.warned[l.Meta.ID] = struct{}{}
+			emit = true
+		}
+		d.lock.Unlock()
+
+		if emit {
+			d.Emit(EventLeaseExpiring, l)
+		}
+
+		return nil
+	})
+}
+
+// subscribers returns the webhooks subscribed to an event type along with their
+// secrets.
+func (d *Dispatcher) subscribers(eventType string) []*webhook.Webhook {
+	subs := []*webhook.Webhook{}
+
+	_ = applyFunc(d.store.QueryType([]string{webhook.Type().Name}), func(res zebra.Resource) error {
+		if w, ok := res.(*webhook.Webhook); ok && w.Matches(eventType) {
+			sub := *w
+			sub.Secret = d.secrets.Get(w.Meta.ID)
+			subs = append(subs, &sub)
+		}
+
+		return nil
+	})
+
+	return subs
+}
+
+// Deliver posts an event to a webhook, retrying with backoff until it is
+// accepted with a 2xx status, the attempts run out or the context is done.
+func (d *Dispatcher) Deliver(ctx context.Context, w *webhook.Webhook, e Event) *Delivery {
+	log := logr.FromContextOrDiscard(ctx)
+	delivery := d.record(&Delivery{
+		ID:        uuid.New().String(),
+		Webhook:   w.Meta.ID,
+		URL:       w.URL,
+		Event:     e.ID,
+		EventType: e.Type,
+		Time:      time.Now(),
+	})
+
+	payload, err := json.Marshal(e)
+	if err != nil {
+		d.update(delivery, 0, err)
+
+		return delivery
+	}
+
+	backoff := d.cfg.Backoff.Duration
+
+	for attempt := 1; attempt <= d.cfg.Attempts; attempt++ {
+		code, err := d.post(ctx, w, e, payload)
+		if d.update(delivery, code, err) {
+			log.Info("webhook delivered", "webhook", w.Meta.ID, "event", e.Type, "attempts", attempt)
+
+			return delivery
+		}
+
+		if attempt == d.cfg.Attempts {
+			break
+		}
+
+		select {
+		case <-ctx.Done():
+			return delivery
+		case <-time.After(backoff):
+		}
+
+		backoff *= 2
+	}
+
+	log.Info("webhook delivery failed", "webhook", w.Meta.ID, "event", e.Type, "error", delivery.Error)
+
+	return delivery
+}
+
+// post sends the signed payload once and returns the response status.
+func (d *Dispatcher) post(ctx context.Context, w *webhook.Webhook, e Event, payload []byte) (int, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(payload))
+	if err != nil {
+		return 0, err
+	}
+
+	timestamp := strconv.FormatInt(time.Now().Unix(), 10)
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "zebra-webhook")
+	req.Header.Set("Zebra-Event", e.Type)
+	req.Header.Set("Zebra-Delivery", e.ID)
+	req.Header.Set("Zebra-Timestamp", timestamp)
+	req.Header.Set("Zebra-Signature", "sha256="+w.Sign(timestamp, payload))
+
+	resp, err := d.client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+
+	_ = resp.Body.Close()
+
+	if resp.StatusCode < http.StatusOK || resp.StatusCode >= http.StatusMultipleChoices {
+		return resp.StatusCode, fmt.Errorf("%w: %s", ErrDelivery, resp.Status)
+	}
+
+	return resp.StatusCode, nil
+}
+
+// record adds a delivery to the log, dropping the oldest one if the log is
+// full.
+func (d *Dispatcher) record(delivery *Delivery) *Delivery {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	d.deliveries = append(d.deliveries, delivery)
+	if len(d.deliveries) > MaxDeliveryLog {
+		d.deliveries = d.deliveries[1:]
+	}
+
+	return delivery
+}
+
+// update records the outcome of an attempt and returns true if it succeeded.
+func (d *Dispatcher) update(delivery *Delivery, code int, err error) bool {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	delivery.Attempts++
+	delivery.StatusCode = code
+	delivery.Time = time.Now()
+	delivery.Delivered = err == nil
+	delivery.Error = ""
+
+	if err != nil {
+		delivery.Error = err.Error()
+	}
+
+	return delivery.Delivered
+}
+
+// Deliveries returns the logged deliveries of a webhook, or of all webhooks if
+// id is empty, newest first.
+func (d *Dispatcher) Deliveries(id string) []Delivery {
+	deliveries := []Delivery{}
+
+	if d == nil {
+		return deliveries
+	}
+
+	d.lock.RLock()
+	defer d.lock.RUnlock()
+
+	for i := len(d.deliveries) - 1; i >= 0; i-- {
+		if id == "" || d.deliveries[i].Webhook == id {
+			deliveries = append(deliveries, *d.deliveries[i])
+		}
+	}
+
+	return deliveries
+}
+
+// handleDeliveries returns the delivery log to users who can read webhooks.
+func handleDeliveries() httprouter.Handle {
+	return func(res http.ResponseWriter, req *http.Request, params httprouter.Params) {
+		ctx := req.Context()
+		api, ok := ctx.Value(ResourcesCtxKey).(*ResourceAPI)
+
+		if !ok {
+			res.WriteHeader(http.StatusInternalServerError)
+
+			return
+		}
+
+		claims, ok := ctx.Value(ClaimsCtxKey).(*auth.Claims)
+		if !ok {
+			res.WriteHeader(http.StatusUnauthorized)
+
+			return
+		}
+
+		if !claims.Read(webhook.Type().Name) {
+			res.WriteHeader(http.StatusForbidden)
+
+			return
+		}
+
+		writeJSON(ctx, res, api.Webhooks.Deliveries(req.URL.Query().Get("webhook")))
+	}
+}
@@ -0,0 +1,312 @@
+package main //nolint:testpackage
+
+import (
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/julienschmidt/httprouter"
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/auth"
+	"github.com/project-safari/zebra/model"
+	"github.com/project-safari/zebra/model/lease"
+	"github.com/project-safari/zebra/model/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+// receiver is a webhook endpoint that fails the first failures requests and
+// records the events it accepts.
+type receiver struct {
+	lock     sync.Mutex
+	failures int
+	events   []Event
+}
+
+func (r *receiver) ServeHTTP(res http.ResponseWriter, req *http.Request) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	body, _ := ioutil.ReadAll(req.Body)
+	sig := strings.TrimPrefix(req.Header.Get("Zebra-Signature"), "sha256=")
+
+	if !webhook.Verify("s3cret", req.Header.Get("Zebra-Timestamp"), body, sig) {
+		res.WriteHeader(http.StatusUnauthorized)
+
+		return
+	}
+
+	if r.failures > 0 {
+		r.failures--
+		res.WriteHeader(http.StatusServiceUnavailable)
+
+		return
+	}
+
+	e := Event{}
+	_ = json.Unmarshal(body, &e)
+	r.events = append(r.events, e)
+}
+
+func (r *receiver) received() []Event {
+	r.lock.Lock()
+	defer r.lock.Unlock()
+
+	return append([]Event{}, r.events...)
+}
+
+func makeWebhookAPI(assert *assert.Assertions, root string) *ResourceAPI {
+	api := makeLeaseAPI(assert, root, 2)
+	cfg := DefaultWebhookConfig()
+	cfg.Attempts = 3
+	cfg.Backoff.Duration = time.Millisecond
+	api.Webhooks = NewDispatcher(cfg, api.Store, api.Webhooks.secrets)
+	api.Allocator.webhooks = api.Webhooks
+
+	return api
+}
+
+func TestWebhookDelivery(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_webhook_delivery"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeWebhookAPI(assert, root)
+
+	recv := &receiver{lock: sync.Mutex{}, failures: 1, events: nil}
+	srv := httptest.NewServer(recv)
+
+	defer srv.Close()
+
+	w := webhook.NewWebhook("ci", srv.URL, "s3cret", []string{"lease.*", EventResourceFaulted})
+	assert.Nil(api.create(w))
+
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+
+	go func() {
+		api.Webhooks.Run(ctx)
+		close(done)
+	}()
+
+	l := serverLease("user@zebra", 1)
+	assert.Nil(api.Allocator.Allocate(l))
+
+	// Not subscribed
+	api.Webhooks.Emit(EventResourceCreated, l)
+
+	assert.Eventually(func() bool {
+		d := api.Webhooks.Deliveries(w.Meta.ID)
+
+		return len(d) == 1 && d[0].Delivered
+	}, time.Second, 5*time.Millisecond)
+
+	assert.Len(recv.received(), 1)
+
+	got := recv.received()[0]
+	assert.Equal(EventLeaseActivated, got.Type)
+
+	activated := new(lease.Lease)
+	assert.Nil(json.Unmarshal(got.Resource, activated))
+	assert.Equal(l.Meta.ID, activated.Meta.ID)
+
+	deliveries := api.Webhooks.Deliveries(w.Meta.ID)
+	assert.Len(deliveries, 1)
+	assert.True(deliveries[0].Delivered)
+	assert.Equal(2, deliveries[0].Attempts)
+	assert.Equal(http.StatusOK, deliveries[0].StatusCode)
+	assert.Empty(api.Webhooks.Deliveries("0000000000"))
+
+	// Expiry
+	_, err := api.Allocator.ExpireDue(time.Now().Add(2 * time.Hour))
+	assert.Nil(err)
+	assert.Eventually(func() bool { return len(recv.received()) == 2 }, time.Second, 5*time.Millisecond)
+	assert.Equal(EventLeaseExpired, recv.received()[1].Type)
+
+	cancel()
+	<-done
+}
+
+func TestWebhookFailure(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_webhook_failure"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeWebhookAPI(assert, root)
+
+	recv := &receiver{lock: sync.Mutex{}, failures: 10, events: nil}
+	srv := httptest.NewServer(recv)
+
+	defer srv.Close()
+
+	w := webhook.NewWebhook("ci", srv.URL, "s3cret", nil)
+	d := api.Webhooks.Deliver(context.Background(), w, Event{ID: "1", Type: EventResourceCreated})
+	assert.False(d.Delivered)
+	assert.Equal(3, d.Attempts)
+	assert.Equal(http.StatusServiceUnavailable, d.StatusCode)
+	assert.NotEmpty(d.Error)
+
+	// A bad secret is rejected by the receiver
+	w = webhook.NewWebhook("ci", srv.URL, "wrong", nil)
+	d = api.Webhooks.Deliver(context.Background(), w, Event{ID: "2", Type: EventResourceCreated})
+	assert.False(d.Delivered)
+	assert.Equal(http.StatusUnauthorized, d.StatusCode)
+
+	w = webhook.NewWebhook("ci", "http://127.0.0.1:0", "s3cret", nil)
+	d = api.Webhooks.Deliver(context.Background(), w, Event{ID: "3", Type: EventResourceCreated})
+	assert.False(d.Delivered)
+	assert.Zero(d.StatusCode)
+
+	assert.Len(api.Webhooks.Deliveries(""), 3)
+	assert.Equal("3", api.Webhooks.Deliveries("")[0].Event)
+}
+
+func TestWebhookEvents(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_webhook_events"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeWebhookAPI(assert, root)
+	d := api.Webhooks
+
+	next := func() string {
+		select {
+		case e := <-d.events:
+			return e.Type
+		default:
+			return ""
+		}
+	}
+
+	l := serverLease("user@zebra", 1)
+	l.Duration = 10 * time.Minute
+	assert.Nil(api.Allocator.Allocate(l))
+	assert.Equal(EventLeaseActivated, next())
+
+	// Only warned once
+	d.WarnExpiring(time.Now())
+	assert.Equal(EventLeaseExpiring, next())
+	d.WarnExpiring(time.Now())
+	assert.Equal("", next())
+
+	server := findResource(api.Store, l.Request[0].Resources[0])
+	assert.Nil(api.Allocator.SetFault(server, zebra.Major))
+	assert.Equal(EventResourceFaulted, next())
+	assert.Nil(api.Allocator.SetFault(server, zebra.None))
+	assert.Equal("", next())
+
+	expired, err := api.Allocator.ExpireDue(time.Now())
+	assert.Nil(err)
+	assert.Empty(expired)
+
+	expired, err = api.Allocator.ExpireDue(time.Now().Add(time.Hour))
+	assert.Nil(err)
+	assert.Len(expired, 1)
+	assert.Equal(lease.Released, l.Phase)
+	assert.True(findResource(api.Store, server.GetMeta().ID).GetStatus().Allocatable())
+	assert.Equal(EventLeaseExpired, next())
+
+	// Resources created and deleted through the api, updates are no events
+	w := webhook.NewWebhook("ci", "http://localhost/hook", "s3cret", nil)
+	resMap := zebra.NewResourceMap(model.Factory())
+	assert.Nil(resMap.Add(w))
+
+	body, err := json.Marshal(resMap)
+	assert.Nil(err)
+
+	// The secret is never marshaled, so new webhooks are refused without it
+	h := handlePost()
+	rr := httptest.NewRecorder()
+	h(rr, createRequest(assert, "POST", "/api/v1/resources", string(body), api), nil)
+	assert.Equal(http.StatusBadRequest, rr.Code)
+	assert.NotContains(string(body), "s3cret")
+
+	withSecret := strings.Replace(string(body), `"url":`, `"secret":"s3cret","url":`, 1)
+
+	for _, event := range []string{EventResourceCreated, ""} {
+		rr := httptest.NewRecorder()
+		h(rr, createRequest(assert, "POST", "/api/v1/resources", withSecret, api), nil)
+		assert.Equal(http.StatusOK, rr.Code)
+		assert.Equal(event, next())
+	}
+
+	// Updates without the secret keep it, events and queries never hold it
+	rr = httptest.NewRecorder()
+	h(rr, createRequest(assert, "POST", "/api/v1/resources", string(body), api), nil)
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("s3cret", api.Webhooks.subscribers(EventResourceCreated)[0].Secret)
+
+	api.Webhooks.Emit(EventResourceCreated, findResource(api.Store, w.Meta.ID))
+	e := <-d.events
+	assert.NotContains(string(e.Resource), "s3cret")
+
+	rr = httptest.NewRecorder()
+	handleQuery()(rr, createRequest(assert, "GET", "/api/v1/resources", "", api), nil)
+	assert.NotContains(rr.Body.String(), "s3cret")
+
+	reloaded, err := NewWebhookSecrets(path.Join(root, WebhookSecretsFile))
+	assert.Nil(err)
+	assert.Equal("s3cret", reloaded.Get(w.Meta.ID))
+
+	del := handleDelete()
+	rr = httptest.NewRecorder()
+	del(rr, createRequest(assert, "DELETE", "/", "", api), httprouter.Params{{Key: "id", Value: w.Meta.ID}})
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal(EventResourceDeleted, next())
+	assert.Empty(api.Webhooks.secrets.Get(w.Meta.ID))
+}
+
+func TestDeliveriesHandler(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	root := "test_deliveries_handler"
+
+	defer func() { os.RemoveAll(root) }()
+
+	api := makeWebhookAPI(assert, root)
+
+	deliveries := func(claims *auth.Claims) *httptest.ResponseRecorder {
+		h := handleDeliveries()
+		rr := httptest.NewRecorder()
+		req := createRequest(assert, "GET", "/api/v1/webhooks/deliveries", "", api)
+
+		if claims != nil {
+			req = makeClaimsRequest(assert, "GET", "/api/v1/webhooks/deliveries", "", api, claims)
+		}
+
+		h(rr, req, nil)
+
+		return rr
+	}
+
+	nobody := auth.NewClaims("zebra", "other", &auth.Role{Name: "none", Privileges: nil}, "other@zebra")
+
+	assert.Equal(http.StatusUnauthorized, deliveries(nil).Code)
+	assert.Equal(http.StatusForbidden, deliveries(nobody).Code)
+
+	rr := deliveries(adminClaims(assert))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("[]", rr.Body.String())
+
+	api.Webhooks = nil
+	rr = deliveries(adminClaims(assert))
+	assert.Equal(http.StatusOK, rr.Code)
+	assert.Equal("[]", rr.Body.String())
+}
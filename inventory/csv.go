@@ -0,0 +1,92 @@
+package inventory
+
+import (
+	"context"
+	"encoding/csv"
+	"errors"
+	"io"
+	"strings"
+
+	"github.com/project-safari/zebra"
+)
+
+var ErrNoHeader = errors.New("csv header is missing")
+
+// ReadCSV reads resources from CSV data. The first row names the columns, the
+// column names are mapped to resource fields with the mapping of the resource
+// type. Each row is a resource of the given type unless the row has a "type"
+// column. Empty cells are left out. Rows that can not be turned into a valid
+// resource are reported with their line number.
+func ReadCSV(ctx context.Context, r io.Reader, factory zebra.ResourceFactory,
+	resType string, mappings Mappings,
+) ([]Entry, []LineError) {
+	reader := csv.NewReader(r)
+	reader.TrimLeadingSpace = true
+
+	header, err := reader.Read()
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			err = ErrNoHeader
+		}
+
+		return nil, []LineError{lineError(1, err)}
+	}
+
+	entries := []Entry{}
+	errs := []LineError{}
+
+	for {
+		row, err := reader.Read()
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		line, _ := reader.FieldPos(0)
+
+		if err != nil {
+			errs = append(errs, lineError(line, err))
+
+			continue
+		}
+
+		flat := make(map[string]string, len(row))
+
+		for i, value := range row {
+			if value = strings.TrimSpace(value); value != "" && i < len(header) {
+				flat[strings.TrimSpace(header[i])] = value
+			}
+		}
+
+		rowType := resType
+		if t, ok := flat[KeyType]; ok {
+			rowType = t
+		}
+
+		record := unflatten(mapColumns(flat, mappings[rowType]))
+
+		res, err := newResource(ctx, factory, rowType, record)
+		if err != nil {
+			errs = append(errs, lineError(line, err))
+
+			continue
+		}
+
+		entries = append(entries, Entry{Line: line, Resource: res})
+	}
+
+	return entries, errs
+}
+
+func mapColumns(flat map[string]string, mapping Mapping) map[string]string {
+	mapped := make(map[string]string, len(flat))
+
+	for column, value := range flat {
+		if field, ok := mapping[column]; ok {
+			column = field
+		}
+
+		mapped[column] = value
+	}
+
+	return mapped
+}
@@ -0,0 +1,87 @@
+package inventory_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra/inventory"
+	"github.com/project-safari/zebra/model"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/project-safari/zebra/model/network"
+	"github.com/stretchr/testify/assert"
+)
+
+const serversCSV = `Hostname,Group,Serial,BMC,model,User,Password,labels.rack
+server-1,lab-1,SN001,10.1.1.1,UCSC-C220,admin,Sup3rSecret!pass,r1
+server-2,lab-1,SN002,10.1.1.2,UCSC-C220,admin,Sup3rSecret!pass,r1
+server-3,lab-1,,10.1.1.3,UCSC-C220,admin,Sup3rSecret!pass,r2
+server-4,lab-1,SN004,not-an-ip,UCSC-C220,admin,Sup3rSecret!pass,r2
+`
+
+func serverMappings() inventory.Mappings {
+	return inventory.Mappings{
+		"compute.server": inventory.Mapping{
+			"Hostname": "name",
+			"Group":    "group",
+			"Serial":   "serialNumber",
+			"BMC":      "boardIp",
+			"User":     "credentials.loginId",
+			"Password": "credentials.keys.password",
+		},
+	}
+}
+
+func TestReadCSV(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	entries, errs := inventory.ReadCSV(ctx, strings.NewReader(serversCSV), model.Factory(),
+		"compute.server", serverMappings())
+	assert.Len(entries, 2)
+	assert.Len(errs, 2)
+	assert.Equal(4, errs[0].Line)
+	assert.Equal(5, errs[1].Line)
+	assert.Contains(errs[1].Error(), "line 5")
+
+	s, ok := entries[0].Resource.(*compute.Server)
+	assert.True(ok)
+	assert.Equal(2, entries[0].Line)
+	assert.Equal("server-1", s.Meta.Name)
+	assert.Equal("SN001", s.SerialNumber)
+	assert.Equal("10.1.1.1", s.BoardIP.String())
+	assert.Equal("admin", s.Credentials.LoginID)
+	assert.True(s.Meta.Labels.MatchEqual("system.group", "lab-1"))
+	assert.True(s.Meta.Labels.MatchEqual("rack", "r1"))
+	assert.Equal("compute.server/lab-1/server-1", inventory.Key(s))
+
+	// no type
+	entries, errs = inventory.ReadCSV(ctx, strings.NewReader(serversCSV), model.Factory(),
+		"", serverMappings())
+	assert.Empty(entries)
+	assert.Len(errs, 4)
+	assert.Equal(inventory.ErrNoType.Error(), errs[0].Message)
+
+	// type column and numeric fields
+	vlans := "type,name,rangeStart,rangeEnd\n" +
+		"network.vlanPool,pool-1,1,100\n" +
+		"network.vlanPool,pool-2,200,x\n" +
+		"zzz,pool-3,1,2\n"
+	entries, errs = inventory.ReadCSV(ctx, strings.NewReader(vlans), model.Factory(), "", nil)
+	assert.Len(entries, 1)
+	assert.Len(errs, 2)
+	assert.Equal(3, errs[0].Line)
+	assert.Equal(4, errs[1].Line)
+
+	pool, ok := entries[0].Resource.(*network.VLANPool)
+	assert.True(ok)
+	assert.Equal("1-100", pool.String())
+	assert.True(pool.Meta.Labels.MatchEqual("system.group", inventory.DefaultGroup))
+
+	// empty
+	_, errs = inventory.ReadCSV(ctx, strings.NewReader(""), model.Factory(), "compute.server", nil)
+	assert.Len(errs, 1)
+	assert.Equal(inventory.ErrNoHeader.Error(), errs[0].Message)
+}
@@ -0,0 +1,364 @@
+package inventory
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/model"
+	"gopkg.in/yaml.v3"
+)
+
+const (
+	FormatNDJSON      = "ndjson"
+	FormatAnsibleINI  = "ansible-ini"
+	FormatAnsibleYAML = "ansible-yaml"
+)
+
+var invalidGroupChars = regexp.MustCompile(`[^A-Za-z0-9_]`) //nolint:gochecknoglobals
+
+// ContentType returns the media type of an export format.
+func ContentType(format string) string {
+	switch format {
+	case FormatCSV:
+		return "text/csv"
+	case FormatYAML, FormatAnsibleYAML:
+		return "application/yaml"
+	case FormatNDJSON:
+		return "application/x-ndjson"
+	}
+
+	return "text/plain"
+}
+
+// Write writes the resources in the given format. Resources are written in
+// dependency order. Credential keys are never exported.
+func Write(w io.Writer, format string, resources []zebra.Resource) error {
+	resources = sorted(resources)
+
+	switch format {
+	case FormatCSV:
+		return WriteCSV(w, resources)
+	case FormatYAML:
+		return WriteYAML(w, resources)
+	case FormatNDJSON:
+		return WriteNDJSON(w, resources)
+	case FormatAnsibleINI:
+		return WriteAnsibleINI(w, resources)
+	case FormatAnsibleYAML:
+		return WriteAnsibleYAML(w, resources)
+	}
+
+	return fmt.Errorf("%w: %s", ErrFormat, format)
+}
+
+// WriteCSV writes one row per resource using the same column names that
+// ReadCSV understands, so that the output can be imported again.
+func WriteCSV(w io.Writer, resources []zebra.Resource) error {
+	rows := make([]map[string]string, 0, len(resources))
+	columns := map[string]struct{}{}
+
+	for _, res := range resources {
+		record, err := shortRecord(res)
+		if err != nil {
+			return err
+		}
+
+		row := map[string]string{}
+		flattenStrings(row, "", record)
+
+		for c := range row {
+			columns[c] = struct{}{}
+		}
+
+		rows = append(rows, row)
+	}
+
+	header := csvHeader(columns)
+	writer := csv.NewWriter(w)
+
+	if err := writer.Write(header); err != nil {
+		return err
+	}
+
+	for _, row := range rows {
+		line := make([]string, len(header))
+		for i, c := range header {
+			line[i] = row[c]
+		}
+
+		if err := writer.Write(line); err != nil {
+			return err
+		}
+	}
+
+	writer.Flush()
+
+	return writer.Error()
+}
+
+// WriteYAML writes one YAML document per resource using the short keys that
+// ReadYAML understands, so that the output can be imported or applied again.
+func WriteYAML(w io.Writer, resources []zebra.Resource) error {
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2) //nolint:gomnd
+
+	for _, res := range resources {
+		record, err := shortRecord(res)
+		if err != nil {
+			return err
+		}
+
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return encoder.Close()
+}
+
+// WriteNDJSON writes every resource, including its status, as one JSON object
+// per line.
+func WriteNDJSON(w io.Writer, resources []zebra.Resource) error {
+	encoder := json.NewEncoder(w)
+
+	for _, res := range resources {
+		record, err := fullRecord(res)
+		if err != nil {
+			return err
+		}
+
+		if err := encoder.Encode(record); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteAnsibleINI writes an Ansible inventory in INI format. Every resource
+// with a management address is a host, grouped by resource type and by its
+// system.group label.
+func WriteAnsibleINI(w io.Writer, resources []zebra.Resource) error {
+	groups := ansibleGroups(resources)
+	names := make([]string, 0, len(groups))
+
+	for name := range groups {
+		names = append(names, name)
+	}
+
+	sort.Strings(names)
+
+	for _, name := range names {
+		if _, err := fmt.Fprintf(w, "[%s]\n", name); err != nil {
+			return err
+		}
+
+		for _, h := range groups[name] {
+			vars := make([]string, 0, len(h.vars))
+			for k, v := range h.vars {
+				vars = append(vars, fmt.Sprintf("%s=%s", k, v))
+			}
+
+			sort.Strings(vars)
+
+			if _, err := fmt.Fprintf(w, "%s %s\n", h.name, strings.Join(vars, " ")); err != nil {
+				return err
+			}
+		}
+
+		if _, err := fmt.Fprintln(w); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// WriteAnsibleYAML writes the same inventory as WriteAnsibleINI in the Ansible
+// YAML inventory format.
+func WriteAnsibleYAML(w io.Writer, resources []zebra.Resource) error {
+	children := map[string]interface{}{}
+
+	for name, hosts := range ansibleGroups(resources) {
+		hostMap := map[string]interface{}{}
+		for _, h := range hosts {
+			hostMap[h.name] = h.vars
+		}
+
+		children[name] = map[string]interface{}{"hosts": hostMap}
+	}
+
+	encoder := yaml.NewEncoder(w)
+	encoder.SetIndent(2) //nolint:gomnd
+
+	if err := encoder.Encode(map[string]interface{}{
+		"all": map[string]interface{}{"children": children},
+	}); err != nil {
+		return err
+	}
+
+	return encoder.Close()
+}
+
+type ansibleHost struct {
+	name string
+	vars map[string]string
+}
+
+func ansibleGroups(resources []zebra.Resource) map[string][]ansibleHost {
+	groups := map[string][]ansibleHost{}
+
+	for _, res := range resources {
+		ip := model.ManagementIP(res)
+		if ip == nil {
+			continue
+		}
+
+		meta := res.GetMeta()
+		host := ansibleHost{
+			name: meta.Name,
+			vars: map[string]string{
+				"ansible_host":    ip.String(),
+				"zebra_id":        meta.ID,
+				"zebra_type":      meta.Type.Name,
+				"zebra_lifecycle": res.GetStatus().Lifecycle.String(),
+			},
+		}
+
+		typeGroup := groupName(meta.Type.Name)
+		groups[typeGroup] = append(groups[typeGroup], host)
+
+		if g := meta.Labels["system.group"]; g != "" {
+			labelGroup := groupName(g)
+			groups[labelGroup] = append(groups[labelGroup], host)
+		}
+	}
+
+	return groups
+}
+
+// groupName turns a type or label value into a valid Ansible group name.
+func groupName(s string) string {
+	return invalidGroupChars.ReplaceAllString(s, "_")
+}
+
+// fullRecord returns the JSON object of a resource without credential keys.
+func fullRecord(res zebra.Resource) (map[string]interface{}, error) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	record := map[string]interface{}{}
+	if err := json.Unmarshal(data, &record); err != nil {
+		return nil, err
+	}
+
+	if creds, ok := record["credentials"].(map[string]interface{}); ok {
+		delete(creds, "keys")
+	}
+
+	return record, nil
+}
+
+// shortRecord returns a resource using the short meta keys read by the
+// importers. The status is left out since it is owned by the server.
+func shortRecord(res zebra.Resource) (map[string]interface{}, error) {
+	record, err := fullRecord(res)
+	if err != nil {
+		return nil, err
+	}
+
+	meta := res.GetMeta()
+	labels := map[string]interface{}{}
+
+	for k, v := range meta.Labels {
+		if k != "system.group" {
+			labels[k] = v
+		}
+	}
+
+	delete(record, KeyMeta)
+	delete(record, KeyStatus)
+
+	record[KeyType] = meta.Type.Name
+	record[KeyID] = meta.ID
+	record[KeyName] = meta.Name
+	record[KeyGroup] = meta.Labels["system.group"]
+	record[KeyOwner] = meta.Owner
+
+	if len(labels) > 0 {
+		record[KeyLabels] = labels
+	}
+
+	return record, nil
+}
+
+// flattenStrings returns the leaf values of a record by their dot separated
+// path. Strings are written as they are, other values JSON encoded.
+func flattenStrings(fields map[string]string, prefix string, value interface{}) {
+	if m, ok := value.(map[string]interface{}); ok {
+		for k, v := range m {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+
+			flattenStrings(fields, path, v)
+		}
+
+		return
+	}
+
+	switch v := value.(type) {
+	case nil:
+	case string:
+		fields[prefix] = v
+	default:
+		b, _ := json.Marshal(v)
+		fields[prefix] = string(b)
+	}
+}
+
+// csvHeader orders the columns with the meta data first.
+func csvHeader(columns map[string]struct{}) []string {
+	header := []string{}
+
+	for _, k := range []string{KeyType, KeyID, KeyName, KeyGroup, KeyOwner} {
+		if _, ok := columns[k]; ok {
+			header = append(header, k)
+			delete(columns, k)
+		}
+	}
+
+	rest := make([]string, 0, len(columns))
+	for k := range columns {
+		rest = append(rest, k)
+	}
+
+	sort.Strings(rest)
+
+	return append(header, rest...)
+}
+
+func sorted(resources []zebra.Resource) []zebra.Resource {
+	out := make([]zebra.Resource, len(resources))
+	copy(out, resources)
+
+	sort.SliceStable(out, func(i, j int) bool {
+		ri, rj := Rank(out[i].GetMeta().Type.Name), Rank(out[j].GetMeta().Type.Name)
+		if ri != rj {
+			return ri < rj
+		}
+
+		return Key(out[i]) < Key(out[j])
+	})
+
+	return out
+}
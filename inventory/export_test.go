@@ -0,0 +1,133 @@
+package inventory_test
+
+import (
+	"bytes"
+	"context"
+	"net"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/inventory"
+	"github.com/project-safari/zebra/model"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/project-safari/zebra/model/network"
+	"github.com/stretchr/testify/assert"
+	"gopkg.in/yaml.v3"
+)
+
+func exportResources(assert *assert.Assertions) []zebra.Resource {
+	server := compute.NewServer("SN1", "C220", "server-1", "zebra", "lab-1")
+	server.BoardIP = net.ParseIP("10.1.1.1")
+	server.Credentials = zebra.NewCredentials("admin")
+	assert.Nil(server.Credentials.Add("password", "Sup3rSecret!pass"))
+	server.Meta.Labels.Add("rack", "r1")
+
+	sw := network.NewSwitch("leaf-1", "zebra", "lab-1")
+	sw.SerialNumber = "SW1"
+	sw.Model = "N9K"
+	sw.NumPorts = 48
+	sw.ManagementIP = net.ParseIP("10.2.0.1")
+
+	pool := network.NewIPAddressPool("pool-1", "zebra", "lab-1")
+	_, subnet, _ := net.ParseCIDR("10.3.0.0/24")
+	pool.Subnets = []net.IPNet{*subnet}
+	pool.Status.Lifecycle = zebra.Maintenance
+
+	return []zebra.Resource{server, sw, pool}
+}
+
+func TestWriteCSV(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	resources := exportResources(assert)
+	out := new(bytes.Buffer)
+	assert.Nil(inventory.Write(out, inventory.FormatCSV, resources))
+
+	lines := strings.Split(out.String(), "\n")
+	assert.True(strings.HasPrefix(lines[0], "type,id,name,group,owner,"))
+	assert.Contains(lines[0], "labels.rack")
+	assert.NotContains(out.String(), "Sup3rSecret")
+	assert.True(strings.HasPrefix(lines[1], "network.ipAddressPool,"))
+	assert.True(strings.HasPrefix(lines[3], "compute.server,"))
+
+	// The pool can be imported again, the switch and server miss their passwords
+	entries, errs := inventory.ReadCSV(context.Background(), out, model.Factory(), "", nil)
+	assert.Len(entries, 1)
+	assert.Len(errs, 2)
+	assert.Equal(4, errs[1].Line)
+
+	pool, ok := entries[0].Resource.(*network.IPAddressPool)
+	assert.True(ok)
+	assert.Equal(resources[2].GetMeta().ID, pool.Meta.ID)
+	assert.Equal("10.3.0.0/24", pool.Subnets[0].String())
+}
+
+func TestWriteYAML(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	resources := exportResources(assert)
+	out := new(bytes.Buffer)
+	assert.Nil(inventory.Write(out, inventory.FormatYAML, resources))
+	assert.NotContains(out.String(), "Sup3rSecret")
+	assert.NotContains(out.String(), "status")
+
+	entries, errs := inventory.ReadYAML(context.Background(), out, model.Factory(), "")
+	assert.Len(entries, 1)
+	assert.Len(errs, 2)
+
+	pool, ok := entries[0].Resource.(*network.IPAddressPool)
+	assert.True(ok)
+	assert.Equal(inventory.Key(resources[2]), inventory.Key(pool))
+	assert.Equal(zebra.Available, pool.Status.Lifecycle)
+}
+
+func TestWriteNDJSON(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	out := new(bytes.Buffer)
+	assert.Nil(inventory.Write(out, inventory.FormatNDJSON, exportResources(assert)))
+
+	lines := strings.Split(strings.TrimSpace(out.String()), "\n")
+	assert.Len(lines, 3)
+	assert.Contains(lines[2], `"loginId":"admin"`)
+	assert.Contains(lines[0], `"lifecycle":"maintenance"`)
+	assert.NotContains(out.String(), "Sup3rSecret")
+}
+
+func TestWriteAnsible(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	resources := exportResources(assert)
+	out := new(bytes.Buffer)
+	assert.Nil(inventory.Write(out, inventory.FormatAnsibleINI, resources))
+
+	ini := out.String()
+	assert.Contains(ini, "[compute_server]\nserver-1 ansible_host=10.1.1.1 ")
+	assert.Contains(ini, "[lab_1]\nleaf-1 ansible_host=10.2.0.1 ")
+	assert.Contains(ini, "zebra_id="+resources[0].GetMeta().ID)
+	assert.NotContains(ini, "pool-1")
+
+	out.Reset()
+	assert.Nil(inventory.Write(out, inventory.FormatAnsibleYAML, resources))
+
+	doc := struct {
+		All struct {
+			Children map[string]struct {
+				Hosts map[string]map[string]string `yaml:"hosts"`
+			} `yaml:"children"`
+		} `yaml:"all"`
+	}{}
+	assert.Nil(yaml.Unmarshal(out.Bytes(), &doc))
+	assert.Len(doc.All.Children, 3)
+	assert.Len(doc.All.Children["lab_1"].Hosts, 2)
+	assert.Equal("10.2.0.1", doc.All.Children["network_switch"].Hosts["leaf-1"]["ansible_host"])
+
+	assert.ErrorIs(inventory.Write(out, "xml", resources), inventory.ErrFormat)
+	assert.Equal("text/csv", inventory.ContentType(inventory.FormatCSV))
+	assert.Equal("application/x-ndjson", inventory.ContentType(inventory.FormatNDJSON))
+}
@@ -0,0 +1,69 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/project-safari/zebra"
+)
+
+const (
+	FormatCSV  = "csv"
+	FormatYAML = "yaml"
+)
+
+var ErrFormat = errors.New("unknown inventory format")
+
+// ImportRequest is the body of an inventory import request.
+type ImportRequest struct {
+	Format   string   `json:"format"`
+	Type     string   `json:"type,omitempty"`
+	Mappings Mappings `json:"mappings,omitempty"`
+	DryRun   bool     `json:"dryRun"`
+	Upsert   bool     `json:"upsert"`
+	Data     string   `json:"data"`
+}
+
+// ImportResult reports the outcome of an import. Nothing is stored when any
+// line has an error or when the import is a dry run.
+type ImportResult struct {
+	DryRun  bool        `json:"dryRun"`
+	Applied bool        `json:"applied"`
+	Created []string    `json:"created"`
+	Updated []string    `json:"updated"`
+	Errors  []LineError `json:"errors"`
+}
+
+func NewImportResult(dryRun bool) *ImportResult {
+	return &ImportResult{
+		DryRun:  dryRun,
+		Applied: false,
+		Created: []string{},
+		Updated: []string{},
+		Errors:  []LineError{},
+	}
+}
+
+// Read reads resources in the given format.
+func Read(ctx context.Context, format string, r io.Reader, factory zebra.ResourceFactory,
+	resType string, mappings Mappings,
+) ([]Entry, []LineError) {
+	switch format {
+	case FormatCSV:
+		return ReadCSV(ctx, r, factory, resType, mappings)
+	case FormatYAML, "yml":
+		return ReadYAML(ctx, r, factory, resType)
+	}
+
+	return nil, []LineError{lineError(0, fmt.Errorf("%w: %s", ErrFormat, format))}
+}
+
+// Key identifies a resource by its type, group and name. Inventory files do not
+// carry resource IDs, so resources are matched against the store by key.
+func Key(res zebra.Resource) string {
+	meta := res.GetMeta()
+
+	return meta.Type.Name + "/" + meta.Labels["system.group"] + "/" + meta.Name
+}
@@ -0,0 +1,319 @@
+// Package inventory reads and writes zebra resources in external inventory
+// formats such as CSV and YAML.
+package inventory
+
+import (
+	"context"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/project-safari/zebra"
+)
+
+var textUnmarshaler = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem() //nolint:gochecknoglobals
+
+var (
+	ErrNoType      = errors.New("resource type is missing")
+	ErrUnknownType = errors.New("unknown resource type")
+	ErrNoName      = errors.New("resource name is missing")
+)
+
+// Record keys that describe the resource meta data rather than type specific
+// fields.
+const (
+	KeyID        = "id"
+	KeyType      = "type"
+	KeyName      = "name"
+	KeyGroup     = "group"
+	KeyOwner     = "owner"
+	KeyLabels    = "labels"
+	KeyLifecycle = "lifecycle"
+	KeyMeta      = "meta"
+	KeyStatus    = "status"
+	DefaultGroup = "default"
+	DefaultOwner = "zebra"
+)
+
+// Mapping maps a CSV column name to a resource field. Fields are given as dot
+// separated JSON paths, for example "credentials.loginId" or "labels.rack".
+// Columns that are not in the mapping are used as field paths as they are.
+type Mapping map[string]string
+
+// Mappings holds the column mapping for each resource type.
+type Mappings map[string]Mapping
+
+// Entry is a resource read from an inventory file along with the line of the
+// file it starts on.
+type Entry struct {
+	Line     int
+	Resource zebra.Resource
+}
+
+// LineError is an error found in a given line of an inventory file.
+type LineError struct {
+	Line    int    `json:"line"`
+	Message string `json:"error"`
+}
+
+func (e LineError) Error() string {
+	return fmt.Sprintf("line %d: %s", e.Line, e.Message)
+}
+
+func lineError(line int, err error) LineError {
+	return LineError{Line: line, Message: err.Error()}
+}
+
+// newResource creates a resource from a record. A record is a (possibly nested)
+// map of JSON field names to values. The well known keys type, name, group,
+// owner, labels and lifecycle fill in the resource meta data and status unless
+// the record carries a full "meta" object, as written by the exporters.
+func newResource(ctx context.Context, factory zebra.ResourceFactory,
+	resType string, record map[string]interface{},
+) (zebra.Resource, error) {
+	if t, ok := record[KeyType].(string); ok && t != "" {
+		resType = t
+	}
+
+	if m, ok := record[KeyMeta].(map[string]interface{}); ok {
+		if t, ok := m[KeyType].(map[string]interface{}); ok {
+			resType, _ = t[KeyName].(string)
+		}
+	}
+
+	if resType == "" {
+		return nil, ErrNoType
+	}
+
+	res := factory.New(resType)
+	if res == nil {
+		return nil, fmt.Errorf("%w: %s", ErrUnknownType, resType)
+	}
+
+	aType, _ := factory.Type(resType)
+	doc := make(map[string]interface{}, len(record))
+
+	for k, v := range record {
+		doc[k] = v
+	}
+
+	if _, ok := doc[KeyMeta]; ok {
+		fillMeta(doc, aType)
+	} else if err := makeMeta(doc, aType); err != nil {
+		return nil, err
+	}
+
+	coerce(doc, reflect.TypeOf(res))
+
+	data, err := json.Marshal(doc)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := json.Unmarshal(data, res); err != nil {
+		return nil, err
+	}
+
+	if err := res.Validate(ctx); err != nil {
+		return nil, err
+	}
+
+	return res, nil
+}
+
+// makeMeta replaces the short meta keys of a record by a meta and status object.
+func makeMeta(doc map[string]interface{}, aType zebra.Type) error {
+	name := stringOf(doc[KeyName])
+	if name == "" {
+		return ErrNoName
+	}
+
+	group := stringOf(doc[KeyGroup])
+	if group == "" {
+		group = DefaultGroup
+	}
+
+	owner := stringOf(doc[KeyOwner])
+	if owner == "" {
+		owner = DefaultOwner
+	}
+
+	meta := zebra.NewMeta(aType, name, group, owner)
+	if id := stringOf(doc[KeyID]); id != "" {
+		meta.ID = id
+	}
+
+	if labels, ok := doc[KeyLabels].(map[string]interface{}); ok {
+		for k, v := range labels {
+			meta.Labels.Add(k, stringOf(v))
+		}
+	}
+
+	status := zebra.DefaultStatus()
+
+	if l := stringOf(doc[KeyLifecycle]); l != "" {
+		if err := status.Lifecycle.UnmarshalText([]byte(l)); err != nil {
+			return err
+		}
+	}
+
+	for _, k := range []string{KeyID, KeyType, KeyName, KeyGroup, KeyOwner, KeyLabels, KeyLifecycle} {
+		delete(doc, k)
+	}
+
+	doc[KeyMeta] = &meta
+	doc[KeyStatus] = &status
+
+	return nil
+}
+
+// fillMeta fills in the parts of a full meta object that may be left out.
+func fillMeta(doc map[string]interface{}, aType zebra.Type) {
+	meta, _ := doc[KeyMeta].(map[string]interface{})
+	if meta == nil {
+		return
+	}
+
+	if stringOf(meta[KeyID]) == "" {
+		meta[KeyID] = uuid.New().String()
+	}
+
+	meta[KeyType] = aType
+
+	delete(doc, KeyType)
+}
+
+// unflatten turns dotted keys of a flat record into nested maps, so that
+// "credentials.loginId" becomes {"credentials": {"loginId": ...}}.
+func unflatten(flat map[string]string) map[string]interface{} {
+	record := make(map[string]interface{}, len(flat))
+
+	for key, value := range flat {
+		parts := strings.Split(key, ".")
+		node := record
+
+		for _, p := range parts[:len(parts)-1] {
+			next, ok := node[p].(map[string]interface{})
+			if !ok {
+				next = make(map[string]interface{})
+				node[p] = next
+			}
+
+			node = next
+		}
+
+		node[parts[len(parts)-1]] = value
+	}
+
+	return record
+}
+
+// coerce converts the scalar values of a record to the kind of the resource
+// field they are stored in, CSV values are always strings and YAML values may
+// be numbers where the resource expects a string.
+func coerce(record map[string]interface{}, t reflect.Type) {
+	for key, value := range record {
+		ft, ok := fieldType(t, key)
+		if !ok {
+			continue
+		}
+
+		if nested, ok := value.(map[string]interface{}); ok {
+			coerce(nested, ft)
+
+			continue
+		}
+
+		record[key] = coerceValue(value, ft)
+	}
+}
+
+func coerceValue(value interface{}, t reflect.Type) interface{} {
+	s := stringOf(value)
+
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.String:
+		return s
+	case reflect.Bool:
+		if b, err := strconv.ParseBool(s); err == nil {
+			return b
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if i, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return i
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		if i, err := strconv.ParseUint(s, 10, 64); err == nil {
+			return i
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, err := strconv.ParseFloat(s, 64); err == nil {
+			return f
+		}
+	case reflect.Slice, reflect.Map, reflect.Struct:
+		// Values such as IP addresses are read from strings, other lists and
+		// objects are given as JSON in CSV cells.
+		str, ok := value.(string)
+		if !ok || reflect.PtrTo(t).Implements(textUnmarshaler) {
+			return value
+		}
+
+		var v interface{}
+		if err := json.Unmarshal([]byte(str), &v); err == nil {
+			return v
+		}
+	}
+
+	return value
+}
+
+// fieldType returns the type of the field stored under the given JSON name.
+// Embedded structs are searched as well since their fields are promoted.
+func fieldType(t reflect.Type, name string) (reflect.Type, bool) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+
+	switch t.Kind() { //nolint:exhaustive
+	case reflect.Map:
+		return t.Elem(), true
+	case reflect.Struct:
+	default:
+		return nil, false
+	}
+
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := strings.Split(f.Tag.Get("json"), ",")[0]
+
+		if f.Anonymous && tag == "" {
+			if ft, ok := fieldType(f.Type, name); ok {
+				return ft, true
+			}
+
+			continue
+		}
+
+		if tag == name || (tag == "" && f.Name == name) {
+			return f.Type, true
+		}
+	}
+
+	return nil, false
+}
+
+func stringOf(v interface{}) string {
+	switch s := v.(type) {
+	case nil:
+		return ""
+	case string:
+		return s
+	default:
+		return fmt.Sprint(s)
+	}
+}
@@ -0,0 +1,310 @@
+package inventory
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+// ManagerLabel marks the resources that are managed by an inventory file, only
+// those resources are deleted when a plan is pruned.
+const ManagerLabel = "system.managed-by"
+
+var ErrDuplicate = errors.New("resource appears more than once")
+
+// dependencyOrder lists the resource types so that a resource comes after the
+// resources it refers to. Types that are not listed go last.
+var dependencyOrder = []string{ //nolint:gochecknoglobals
+	"dc.datacenter",
+	"dc.lab",
+	"dc.rack",
+	"network.vlanPool",
+	"network.ipAddressPool",
+	"network.switch",
+	"compute.server",
+	"compute.esx",
+	"compute.vcenter",
+	"compute.vm",
+}
+
+// Fields that are owned by the server and never show up in a diff.
+var ignoredFields = []string{"meta.id", "meta.creationTime", "meta.modificationTime", "status"} //nolint:gochecknoglobals
+
+const sensitiveValue = "(sensitive)"
+
+// Rank returns the position of a resource type in the dependency order.
+func Rank(resType string) int {
+	for i, t := range dependencyOrder {
+		if t == resType {
+			return i
+		}
+	}
+
+	return len(dependencyOrder)
+}
+
+type Action string
+
+const (
+	Create Action = "create"
+	Update Action = "update"
+	Delete Action = "delete"
+)
+
+// FieldDiff is the change of a single field, given as a dot separated JSON path
+// with JSON encoded values.
+type FieldDiff struct {
+	Field string `json:"field"`
+	Old   string `json:"old,omitempty"`
+	New   string `json:"new,omitempty"`
+}
+
+// Change is a resource that has to be created, updated or deleted.
+type Change struct {
+	Action   Action         `json:"action"`
+	Key      string         `json:"key"`
+	Resource zebra.Resource `json:"-"`
+	Diffs    []FieldDiff    `json:"diffs,omitempty"`
+}
+
+// Plan lists the changes needed to make the server match an inventory, in the
+// order they have to be applied.
+type Plan struct {
+	Changes []Change `json:"changes"`
+}
+
+// NewPlan compares the desired resources against the current ones. Resources
+// are matched by Key. Desired resources are labeled with the manager so that
+// a later pruned plan deletes the managed resources that are no longer
+// desired. Matched resources take over the ID and status of the current ones.
+func NewPlan(desired, current []zebra.Resource, manager string, prune bool) (*Plan, error) {
+	currentByKey := make(map[string]zebra.Resource, len(current))
+	for _, r := range current {
+		currentByKey[Key(r)] = r
+	}
+
+	plan := &Plan{Changes: []Change{}}
+	seen := make(map[string]struct{}, len(desired))
+
+	for _, r := range desired {
+		key := Key(r)
+		if _, ok := seen[key]; ok {
+			return nil, fmt.Errorf("%w: %s", ErrDuplicate, key)
+		}
+
+		seen[key] = struct{}{}
+
+		if manager != "" {
+			r.UpdateMeta().Labels.Add(ManagerLabel, manager)
+		}
+
+		old, ok := currentByKey[key]
+		if !ok {
+			plan.Changes = append(plan.Changes, Change{Action: Create, Key: key, Resource: r, Diffs: nil})
+
+			continue
+		}
+
+		meta := r.UpdateMeta()
+		meta.ID = old.GetMeta().ID
+		meta.CreationTime = old.GetMeta().CreationTime
+		meta.ModificationTime = old.GetMeta().ModificationTime
+		*r.UpdateStatus() = old.GetStatus()
+
+		diffs, err := Diff(old, r)
+		if err != nil {
+			return nil, err
+		}
+
+		if len(diffs) > 0 {
+			meta.ModificationTime = time.Now()
+			plan.Changes = append(plan.Changes, Change{Action: Update, Key: key, Resource: r, Diffs: diffs})
+		}
+	}
+
+	if prune && manager != "" {
+		for key, r := range currentByKey {
+			if _, ok := seen[key]; ok || !r.GetMeta().Labels.MatchEqual(ManagerLabel, manager) {
+				continue
+			}
+
+			plan.Changes = append(plan.Changes, Change{Action: Delete, Key: key, Resource: r, Diffs: nil})
+		}
+	}
+
+	plan.sort()
+
+	return plan, nil
+}
+
+// sort orders creates and updates by dependency, followed by the deletes in
+// reverse dependency order.
+func (p *Plan) sort() {
+	rank := func(c Change) int {
+		r := Rank(c.Resource.GetMeta().Type.Name)
+		if c.Action == Delete {
+			return 2*len(dependencyOrder) + 1 - r
+		}
+
+		return r
+	}
+
+	sort.SliceStable(p.Changes, func(i, j int) bool {
+		ri, rj := rank(p.Changes[i]), rank(p.Changes[j])
+		if ri != rj {
+			return ri < rj
+		}
+
+		return p.Changes[i].Key < p.Changes[j].Key
+	})
+}
+
+// Count returns the number of changes with the given action.
+func (p *Plan) Count(action Action) int {
+	n := 0
+
+	for _, c := range p.Changes {
+		if c.Action == action {
+			n++
+		}
+	}
+
+	return n
+}
+
+// Print writes the plan in a human readable form.
+func (p *Plan) Print(w io.Writer) {
+	if len(p.Changes) == 0 {
+		fmt.Fprintln(w, "No changes.")
+
+		return
+	}
+
+	symbols := map[Action]string{Create: "+", Update: "~", Delete: "-"}
+
+	for _, c := range p.Changes {
+		fmt.Fprintf(w, "%s %s %s\n", symbols[c.Action], c.Action, c.Key)
+
+		for _, d := range c.Diffs {
+			fmt.Fprintf(w, "    %s: %s => %s\n", d.Field, orNone(d.Old), orNone(d.New))
+		}
+	}
+
+	fmt.Fprintf(w, "Plan: %d to create, %d to update, %d to delete.\n",
+		p.Count(Create), p.Count(Update), p.Count(Delete))
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "(none)"
+	}
+
+	return s
+}
+
+// Diff returns the fields that differ between two resources, leaving out the
+// fields owned by the server. Credential keys are never shown.
+func Diff(old, updated zebra.Resource) ([]FieldDiff, error) {
+	oldFields, err := flatten(old)
+	if err != nil {
+		return nil, err
+	}
+
+	newFields, err := flatten(updated)
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make(map[string]struct{}, len(oldFields)+len(newFields))
+	for f := range oldFields {
+		fields[f] = struct{}{}
+	}
+
+	for f := range newFields {
+		fields[f] = struct{}{}
+	}
+
+	diffs := []FieldDiff{}
+
+	for f := range fields {
+		if ignored(f) || oldFields[f] == newFields[f] {
+			continue
+		}
+
+		d := FieldDiff{Field: f, Old: oldFields[f], New: newFields[f]}
+		if strings.HasPrefix(f, "credentials.keys.") {
+			d.Old, d.New = hide(d.Old), hide(d.New)
+		}
+
+		diffs = append(diffs, d)
+	}
+
+	sort.Slice(diffs, func(i, j int) bool { return diffs[i].Field < diffs[j].Field })
+
+	return diffs, nil
+}
+
+func hide(s string) string {
+	if s == "" {
+		return s
+	}
+
+	return sensitiveValue
+}
+
+func ignored(field string) bool {
+	for _, f := range ignoredFields {
+		if field == f || strings.HasPrefix(field, f+".") {
+			return true
+		}
+	}
+
+	return false
+}
+
+// flatten returns the JSON encoded leaf values of a resource by their dot
+// separated path.
+func flatten(res zebra.Resource) (map[string]string, error) {
+	data, err := json.Marshal(res)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := map[string]interface{}{}
+	if err := json.Unmarshal(data, &tree); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]string{}
+	flattenInto(fields, "", tree)
+
+	return fields, nil
+}
+
+func flattenInto(fields map[string]string, prefix string, value interface{}) {
+	if m, ok := value.(map[string]interface{}); ok {
+		for k, v := range m {
+			path := k
+			if prefix != "" {
+				path = prefix + "." + k
+			}
+
+			flattenInto(fields, path, v)
+		}
+
+		return
+	}
+
+	if value == nil {
+		return
+	}
+
+	b, _ := json.Marshal(value)
+	fields[prefix] = string(b)
+}
@@ -0,0 +1,105 @@
+package inventory_test
+
+import (
+	"bytes"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/inventory"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/project-safari/zebra/model/dc"
+	"github.com/project-safari/zebra/model/network"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRank(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	assert.Less(inventory.Rank("dc.datacenter"), inventory.Rank("dc.lab"))
+	assert.Less(inventory.Rank("network.switch"), inventory.Rank("compute.server"))
+	assert.Less(inventory.Rank("compute.vcenter"), inventory.Rank("compute.vm"))
+	assert.Less(inventory.Rank("compute.vm"), inventory.Rank("zzz"))
+}
+
+func TestPlan(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	oldPool := network.NewVLANPool("pool-1", "zebra", "lab")
+	oldPool.RangeEnd = 10
+	oldPool.Status.Lifecycle = zebra.Maintenance
+	oldPool.Meta.Labels.Add(inventory.ManagerLabel, "lab")
+
+	gone := network.NewVLANPool("pool-2", "zebra", "lab")
+	gone.Meta.Labels.Add(inventory.ManagerLabel, "lab")
+
+	unmanaged := network.NewVLANPool("pool-3", "zebra", "lab")
+
+	same := dc.NewDatacenter("dc-addr", "dc-1", "zebra", "lab")
+	same.Meta.Labels.Add(inventory.ManagerLabel, "lab")
+
+	newPool := network.NewVLANPool("pool-1", "zebra", "lab")
+	newPool.RangeEnd = 20
+
+	sameCopy := dc.NewDatacenter("dc-addr", "dc-1", "zebra", "lab")
+	server := compute.NewServer("SN1", "C220", "server-1", "zebra", "lab")
+
+	current := []zebra.Resource{oldPool, gone, unmanaged, same}
+	desired := []zebra.Resource{server, newPool, sameCopy}
+
+	plan, err := inventory.NewPlan(desired, current, "lab", false)
+	assert.Nil(err)
+	assert.Len(plan.Changes, 2)
+	assert.Equal(inventory.Update, plan.Changes[0].Action)
+	assert.Equal("network.vlanPool/lab/pool-1", plan.Changes[0].Key)
+	assert.Equal(inventory.Create, plan.Changes[1].Action)
+	assert.Equal("compute.server/lab/server-1", plan.Changes[1].Key)
+
+	assert.Equal([]inventory.FieldDiff{{Field: "rangeEnd", Old: "10", New: "20"}}, plan.Changes[0].Diffs)
+	assert.Equal(oldPool.Meta.ID, newPool.Meta.ID)
+	assert.Equal(zebra.Maintenance, newPool.Status.Lifecycle)
+	assert.True(server.Meta.Labels.MatchEqual(inventory.ManagerLabel, "lab"))
+
+	// Pruning deletes only managed resources
+	plan, err = inventory.NewPlan(desired, current, "lab", true)
+	assert.Nil(err)
+	assert.Len(plan.Changes, 3)
+	assert.Equal(inventory.Delete, plan.Changes[2].Action)
+	assert.Equal(gone.Meta.ID, plan.Changes[2].Resource.GetMeta().ID)
+	assert.Equal(1, plan.Count(inventory.Delete))
+
+	out := new(bytes.Buffer)
+	plan.Print(out)
+	assert.Contains(out.String(), "~ update network.vlanPool/lab/pool-1\n    rangeEnd: 10 => 20\n")
+	assert.Contains(out.String(), "Plan: 1 to create, 1 to update, 1 to delete.")
+
+	_, err = inventory.NewPlan([]zebra.Resource{newPool, newPool}, current, "lab", false)
+	assert.ErrorIs(err, inventory.ErrDuplicate)
+
+	plan, err = inventory.NewPlan(nil, nil, "", true)
+	assert.Nil(err)
+
+	out.Reset()
+	plan.Print(out)
+	assert.Equal("No changes.\n", out.String())
+}
+
+func TestDiffHidesCredentials(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	old := compute.NewServer("SN1", "C220", "server-1", "zebra", "lab")
+	old.Credentials = zebra.NewCredentials("admin")
+	assert.Nil(old.Credentials.Add("password", "Sup3rSecret!old"))
+
+	updated := compute.NewServer("SN1", "C220", "server-1", "zebra", "lab")
+	updated.Credentials = zebra.NewCredentials("admin")
+	assert.Nil(updated.Credentials.Add("password", "Sup3rSecret!new"))
+
+	diffs, err := inventory.Diff(old, updated)
+	assert.Nil(err)
+	assert.Equal([]inventory.FieldDiff{
+		{Field: "credentials.keys.password", Old: "(sensitive)", New: "(sensitive)"},
+	}, diffs)
+}
@@ -0,0 +1,66 @@
+package inventory
+
+import (
+	"context"
+	"errors"
+	"io"
+
+	"github.com/project-safari/zebra"
+	"gopkg.in/yaml.v3"
+)
+
+// ReadYAML reads resources from a stream of YAML documents, one resource per
+// document. A document either uses the short keys type, name, group, owner,
+// labels and lifecycle next to the type specific fields, or holds a full
+// resource with "meta" as written by the exporters. Documents that can not be
+// turned into a valid resource are reported with the line they start on.
+func ReadYAML(ctx context.Context, r io.Reader, factory zebra.ResourceFactory,
+	resType string,
+) ([]Entry, []LineError) {
+	decoder := yaml.NewDecoder(r)
+	entries := []Entry{}
+	errs := []LineError{}
+
+	for {
+		node := new(yaml.Node)
+
+		err := decoder.Decode(node)
+		if errors.Is(err, io.EOF) {
+			break
+		}
+
+		if err != nil {
+			// The decoder can not recover from a syntax error.
+			errs = append(errs, lineError(node.Line, err))
+
+			break
+		}
+
+		line := node.Line
+		if len(node.Content) > 0 {
+			line = node.Content[0].Line
+		}
+
+		record := map[string]interface{}{}
+		if err := node.Decode(&record); err != nil {
+			errs = append(errs, lineError(line, err))
+
+			continue
+		}
+
+		if len(record) == 0 {
+			continue
+		}
+
+		res, err := newResource(ctx, factory, resType, record)
+		if err != nil {
+			errs = append(errs, lineError(line, err))
+
+			continue
+		}
+
+		entries = append(entries, Entry{Line: line, Resource: res})
+	}
+
+	return entries, errs
+}
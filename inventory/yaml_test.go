@@ -0,0 +1,84 @@
+package inventory_test
+
+import (
+	"context"
+	"strings"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/project-safari/zebra/inventory"
+	"github.com/project-safari/zebra/model"
+	"github.com/project-safari/zebra/model/network"
+	"github.com/stretchr/testify/assert"
+)
+
+const labYAML = `type: network.switch
+name: leaf-1
+group: lab-1
+labels:
+  rack: r1
+managementIp: 10.2.0.1
+serialNumber: 12345
+model: N9K
+numPorts: "48"
+credentials:
+  loginId: admin
+  keys:
+    password: Sup3rSecret!pass
+---
+type: network.vlanPool
+name: pool-1
+lifecycle: provisioning
+rangeStart: 10
+rangeEnd: 1
+---
+type: network.vlanPool
+name: pool-2
+lifecycle: bogus
+---
+meta:
+  name: pool-3
+  type:
+    name: network.vlanPool
+  labels:
+    system.group: lab-1
+rangeStart: 10
+rangeEnd: 20
+`
+
+func TestReadYAML(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	ctx := context.Background()
+
+	entries, errs := inventory.ReadYAML(ctx, strings.NewReader(labYAML), model.Factory(), "")
+	assert.Len(entries, 2)
+	assert.Len(errs, 2)
+	assert.Equal(15, errs[0].Line)
+	assert.Equal(network.ErrInvalidRange.Error(), errs[0].Message)
+	assert.Equal(21, errs[1].Line)
+	assert.Equal(zebra.ErrLifecycle.Error(), errs[1].Message)
+
+	sw, ok := entries[0].Resource.(*network.Switch)
+	assert.True(ok)
+	assert.Equal(1, entries[0].Line)
+	assert.Equal("12345", sw.SerialNumber)
+	assert.Equal(uint32(48), sw.NumPorts)
+	assert.Equal("10.2.0.1", sw.ManagementIP.String())
+	assert.True(sw.Meta.Labels.MatchEqual("rack", "r1"))
+	assert.Equal(inventory.DefaultOwner, sw.Meta.Owner)
+
+	pool, ok := entries[1].Resource.(*network.VLANPool)
+	assert.True(ok)
+	assert.Equal(25, entries[1].Line)
+	assert.NotEmpty(pool.Meta.ID)
+	assert.Equal("network.vlanPool/lab-1/pool-3", inventory.Key(pool))
+
+	// syntax errors stop the reader
+	_, errs = inventory.ReadYAML(ctx, strings.NewReader("name: [x"), model.Factory(), "")
+	assert.Len(errs, 1)
+
+	_, errs = inventory.Read(ctx, "xml", strings.NewReader(""), model.Factory(), "", nil)
+	assert.Len(errs, 1)
+}
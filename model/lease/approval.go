@@ -0,0 +1,105 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+// DefaultApprover is the role approving leases under policies without one.
+const DefaultApprover = "admin"
+
+var (
+	ErrPolicyValid = errors.New("approval policy is not valid")
+	ErrNotPending  = errors.New("lease is not pending approval")
+	ErrNotApprover = errors.New("role may not approve the lease")
+)
+
+func PolicyType() zebra.Type {
+	return zebra.Type{
+		Name:        "system.approval-policy",
+		Description: "resources that may only be leased once approved",
+	}
+}
+
+func EmptyPolicy() zebra.Resource {
+	p := new(ApprovalPolicy)
+	p.Meta.Type = PolicyType()
+
+	return p
+}
+
+// ApprovalPolicy makes leases that may get a resource of ResourceType whose
+// labels match all of the Selector queries wait for approval by a user with the
+// Approver role. An empty ResourceType matches resources of any type and an
+// empty Selector resources with any labels.
+type ApprovalPolicy struct {
+	zebra.BaseResource
+	ResourceType string        `json:"resourceType,omitempty"`
+	Selector     []zebra.Query `json:"selector,omitempty"`
+	Approver     string        `json:"approver"`
+}
+
+// NewPolicy returns an approval policy for resources of a type matching the
+// selector.
+func NewPolicy(name, resType string, selector []zebra.Query, approver string) *ApprovalPolicy {
+	return &ApprovalPolicy{
+		BaseResource: *zebra.NewBaseResource(PolicyType(), name, "", "system.approval-policies"),
+		ResourceType: resType,
+		Selector:     selector,
+		Approver:     approver,
+	}
+}
+
+func (p *ApprovalPolicy) Validate(ctx context.Context) error {
+	if p.ResourceType == "" && len(p.Selector) == 0 {
+		return ErrPolicyValid
+	}
+
+	for i := range p.Selector {
+		if err := p.Selector[i].Validate(); err != nil {
+			return err
+		}
+	}
+
+	return p.BaseResource.Validate(ctx)
+}
+
+// Role returns the role of the users who may approve leases under the policy.
+func (p *ApprovalPolicy) Role() string {
+	if p.Approver == "" {
+		return DefaultApprover
+	}
+
+	return p.Approver
+}
+
+// Matches returns true if leasing the resource needs approval.
+func (p *ApprovalPolicy) Matches(res zebra.Resource) bool {
+	meta := res.GetMeta()
+
+	if p.ResourceType != "" && p.ResourceType != meta.Type.Name {
+		return false
+	}
+
+	for _, q := range p.Selector {
+		matchIn := meta.Labels.MatchIn(q.Key, q.Values...)
+		inVals := q.Op == zebra.MatchEqual || q.Op == zebra.MatchIn
+
+		if matchIn != inVals {
+			return false
+		}
+	}
+
+	return true
+}
+
+// Approval is the decision taken on a lease that needed approval.
+type Approval struct {
+	Approver string    `json:"approver"`
+	Approved bool      `json:"approved"`
+	Reason   string    `json:"reason,omitempty"`
+	Time     time.Time `json:"time"`
+}
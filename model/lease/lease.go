@@ -3,6 +3,7 @@ package lease
 import (
 	"context"
 	"errors"
+	"fmt"
 	"sync"
 	"time"
 
@@ -23,34 +24,71 @@ func Empty() zebra.Resource {
 	return l
 }
 
+// ResourceReq is a request for Count resources of a given type. Name names the
+// request for templates and placement constraints. A request can be pinned to
+// specific resources by their IDs or names, it then gets exactly those.
+// Resources holds the IDs of the resources that have been assigned to the
+// request.
 type ResourceReq struct {
-	Type      string           `json:"type"`
-	Group     string           `json:"group"`
-	Name      string           `json:"name"`
-	Count     int              `json:"count"`
-	Filters   []zebra.Query    `json:"filters,omitempty"`
-	Resources []zebra.Resource `json:"resources,omitempty"`
+	Type      string        `json:"type"`
+	Group     string        `json:"group"`
+	Name      string        `json:"name"`
+	Count     int           `json:"count"`
+	Filters   []zebra.Query `json:"filters,omitempty"`
+	IDs       []string      `json:"ids,omitempty"`
+	Names     []string      `json:"names,omitempty"`
+	Resources []string      `json:"resources,omitempty"`
 }
 
+// Lease is a request for resources for a duration. A lease starts right away
+// unless it has a StartTime in the future, in which case the resources are
+// booked for that time and the lease is scheduled until then. A lease with a
+// HeartbeatInterval must be kept alive with heartbeats while it is active.
+// The Limits of a lease bound its duration and how often it may be extended.
 type Lease struct {
 	zebra.BaseResource
-	lock           sync.RWMutex
-	Duration       time.Duration  `json:"duration"`
-	Request        []*ResourceReq `json:"request"`
-	ActivationTime time.Time      `json:"activationTime"`
+	lock              sync.RWMutex
+	Duration          time.Duration  `json:"duration"`
+	Request           []*ResourceReq `json:"request"`
+	Placement         []Placement    `json:"placement,omitempty"`
+	StartTime         time.Time      `json:"startTime"`
+	ActivationTime    time.Time      `json:"activationTime"`
+	Phase             Phase          `json:"phase"`
+	Priority          int            `json:"priority"`
+	Approvers         []string       `json:"approvers,omitempty"`
+	Approval          *Approval      `json:"approval,omitempty"`
+	Hooks             []HookResult   `json:"hooks,omitempty"`
+	Template          *TemplateRef   `json:"template,omitempty"`
+	HeartbeatInterval time.Duration  `json:"heartbeatInterval,omitempty"`
+	LastHeartbeat     time.Time      `json:"lastHeartbeat,omitempty"`
+	Limits            *Limits        `json:"limits,omitempty"`
+	Extensions        []Extension    `json:"extensions,omitempty"`
+}
+
+// HookResult is the outcome of a setup or teardown hook run on a resource of
+// the lease.
+type HookResult struct {
+	Resource string    `json:"resource"`
+	Hook     string    `json:"hook"`
+	Output   string    `json:"output,omitempty"`
+	Error    string    `json:"error,omitempty"`
+	Time     time.Time `json:"time"`
 }
 
 var (
 	ErrLeaseActivate = errors.New("tried to activate lease but request has not been satisfied entirely")
 	ErrLeaseValid    = errors.New("lease is not valid")
+	ErrLeaseSchedule = errors.New("tried to schedule lease but request has not been satisfied entirely")
+	ErrLeaseSetUp    = errors.New("tried to set up lease but request has not been satisfied entirely")
+	ErrNotActive     = errors.New("lease is not active")
 )
 
 func (r *ResourceReq) Assign(res zebra.Resource) error {
 	if r.Resources == nil {
-		r.Resources = make([]zebra.Resource, 0)
+		r.Resources = make([]string, 0)
 	}
 
-	r.Resources = append(r.Resources, res)
+	r.Resources = append(r.Resources, res.GetMeta().ID)
 
 	return nil
 }
@@ -59,6 +97,19 @@ func (r *ResourceReq) IsSatisfied() bool {
 	return len(r.Resources) == r.Count
 }
 
+// IsPinned returns true if the request asks for specific resources.
+func (r *ResourceReq) IsPinned() bool {
+	return len(r.IDs)+len(r.Names) > 0
+}
+
+// Pins returns true if the resource is one of the resources the request is
+// pinned to.
+func (r *ResourceReq) Pins(res zebra.Resource) bool {
+	meta := res.GetMeta()
+
+	return zebra.IsIn(meta.ID, r.IDs) || zebra.IsIn(meta.Name, r.Names)
+}
+
 // Return a new lease pointer with default values.
 func NewLease(userEmail string, dur time.Duration, req []*ResourceReq) *Lease {
 	// Set default values, don't set activation time yet
@@ -96,6 +147,117 @@ func (l *Lease) Activate() error {
 
 	l.ActivationTime = time.Now()
 	l.Status.State = zebra.Active
+	l.Phase = Activated
+
+	if l.HeartbeatInterval > 0 {
+		l.LastHeartbeat = l.ActivationTime
+	}
+
+	return nil
+}
+
+// Schedule marks a lease whose resources have been booked for a future start.
+func (l *Lease) Schedule() error {
+	if !l.IsSatisfied() {
+		return ErrLeaseSchedule
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.Phase = Scheduled
+
+	return nil
+}
+
+// SetUp marks a lease whose resources are being set up before it is activated.
+func (l *Lease) SetUp() error {
+	if !l.IsSatisfied() {
+		return ErrLeaseSetUp
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.Phase = SettingUp
+
+	return nil
+}
+
+// RecordHooks adds the results of hooks run on the resources of the lease.
+func (l *Lease) RecordHooks(results []HookResult) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.Hooks = append(l.Hooks, results...)
+}
+
+// Beat records a heartbeat of an active lease.
+func (l *Lease) Beat(now time.Time) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.Phase != Activated {
+		return ErrNotActive
+	}
+
+	l.LastHeartbeat = now
+
+	return nil
+}
+
+// Idle returns how long an active lease that needs heartbeats has gone
+// without one, 0 for other leases.
+func (l *Lease) Idle(now time.Time) time.Duration {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.HeartbeatInterval <= 0 || l.Phase != Activated {
+		return 0
+	}
+
+	return now.Sub(l.LastHeartbeat)
+}
+
+// Enqueue marks a lease that waits for resources to free up.
+func (l *Lease) Enqueue() {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.Phase = Queued
+}
+
+// AwaitApproval marks a lease that waits for a user with one of the approver
+// roles to approve it.
+func (l *Lease) AwaitApproval(roles []string) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.Approvers = roles
+	l.Phase = PendingApproval
+}
+
+// Decide records the decision of approver on a lease pending approval. A denied
+// lease is released, an approved one is ready to be allocated.
+func (l *Lease) Decide(approver, role string, approved bool, reason string) error {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	if l.Phase != PendingApproval {
+		return ErrNotPending
+	}
+
+	if !zebra.IsIn(role, l.Approvers) {
+		return ErrNotApprover
+	}
+
+	l.Approval = &Approval{Approver: approver, Approved: approved, Reason: reason, Time: time.Now()}
+	l.Phase = Requested
+
+	if !approved {
+		l.Status.State = zebra.Inactive
+		l.Phase = Released
+	}
 
 	return nil
 }
@@ -106,6 +268,37 @@ func (l *Lease) Deactivate() {
 	defer l.lock.Unlock()
 
 	l.Status.State = zebra.Inactive
+	l.Phase = Released
+}
+
+// Start returns the time the lease started, or the time it is meant to start
+// if it is not active yet.
+func (l *Lease) Start() time.Time {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if !l.ActivationTime.IsZero() {
+		return l.ActivationTime
+	}
+
+	if !l.StartTime.IsZero() {
+		return l.StartTime
+	}
+
+	return time.Now()
+}
+
+// End returns the time the lease ends.
+func (l *Lease) End() time.Time {
+	return l.Start().Add(l.Duration)
+}
+
+// IsFuture returns true if the lease asks to start later than now.
+func (l *Lease) IsFuture(now time.Time) bool {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	return l.StartTime.After(now)
 }
 
 func (l *Lease) IsSatisfied() bool {
@@ -145,8 +338,8 @@ func (l *Lease) RequestList() []*ResourceReq {
 }
 
 func (l *Lease) Validate(ctx context.Context) error {
-	if l.Duration.Hours() > zebra.DefaultMaxDuration {
-		return ErrLeaseValid
+	if !l.withinLimits() {
+		return fmt.Errorf("%w: duration %s is over the limits", ErrLeaseValid, l.Duration)
 	}
 
 	if l.Request == nil {
@@ -157,5 +350,25 @@ func (l *Lease) Validate(ctx context.Context) error {
 		return ErrLeaseValid
 	}
 
+	if l.Phase > Released {
+		return ErrPhase
+	}
+
+	if l.HeartbeatInterval < 0 {
+		return ErrLeaseValid
+	}
+
+	for _, r := range l.Request {
+		if r.IsPinned() && r.Count != len(r.IDs)+len(r.Names) {
+			return ErrLeaseValid
+		}
+	}
+
+	for _, p := range l.Placement {
+		if err := p.Validate(l.Request); err != nil {
+			return err
+		}
+	}
+
 	return l.BaseResource.Validate(ctx)
 }
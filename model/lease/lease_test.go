@@ -159,3 +159,65 @@ func getRes() zebra.Resource {
 		zebra.Type{Name: "dummy", Description: "dummy"},
 		"test_res", "tester", "test_group")
 }
+
+func TestSchedule(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	l := getLease()
+	assert.Equal(ErrLeaseSchedule, l.Schedule())
+
+	l = getEmptyLease()
+	start := time.Now().Add(time.Hour)
+	l.StartTime = start
+
+	assert.True(l.IsFuture(time.Now()))
+	assert.Equal(start, l.Start())
+	assert.Equal(start.Add(l.Duration), l.End())
+
+	assert.Nil(l.Schedule())
+	assert.Equal(Scheduled, l.Phase)
+	assert.True(l.Phase.Holds())
+	assert.Nil(l.Validate(context.Background()))
+
+	assert.Nil(l.Activate())
+	assert.Equal(Activated, l.Phase)
+	assert.Equal(l.ActivationTime, l.Start())
+
+	l.Deactivate()
+	assert.Equal(Released, l.Phase)
+	assert.False(l.Phase.Holds())
+
+	l.Phase = 9
+	assert.Equal(ErrPhase, l.Validate(context.Background()))
+	assert.Equal("unknown", l.Phase.String())
+
+	p := Scheduled
+	b, err := p.MarshalText()
+	assert.Nil(err)
+	assert.Equal("scheduled", string(b))
+	assert.Nil(p.UnmarshalText([]byte("active")))
+	assert.Equal(Activated, p)
+	assert.Equal(ErrPhase, p.UnmarshalText([]byte("zzz")))
+}
+
+func TestEnqueue(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	l := getLease()
+	l.Enqueue()
+	assert.Equal(Queued, l.Phase)
+	assert.True(l.Phase.IsPending())
+	assert.False(l.Phase.Holds())
+	assert.Nil(l.Validate(context.Background()))
+
+	b, err := l.Phase.MarshalText()
+	assert.Nil(err)
+	assert.Equal("queued", string(b))
+
+	p := Released
+	assert.False(p.IsPending())
+	assert.Nil(p.UnmarshalText([]byte("queued")))
+	assert.Equal(Queued, p)
+}
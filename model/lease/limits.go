@@ -0,0 +1,96 @@
+package lease
+
+import (
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+var ErrExtendLimit = errors.New("lease extension is over the limits of the lease")
+
+// Limits bound how long a lease may be held. MaxDuration bounds the duration
+// asked for when the lease is made, MaxExtensions the number of times it may
+// be extended and MaxTotal its duration with all extensions.
+type Limits struct {
+	MaxDuration   time.Duration `json:"maxDuration"`
+	MaxExtensions int           `json:"maxExtensions"`
+	MaxTotal      time.Duration `json:"maxTotal"`
+}
+
+// DefaultLimits returns the limits of leases made before limits could be
+// configured, they can not be extended.
+func DefaultLimits() Limits {
+	maxDuration := zebra.DefaultMaxDuration * time.Hour
+
+	return Limits{MaxDuration: maxDuration, MaxExtensions: 0, MaxTotal: maxDuration}
+}
+
+// Extension records who extended a lease by how much and when.
+type Extension struct {
+	Actor    string        `json:"actor"`
+	Duration time.Duration `json:"duration"`
+	Time     time.Time     `json:"time"`
+}
+
+// CanExtend returns an error if the lease is not active or extending it by the
+// duration would break its limits.
+func (l *Lease) CanExtend(by time.Duration) error {
+	l.lock.RLock()
+	defer l.lock.RUnlock()
+
+	if l.Phase != Activated {
+		return ErrNotActive
+	}
+
+	limits := l.limits()
+
+	if len(l.Extensions) >= limits.MaxExtensions {
+		return fmt.Errorf("%w: extended %d of %d times", ErrExtendLimit, len(l.Extensions), limits.MaxExtensions)
+	}
+
+	if l.Duration+by > limits.MaxTotal {
+		return fmt.Errorf("%w: %s would be over %s", ErrExtendLimit, l.Duration+by, limits.MaxTotal)
+	}
+
+	return nil
+}
+
+// Extend adds to the duration of an active lease if its limits allow it.
+func (l *Lease) Extend(by time.Duration, actor string, now time.Time) error {
+	if err := l.CanExtend(by); err != nil {
+		return err
+	}
+
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	l.Duration += by
+	l.Extensions = append(l.Extensions, Extension{Actor: actor, Duration: by, Time: now})
+
+	return nil
+}
+
+// limits returns the limits of the lease, the default limits if it has none.
+func (l *Lease) limits() Limits {
+	if l.Limits == nil {
+		return DefaultLimits()
+	}
+
+	return *l.Limits
+}
+
+// withinLimits returns true if the duration first asked for, the number of
+// extensions and the total duration are within the limits of the lease.
+func (l *Lease) withinLimits() bool {
+	limits := l.limits()
+	extended := time.Duration(0)
+
+	for _, e := range l.Extensions {
+		extended += e.Duration
+	}
+
+	return l.Duration-extended <= limits.MaxDuration && l.Duration <= limits.MaxTotal &&
+		len(l.Extensions) <= limits.MaxExtensions
+}
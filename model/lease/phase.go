@@ -0,0 +1,76 @@
+package lease
+
+import (
+	"errors"
+	"strings"
+)
+
+// Phase is the stage of a lease from request to release.
+type Phase uint8
+
+const (
+	Requested Phase = iota
+	PendingApproval
+	Queued
+	Scheduled
+	SettingUp
+	Activated
+	Released
+)
+
+var ErrPhase = errors.New("invalid lease phase")
+
+func (p Phase) String() string {
+	strs := map[Phase]string{
+		Requested:       "requested",
+		PendingApproval: "pending-approval",
+		Queued:          "queued",
+		Scheduled:       "scheduled",
+		SettingUp:       "setup",
+		Activated:       "active",
+		Released:        "released",
+	}
+
+	pstr, ok := strs[p]
+	if !ok {
+		return "unknown"
+	}
+
+	return pstr
+}
+
+func (p *Phase) MarshalText() ([]byte, error) {
+	return []byte(p.String()), nil
+}
+
+func (p *Phase) UnmarshalText(data []byte) error {
+	pmap := map[string]Phase{
+		"requested":        Requested,
+		"pending-approval": PendingApproval,
+		"queued":           Queued,
+		"scheduled":        Scheduled,
+		"setup":            SettingUp,
+		"active":           Activated,
+		"released":         Released,
+	}
+
+	pval, ok := pmap[strings.ToLower(string(data))]
+	if !ok {
+		return ErrPhase
+	}
+
+	*p = pval
+
+	return nil
+}
+
+// IsPending returns true if leases in this phase have not started yet and can
+// still be cancelled without releasing any resource.
+func (p Phase) IsPending() bool {
+	return p == PendingApproval || p == Queued || p == Scheduled
+}
+
+// Holds returns true if leases in this phase hold a booking of their resources.
+func (p Phase) Holds() bool {
+	return p == Scheduled || p == SettingUp || p == Activated
+}
@@ -0,0 +1,68 @@
+package lease
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/project-safari/zebra"
+)
+
+// Placement policies.
+const (
+	PlaceTogether = "same"
+	PlaceSpread   = "spread"
+)
+
+var ErrPlacementValid = errors.New("placement constraint is not valid")
+
+// Placement constrains where the resources of a lease come from, by the value
+// of a label such as "rack", "switch" or "lab". With the "same" policy all
+// resources of the constrained requests must have the same value, with
+// "spread" they must all have different values. Requests names the requests
+// the constraint applies to, all of them if empty.
+type Placement struct {
+	Policy   string   `json:"policy"`
+	Key      string   `json:"key"`
+	Requests []string `json:"requests,omitempty"`
+}
+
+// Validate returns an error if the policy or key is missing, or the placement
+// names a request that is not part of reqs.
+func (p Placement) Validate(reqs []*ResourceReq) error {
+	if p.Policy != PlaceTogether && p.Policy != PlaceSpread {
+		return fmt.Errorf("%w: unknown policy %q", ErrPlacementValid, p.Policy)
+	}
+
+	if p.Key == "" {
+		return fmt.Errorf("%w: no label key", ErrPlacementValid)
+	}
+
+	for _, name := range p.Requests {
+		found := false
+
+		for _, req := range reqs {
+			found = found || (req.Name != "" && req.Name == name)
+		}
+
+		if !found {
+			return fmt.Errorf("%w: no request named %s", ErrPlacementValid, name)
+		}
+	}
+
+	return nil
+}
+
+// Applies returns true if the placement constrains the request.
+func (p Placement) Applies(req *ResourceReq) bool {
+	return len(p.Requests) == 0 || zebra.IsIn(req.Name, p.Requests)
+}
+
+func (p Placement) String() string {
+	s := p.Policy + " " + p.Key
+	if len(p.Requests) > 0 {
+		s += " for " + strings.Join(p.Requests, ", ")
+	}
+
+	return s
+}
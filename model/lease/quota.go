@@ -0,0 +1,108 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+var ErrQuotaValid = errors.New("quota is not valid")
+
+func QuotaType() zebra.Type {
+	return zebra.Type{
+		Name:        "system.quota",
+		Description: "lease quota of a user or a group",
+	}
+}
+
+func EmptyQuota() zebra.Resource {
+	q := new(Quota)
+	q.Meta.Type = QuotaType()
+
+	return q
+}
+
+// DefaultQuotaPeriod is the period lease hours are counted over if a quota does
+// not set one.
+const DefaultQuotaPeriod = 7 * 24 * time.Hour
+
+// Quota limits the resources that can be held by leases. A quota applies to the
+// leases of one user if User is set, to the leases of all users in a group
+// combined if Group is set, and to the leases of every user on their own if
+// neither is set. ResourceType limits the quota to one type of resource.
+// MaxResources caps the number of resources held at the same time by leases
+// that have not been released yet. MaxHours caps the lease hours (resources
+// times lease duration) of those leases together with the hours used by
+// released leases within the last Period. A limit of 0 means no limit.
+type Quota struct {
+	zebra.BaseResource
+	User         string        `json:"user,omitempty"`
+	Group        string        `json:"group,omitempty"`
+	ResourceType string        `json:"resourceType,omitempty"`
+	MaxResources int           `json:"maxResources"`
+	MaxHours     float64       `json:"maxHours"`
+	Period       time.Duration `json:"period,omitempty"`
+}
+
+// NewQuota returns a quota for the leases of a user or a group, or of every
+// user if both are empty.
+func NewQuota(name, user, group, resType string, maxResources int, maxHours float64) *Quota {
+	return &Quota{
+		BaseResource: *zebra.NewBaseResource(QuotaType(), name, "", "system.quotas"),
+		User:         user,
+		Group:        group,
+		ResourceType: resType,
+		MaxResources: maxResources,
+		MaxHours:     maxHours,
+	}
+}
+
+func (q *Quota) Validate(ctx context.Context) error {
+	if q.User != "" && q.Group != "" {
+		return ErrQuotaValid
+	}
+
+	if q.MaxResources < 0 || q.MaxHours < 0 || q.Period < 0 {
+		return ErrQuotaValid
+	}
+
+	return q.BaseResource.Validate(ctx)
+}
+
+// Applies returns true if the quota limits the leases of a user in a group.
+func (q *Quota) Applies(user, group string) bool {
+	switch {
+	case q.User != "":
+		return q.User == user
+	case q.Group != "":
+		return q.Group == group
+	default:
+		return true
+	}
+}
+
+// Window returns the period lease hours are counted over.
+func (q *Quota) Window() time.Duration {
+	if q.Period == 0 {
+		return DefaultQuotaPeriod
+	}
+
+	return q.Period
+}
+
+// Counts returns true if resources requested by req count against the quota.
+func (q *Quota) Counts(req *ResourceReq) bool {
+	return q.ResourceType == "" || q.ResourceType == req.Type
+}
+
+// Subject returns who the quota is for, the user for a quota that applies to
+// every user.
+func (q *Quota) Subject(user string) string {
+	if q.Group != "" {
+		return "group " + q.Group
+	}
+
+	return "user " + user
+}
@@ -0,0 +1,143 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+var (
+	ErrTemplateValid = errors.New("lease template is not valid")
+	ErrTemplateParam = errors.New("lease template has no request with this name")
+)
+
+func TemplateType() zebra.Type {
+	return zebra.Type{
+		Name:        "system.lease-template",
+		Description: "reusable lease definition",
+	}
+}
+
+func EmptyTemplate() zebra.Resource {
+	t := new(Template)
+	t.Meta.Type = TemplateType()
+
+	return t
+}
+
+// Template is a named lease definition that users can lease again and again.
+// The count of a request with a Name can be changed when the template is
+// used, as can the Duration. Version goes up every time the template is
+// updated; leases keep their own copy of the requests so that a change of the
+// template does not affect them, nor do changes of its Placement constraints.
+type Template struct {
+	zebra.BaseResource
+	Version   int            `json:"version"`
+	Duration  time.Duration  `json:"duration"`
+	Request   []*ResourceReq `json:"request"`
+	Placement []Placement    `json:"placement,omitempty"`
+}
+
+// NewTemplate returns a lease template with the given requests.
+func NewTemplate(name string, dur time.Duration, req []*ResourceReq) *Template {
+	return &Template{
+		BaseResource: *zebra.NewBaseResource(TemplateType(), name, "", "system.lease-templates"),
+		Version:      1,
+		Duration:     dur,
+		Request:      req,
+	}
+}
+
+// Validate checks the template. How long its Duration may be depends on the
+// lease limits of the server, which checks it when the template is stored.
+func (t *Template) Validate(ctx context.Context) error {
+	if len(t.Request) == 0 || t.Duration <= 0 {
+		return ErrTemplateValid
+	}
+
+	names := map[string]struct{}{}
+
+	for _, req := range t.Request {
+		if req.Type == "" || req.Count <= 0 || len(req.Resources) != 0 {
+			return ErrTemplateValid
+		}
+
+		if _, ok := names[req.Name]; ok && req.Name != "" {
+			return fmt.Errorf("%w: request %s appears twice", ErrTemplateValid, req.Name)
+		}
+
+		names[req.Name] = struct{}{}
+
+		for i := range req.Filters {
+			if err := req.Filters[i].Validate(); err != nil {
+				return err
+			}
+		}
+	}
+
+	for _, p := range t.Placement {
+		if err := p.Validate(t.Request); err != nil {
+			return err
+		}
+	}
+
+	return t.BaseResource.Validate(ctx)
+}
+
+// Instantiate returns a copy of the requests of the template, with the counts
+// of the named requests replaced by the given ones.
+func (t *Template) Instantiate(counts map[string]int) ([]*ResourceReq, error) {
+	for name, count := range counts {
+		if !t.hasRequest(name) {
+			return nil, fmt.Errorf("%w: %s", ErrTemplateParam, name)
+		}
+
+		if count <= 0 {
+			return nil, fmt.Errorf("%w: count of %s must be positive", ErrTemplateValid, name)
+		}
+	}
+
+	reqs := make([]*ResourceReq, 0, len(t.Request))
+
+	for _, r := range t.Request {
+		req := &ResourceReq{
+			Type:      r.Type,
+			Group:     r.Group,
+			Name:      r.Name,
+			Count:     r.Count,
+			Filters:   append([]zebra.Query{}, r.Filters...),
+			IDs:       append([]string{}, r.IDs...),
+			Names:     append([]string{}, r.Names...),
+			Resources: nil,
+		}
+
+		if count, ok := counts[r.Name]; ok {
+			req.Count = count
+		}
+
+		reqs = append(reqs, req)
+	}
+
+	return reqs, nil
+}
+
+func (t *Template) hasRequest(name string) bool {
+	for _, r := range t.Request {
+		if r.Name != "" && r.Name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// TemplateRef names the template a lease was made from, the version of the
+// template at that time and the counts that were given.
+type TemplateRef struct {
+	Name    string         `json:"name"`
+	Version int            `json:"version,omitempty"`
+	Counts  map[string]int `json:"counts,omitempty"`
+}
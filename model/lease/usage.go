@@ -0,0 +1,82 @@
+package lease
+
+import (
+	"context"
+	"errors"
+	"time"
+
+	"github.com/project-safari/zebra"
+)
+
+var ErrUsageValid = errors.New("usage record is not valid")
+
+func UsageType() zebra.Type {
+	return zebra.Type{
+		Name:        "system.usage",
+		Description: "time a resource was held by a lease",
+	}
+}
+
+func EmptyUsage() zebra.Resource {
+	u := new(Usage)
+	u.Meta.Type = UsageType()
+
+	return u
+}
+
+// Usage records that a resource was held by a lease from Start to End. It is
+// recorded when the lease is released, along with the type of the resource
+// and the user and group that held it, so that usage can be reported on after
+// the lease and the resource are gone.
+type Usage struct {
+	zebra.BaseResource
+	Resource     string    `json:"resource"`
+	ResourceName string    `json:"resourceName"`
+	ResourceType string    `json:"resourceType"`
+	Lease        string    `json:"lease"`
+	User         string    `json:"user"`
+	Group        string    `json:"group,omitempty"`
+	Start        time.Time `json:"start"`
+	End          time.Time `json:"end"`
+}
+
+// NewUsage returns the usage of a resource by a lease.
+func NewUsage(l *Lease, res zebra.Resource, group string, start, end time.Time) *Usage {
+	meta := res.GetMeta()
+
+	return &Usage{
+		BaseResource: *zebra.NewBaseResource(UsageType(), meta.Name, "", "system.usage"),
+		Resource:     meta.ID,
+		ResourceName: meta.Name,
+		ResourceType: meta.Type.Name,
+		Lease:        l.Meta.ID,
+		User:         l.Owner(),
+		Group:        group,
+		Start:        start,
+		End:          end,
+	}
+}
+
+func (u *Usage) Validate(ctx context.Context) error {
+	if u.Resource == "" || u.ResourceType == "" || u.Lease == "" || u.End.Before(u.Start) {
+		return ErrUsageValid
+	}
+
+	return u.BaseResource.Validate(ctx)
+}
+
+// Within returns the part of the usage between from and to, and false if there
+// is none.
+func (u *Usage) Within(from, to time.Time) (time.Time, time.Time, bool) {
+	start, end := u.Start, u.End
+
+	if start.Before(from) {
+		start = from
+	}
+
+	if end.After(to) {
+		end = to
+	}
+
+	return start, end, start.Before(end)
+}
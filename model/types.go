@@ -1,12 +1,15 @@
 package model
 
 import (
+	"net"
+
 	"github.com/project-safari/zebra"
 	"github.com/project-safari/zebra/model/compute"
 	"github.com/project-safari/zebra/model/dc"
 	"github.com/project-safari/zebra/model/lease"
 	"github.com/project-safari/zebra/model/network"
 	"github.com/project-safari/zebra/model/user"
+	"github.com/project-safari/zebra/model/webhook"
 )
 
 // Factory returns a resource factory with all the known types.
@@ -31,10 +34,34 @@ func Factory() zebra.ResourceFactory {
 
 	// zebra server resources
 	factory.Add(user.Type(), user.Empty)
+	factory.Add(webhook.Type(), webhook.Empty)
 
 	// zebra lease resource
 	factory.Add(lease.Type(), lease.Empty)
+	factory.Add(lease.QuotaType(), lease.EmptyQuota)
+	factory.Add(lease.PolicyType(), lease.EmptyPolicy)
+	factory.Add(lease.TemplateType(), lease.EmptyTemplate)
+	factory.Add(lease.UsageType(), lease.EmptyUsage)
 
 	// Need to add all the known types here
 	return factory
 }
+
+// ManagementIP returns the address through which a resource is managed, nil if
+// the resource type has no such address.
+func ManagementIP(res zebra.Resource) net.IP {
+	switch r := res.(type) {
+	case *compute.Server:
+		return r.BoardIP
+	case *compute.ESX:
+		return r.IP
+	case *compute.VCenter:
+		return r.IP
+	case *compute.VM:
+		return r.ManagementIP
+	case *network.Switch:
+		return r.ManagementIP
+	}
+
+	return nil
+}
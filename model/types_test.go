@@ -4,6 +4,9 @@ import (
 	"testing"
 
 	"github.com/project-safari/zebra/model"
+	"github.com/project-safari/zebra/model/compute"
+	"github.com/project-safari/zebra/model/dc"
+	"github.com/project-safari/zebra/model/network"
 	"github.com/stretchr/testify/assert"
 )
 
@@ -22,3 +25,16 @@ func TestDefaultFactory(t *testing.T) {
 		assert.NotNil(types.New(t.Name))
 	}
 }
+
+func TestManagementIP(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	assert.NotNil(model.ManagementIP(compute.MockServer(1)[0]))
+	assert.NotNil(model.ManagementIP(compute.MockESX(1)[0]))
+	assert.NotNil(model.ManagementIP(compute.MockVCenter(1)[0]))
+	assert.NotNil(model.ManagementIP(compute.MockVM(1)[0]))
+	assert.NotNil(model.ManagementIP(network.MockSwitch(1)[0]))
+	assert.Nil(model.ManagementIP(dc.MockLab(1)[0]))
+}
@@ -0,0 +1,120 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/url"
+	"strings"
+
+	"github.com/project-safari/zebra"
+)
+
+var (
+	ErrURL    = errors.New("webhook url must be an absolute http or https url")
+	ErrSecret = errors.New("webhook secret is empty")
+)
+
+func Type() zebra.Type {
+	return zebra.Type{
+		Name:        "system.webhook",
+		Description: "subscription of an outside system to zebra events",
+	}
+}
+
+func Empty() zebra.Resource {
+	w := new(Webhook)
+	w.Meta.Type = Type()
+
+	return w
+}
+
+// Webhook is a subscription to zebra events. Events whose type matches one of
+// Events are posted to URL, an empty list matches all events and an entry
+// ending with ".*" matches all events starting with what comes before it, for
+// example "lease.*". Payloads are signed with Secret, which is read from the
+// "secret" of a posted webhook but never marshaled: the server keeps it apart
+// from the resource so that it is not returned or sent in events.
+type Webhook struct {
+	zebra.BaseResource
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+	Secret string   `json:"-"`
+}
+
+func NewWebhook(name, url, secret string, events []string) *Webhook {
+	return &Webhook{
+		BaseResource: *zebra.NewBaseResource(Type(), name, "", "system.webhooks"),
+		URL:          url,
+		Events:       events,
+		Secret:       secret,
+	}
+}
+
+// UnmarshalJSON reads a webhook along with its secret.
+func (w *Webhook) UnmarshalJSON(data []byte) error {
+	type plain Webhook
+
+	in := struct {
+		*plain
+		Secret string `json:"secret"`
+	}{plain: (*plain)(w)}
+
+	if err := json.Unmarshal(data, &in); err != nil {
+		return err
+	}
+
+	w.Secret = in.Secret
+
+	return nil
+}
+
+// Validate checks the webhook. The secret is not checked since it is not
+// stored with the resource, the server makes sure that every webhook has one.
+func (w *Webhook) Validate(ctx context.Context) error {
+	u, err := url.Parse(w.URL)
+	if err != nil || !u.IsAbs() || (u.Scheme != "http" && u.Scheme != "https") {
+		return ErrURL
+	}
+
+	return w.BaseResource.Validate(ctx)
+}
+
+// Matches returns true if the webhook subscribes to events of the given type.
+func (w *Webhook) Matches(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+
+	for _, e := range w.Events {
+		if e == event || (strings.HasSuffix(e, ".*") && strings.HasPrefix(event, strings.TrimSuffix(e, "*"))) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Sign returns the signature of a payload sent at timestamp, the hex encoded
+// HMAC-SHA256 of the timestamp, a dot and the payload keyed with the secret.
+func (w *Webhook) Sign(timestamp string, payload []byte) string {
+	return Sign(w.Secret, timestamp, payload)
+}
+
+// Sign returns the signature of a payload sent at timestamp with a secret.
+func Sign(secret, timestamp string, payload []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(timestamp + "."))
+	mac.Write(payload)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify returns true if signature is the signature of the payload sent at
+// timestamp with the secret.
+func Verify(secret, timestamp string, payload []byte, signature string) bool {
+	return hmac.Equal([]byte(Sign(secret, timestamp, payload)), []byte(signature))
+}
@@ -0,0 +1,66 @@
+package webhook_test
+
+import (
+	"context"
+	"encoding/json"
+	"testing"
+
+	"github.com/project-safari/zebra/model/webhook"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWebhook(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+	ctx := context.Background()
+
+	w := webhook.NewWebhook("ci", "https://ci.example.com/zebra", "s3cret", nil)
+	assert.Nil(w.Validate(ctx))
+	assert.True(w.Matches("lease.activated"))
+
+	assert.NotNil(webhook.NewWebhook("ci", "ci.example.com/zebra", "s3cret", nil).Validate(ctx))
+	assert.NotNil(webhook.NewWebhook("ci", "ftp://ci.example.com", "s3cret", nil).Validate(ctx))
+	assert.NotNil(webhook.Empty().Validate(ctx))
+
+	w.Events = []string{"lease.*", "resource.faulted"}
+	assert.True(w.Matches("lease.expired"))
+	assert.True(w.Matches("resource.faulted"))
+	assert.False(w.Matches("resource.created"))
+	assert.False(w.Matches("leases"))
+}
+
+func TestSecret(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	w := webhook.NewWebhook("ci", "https://ci.example.com/zebra", "s3cret", nil)
+
+	b, err := json.Marshal(w)
+	assert.Nil(err)
+	assert.NotContains(string(b), "s3cret")
+
+	read := new(webhook.Webhook)
+	assert.Nil(json.Unmarshal([]byte(`{"url":"https://ci.example.com/zebra","secret":"s3cret"}`), read))
+	assert.Equal("s3cret", read.Secret)
+	assert.Equal("https://ci.example.com/zebra", read.URL)
+
+	assert.NotNil(json.Unmarshal([]byte(`{"url":1}`), read))
+}
+
+func TestSign(t *testing.T) {
+	t.Parallel()
+
+	assert := assert.New(t)
+
+	w := webhook.NewWebhook("ci", "https://ci.example.com/zebra", "s3cret", nil)
+	payload := []byte(`{"type":"lease.activated"}`)
+
+	sig := w.Sign("1700000000", payload)
+	assert.Len(sig, 64)
+	assert.True(webhook.Verify("s3cret", "1700000000", payload, sig))
+	assert.False(webhook.Verify("s3cret", "1700000001", payload, sig))
+	assert.False(webhook.Verify("other", "1700000000", payload, sig))
+	assert.False(webhook.Verify("s3cret", "1700000000", []byte("{}"), sig))
+}
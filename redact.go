@@ -0,0 +1,121 @@
+package zebra
+
+import (
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"strings"
+)
+
+// Redacted replaces secrets in logs, debug dumps and marshaled secrets.
+const Redacted = "*****"
+
+// secretKeys are the parts of field and log keys that name secrets. Keys are
+// matched in lower case with "-" and "_" removed, so "ssh-key" matches
+// "sshkey" and "passwordHash" matches "password".
+var secretKeys = []string{
+	"password", "passwd", "secret", "token", "privatekey", "sshkey", "apikey", "authkey", "authorization",
+	"cookie",
+}
+
+// IsSecretKey returns true if the field or log key names a secret, such as a
+// password, a token or the keys of credentials.
+func IsSecretKey(key string) bool {
+	key = strings.NewReplacer("-", "", "_", "").Replace(strings.ToLower(key))
+
+	if key == "keys" {
+		return true
+	}
+
+	for _, secret := range secretKeys {
+		if strings.Contains(key, secret) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RedactJSON returns the JSON document with the values of all secret keys
+// replaced, at any depth. Since a document that cannot be parsed might still
+// hold secrets, only its length is returned for it.
+func RedactJSON(data []byte) []byte {
+	if len(data) == 0 {
+		return data
+	}
+
+	var doc interface{}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return []byte(fmt.Sprintf("<%d bytes of invalid JSON>", len(data)))
+	}
+
+	redacted, err := json.Marshal(redactValue(doc))
+	if err != nil {
+		return []byte(Redacted)
+	}
+
+	return redacted
+}
+
+func redactValue(value interface{}) interface{} {
+	switch v := value.(type) {
+	case map[string]interface{}:
+		for key, field := range v {
+			if IsSecretKey(key) {
+				v[key] = Redacted
+			} else {
+				v[key] = redactValue(field)
+			}
+		}
+	case []interface{}:
+		for i, item := range v {
+			v[i] = redactValue(item)
+		}
+	}
+
+	return value
+}
+
+// Redact returns a value that is safe to log in place of the given one.
+// Secrets are replaced, structs, maps and slices are turned into JSON with
+// their secrets redacted and strings holding JSON are redacted as such. Other
+// values are returned as they are.
+func Redact(value interface{}) interface{} {
+	switch v := value.(type) {
+	case Secret, *Secret:
+		return Redacted
+	case nil, error, fmt.Stringer:
+		return value
+	case string:
+		return redactString(v)
+	case []byte:
+		return redactString(string(v))
+	case json.RawMessage:
+		return json.RawMessage(RedactJSON(v))
+	}
+
+	kind := reflect.TypeOf(value).Kind()
+	if kind == reflect.Ptr {
+		kind = reflect.TypeOf(value).Elem().Kind()
+	}
+
+	if kind != reflect.Struct && kind != reflect.Map && kind != reflect.Slice && kind != reflect.Array {
+		return value
+	}
+
+	data, err := json.Marshal(value)
+	if err != nil {
+		return Redacted
+	}
+
+	return json.RawMessage(RedactJSON(data))
+}
+
+func redactString(s string) string {
+	trimmed := strings.TrimSpace(s)
+	if strings.HasPrefix(trimmed, "{") || strings.HasPrefix(trimmed, "[") {
+		return string(RedactJSON([]byte(trimmed)))
+	}
+
+	return s
+}
@@ -0,0 +1,68 @@
+package zebra_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"testing"
+
+	"github.com/project-safari/zebra"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSecretKey(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	for _, key := range []string{"password", "passwordHash", "ssh-key", "secret", "authKey", "keys", "X_API_KEY"} {
+		assert.True(zebra.IsSecretKey(key), key)
+	}
+
+	for _, key := range []string{"name", "email", "key", "loginId", "id"} {
+		assert.False(zebra.IsSecretKey(key), key)
+	}
+}
+
+func TestRedactJSON(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	body := `{"name":"n","password":"p4ss","nested":[{"credentials":{"loginId":"admin","keys":{"ssh-key":"k3y"}}}]}`
+	redacted := string(zebra.RedactJSON([]byte(body)))
+
+	assert.NotContains(redacted, "p4ss")
+	assert.NotContains(redacted, "k3y")
+	assert.Contains(redacted, `"name":"n"`)
+	assert.Contains(redacted, `"loginId":"admin"`)
+
+	// Bodies that cannot be parsed are not shown at all
+	redacted = string(zebra.RedactJSON([]byte(`{"password":"p4ss"`)))
+	assert.NotContains(redacted, "p4ss")
+
+	assert.Empty(zebra.RedactJSON(nil))
+}
+
+func TestRedact(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	secret := zebra.Secret{}
+	assert.Nil(secret.UnmarshalText([]byte("p4ss")))
+	assert.Equal(zebra.Redacted, zebra.Redact(secret))
+	assert.Equal(zebra.Redacted, zebra.Redact(&secret))
+	assert.NotContains(fmt.Sprintf("%v %+v %#v", secret, secret, secret), "p4ss")
+
+	creds := zebra.NewCredentials("admin")
+	assert.Nil(creds.Add("password", "p4ss"))
+
+	redacted, ok := zebra.Redact(creds).(json.RawMessage)
+	assert.True(ok)
+	assert.NotContains(string(redacted), "p4ss")
+	assert.Contains(string(redacted), "admin")
+
+	assert.NotContains(zebra.Redact(`{"password":"p4ss"}`), "p4ss")
+	assert.NotContains(string(zebra.Redact([]byte(`[{"token":"p4ss"}]`)).(string)), "p4ss")
+	assert.Equal("plain", zebra.Redact("plain"))
+	assert.Equal(42, zebra.Redact(42))
+	assert.Nil(zebra.Redact(nil))
+	assert.Equal(json.RawMessage(`{"a":"b"}`), zebra.Redact(map[string]string{"a": "b"}))
+}
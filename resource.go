@@ -10,6 +10,8 @@ type Resource interface {
 	Validate(ctx context.Context) error
 	GetMeta() Meta
 	GetStatus() Status
+	UpdateStatus() *Status
+	UpdateMeta() *Meta
 }
 
 type BaseResource struct {
@@ -37,6 +39,18 @@ func (r *BaseResource) GetStatus() Status {
 	return r.Status
 }
 
+// UpdateStatus returns a pointer to the resource status, so that the status can
+// be changed in place by the lease allocator and the lifecycle APIs.
+func (r *BaseResource) UpdateStatus() *Status {
+	return &r.Status
+}
+
+// UpdateMeta returns a pointer to the resource meta data, so that imported
+// resources can take over the identity of the resources they replace.
+func (r *BaseResource) UpdateMeta() *Meta {
+	return &r.Meta
+}
+
 func NewBaseResource(rType Type, name, owner, group string) *BaseResource {
 	return &BaseResource{
 		Meta:   NewMeta(rType, name, group, owner),
@@ -1,11 +1,13 @@
 package zebra
 
+// Secret holds a value that must never be shown. It is marshaled, printed and
+// logged as Redacted.
 type Secret struct {
 	secret string
 }
 
 func (s *Secret) MarshalText() ([]byte, error) {
-	return []byte("*****"), nil
+	return []byte(Redacted), nil
 }
 
 func (s *Secret) UnmarshalText(text []byte) error {
@@ -13,3 +15,11 @@ func (s *Secret) UnmarshalText(text []byte) error {
 
 	return nil
 }
+
+func (s Secret) String() string {
+	return Redacted
+}
+
+func (s Secret) GoString() string {
+	return Redacted
+}
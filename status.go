@@ -3,21 +3,39 @@ package zebra
 import (
 	"errors"
 	"strings"
+	"time"
 )
 
+// MaxTransitions is the number of lifecycle transitions that are remembered in
+// the status of a resource, older transitions are dropped.
+const MaxTransitions = 16
+
 type Status struct {
-	Fault       Fault       `json:"fault,omitempty"`
-	LeaseStatus LeaseStatus `json:"lease,omitempty"`
-	UsedBy      string      `json:"usedBy,omitempty"`
-	State       State       `json:"state,omitempty"`
+	Fault       Fault        `json:"fault,omitempty"`
+	LeaseStatus LeaseStatus  `json:"lease,omitempty"`
+	UsedBy      string       `json:"usedBy,omitempty"`
+	State       State        `json:"state,omitempty"`
+	Lifecycle   Lifecycle    `json:"lifecycle,omitempty"`
+	Transitions []Transition `json:"transitions,omitempty"`
 }
 
 type (
 	Fault       uint8
 	LeaseStatus uint8
 	State       uint8
+	Lifecycle   uint8
 )
 
+// Transition records a single lifecycle change of a resource, who made it and
+// why.
+type Transition struct {
+	From   Lifecycle `json:"from"`
+	To     Lifecycle `json:"to"`
+	Actor  string    `json:"actor"`
+	Reason string    `json:"reason,omitempty"`
+	Time   time.Time `json:"time"`
+}
+
 const (
 	None Fault = iota
 	Minor
@@ -36,6 +54,17 @@ const (
 	Active
 )
 
+// Lifecycle states of a resource. Available is the zero value so that
+// resources stored before lifecycles existed remain allocatable.
+const (
+	Available Lifecycle = iota
+	Provisioning
+	InUse
+	Maintenance
+	Decommissioned
+	RMA
+)
+
 const Unknown = "unknown"
 
 var (
@@ -43,8 +72,23 @@ var (
 	ErrLeaseStatus = errors.New(`lease is incorrect, must be in ["leased", "free", "setup"]`)
 	ErrState       = errors.New(`state is incorrect, must be in ["active", "inactive"]`)
 	ErrCreatedTime = errors.New(`createdTime is incorrect, must be before current time`)
+	ErrLifecycle   = errors.New(`lifecycle is incorrect, must be in ["available", "provisioning", ` +
+		`"leased", "maintenance", "decommissioned", "rma"]`)
+	ErrTransition    = errors.New("lifecycle transition is not allowed")
+	ErrLeaseMismatch = errors.New("lease status does not match lifecycle")
 )
 
+// transitions lists the lifecycle states that can be reached from a given
+// state. InUse is entered and left only through lease allocation and release.
+var transitions = map[Lifecycle][]Lifecycle{ //nolint:gochecknoglobals
+	Provisioning:   {Available, Decommissioned},
+	Available:      {InUse, Maintenance, Decommissioned, RMA},
+	InUse:          {Available},
+	Maintenance:    {Available, RMA, Decommissioned},
+	RMA:            {Maintenance, Provisioning, Decommissioned},
+	Decommissioned: {},
+}
+
 func (f *Fault) String() string {
 	strs := map[Fault]string{None: "none", Minor: "minor", Major: "major", Critical: "critical"}
 	fstr, ok := strs[*f]
@@ -141,6 +185,65 @@ func (s *State) UnmarshalText(data []byte) error {
 	return nil
 }
 
+func (l Lifecycle) String() string {
+	strs := map[Lifecycle]string{
+		Available:      "available",
+		Provisioning:   "provisioning",
+		InUse:          "leased",
+		Maintenance:    "maintenance",
+		Decommissioned: "decommissioned",
+		RMA:            "rma",
+	}
+	lstr, ok := strs[l]
+
+	if !ok {
+		return Unknown
+	}
+
+	return lstr
+}
+
+func (l *Lifecycle) MarshalText() ([]byte, error) {
+	return []byte(l.String()), nil
+}
+
+func (l *Lifecycle) UnmarshalText(data []byte) error {
+	lmap := map[string]Lifecycle{
+		"available":      Available,
+		"provisioning":   Provisioning,
+		"leased":         InUse,
+		"maintenance":    Maintenance,
+		"decommissioned": Decommissioned,
+		"rma":            RMA,
+	}
+
+	lval, ok := lmap[strings.ToLower(string(data))]
+	if !ok {
+		return ErrLifecycle
+	}
+
+	*l = lval
+
+	return nil
+}
+
+// CanTransition returns true if a resource in lifecycle state l is allowed to
+// move to lifecycle state to.
+func (l Lifecycle) CanTransition(to Lifecycle) bool {
+	for _, next := range transitions[l] {
+		if next == to {
+			return true
+		}
+	}
+
+	return false
+}
+
+// IsInitial returns true if a resource can be created in this lifecycle state.
+func (l Lifecycle) IsInitial() bool {
+	return l == Available || l == Provisioning
+}
+
 func (s Status) Validate() error {
 	if s.Fault > Critical {
 		return ErrFault
@@ -154,16 +257,88 @@ func (s Status) Validate() error {
 		return ErrState
 	}
 
+	if s.Lifecycle > RMA {
+		return ErrLifecycle
+	}
+
+	// A resource can only be leased or in setup while it is in use, and a
+	// resource in use must be backed by a lease.
+	if (s.LeaseStatus != Free) != (s.Lifecycle == InUse) {
+		return ErrLeaseMismatch
+	}
+
+	return nil
+}
+
+// Allocatable returns true if a resource with this status can be handed out
+// to a new lease. Faulted resources are never handed out.
+func (s Status) Allocatable() bool {
+	return s.Lifecycle == Available && s.LeaseStatus == Free && s.Fault == None
+}
+
+// Transition moves the status to the given lifecycle state, recording the actor
+// and the reason for the change. It returns ErrTransition if the move is not
+// allowed from the current state.
+func (s *Status) Transition(to Lifecycle, actor, reason string) error {
+	if !s.Lifecycle.CanTransition(to) {
+		return ErrTransition
+	}
+
+	s.Transitions = append(s.Transitions, Transition{
+		From:   s.Lifecycle,
+		To:     to,
+		Actor:  actor,
+		Reason: reason,
+		Time:   time.Now(),
+	})
+
+	if len(s.Transitions) > MaxTransitions {
+		s.Transitions = s.Transitions[len(s.Transitions)-MaxTransitions:]
+	}
+
+	s.Lifecycle = to
+
+	return nil
+}
+
+// Lease marks the status as leased by the given user. The resource must be
+// allocatable.
+func (s *Status) Lease(user string) error {
+	if !s.Allocatable() {
+		return ErrTransition
+	}
+
+	if err := s.Transition(InUse, user, "leased"); err != nil {
+		return err
+	}
+
+	s.LeaseStatus = Leased
+	s.UsedBy = user
+
+	return nil
+}
+
+// Release frees a leased status and makes the resource available again.
+func (s *Status) Release(actor string) error {
+	if err := s.Transition(Available, actor, "released"); err != nil {
+		return err
+	}
+
+	s.LeaseStatus = Free
+	s.UsedBy = ""
+
 	return nil
 }
 
 // DefaultStatus returns a Status object with starting values (i.e. healthy
-// resource in a free state, active, no user, and create time as right now).
+// resource in a free state, available, no user, and create time as right now).
 func DefaultStatus() Status {
 	return Status{
 		Fault:       None,
 		LeaseStatus: Free,
 		UsedBy:      "",
 		State:       Inactive,
+		Lifecycle:   Available,
+		Transitions: nil,
 	}
 }
@@ -88,3 +88,80 @@ func TestUnmarshal(t *testing.T) {
 	assert.Equal(zebra.ErrFault, f.UnmarshalText([]byte("zzz")))
 	assert.Equal(zebra.ErrState, s.UnmarshalText([]byte("zzz")))
 }
+
+func TestLifecycle(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	var l zebra.Lifecycle = 8
+
+	assert.Equal("unknown", l.String())
+
+	l = zebra.Maintenance
+	b, err := l.MarshalText()
+	assert.Nil(err)
+	assert.Equal("maintenance", string(b))
+
+	assert.Nil(l.UnmarshalText([]byte("leased")))
+	assert.Equal(zebra.InUse, l)
+	assert.Equal(zebra.ErrLifecycle, l.UnmarshalText([]byte("zzz")))
+
+	assert.True(zebra.Available.IsInitial())
+	assert.True(zebra.Provisioning.IsInitial())
+	assert.False(zebra.RMA.IsInitial())
+
+	assert.True(zebra.Available.CanTransition(zebra.Maintenance))
+	assert.True(zebra.RMA.CanTransition(zebra.Provisioning))
+	assert.False(zebra.Provisioning.CanTransition(zebra.InUse))
+	assert.False(zebra.Decommissioned.CanTransition(zebra.Available))
+
+	s := zebra.DefaultStatus()
+	s.Lifecycle = 8
+	assert.Equal(zebra.ErrLifecycle, s.Validate())
+
+	s.Lifecycle = zebra.Available
+	s.LeaseStatus = zebra.Leased
+	assert.Equal(zebra.ErrLeaseMismatch, s.Validate())
+}
+
+func TestTransition(t *testing.T) {
+	t.Parallel()
+	assert := assert.New(t)
+
+	s := zebra.DefaultStatus()
+	assert.True(s.Allocatable())
+
+	s.Fault = zebra.Minor
+	assert.False(s.Allocatable())
+	assert.Equal(zebra.ErrTransition, s.Lease("user"))
+
+	s.Fault = zebra.None
+	assert.Nil(s.Transition(zebra.Maintenance, "admin", "firmware upgrade"))
+	assert.False(s.Allocatable())
+	assert.Len(s.Transitions, 1)
+	assert.Equal("admin", s.Transitions[0].Actor)
+	assert.Equal("firmware upgrade", s.Transitions[0].Reason)
+	assert.Equal(zebra.Available, s.Transitions[0].From)
+	assert.Equal(zebra.Maintenance, s.Transitions[0].To)
+
+	assert.Equal(zebra.ErrTransition, s.Lease("user"))
+	assert.Equal(zebra.ErrTransition, s.Transition(zebra.Provisioning, "admin", ""))
+
+	assert.Nil(s.Transition(zebra.Available, "admin", "done"))
+	assert.Nil(s.Lease("user"))
+	assert.Equal(zebra.InUse, s.Lifecycle)
+	assert.Equal(zebra.Leased, s.LeaseStatus)
+	assert.Equal("user", s.UsedBy)
+	assert.Nil(s.Validate())
+
+	assert.Nil(s.Release("user"))
+	assert.True(s.Allocatable())
+	assert.Equal("", s.UsedBy)
+
+	for i := 0; i < zebra.MaxTransitions; i++ {
+		assert.Nil(s.Transition(zebra.Maintenance, "admin", ""))
+		assert.Nil(s.Transition(zebra.Available, "admin", ""))
+	}
+
+	assert.Len(s.Transitions, zebra.MaxTransitions)
+}